@@ -23,6 +23,10 @@ var (
 
 	// ErrServerError
 	ErrServerError = errors.New("error: server error")
+
+	// ErrOTPRequired is returned by Login when the user has two-factor
+	// authentication enabled and no OTP was given
+	ErrOTPRequired = errors.New("error: two-factor authentication code required")
 )
 
 // Client ...
@@ -95,6 +99,10 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 
 	switch res.StatusCode {
 	case http.StatusUnauthorized:
+		// Some endpoints explain why in a JSON body, e.g: otp_required
+		if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+			_ = json.NewDecoder(res.Body).Decode(v)
+		}
 		return ErrUnauthorized
 	case http.StatusInternalServerError:
 		return ErrServerError
@@ -106,12 +114,19 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 }
 
 // Login ...
-func (c *Client) Login(username, password string) (res types.AuthResponse, err error) {
-	req, err := c.newRequest("POST", "/auth", types.AuthRequest{username, password})
+func (c *Client) Login(username, password, otp string) (res types.AuthResponse, err error) {
+	req, err := c.newRequest("POST", "/auth", types.AuthRequest{
+		Username: username,
+		Password: password,
+		OTP:      otp,
+	})
 	if err != nil {
 		return types.AuthResponse{}, err
 	}
 	err = c.do(req, &res)
+	if err == ErrUnauthorized && res.OTPRequired {
+		err = ErrOTPRequired
+	}
 	return
 }
 
@@ -134,3 +149,141 @@ func (c *Client) Timeline(page int) (res types.PagedResponse, err error) {
 	err = c.do(req, &res)
 	return
 }
+
+// Bookmarks ...
+func (c *Client) Bookmarks(page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest("POST", "/bookmarks", types.PagedRequest{Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Bookmark ...
+func (c *Client) Bookmark(hash string) error {
+	req, err := c.newRequest("POST", "/bookmarks/add", types.BookmarkRequest{Hash: hash})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// Unbookmark ...
+func (c *Client) Unbookmark(hash string) error {
+	req, err := c.newRequest("POST", "/bookmarks/remove", types.BookmarkRequest{Hash: hash})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// Lists ...
+func (c *Client) Lists() (res types.ListsResponse, err error) {
+	req, err := c.newRequest("POST", "/lists", nil)
+	if err != nil {
+		return types.ListsResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// ListTimeline ...
+func (c *Client) ListTimeline(name string, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest("POST", fmt.Sprintf("/lists/%s/timeline", name), types.PagedRequest{Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Filters ...
+func (c *Client) Filters() (res types.FiltersResponse, err error) {
+	req, err := c.newRequest("POST", "/filters", nil)
+	if err != nil {
+		return types.FiltersResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// AddFilter ...
+func (c *Client) AddFilter(typ, value, action, expires string) error {
+	req, err := c.newRequest("POST", "/filters/add", types.FilterRequest{
+		Type:    typ,
+		Value:   value,
+		Action:  action,
+		Expires: expires,
+	})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// RemoveFilter ...
+func (c *Client) RemoveFilter(id string) error {
+	req, err := c.newRequest("POST", "/filters/remove", types.FilterRequest{ID: id})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// FollowTag ...
+func (c *Client) FollowTag(tag string) error {
+	req, err := c.newRequest("POST", "/tags/follow", types.TagRequest{Tag: tag})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// UnfollowTag ...
+func (c *Client) UnfollowTag(tag string) error {
+	req, err := c.newRequest("POST", "/tags/unfollow", types.TagRequest{Tag: tag})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// ReadMarkers ...
+func (c *Client) ReadMarkers() (res types.ReadMarkersResponse, err error) {
+	req, err := c.newRequest("POST", "/markers", nil)
+	if err != nil {
+		return types.ReadMarkersResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// AdvanceReadMarker ...
+func (c *Client) AdvanceReadMarker(name, hash string) error {
+	req, err := c.newRequest("POST", "/markers/advance", types.ReadMarkerRequest{Name: name, Hash: hash})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
+
+// Notifications ...
+func (c *Client) Notifications(page int) (res types.NotificationsResponse, err error) {
+	req, err := c.newRequest("POST", "/notifications", types.PagedRequest{Page: page})
+	if err != nil {
+		return types.NotificationsResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// MarkNotificationsRead marks the notification with id, or all notifications
+// if id is empty, as read.
+func (c *Client) MarkNotificationsRead(id string) error {
+	req, err := c.newRequest("POST", "/notifications/read", types.NotificationRequest{ID: id})
+	if err != nil {
+		return err
+	}
+	return c.do(req, &struct{}{})
+}
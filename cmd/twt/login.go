@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/mitchellh/go-homedir"
@@ -60,6 +61,18 @@ func readCredentials() (string, string, error) {
 	return username, password, nil
 }
 
+func readOTP() (string, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("\nAuthentication code: ")
+	otp, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(otp), nil
+}
+
 func login(cli *client.Client) {
 	username, password, err := readCredentials()
 	if err != nil {
@@ -67,7 +80,16 @@ func login(cli *client.Client) {
 		os.Exit(1)
 	}
 
-	res, err := cli.Login(username, password)
+	res, err := cli.Login(username, password, "")
+	if err == client.ErrOTPRequired {
+		var otp string
+		otp, err = readOTP()
+		if err != nil {
+			log.WithError(err).Error("error reading authentication code")
+			os.Exit(1)
+		}
+		res, err = cli.Login(username, password, otp)
+	}
 	if err != nil {
 		log.WithError(err).Error("error making login request")
 		os.Exit(1)
@@ -32,15 +32,37 @@ var timelineCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		timeline(cli, args)
+		unread, err := cmd.Flags().GetBool("unread")
+		if err != nil {
+			log.WithError(err).Error("error parsing unread flag")
+			os.Exit(1)
+		}
+
+		markRead, err := cmd.Flags().GetBool("mark-read")
+		if err != nil {
+			log.WithError(err).Error("error parsing mark-read flag")
+			os.Exit(1)
+		}
+
+		timeline(cli, unread, markRead, args)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(timelineCmd)
+
+	timelineCmd.Flags().BoolP(
+		"unread", "n", false,
+		"Only display twts newer than your timeline read marker",
+	)
+
+	timelineCmd.Flags().BoolP(
+		"mark-read", "m", false,
+		"Advance your timeline read marker to the newest twt displayed",
+	)
 }
 
-func timeline(cli *client.Client, args []string) {
+func timeline(cli *client.Client, unread, markRead bool, args []string) {
 	// TODO: How do we get more pages?
 	res, err := cli.Timeline(0)
 	if err != nil {
@@ -48,10 +70,42 @@ func timeline(cli *client.Client, args []string) {
 		os.Exit(1)
 	}
 
-	sort.Sort(sort.Reverse(res.Twts))
+	twts := res.Twts
+
+	if unread {
+		markers, err := cli.ReadMarkers()
+		if err != nil {
+			log.WithError(err).Error("error retrieving read markers")
+			os.Exit(1)
+		}
+
+		var lastRead time.Time
+		for _, marker := range markers.Markers {
+			if marker.Name == "timeline" {
+				lastRead = marker.Timestamp
+			}
+		}
+
+		twts = nil
+		for _, twt := range res.Twts {
+			if twt.Created().After(lastRead) {
+				twts = append(twts, twt)
+			}
+		}
+	}
+
+	sort.Sort(sort.Reverse(twts))
 
-	for _, twt := range res.Twts {
+	for _, twt := range twts {
 		PrintTwt(twt, time.Now())
 		fmt.Println()
 	}
+
+	if markRead && len(twts) > 0 {
+		// Twts are displayed oldest first so the newest is last
+		if err := cli.AdvanceReadMarker("timeline", twts[len(twts)-1].Hash()); err != nil {
+			log.WithError(err).Error("error advancing read marker")
+			os.Exit(1)
+		}
+	}
 }
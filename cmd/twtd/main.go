@@ -44,7 +44,9 @@ var (
 	// Pod Limits
 	twtsPerPage   int
 	maxTwtLength  int
+	maxUserFeeds  int
 	maxUploadSize int64
+	maxImportSize int64
 	maxFetchLimit int64
 	maxCacheTTL   time.Duration
 	maxCacheItems int
@@ -65,6 +67,11 @@ var (
 	smtpBind string
 	pop3Bind string
 
+	// Gemini Settings
+	geminiBind string
+	geminiCert string
+	geminiKey  string
+
 	// Timeouts
 	sessionExpiry     time.Duration
 	sessionCacheTTL   time.Duration
@@ -113,10 +120,18 @@ func init() {
 		&maxTwtLength, "max-twt-length", "L", internal.DefaultMaxTwtLength,
 		"maximum length of posts",
 	)
+	flag.IntVar(
+		&maxUserFeeds, "max-user-feeds", internal.DefaultMaxUserFeeds,
+		"maximum number of feeds a user may create",
+	)
 	flag.Int64VarP(
 		&maxUploadSize, "max-upload-size", "U", internal.DefaultMaxUploadSize,
 		"maximum upload size of media",
 	)
+	flag.Int64Var(
+		&maxImportSize, "max-import-size", internal.DefaultMaxImportSize,
+		"maximum size of imported Twitter or Mastodon archives",
+	)
 	flag.Int64VarP(
 		&maxFetchLimit, "max-fetch-limit", "F", internal.DefaultMaxFetchLimit,
 		"maximum feed fetch limit in bytes",
@@ -155,6 +170,11 @@ func init() {
 	flag.StringVar(&smtpBind, "smtp-bind", internal.DefaultSMTPBind, "SMTP interface and port to bind to")
 	flag.StringVar(&pop3Bind, "pop3-bind", internal.DefaultPOP3Bind, "POP3 interface and port to bind to")
 
+	// Gemini Settings
+	flag.StringVar(&geminiBind, "gemini-bind", internal.DefaultGeminiBind, "Gemini interface and port to bind to (disabled if empty)")
+	flag.StringVar(&geminiCert, "gemini-cert", "", "TLS certificate for Gemini (self-signed if empty)")
+	flag.StringVar(&geminiKey, "gemini-key", "", "TLS private key for Gemini (self-signed if empty)")
+
 	// Timeouts
 	flag.DurationVar(
 		&sessionExpiry, "session-expiry", internal.DefaultSessionExpiry,
@@ -258,7 +278,9 @@ func main() {
 		// Pod Limits
 		internal.WithTwtsPerPage(twtsPerPage),
 		internal.WithMaxTwtLength(maxTwtLength),
+		internal.WithMaxUserFeeds(maxUserFeeds),
 		internal.WithMaxUploadSize(maxUploadSize),
+		internal.WithMaxImportSize(maxImportSize),
 		internal.WithMaxFetchLimit(maxFetchLimit),
 		internal.WithMaxCacheTTL(maxCacheTTL),
 		internal.WithMaxCacheItems(maxCacheItems),
@@ -279,6 +301,10 @@ func main() {
 		internal.WithSMTPBind(smtpBind),
 		internal.WithPOP3Bind(pop3Bind),
 
+		// Gemini Settings
+		internal.WithGeminiBind(geminiBind),
+		internal.WithGeminiCert(geminiCert, geminiKey),
+
 		// Timeouts
 		internal.WithSessionExpiry(sessionExpiry),
 		internal.WithSessionCacheTTL(sessionCacheTTL),
@@ -0,0 +1,822 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// ActivityStreamsContext is the JSON-LD context of ActivityPub documents
+	ActivityStreamsContext = "https://www.w3.org/ns/activitystreams"
+
+	// ActivityStreamsPublic is the special collection addressing everyone
+	ActivityStreamsPublic = "https://www.w3.org/ns/activitystreams#Public"
+
+	// SecurityContext is the JSON-LD context of actor public keys
+	SecurityContext = "https://w3id.org/security/v1"
+
+	// ActivityPubContentType is the media type of ActivityPub documents
+	ActivityPubContentType = "application/activity+json"
+
+	// activityPubKeyFile is the pod's actor signing key in the data directory
+	activityPubKeyFile = "activitypub.pem"
+
+	// maxActivityPubSize is the maximum size of an incoming activity or a
+	// fetched remote actor
+	maxActivityPubSize = 1 << 20
+
+	// maxSignatureSkew is how far the Date of a signed request may be from
+	// our clock
+	maxSignatureSkew = 12 * time.Hour
+)
+
+var (
+	ErrInvalidSignature = errors.New("error: invalid http signature")
+	ErrInvalidActivity  = errors.New("error: invalid activity")
+	ErrInvalidActor     = errors.New("error: invalid actor")
+
+	signatureParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// ActivityPubPublicKey is the public key actors sign their requests with
+type ActivityPubPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// ActivityPubImage ...
+type ActivityPubImage struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// ActivityPubEndpoints ...
+type ActivityPubEndpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+// ActivityPubActor is the actor document of a local or remote user
+type ActivityPubActor struct {
+	Context           interface{}           `json:"@context,omitempty"`
+	ID                string                `json:"id"`
+	Type              string                `json:"type"`
+	PreferredUsername string                `json:"preferredUsername"`
+	Name              string                `json:"name,omitempty"`
+	Summary           string                `json:"summary,omitempty"`
+	URL               string                `json:"url,omitempty"`
+	Inbox             string                `json:"inbox"`
+	Outbox            string                `json:"outbox,omitempty"`
+	Followers         string                `json:"followers,omitempty"`
+	Icon              *ActivityPubImage     `json:"icon,omitempty"`
+	Endpoints         *ActivityPubEndpoints `json:"endpoints,omitempty"`
+	PublicKey         ActivityPubPublicKey  `json:"publicKey"`
+}
+
+// ActivityPubNote is a twt as an ActivityStreams Note
+type ActivityPubNote struct {
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Published    string   `json:"published"`
+	URL          string   `json:"url"`
+	To           []string `json:"to"`
+	CC           []string `json:"cc,omitempty"`
+}
+
+// ActivityPubActivity is an activity sent to or received from an inbox.
+// Object is either the id of an object or an embedded object.
+type ActivityPubActivity struct {
+	Context   interface{} `json:"@context,omitempty"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Object    interface{} `json:"object,omitempty"`
+	Published string      `json:"published,omitempty"`
+	To        []string    `json:"to,omitempty"`
+	CC        []string    `json:"cc,omitempty"`
+}
+
+// ObjectID returns the id of the activity's object
+func (a ActivityPubActivity) ObjectID() string {
+	switch v := a.Object.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		id, _ := v["id"].(string)
+		return id
+	default:
+		return ""
+	}
+}
+
+// ObjectType returns the type of an embedded object, or an empty string
+// if the object is only referenced by its id
+func (a ActivityPubActivity) ObjectType() string {
+	if v, ok := a.Object.(map[string]interface{}); ok {
+		typ, _ := v["type"].(string)
+		return typ
+	}
+	return ""
+}
+
+// ActivityPubCollection is an OrderedCollection or OrderedCollectionPage
+type ActivityPubCollection struct {
+	Context      interface{}   `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	First        string        `json:"first,omitempty"`
+	Next         string        `json:"next,omitempty"`
+	Prev         string        `json:"prev,omitempty"`
+	PartOf       string        `json:"partOf,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+// ActivityPubFollower is a remote actor following a local user or feed
+type ActivityPubFollower struct {
+	ID        string
+	Name      string
+	Actor     string
+	Inbox     string
+	CreatedAt time.Time
+}
+
+// LoadActivityPubFollower ...
+func LoadActivityPubFollower(data []byte) (f *ActivityPubFollower, err error) {
+	f = &ActivityPubFollower{}
+	if err := defaults.Set(f); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (f *ActivityPubFollower) Bytes() ([]byte, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ActivityPubRetry is a failed delivery of an activity waiting to be
+// attempted again, retries are stored so they survive restarts.
+type ActivityPubRetry struct {
+	ID      string
+	Name    string
+	Inbox   string
+	Body    []byte
+	Attempt int
+	RetryAt time.Time
+}
+
+// LoadActivityPubRetry ...
+func LoadActivityPubRetry(data []byte) (r *ActivityPubRetry, err error) {
+	r = &ActivityPubRetry{}
+	if err := defaults.Set(r); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (r *ActivityPubRetry) Bytes() ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// LoadOrCreateActivityPubKey loads the RSA key used to sign requests made on
+// behalf of the pod's actors, creating it if it does not exist
+func LoadOrCreateActivityPubKey(fn string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("error decoding activitypub key %s", fn)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	data = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(fn, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EncodePublicKey returns the PEM encoded PKIX form of the public key
+func EncodePublicKey(key *rsa.PublicKey) (string, error) {
+	data, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data})), nil
+}
+
+// DecodePublicKey parses a PEM encoded PKIX or PKCS1 RSA public key
+func DecodePublicKey(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, ErrInvalidActor
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, ErrInvalidActor
+	}
+
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+// signingString builds the string covered by an HTTP signature
+// (draft-cavage-http-signatures) from the listed headers
+func signingString(req *http.Request, headers []string) (string, error) {
+	var lines []string
+
+	for _, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines = append(lines, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
+		case "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			lines = append(lines, fmt.Sprintf("host: %s", host))
+		default:
+			v := req.Header.Get(h)
+			if v == "" {
+				return "", ErrInvalidSignature
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", h, v))
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Digest returns the value of the Digest header of a request body
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("SHA-256=%s", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// SignRequest signs the request with an HTTP signature covering the request
+// target, host, date and, if there is a body, its digest
+func SignRequest(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", Digest(body))
+		headers = append(headers, "digest")
+	}
+
+	s, err := signingString(req, headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(s))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig),
+	))
+
+	return nil
+}
+
+// VerifyRequest verifies the HTTP signature of an incoming request and the
+// digest of its body. fetchKey returns the public key and owning actor of
+// a keyId. The owning actor is returned on success.
+func VerifyRequest(req *http.Request, body []byte, fetchKey func(keyID string) (*rsa.PublicKey, string, error)) (string, error) {
+	params := make(map[string]string)
+	for _, match := range signatureParamRegexp.FindAllStringSubmatch(req.Header.Get("Signature"), -1) {
+		params[match[1]] = match[2]
+	}
+
+	keyID, signature := params["keyId"], params["signature"]
+	if keyID == "" || signature == "" {
+		return "", ErrInvalidSignature
+	}
+
+	if algorithm := params["algorithm"]; algorithm != "" && algorithm != "rsa-sha256" && algorithm != "hs2019" {
+		return "", ErrInvalidSignature
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	if !HasString(headers, "(request-target)") || !HasString(headers, "date") {
+		return "", ErrInvalidSignature
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if skew := time.Since(date); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return "", ErrInvalidSignature
+	}
+
+	if len(body) > 0 {
+		if !HasString(headers, "digest") || req.Header.Get("Digest") != Digest(body) {
+			return "", ErrInvalidSignature
+		}
+	}
+
+	s, err := signingString(req, headers)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	key, owner, err := fetchKey(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256([]byte(s))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	return owner, nil
+}
+
+// ActivityPub bridges the pod's users and feeds to the fediverse as
+// ActivityPub actors. New twts are delivered to remote followers' inboxes.
+type ActivityPub struct {
+	conf   *Config
+	db     Store
+	tasks  *Dispatcher
+	events *EventBus
+	key    *rsa.PrivateKey
+
+	// dial dials remote servers, only public addresses by default
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewActivityPub ...
+func NewActivityPub(conf *Config, db Store, tasks *Dispatcher, events *EventBus) (*ActivityPub, error) {
+	if err := os.MkdirAll(conf.Data, 0755); err != nil {
+		return nil, err
+	}
+
+	key, err := LoadOrCreateActivityPubKey(filepath.Join(conf.Data, activityPubKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActivityPub{conf: conf, db: db, tasks: tasks, events: events, key: key, dial: dialPublic}, nil
+}
+
+// URLForActor returns the id of the ActivityPub actor of a local user or feed
+func URLForActor(conf *Config, name string) string {
+	return fmt.Sprintf("%s/ap/%s", strings.TrimSuffix(conf.BaseURL, "/"), name)
+}
+
+// ActorURL returns the id of the actor of a local user or feed
+func (ap *ActivityPub) ActorURL(name string) string {
+	return URLForActor(ap.conf, name)
+}
+
+// KeyID returns the id of the actor's public key
+func (ap *ActivityPub) KeyID(name string) string {
+	return fmt.Sprintf("%s#main-key", ap.ActorURL(name))
+}
+
+// HasActor returns true if name is a local user or feed
+func (ap *ActivityPub) HasActor(name string) bool {
+	return ap.db.HasUser(name) || ap.db.HasFeed(name)
+}
+
+// Actor returns the actor document of a local user or feed
+func (ap *ActivityPub) Actor(name string) (*ActivityPubActor, error) {
+	var (
+		typ     string
+		profile types.Profile
+	)
+
+	if user, err := ap.db.GetUser(name); err == nil {
+		typ, profile = "Person", user.Profile(ap.conf.BaseURL, nil)
+	} else if feed, err := ap.db.GetFeed(name); err == nil {
+		typ, profile = "Service", feed.Profile(ap.conf.BaseURL, nil)
+	} else {
+		return nil, ErrFeedNotFound
+	}
+
+	publicKeyPem, err := EncodePublicKey(&ap.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	actorURL := ap.ActorURL(name)
+
+	return &ActivityPubActor{
+		Context:           []string{ActivityStreamsContext, SecurityContext},
+		ID:                actorURL,
+		Type:              typ,
+		PreferredUsername: name,
+		Name:              profile.Username,
+		Summary:           html.EscapeString(profile.Tagline),
+		URL:               UserURL(URLForUser(ap.conf, name)),
+		Inbox:             fmt.Sprintf("%s/inbox", actorURL),
+		Outbox:            fmt.Sprintf("%s/outbox", actorURL),
+		Followers:         fmt.Sprintf("%s/followers", actorURL),
+		Icon:              &ActivityPubImage{Type: "Image", URL: URLForAvatar(ap.conf, name)},
+		PublicKey: ActivityPubPublicKey{
+			ID:           ap.KeyID(name),
+			Owner:        actorURL,
+			PublicKeyPem: publicKeyPem,
+		},
+	}, nil
+}
+
+// Create returns the Create activity of a twt posted by a local user or feed
+func (ap *ActivityPub) Create(name string, twt types.Twt) ActivityPubActivity {
+	formatTwt := FormatTwtFactory(ap.conf)
+
+	actorURL := ap.ActorURL(name)
+	noteURL := URLForTwt(ap.conf.BaseURL, twt.Hash())
+	published := twt.Created().UTC().Format(time.RFC3339)
+	to := []string{ActivityStreamsPublic}
+	cc := []string{fmt.Sprintf("%s/followers", actorURL)}
+
+	return ActivityPubActivity{
+		Context:   ActivityStreamsContext,
+		ID:        fmt.Sprintf("%s#create", noteURL),
+		Type:      "Create",
+		Actor:     actorURL,
+		Published: published,
+		To:        to,
+		CC:        cc,
+		Object: ActivityPubNote{
+			ID:           noteURL,
+			Type:         "Note",
+			AttributedTo: actorURL,
+			Content:      string(formatTwt(twt.Text())),
+			Published:    published,
+			URL:          noteURL,
+			To:           to,
+			CC:           cc,
+		},
+	}
+}
+
+// Publish delivers a new twt by a local user or feed to the inboxes of its
+// remote followers
+func (ap *ActivityPub) Publish(name string, twt types.Twt) {
+	followers, err := ap.db.GetActivityPubFollowers(name)
+	if err != nil {
+		log.WithError(err).Errorf("error loading activitypub followers of %s", name)
+		return
+	}
+	if len(followers) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(ap.Create(name, twt))
+	if err != nil {
+		log.WithError(err).Errorf("error serializing activity for twt %s", twt.Hash())
+		return
+	}
+
+	// Followers on the same server usually share an inbox
+	seen := make(map[string]bool)
+	for _, follower := range followers {
+		if seen[follower.Inbox] {
+			continue
+		}
+		seen[follower.Inbox] = true
+
+		ap.deliverLater(name, follower.Inbox, body)
+	}
+}
+
+// RetryDeliveries dispatches the stored retries of failed deliveries that
+// are due to be attempted again
+func (ap *ActivityPub) RetryDeliveries() {
+	retries, err := ap.db.GetActivityPubRetries()
+	if err != nil {
+		log.WithError(err).Error("error loading activitypub retries")
+		return
+	}
+
+	now := time.Now()
+	for _, retry := range retries {
+		if retry.RetryAt.After(now) {
+			continue
+		}
+
+		if err := ap.db.DelActivityPubRetry(retry.ID); err != nil {
+			log.WithError(err).Errorf("error removing activitypub retry %s", retry.ID)
+			continue
+		}
+
+		task := NewActivityPubTask(ap, retry.Name, retry.Inbox, retry.Body, retry.Attempt)
+		if _, err := ap.tasks.Dispatch(task); err != nil {
+			log.WithError(err).Errorf("error dispatching retry of activity delivery to %s", retry.Inbox)
+		}
+	}
+}
+
+func (ap *ActivityPub) deliverLater(name, inbox string, body []byte) {
+	if _, err := ap.tasks.Dispatch(NewActivityPubTask(ap, name, inbox, body, 1)); err != nil {
+		log.WithError(err).Errorf("error dispatching activitypub delivery to %s", inbox)
+	}
+}
+
+func (ap *ActivityPub) userAgent() string {
+	return fmt.Sprintf(
+		"twtxt/%s (Pod: %s Support: %s)",
+		twtxt.FullVersion(), ap.conf.Name, URLForPage(ap.conf.BaseURL, "support"),
+	)
+}
+
+// client returns a client for requests to remote servers. Actor and inbox
+// URLs come from remote servers so they may only resolve to public
+// addresses, including when following redirects.
+func (ap *ActivityPub) client() *http.Client {
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{DialContext: ap.dial},
+	}
+}
+
+// Deliver POSTs an activity signed by the local actor to an inbox and
+// returns the response status code. Any non-2xx response is an error.
+func (ap *ActivityPub) Deliver(name, inbox string, body []byte) (int, error) {
+	if !isHTTPURL(inbox) {
+		return 0, ErrInvalidActor
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", ActivityPubContentType)
+	req.Header.Set("User-Agent", ap.userAgent())
+
+	if err := SignRequest(req, ap.KeyID(name), ap.key, body); err != nil {
+		return 0, err
+	}
+
+	client := ap.client()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// FetchActor fetches a remote actor document with a GET signed by the local
+// actor, as some servers require signed fetches
+func (ap *ActivityPub) FetchActor(name, uri string) (*ActivityPubActor, error) {
+	if !isHTTPURL(uri) {
+		return nil, ErrInvalidActor
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", ActivityPubContentType)
+	req.Header.Set("User-Agent", ap.userAgent())
+
+	if err := SignRequest(req, ap.KeyID(name), ap.key, nil); err != nil {
+		return nil, err
+	}
+
+	client := ap.client()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status %s fetching actor %s", res.Status, uri)
+	}
+
+	var actor ActivityPubActor
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxActivityPubSize)).Decode(&actor); err != nil {
+		return nil, err
+	}
+
+	if !isHTTPURL(actor.ID) || !isHTTPURL(actor.Inbox) {
+		return nil, ErrInvalidActor
+	}
+	if actor.Endpoints != nil && actor.Endpoints.SharedInbox != "" && !isHTTPURL(actor.Endpoints.SharedInbox) {
+		return nil, ErrInvalidActor
+	}
+
+	// An actor document can only speak for actors on the server it was
+	// fetched from
+	if !sameOrigin(actor.ID, uri) {
+		return nil, ErrInvalidActor
+	}
+
+	return &actor, nil
+}
+
+// isHTTPURL returns true if uri is an absolute http or https URL
+func isHTTPURL(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// sameOrigin returns true if both URLs have the same scheme and host
+func sameOrigin(a, b string) bool {
+	u, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	v, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == v.Scheme && strings.EqualFold(u.Host, v.Host)
+}
+
+// VerifyInboxRequest verifies the signature of a request to the inbox of a
+// local user or feed and returns the actor that signed it
+func (ap *ActivityPub) VerifyInboxRequest(name string, req *http.Request, body []byte) (string, error) {
+	return VerifyRequest(req, body, func(keyID string) (*rsa.PublicKey, string, error) {
+		actor, err := ap.FetchActor(name, strings.SplitN(keyID, "#", 2)[0])
+		if err != nil {
+			return nil, "", err
+		}
+
+		if actor.PublicKey.ID != keyID || actor.PublicKey.Owner != actor.ID {
+			return nil, "", ErrInvalidSignature
+		}
+
+		key, err := DecodePublicKey(actor.PublicKey.PublicKeyPem)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return key, actor.ID, nil
+	})
+}
+
+// HandleActivity processes an activity sent to the inbox of a local user or
+// feed by the (verified) signer. Follow and Undo Follow are supported and
+// other activities are ignored.
+func (ap *ActivityPub) HandleActivity(name, signer string, activity ActivityPubActivity) error {
+	if activity.Actor == "" || activity.Actor != signer {
+		return ErrInvalidActivity
+	}
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != ap.ActorURL(name) {
+			return ErrInvalidActivity
+		}
+		return ap.follow(name, activity)
+	case "Undo":
+		if typ := activity.ObjectType(); typ != "" && typ != "Follow" {
+			return nil
+		}
+		return ap.unfollow(name, activity.Actor)
+	default:
+		log.Debugf("ignoring %s activity from %s to %s", activity.Type, activity.Actor, name)
+		return nil
+	}
+}
+
+func (ap *ActivityPub) follow(name string, activity ActivityPubActivity) error {
+	actor, err := ap.FetchActor(name, activity.Actor)
+	if err != nil {
+		return err
+	}
+
+	inbox := actor.Inbox
+	if actor.Endpoints != nil && actor.Endpoints.SharedInbox != "" {
+		inbox = actor.Endpoints.SharedInbox
+	}
+
+	follower := &ActivityPubFollower{
+		ID:        FastHash(actor.ID),
+		Name:      name,
+		Actor:     actor.ID,
+		Inbox:     inbox,
+		CreatedAt: time.Now(),
+	}
+
+	if err := ap.db.SetActivityPubFollower(name, follower.ID, follower); err != nil {
+		return err
+	}
+
+	accept, err := json.Marshal(ActivityPubActivity{
+		Context: ActivityStreamsContext,
+		ID:      fmt.Sprintf("%s#accepts/%s", ap.ActorURL(name), FastHash(activity.ID)),
+		Type:    "Accept",
+		Actor:   ap.ActorURL(name),
+		Object:  activity,
+	})
+	if err != nil {
+		return err
+	}
+	ap.deliverLater(name, actor.Inbox, accept)
+
+	from := actor.PreferredUsername
+	if from == "" {
+		from = actor.Name
+	}
+	fromURL := actor.URL
+	if fromURL == "" {
+		fromURL = actor.ID
+	}
+	NotifyFeedFollow(ap.db, ap.events, name, from, fromURL)
+
+	log.Infof("%s is now followed by %s via activitypub", name, actor.ID)
+
+	return nil
+}
+
+func (ap *ActivityPub) unfollow(name, actor string) error {
+	if err := ap.db.DelActivityPubFollower(name, FastHash(actor)); err != nil {
+		return err
+	}
+
+	log.Infof("%s is no longer followed by %s via activitypub", name, actor)
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func writeActivityPub(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Error("error serializing activitypub document")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ActivityPubContentType)
+	_, _ = w.Write(data)
+}
+
+// ActivityPubActorHandler serves the ActivityPub actor of a local user or feed
+func (s *Server) ActivityPubActorHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+
+		actor, err := s.activitypub.Actor(nick)
+		if err != nil {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		writeActivityPub(w, actor)
+	}
+}
+
+// ActivityPubOutboxHandler serves the outbox of a local user or feed built
+// from their twtxt feed, newest first
+func (s *Server) ActivityPubOutboxHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		if !s.activitypub.HasActor(nick) {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		outboxURL := fmt.Sprintf("%s/outbox", s.activitypub.ActorURL(nick))
+		twts := s.cache.GetByURL(URLForUser(s.config, nick))
+
+		if r.FormValue("page") == "" {
+			writeActivityPub(w, ActivityPubCollection{
+				Context:    ActivityStreamsContext,
+				ID:         outboxURL,
+				Type:       "OrderedCollection",
+				TotalItems: len(twts),
+				First:      fmt.Sprintf("%s?page=1", outboxURL),
+			})
+			return
+		}
+
+		var pagedTwts types.Twts
+
+		page := SafeParseInt(r.FormValue("page"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error paging outbox")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		collection := ActivityPubCollection{
+			Context:      ActivityStreamsContext,
+			ID:           fmt.Sprintf("%s?page=%d", outboxURL, page),
+			Type:         "OrderedCollectionPage",
+			TotalItems:   len(twts),
+			PartOf:       outboxURL,
+			OrderedItems: []interface{}{},
+		}
+		if page < pager.PageNums() {
+			collection.Next = fmt.Sprintf("%s?page=%d", outboxURL, page+1)
+		}
+		if page > 1 {
+			collection.Prev = fmt.Sprintf("%s?page=%d", outboxURL, page-1)
+		}
+
+		for _, twt := range pagedTwts {
+			collection.OrderedItems = append(collection.OrderedItems, s.activitypub.Create(nick, twt))
+		}
+
+		writeActivityPub(w, collection)
+	}
+}
+
+// ActivityPubFollowersHandler serves the collection of remote actors
+// following a local user or feed
+func (s *Server) ActivityPubFollowersHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		if !s.activitypub.HasActor(nick) {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		followers, err := s.db.GetActivityPubFollowers(nick)
+		if err != nil {
+			log.WithError(err).Errorf("error loading activitypub followers of %s", nick)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		collection := ActivityPubCollection{
+			Context:      ActivityStreamsContext,
+			ID:           fmt.Sprintf("%s/followers", s.activitypub.ActorURL(nick)),
+			Type:         "OrderedCollection",
+			TotalItems:   len(followers),
+			OrderedItems: []interface{}{},
+		}
+		for _, follower := range followers {
+			collection.OrderedItems = append(collection.OrderedItems, follower.Actor)
+		}
+
+		writeActivityPub(w, collection)
+	}
+}
+
+// ActivityPubInboxHandler accepts signed activities for a local user or feed
+func (s *Server) ActivityPubInboxHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		if !s.activitypub.HasActor(nick) {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxActivityPubSize))
+		if err != nil {
+			log.WithError(err).Error("error reading activity")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		signer, err := s.activitypub.VerifyInboxRequest(nick, r, body)
+		if err != nil {
+			log.WithError(err).Warnf("rejecting unsigned or invalid activity for %s", nick)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var activity ActivityPubActivity
+		if err := json.Unmarshal(body, &activity); err != nil {
+			log.WithError(err).Warnf("error parsing activity for %s from %s", nick, signer)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.activitypub.HandleActivity(nick, signer, activity); err != nil {
+			log.WithError(err).Warnf("error handling %s activity for %s from %s", activity.Type, nick, signer)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
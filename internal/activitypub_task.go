@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxActivityPubAttempts is the number of times an activity is delivered
+	// to an inbox before giving up
+	maxActivityPubAttempts = 3
+
+	// activityPubBackoff is the delay before the first retry, doubling with
+	// each subsequent attempt. Retries are dispatched by
+	// ActivityPub.RetryDeliveries so may be delayed by up to its schedule.
+	activityPubBackoff = time.Minute
+)
+
+type ActivityPubTask struct {
+	*BaseTask
+
+	ap      *ActivityPub
+	name    string
+	inbox   string
+	body    []byte
+	attempt int
+}
+
+func NewActivityPubTask(ap *ActivityPub, name, inbox string, body []byte, attempt int) *ActivityPubTask {
+	return &ActivityPubTask{
+		BaseTask: NewBaseTask(),
+
+		ap:      ap,
+		name:    name,
+		inbox:   inbox,
+		body:    body,
+		attempt: attempt,
+	}
+}
+
+func (t *ActivityPubTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *ActivityPubTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	statusCode, err := t.ap.Deliver(t.name, t.inbox, t.body)
+
+	t.SetData("statusCode", fmt.Sprintf("%d", statusCode))
+	t.SetData("attempt", fmt.Sprintf("%d", t.attempt))
+
+	if err != nil {
+		if t.attempt < maxActivityPubAttempts {
+			backoff := activityPubBackoff * time.Duration(1<<uint(t.attempt-1))
+			log.WithError(err).Warnf(
+				"error delivering activity from %s to %s (attempt %d), retrying in %s",
+				t.name, t.inbox, t.attempt, backoff,
+			)
+			retry := &ActivityPubRetry{
+				ID:      GenerateRandomToken(),
+				Name:    t.name,
+				Inbox:   t.inbox,
+				Body:    t.body,
+				Attempt: t.attempt + 1,
+				RetryAt: time.Now().Add(backoff),
+			}
+			if err := t.ap.db.SetActivityPubRetry(retry.ID, retry); err != nil {
+				log.WithError(err).Errorf("error scheduling retry of activity delivery to %s", t.inbox)
+			}
+		} else {
+			log.WithError(err).Errorf(
+				"giving up delivering activity from %s to %s after %d attempts",
+				t.name, t.inbox, t.attempt,
+			)
+		}
+		return t.Fail(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func TestHTTPSignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	body := []byte(`{"type":"Follow"}`)
+	req := httptest.NewRequest(http.MethodPost, "https://pod.example.com/ap/alice/inbox", bytes.NewReader(body))
+	require.NoError(t, SignRequest(req, "https://example.com/users/bob#main-key", key, body))
+
+	fetchKey := func(keyID string) (*rsa.PublicKey, string, error) {
+		assert.Equal(t, "https://example.com/users/bob#main-key", keyID)
+		return &key.PublicKey, "https://example.com/users/bob", nil
+	}
+
+	owner, err := VerifyRequest(req, body, fetchKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/users/bob", owner)
+
+	_, err = VerifyRequest(req, []byte(`{"type":"Undo"}`), fetchKey)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	req.Header.Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+	_, err = VerifyRequest(req, body, fetchKey)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+// fakeRemote is a remote ActivityPub server with a single actor whose inbox
+// records (verified) deliveries
+type fakeRemote struct {
+	*httptest.Server
+
+	key        *rsa.PrivateKey
+	deliveries chan ActivityPubActivity
+}
+
+func newFakeRemote(t *testing.T, podKey *rsa.PublicKey) *fakeRemote {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	remote := &fakeRemote{key: key, deliveries: make(chan ActivityPubActivity, 10)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/bob", func(w http.ResponseWriter, r *http.Request) {
+		publicKeyPem, _ := EncodePublicKey(&key.PublicKey)
+		_ = json.NewEncoder(w).Encode(ActivityPubActor{
+			ID:                remote.ActorURL(),
+			Type:              "Person",
+			PreferredUsername: "bob",
+			Inbox:             remote.URL + "/users/bob/inbox",
+			PublicKey: ActivityPubPublicKey{
+				ID:           remote.KeyID(),
+				Owner:        remote.ActorURL(),
+				PublicKeyPem: publicKeyPem,
+			},
+		})
+	})
+	mux.HandleFunc("/users/bob/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, err := VerifyRequest(r, body, func(keyID string) (*rsa.PublicKey, string, error) {
+			return podKey, "", nil
+		})
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var activity ActivityPubActivity
+		_ = json.Unmarshal(body, &activity)
+		remote.deliveries <- activity
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	remote.Server = httptest.NewServer(mux)
+
+	return remote
+}
+
+func (remote *fakeRemote) ActorURL() string { return remote.URL + "/users/bob" }
+func (remote *fakeRemote) KeyID() string    { return remote.ActorURL() + "#main-key" }
+
+func (remote *fakeRemote) Post(t *testing.T, ap *ActivityPub, activity ActivityPubActivity) error {
+	body, err := json.Marshal(activity)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, ap.ActorURL("alice")+"/inbox", bytes.NewReader(body))
+	require.NoError(t, SignRequest(req, remote.KeyID(), remote.key, body))
+
+	signer, err := ap.VerifyInboxRequest("alice", req, body)
+	if err != nil {
+		return err
+	}
+
+	return ap.HandleActivity("alice", signer, activity)
+}
+
+func (remote *fakeRemote) Next(t *testing.T) ActivityPubActivity {
+	select {
+	case activity := <-remote.deliveries:
+		return activity
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return ActivityPubActivity{}
+	}
+}
+
+func TestActivityPubFollowAndPublish(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-activitypub")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = URLForUser(conf, "alice")
+	require.NoError(t, db.SetUser("alice", user))
+
+	tasks := NewDispatcher(2, 10)
+	tasks.Start()
+	defer tasks.Stop()
+
+	ap, err := NewActivityPub(conf, db, tasks, nil)
+	require.NoError(t, err)
+
+	// The test servers listen on loopback
+	ap.dial = (&net.Dialer{}).DialContext
+
+	remote := newFakeRemote(t, &ap.key.PublicKey)
+	defer remote.Close()
+
+	// Unsigned by the actor it claims to be from
+	err = ap.HandleActivity("alice", "https://example.com/users/mallory", ActivityPubActivity{
+		Type: "Follow", Actor: remote.ActorURL(), Object: ap.ActorURL("alice"),
+	})
+	assert.Equal(t, ErrInvalidActivity, err)
+
+	follow := ActivityPubActivity{
+		ID:     remote.ActorURL() + "#follows/1",
+		Type:   "Follow",
+		Actor:  remote.ActorURL(),
+		Object: ap.ActorURL("alice"),
+	}
+	require.NoError(t, remote.Post(t, ap, follow))
+
+	accept := remote.Next(t)
+	assert.Equal(t, "Accept", accept.Type)
+	assert.Equal(t, ap.ActorURL("alice"), accept.Actor)
+	assert.Equal(t, follow.ID, accept.ObjectID())
+
+	followers, err := db.GetActivityPubFollowers("alice")
+	require.NoError(t, err)
+	require.Len(t, followers, 1)
+	assert.Equal(t, remote.ActorURL(), followers[0].Actor)
+
+	twt, err := types.ParseLine("2020-11-01T12:00:00Z\tHello fediverse!", user.Twter())
+	require.NoError(t, err)
+	ap.Publish("alice", twt)
+
+	create := remote.Next(t)
+	assert.Equal(t, "Create", create.Type)
+	assert.Equal(t, URLForTwt(conf.BaseURL, twt.Hash()), create.ObjectID())
+	assert.Equal(t, "Note", create.ObjectType())
+
+	undo := ActivityPubActivity{
+		ID:     remote.ActorURL() + "#follows/1/undo",
+		Type:   "Undo",
+		Actor:  remote.ActorURL(),
+		Object: map[string]interface{}{"id": follow.ID, "type": "Follow"},
+	}
+	require.NoError(t, remote.Post(t, ap, undo))
+
+	followers, err = db.GetActivityPubFollowers("alice")
+	require.NoError(t, err)
+	assert.Len(t, followers, 0)
+}
+
+func TestActivityPubVerifyInboxRequestSpoofedActor(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-activitypub")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	ap, err := NewActivityPub(conf, db, nil, nil)
+	require.NoError(t, err)
+
+	// The test servers listen on loopback
+	ap.dial = (&net.Dialer{}).DialContext
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyPem, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	var ts *httptest.Server
+	actors := map[string]func() ActivityPubActor{
+		// Claims to be an actor on another server
+		"/users/mallory": func() ActivityPubActor {
+			victim := "https://victim.example.com/users/alice"
+			return ActivityPubActor{
+				ID:        victim,
+				Inbox:     victim + "/inbox",
+				PublicKey: ActivityPubPublicKey{ID: ts.URL + "/users/mallory#main-key", Owner: victim, PublicKeyPem: publicKeyPem},
+			}
+		},
+		// Publishes a key owned by another actor
+		"/users/eve": func() ActivityPubActor {
+			return ActivityPubActor{
+				ID:        ts.URL + "/users/eve",
+				Inbox:     ts.URL + "/users/eve/inbox",
+				PublicKey: ActivityPubPublicKey{ID: ts.URL + "/users/eve#main-key", Owner: ts.URL + "/users/bob", PublicKeyPem: publicKeyPem},
+			}
+		},
+	}
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := actors[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(actor())
+	}))
+	defer ts.Close()
+
+	for path := range actors {
+		body := []byte(`{"type":"Follow"}`)
+		req := httptest.NewRequest(http.MethodPost, ap.ActorURL("alice")+"/inbox", bytes.NewReader(body))
+		require.NoError(t, SignRequest(req, ts.URL+path+"#main-key", key, body))
+
+		_, err := ap.VerifyInboxRequest("alice", req, body)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestActivityPubRetryDeliveries(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-activitypub")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	tasks := NewDispatcher(2, 10)
+	tasks.Start()
+	defer tasks.Stop()
+
+	ap, err := NewActivityPub(conf, db, tasks, nil)
+	require.NoError(t, err)
+
+	// The test servers listen on loopback
+	ap.dial = (&net.Dialer{}).DialContext
+
+	attempts := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts <- struct{}{}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	body := []byte(`{"type":"Create"}`)
+	assert.Error(t, NewActivityPubTask(ap, "alice", ts.URL+"/inbox", body, 1).Run())
+	<-attempts
+
+	// Failed deliveries are stored to be retried later
+	retries, err := db.GetActivityPubRetries()
+	require.NoError(t, err)
+	require.Len(t, retries, 1)
+	assert.Equal(t, 2, retries[0].Attempt)
+	assert.Equal(t, body, retries[0].Body)
+
+	ap.RetryDeliveries()
+	assert.Len(t, attempts, 0)
+
+	retries[0].RetryAt = time.Now()
+	require.NoError(t, db.SetActivityPubRetry(retries[0].ID, retries[0]))
+
+	ap.RetryDeliveries()
+	select {
+	case <-attempts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for retry")
+	}
+}
+
+func TestActivityPubInternalAddresses(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-activitypub")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	ap, err := NewActivityPub(conf, db, nil, nil)
+	require.NoError(t, err)
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	_, err = ap.FetchActor("alice", ts.URL+"/users/bob")
+	assert.Error(t, err)
+
+	_, err = ap.Deliver("alice", ts.URL+"/inbox", []byte(`{}`))
+	assert.Error(t, err)
+
+	assert.Equal(t, 0, requests)
+
+	_, err = ap.FetchActor("alice", "/users/bob")
+	assert.Equal(t, ErrInvalidActor, err)
+
+	_, err = ap.Deliver("alice", "file:///etc/passwd", []byte(`{}`))
+	assert.Equal(t, ErrInvalidActor, err)
+}
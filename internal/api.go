@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -19,7 +20,6 @@ import (
 	"github.com/vcraescu/go-paginator"
 	"github.com/vcraescu/go-paginator/adapter"
 
-	"github.com/jointwt/twtxt"
 	"github.com/jointwt/twtxt/internal/passwords"
 	"github.com/jointwt/twtxt/types"
 )
@@ -49,11 +49,14 @@ type API struct {
 	db      Store
 	pm      passwords.Passwords
 	tasks   *Dispatcher
+	msgs    *MessagesCache
+	events  *EventBus
+	hooks   *AppendTwtHooks
 }
 
 // NewAPI ...
-func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db Store, pm passwords.Passwords, tasks *Dispatcher) *API {
-	api := &API{router, config, cache, archive, db, pm, tasks}
+func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db Store, pm passwords.Passwords, tasks *Dispatcher, msgs *MessagesCache, events *EventBus, hooks *AppendTwtHooks) *API {
+	api := &API{router, config, cache, archive, db, pm, tasks, msgs, events, hooks}
 
 	api.initRoutes()
 
@@ -68,19 +71,54 @@ func (a *API) initRoutes() {
 	router.POST("/register", a.RegisterEndpoint())
 	router.POST("/config", a.PodConfigEndpoint())
 
-	router.POST("/post", a.isAuthorized(a.PostEndpoint()))
-	router.POST("/upload", a.isAuthorized(a.UploadMediaEndpoint()))
+	// OAuth2 token issuance and revocation for third-party apps
+	router.POST("/oauth/token", a.OAuthTokenEndpoint())
+	router.POST("/oauth/revoke", a.OAuthRevokeEndpoint())
 
-	router.GET("/settings", a.isAuthorized(a.SettingsEndpoint()))
-	router.POST("/settings", a.isAuthorized(a.SettingsEndpoint()))
+	router.POST("/post", a.isAuthorized(a.PostEndpoint(), ScopeWrite))
+	router.POST("/upload", a.isAuthorized(a.UploadMediaEndpoint(), ScopeWrite))
 
-	router.POST("/follow", a.isAuthorized(a.FollowEndpoint()))
-	router.POST("/unfollow", a.isAuthorized(a.UnfollowEndpoint()))
+	router.GET("/settings", a.isAuthorized(a.SettingsEndpoint(), ScopeRead))
+	router.POST("/settings", a.isAuthorized(a.SettingsEndpoint(), ScopeAccount))
 
-	router.POST("/mute", a.isAuthorized(a.MuteEndpoint()))
-	router.POST("/unmute", a.isAuthorized(a.UnmuteEndpoint()))
+	router.GET("/feed/:name/settings", a.isAuthorized(a.FeedSettingsEndpoint(), ScopeRead))
+	router.POST("/feed/:name/settings", a.isAuthorized(a.FeedSettingsEndpoint(), ScopeAccount))
+
+	router.POST("/follow", a.isAuthorized(a.FollowEndpoint(), ScopeWrite))
+	router.POST("/unfollow", a.isAuthorized(a.UnfollowEndpoint(), ScopeWrite))
+	router.POST("/follows/import", a.isAuthorized(a.ImportFollowsEndpoint(), ScopeWrite))
+	router.GET("/follows/export", a.isAuthorized(a.ExportFollowsEndpoint(), ScopeRead))
+
+	router.POST("/export", a.isAuthorized(a.ExportDataEndpoint(), ScopeAccount))
+	router.GET("/export/:id", a.isAuthorized(a.DownloadExportEndpoint(), ScopeAccount))
+
+	router.POST("/tags/follow", a.isAuthorized(a.FollowTagEndpoint(), ScopeWrite))
+	router.POST("/tags/unfollow", a.isAuthorized(a.UnfollowTagEndpoint(), ScopeWrite))
+
+	router.POST("/mute", a.isAuthorized(a.MuteEndpoint(), ScopeWrite))
+	router.POST("/unmute", a.isAuthorized(a.UnmuteEndpoint(), ScopeWrite))
+
+	router.POST("/bookmarks", a.isAuthorized(a.BookmarksEndpoint(), ScopeRead))
+	router.POST("/bookmarks/add", a.isAuthorized(a.BookmarkEndpoint(), ScopeWrite))
+	router.POST("/bookmarks/remove", a.isAuthorized(a.UnbookmarkEndpoint(), ScopeWrite))
+
+	router.POST("/timeline", a.isAuthorized(a.TimelineEndpoint(), ScopeRead))
+
+	router.GET("/events", a.isAuthorized(a.EventsEndpoint(), ScopeRead))
+
+	router.POST("/notifications", a.isAuthorized(a.NotificationsEndpoint(), ScopeRead))
+	router.POST("/notifications/read", a.isAuthorized(a.MarkNotificationsReadEndpoint(), ScopeWrite))
+
+	router.POST("/markers", a.isAuthorized(a.ReadMarkersEndpoint(), ScopeRead))
+	router.POST("/markers/advance", a.isAuthorized(a.AdvanceReadMarkerEndpoint(), ScopeWrite))
+
+	router.POST("/filters", a.isAuthorized(a.FiltersEndpoint(), ScopeRead))
+	router.POST("/filters/add", a.isAuthorized(a.AddFilterEndpoint(), ScopeWrite))
+	router.POST("/filters/remove", a.isAuthorized(a.RemoveFilterEndpoint(), ScopeWrite))
+
+	router.POST("/lists", a.isAuthorized(a.ListsEndpoint(), ScopeRead))
+	router.POST("/lists/:name/timeline", a.isAuthorized(a.ListTimelineEndpoint(), ScopeRead))
 
-	router.POST("/timeline", a.isAuthorized(a.TimelineEndpoint()))
 	router.POST("/discover", a.DiscoverEndpoint())
 
 	router.GET("/profile/:nick", a.ProfileEndpoint())
@@ -89,11 +127,11 @@ func (a *API) initRoutes() {
 
 	router.POST("/external", a.ExternalProfileEndpoint())
 
-	router.POST("/mentions", a.isAuthorized(a.MentionsEndpoint()))
+	router.POST("/mentions", a.isAuthorized(a.MentionsEndpoint(), ScopeRead))
 
 	// Support / Report endpoints
-	router.POST("/support", a.isAuthorized(a.SupportEndpoint()))
-	router.POST("/report", a.isAuthorized(a.ReportEndpoint()))
+	router.POST("/support", a.isAuthorized(a.SupportEndpoint(), ScopeWrite))
+	router.POST("/report", a.isAuthorized(a.ReportEndpoint(), ScopeWrite))
 }
 
 // CreateToken ...
@@ -139,8 +177,47 @@ func (a *API) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
 	return []byte(a.config.APISigningKey), nil
 }
 
+// tokenFromRequest returns the token from the Token header or an OAuth2
+// bearer token from the Authorization header
+func tokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get("Token"); token != "" {
+		return token
+	}
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// tokenScopes returns the scopes a valid token grants. Tokens issued by
+// /api/v1/auth grant every scope, OAuth access tokens only those the user
+// approved and only until they are revoked or their app is deleted.
+func (a *API) tokenScopes(token *jwt.Token) ([]string, error) {
+	claims := token.Claims.(jwt.MapClaims)
+
+	typ, _ := claims["typ"].(string)
+	switch typ {
+	case "":
+		return OAuthScopes, nil
+	case oauthTokenAccess:
+		tkn, err := a.db.GetToken(token.Signature)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		if _, err := a.db.GetOAuthApp(tkn.ClientID); err != nil {
+			return nil, ErrInvalidToken
+		}
+		return tkn.Scopes, nil
+	default:
+		return nil, ErrInvalidToken
+	}
+}
+
 func (a *API) getLoggedInUser(r *http.Request) *User {
-	token, err := jwt.Parse(r.Header.Get("Token"), a.jwtKeyFunc)
+	token, err := jwt.Parse(tokenFromRequest(r), a.jwtKeyFunc)
 	if err != nil {
 		return nil
 	}
@@ -149,10 +226,21 @@ func (a *API) getLoggedInUser(r *http.Request) *User {
 		return nil
 	}
 
+	if scopes, err := a.tokenScopes(token); err != nil || !HasString(scopes, ScopeRead) {
+		return nil
+	}
+
 	claims := token.Claims.(jwt.MapClaims)
 
 	username := claims["username"].(string)
 
+	// Tokens issued before a user was renamed still carry their old username
+	if !a.db.HasUser(username) {
+		if resolved, ok := ResolveAlias(a.db, username); ok {
+			username = resolved
+		}
+	}
+
 	user, err := a.db.GetUser(username)
 	if err != nil {
 		log.WithError(err).Error("error loading user object")
@@ -171,25 +259,49 @@ func (a *API) getLoggedInUser(r *http.Request) *User {
 
 }
 
-func (a *API) isAuthorized(endpoint httprouter.Handle) httprouter.Handle {
+// isAuthorized only calls endpoint for requests with a valid token that
+// grants scope
+func (a *API) isAuthorized(endpoint httprouter.Handle, scope string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if r.Header.Get("Token") == "" {
+		value := tokenFromRequest(r)
+		if value == "" {
 			http.Error(w, "No Token Provided", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(r.Header.Get("Token"), a.jwtKeyFunc)
+		token, err := jwt.Parse(value, a.jwtKeyFunc)
 		if err != nil {
+			// Expired OAuth access tokens are refreshed by the app
+			if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+				http.Error(w, "Token Expired", http.StatusUnauthorized)
+				return
+			}
 			log.WithError(err).Error("error parsing token")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
 		if token.Valid {
+			scopes, err := a.tokenScopes(token)
+			if err != nil {
+				http.Error(w, "Invalid Token", http.StatusUnauthorized)
+				return
+			}
+			if !HasString(scopes, scope) {
+				http.Error(w, "Insufficient Scope", http.StatusForbidden)
+				return
+			}
+
 			claims := token.Claims.(jwt.MapClaims)
 
 			username := claims["username"].(string)
 
+			if !a.db.HasUser(username) {
+				if resolved, ok := ResolveAlias(a.db, username); ok {
+					username = resolved
+				}
+			}
+
 			user, err := a.db.GetUser(username)
 			if err != nil {
 				log.WithError(err).Error("error loading user object")
@@ -243,7 +355,7 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 			return
 		}
 
-		if a.db.HasUser(username) || a.db.HasFeed(username) {
+		if a.db.HasUser(username) || a.db.HasFeed(username) || a.db.HasAlias(username) {
 			http.Error(w, "Username Exists", http.StatusBadRequest)
 			return
 		}
@@ -336,6 +448,42 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 			return
 		}
 
+		// Two-factor authentication, clients retry with an OTP when told
+		// one is required
+		if user.HasTOTP() {
+			if req.OTP == "" {
+				res := types.AuthResponse{OTPRequired: true}
+				body, err := res.Bytes()
+				if err != nil {
+					log.WithError(err).Error("error serializing response")
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write(body)
+				return
+			}
+
+			if _, err := user.CheckTOTP(req.OTP); err != nil {
+				// #239: Throttle failed login attempts and lock user  account.
+				failed := failures.Inc(user.Username)
+				time.Sleep(time.Duration(IntPow(2, failed)) * time.Second)
+
+				log.WithField("username", username).Warn("login attempt with invalid otp")
+				http.Error(w, "Invalid Credentials", http.StatusUnauthorized)
+				return
+			}
+
+			// Record the code used so it can't be replayed
+			if err := a.db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Errorf("error updating user object for %s", user.Username)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// #239: Throttle failed login attempts and lock user  account.
 		failures.Reset(user.Username)
 
@@ -394,15 +542,15 @@ func (a *API) PostEndpoint() httprouter.Handle {
 			return
 		}
 
+		var twt types.Twt
+
+		name := user.Username
 		switch req.PostAs {
 		case "", me:
-			_, err = AppendTwt(a.config, a.db, user, text)
+			twt, err = AppendTwt(a.config, a.db, user, text)
 		default:
-			if user.OwnsFeed(req.PostAs) {
-				_, err = AppendSpecial(a.config, a.db, req.PostAs, text)
-			} else {
-				err = ErrFeedImposter
-			}
+			name = req.PostAs
+			twt, err = PostAsFeed(a.config, a.db, user, req.PostAs, text)
 		}
 
 		if err != nil {
@@ -415,6 +563,8 @@ func (a *API) PostEndpoint() httprouter.Handle {
 			return
 		}
 
+		a.hooks.Run(name, twt)
+
 		// Update user's own timeline with their own new post.
 		a.cache.FetchTwts(a.config, a.archive, user.Source(), nil)
 
@@ -439,13 +589,7 @@ func (a *API) TimelineEndpoint() httprouter.Handle {
 			return
 		}
 
-		var twts types.Twts
-
-		for feed := range user.Sources() {
-			twts = append(twts, a.cache.GetByURL(feed.URL)...)
-		}
-
-		sort.Sort(twts)
+		twts := a.cache.GetTimeline(user)
 
 		var pagedTwts types.Twts
 
@@ -465,6 +609,7 @@ func (a *API) TimelineEndpoint() httprouter.Handle {
 				MaxPages:  pager.PageNums(),
 				TotalTwts: pager.Nums(),
 			},
+			Warnings: FilterWarnings(user, pagedTwts),
 		}
 
 		body, err := res.Bytes()
@@ -511,6 +656,7 @@ func (a *API) DiscoverEndpoint() httprouter.Handle {
 				MaxPages:  pager.PageNums(),
 				TotalTwts: pager.Nums(),
 			},
+			Warnings: FilterWarnings(loggedInUser, pagedTwts),
 		}
 
 		body, err := res.Bytes()
@@ -558,6 +704,7 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 				MaxPages:  pager.PageNums(),
 				TotalTwts: pager.Nums(),
 			},
+			Warnings: FilterWarnings(user, pagedTwts),
 		}
 
 		body, err := res.Bytes()
@@ -572,6 +719,19 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 	}
 }
 
+// EventsEndpoint streams real-time timeline, mentions and messages updates
+// to the client as Server-Sent Events.
+func (a *API) EventsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		ServeEvents(
+			w, r, a.events, user.Username,
+			Event{Type: MessagesEvent, Count: a.msgs.Get(user.Username)},
+		)
+	}
+}
+
 // FollowEndpoint ...
 func (a *API) FollowEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -584,8 +744,7 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 			return
 		}
 
-		nick := strings.TrimSpace(req.Nick)
-		url := NormalizeURL(req.URL)
+		nick, url := ResolveFollow(a.config, a.db, strings.TrimSpace(req.Nick), strings.TrimSpace(req.URL))
 
 		if nick == "" || url == "" {
 			log.Warn("no nick or url provided")
@@ -629,18 +788,7 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 					return
 				}
 
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(a.config, followee.Username),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				NotifyFeedFollow(a.db, a.events, followee.Username, user.Username, user.URL)
 			} else if a.db.HasFeed(nick) {
 				feed, err := a.db.GetFeed(nick)
 				if err != nil {
@@ -657,18 +805,7 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 					return
 				}
 
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						feed.Name, URLForUser(a.config, feed.Name),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				NotifyFeedFollow(a.db, a.events, feed.Name, user.Username, user.URL)
 			}
 		}
 
@@ -678,6 +815,151 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 	}
 }
 
+// ImportFollowsEndpoint dispatches a FollowsImportTask to import feeds for
+// the user, or a feed they own, to follow from an OPML document or a list of
+// follows and returns the task's URI whose data contains the results
+func (a *API) ImportFollowsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewImportFollowsRequest(io.LimitReader(r.Body, a.config.MaxUploadSize))
+		if err != nil {
+			log.WithError(err).Error("error parsing import follows request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		feeds, err := ParseFollows([]byte(req.Data))
+		if err != nil {
+			log.WithError(err).Error("error parsing follows to import")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if len(feeds) > maxImportFollows {
+			log.WithError(ErrTooManyFollows).Errorf("error importing follows for %s", user.Username)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := GetFollowsImporter(a.db, user, req.Feed); err != nil {
+			log.WithError(err).Errorf("error importing follows for %s", user.Username)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		uuid, err := a.tasks.Dispatch(NewFollowsImportTask(a.config, a.db, user.Username, req.Feed, feeds))
+		if err != nil {
+			log.WithError(err).Errorf("error dispatching follows import task for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		uri := URI{Type: "taskURI", Path: URLForTask(a.config.BaseURL, uuid)}
+
+		data, err := json.Marshal(uri)
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write(data)
+	}
+}
+
+// ExportFollowsEndpoint returns the feeds the user, or a feed they own,
+// follows as OPML or as
+// twtxt `# follow = nick url` lines
+func (a *API) ExportFollowsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		format := strings.ToLower(r.FormValue("format"))
+		if format == "" {
+			format = FollowsFormatOPML
+		}
+
+		name := user.Username
+		if feed := r.FormValue("feed"); feed != "" {
+			name = feed
+		}
+
+		from, err := GetFollowsImporter(a.db, user, name)
+		if err != nil {
+			log.WithError(err).Errorf("error exporting follows of %s", name)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		data, err := ExportFollowsOf(a.config, from, format)
+		if err != nil {
+			log.WithError(err).Errorf("error exporting follows for %s", user.Username)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if format == FollowsFormatOPML {
+			w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+// ExportDataEndpoint dispatches an ExportTask and returns the task's URI
+// whose data contains the exportID to download once it is complete
+func (a *API) ExportDataEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		uuid, err := a.tasks.Dispatch(NewExportTask(a.config, a.db, user.Username))
+		if err != nil {
+			log.WithError(err).Errorf("error dispatching export task for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		uri := URI{Type: "taskURI", Path: URLForTask(a.config.BaseURL, uuid)}
+
+		data, err := json.Marshal(uri)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write(data)
+	}
+}
+
+// DownloadExportEndpoint downloads a completed export archive by its id
+func (a *API) DownloadExportEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		id := p.ByName("id")
+		if id == "" || filepath.Base(id) != id || id[0] == '.' {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		fn := ExportPath(a.config, user.Username, id)
+		if !FileExists(fn) {
+			log.WithError(ErrExportNotFound).Warnf("no export %s for %s", id, user.Username)
+			http.Error(w, "Export Not Found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeFile(w, r, fn)
+	}
+}
+
 // UnfollowEndpoint ...
 func (a *API) UnfollowEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -731,18 +1013,6 @@ func (a *API) UnfollowEndpoint() httprouter.Handle {
 						log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
 					}
 				}
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(a.config, followee.Username),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
 			}
 		}
 
@@ -762,7 +1032,14 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 		user := r.Context().Value(UserContextKey).(*User)
 
 		if r.Method == http.MethodGet {
-			data, err := json.Marshal(user)
+			// Never hand out the user's password hash or two-factor
+			// authentication secrets, third-party apps may read settings
+			settings := *user
+			settings.Password = ""
+			settings.TOTPSecret = ""
+			settings.TOTPRecoveryCodes = nil
+
+			data, err := json.Marshal(settings)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -842,6 +1119,64 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 	}
 }
 
+// FeedSettingsEndpoint returns or updates the profile of a feed the user
+// is a member of, updating requires a role permitting it
+func (a *API) FeedSettingsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, a.config.MaxUploadSize)
+		defer r.Body.Close()
+
+		user := r.Context().Value(UserContextKey).(*User)
+
+		feed, err := a.db.GetFeed(NormalizeFeedName(p.ByName("name")))
+		if err != nil {
+			if err == ErrFeedNotFound {
+				http.Error(w, "Feed not found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Error("error loading feed object")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if feed.Role(user) == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if !feed.Can(user, FeedActionUpdate) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if err := UpdateFeedProfile(a.config, feed, r); err != nil {
+				log.WithError(err).Errorf("error updating profile of feed %s", feed.Name)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			feed.AddAuditEntry(user.Username, FeedActionUpdate, "")
+
+			if err := a.db.SetFeed(feed.Name, feed); err != nil {
+				log.WithError(err).Error("error updating feed object")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		data, err := json.Marshal(feed.Profile(a.config.BaseURL, user))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
 // OldUploadMediaEndpoint ...
 // TODO: Remove when the api_old_upload_media counter nears zero
 // XXX: Used for Goryon < v1.0.3
@@ -1045,6 +1380,9 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 		profileResponse := types.ProfileResponse{}
 
 		profileResponse.Profile = profile
+		profileResponse.PinnedTwts = a.formatTwtText(
+			FilterTwts(loggedInUser, GetPinnedTwts(a.cache, a.archive, profile.Pinned)),
+		)
 
 		profileResponse.Links = types.Links{types.Link{
 			Href: fmt.Sprintf("%s/webmention", UserURL(profile.URL)),
@@ -1057,6 +1395,11 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 				Title: fmt.Sprintf("%s local feed", a.config.Name),
 				URL:   fmt.Sprintf("%s/atom.xml", a.config.BaseURL),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s local JSON feed", a.config.Name),
+				URL:   fmt.Sprintf("%s/feed.json", a.config.BaseURL),
+			},
 			types.Alternative{
 				Type:  "text/plain",
 				Title: fmt.Sprintf("%s's Twtxt Feed", profile.Username),
@@ -1067,6 +1410,11 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 				Title: fmt.Sprintf("%s's Atom Feed", profile.Username),
 				URL:   fmt.Sprintf("%s/atom.xml", UserURL(profile.URL)),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s's JSON Feed", profile.Username),
+				URL:   fmt.Sprintf("%s/feed.json", UserURL(profile.URL)),
+			},
 		}
 
 		profileResponse.Twter = types.Twter{
@@ -1161,6 +1509,7 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 				MaxPages:  pager.PageNums(),
 				TotalTwts: pager.Nums(),
 			},
+			Warnings: FilterWarnings(loggedInUser, pagedTwts),
 		}
 
 		data, err := json.Marshal(res)
@@ -1245,6 +1594,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 				MaxPages:  pager.PageNums(),
 				TotalTwts: pager.Nums(),
 			},
+			Warnings: FilterWarnings(loggedInUser, pagedTwts),
 		}
 
 		data, err := json.Marshal(res)
@@ -1379,33 +1729,146 @@ func (a *API) UnmuteEndpoint() httprouter.Handle {
 	}
 }
 
-// SupportEndpoint ...
-func (a *API) SupportEndpoint() httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		req, err := types.NewSupportRequest(r.Body)
+// BookmarksEndpoint ...
+func (a *API) BookmarksEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewPagedRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing support request")
+			log.WithError(err).Error("error parsing bookmarks request")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		name := req.Name
-		email := req.Email
-		subject := req.Subject
-		message := req.Message
+		twts := GetBookmarkedTwts(a.cache, a.archive, user)
 
-		if err := SendSupportRequestEmail(a.config, name, email, subject, message); err != nil {
-			log.WithError(err).Errorf("unable to send support email for %s", email)
-			log.WithError(err).Error("error sending support request")
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error loading bookmarks")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		log.Infof("support message email sent for %s", email)
+		res := types.PagedResponse{
+			Twts: a.formatTwtText(FilterTwts(user, pagedTwts)),
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+			Warnings: FilterWarnings(user, pagedTwts),
+		}
 
-		// No real response
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write([]byte(`{}`))
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// BookmarkEndpoint ...
+func (a *API) BookmarkEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewBookmarkRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing bookmark request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		hash := strings.TrimSpace(req.Hash)
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := BookmarkTwt(a.cache, a.archive, a.db, user, hash); err != nil {
+			if err == ErrTwtNotFound {
+				http.Error(w, "Twt Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Errorf("error bookmarking twt %s", hash)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// UnbookmarkEndpoint ...
+func (a *API) UnbookmarkEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewBookmarkRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing unbookmark request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		hash := strings.TrimSpace(req.Hash)
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user.Unbookmark(hash)
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Error("error updating user object")
+			http.Error(w, "User Update Failed", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// SupportEndpoint ...
+func (a *API) SupportEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		req, err := types.NewSupportRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing support request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		name := req.Name
+		email := req.Email
+		subject := req.Subject
+		message := req.Message
+
+		if err := SendSupportRequestEmail(a.config, name, email, subject, message); err != nil {
+			log.WithError(err).Errorf("unable to send support email for %s", email)
+			log.WithError(err).Error("error sending support request")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Infof("support message email sent for %s", email)
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
 
 	}
 }
@@ -1460,3 +1923,672 @@ func (a *API) PodConfigEndpoint() httprouter.Handle {
 		_, _ = w.Write(data)
 	}
 }
+
+// ListsEndpoint ...
+func (a *API) ListsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		lists, err := a.db.GetUserLists(user.Username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading lists for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.ListsResponse{Lists: []types.List{}}
+		for _, list := range lists {
+			res.Lists = append(res.Lists, types.List{
+				Name:  list.Name,
+				Owner: list.Owner,
+				URL:   URLForList(a.config.BaseURL, list.Owner, list.Name),
+				Feeds: list.Feeds,
+			})
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// ListTimelineEndpoint ...
+func (a *API) ListTimelineEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewPagedRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing post request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		name := NormalizeFeedName(p.ByName("name"))
+
+		list, err := a.db.GetList(user.Username, name)
+		if err != nil {
+			if err == ErrListNotFound {
+				http.Error(w, "List Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Errorf("error loading list %s for %s", name, user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		twts := GetListTwts(a.cache, list)
+
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error loading list timeline")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.PagedResponse{
+			Twts: a.formatTwtText(FilterTwts(user, pagedTwts)),
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+			Warnings: FilterWarnings(user, pagedTwts),
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// FiltersEndpoint ...
+func (a *API) FiltersEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		res := types.FiltersResponse{Filters: []types.Filter{}}
+		for _, filter := range user.Filters {
+			res.Filters = append(res.Filters, types.Filter{
+				ID:        filter.ID,
+				Type:      filter.Type,
+				Value:     filter.Value,
+				Action:    filter.Action,
+				ExpiresAt: filter.ExpiresAt,
+			})
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// AddFilterEndpoint ...
+func (a *API) AddFilterEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewFilterRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing filter request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		expiry, err := ParseFilterExpiry(req.Expires)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := NewMuteFilter(req.Type, req.Value, req.Action, expiry)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user.AddFilter(filter)
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating user object for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// RemoveFilterEndpoint ...
+func (a *API) RemoveFilterEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewFilterRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing filter request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := user.RemoveFilter(req.ID); err != nil {
+			http.Error(w, "Filter Not Found", http.StatusNotFound)
+			return
+		}
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating user object for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// FollowTagEndpoint ...
+func (a *API) FollowTagEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewTagRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing tag request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if NormalizeTag(req.Tag) == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user.FollowTag(req.Tag)
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Error("error updating user object")
+			http.Error(w, "User Update Failed", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// UnfollowTagEndpoint ...
+func (a *API) UnfollowTagEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewTagRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing tag request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if NormalizeTag(req.Tag) == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user.UnfollowTag(req.Tag)
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Error("error updating user object")
+			http.Error(w, "User Update Failed", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// ReadMarkersEndpoint ...
+func (a *API) ReadMarkersEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		names := []string{TimelineReadMarker, MentionsReadMarker}
+
+		lists, err := a.db.GetUserLists(user.Username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading lists for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, list := range lists {
+			names = append(names, ListReadMarker(list.Name))
+		}
+
+		res := types.ReadMarkersResponse{Markers: []types.ReadMarker{}}
+
+		for _, name := range names {
+			twts, err := GetReadMarkerTwts(a.cache, a.db, user, name)
+			if err != nil {
+				log.WithError(err).Errorf("error loading twts for %s read marker", name)
+				continue
+			}
+
+			marker := user.GetReadMarker(name)
+			res.Markers = append(res.Markers, types.ReadMarker{
+				Name:      name,
+				Hash:      marker.Hash,
+				Timestamp: marker.Timestamp,
+				Unread:    CountUnread(FilterTwts(user, twts), marker),
+			})
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// AdvanceReadMarkerEndpoint ...
+func (a *API) AdvanceReadMarkerEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewReadMarkerRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing read marker request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if !IsValidReadMarker(a.db, user, req.Name) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var twt types.Twt = types.NilTwt
+
+		if req.Hash == "" {
+			// Without a hash mark everything in the timeline as read
+			twts, err := GetReadMarkerTwts(a.cache, a.db, user, req.Name)
+			if err != nil {
+				log.WithError(err).Errorf("error loading twts for %s read marker", req.Name)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if len(twts) > 0 {
+				twt = twts[0]
+			}
+		} else {
+			twt, err = GetTwtByHash(a.cache, a.archive, req.Hash)
+			if err != nil {
+				log.WithError(err).Errorf("error loading twt %s", req.Hash)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if twt.IsZero() {
+				http.Error(w, "Twt Not Found", http.StatusNotFound)
+				return
+			}
+		}
+
+		if user.MarkRead(req.Name, twt) {
+			if err := a.db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Error("error updating user object")
+				http.Error(w, "User Update Failed", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// NotificationsEndpoint ...
+func (a *API) NotificationsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		req, err := types.NewPagedRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing post request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user := r.Context().Value(UserContextKey).(*User)
+
+		notifications, err := GetNotifications(a.db, user.Username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading notifications for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var pagedNotifications Notifications
+
+		pager := paginator.New(adapter.NewSliceAdapter(notifications), a.config.TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedNotifications); err != nil {
+			log.WithError(err).Error("error paging notifications")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.NotificationsResponse{
+			Notifications: []types.Notification{},
+			Unread:        notifications.Unread(),
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+		}
+
+		for _, n := range pagedNotifications {
+			res.Notifications = append(res.Notifications, types.Notification{
+				ID:        n.ID,
+				Type:      n.Type,
+				From:      n.From,
+				FromURL:   n.FromURL,
+				Target:    n.Target,
+				Hash:      n.Hash,
+				Text:      n.String(),
+				CreatedAt: n.CreatedAt,
+				Read:      n.Read,
+			})
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// MarkNotificationsReadEndpoint ...
+func (a *API) MarkNotificationsReadEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		req, err := types.NewNotificationRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing notification request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if err := MarkNotificationsRead(a.db, user.Username, req.ID); err != nil {
+			if err == ErrNotificationNotFound {
+				http.Error(w, "Notification Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Errorf("error marking notifications read for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// writeOAuthError writes an OAuth2 error response as defined by RFC 6749
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	body, err := types.OAuthErrorResponse{Error: code, Description: description}.Bytes()
+	if err != nil {
+		log.WithError(err).Error("error serializing response")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// oauthClient authenticates the app making a request to the OAuth2
+// endpoints with HTTP Basic auth or client_id (and client_secret) params
+func (a *API) oauthClient(r *http.Request) (*OAuthApp, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.FormValue("client_id")
+		secret = r.FormValue("client_secret")
+	}
+
+	app, err := a.db.GetOAuthApp(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !app.CheckSecret(secret) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return app, nil
+}
+
+// oauthUser loads the user a code or token was issued to, following their
+// renames
+func (a *API) oauthUser(claims jwt.MapClaims) (*User, error) {
+	username, _ := claims["username"].(string)
+	if !a.db.HasUser(username) {
+		if resolved, ok := ResolveAlias(a.db, username); ok {
+			username = resolved
+		}
+	}
+	return a.db.GetUser(username)
+}
+
+// OAuthTokenEndpoint exchanges an authorization code (with its PKCE code
+// verifier) or a refresh token for a new access token and refresh token.
+// Refresh tokens are rotated, the old one stops working once used.
+func (a *API) OAuthTokenEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		app, err := a.oauthClient(r)
+		if err != nil {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client or invalid client secret")
+			return
+		}
+
+		var (
+			user    *User
+			grantID string
+			scopes  []string
+		)
+
+		switch r.FormValue("grant_type") {
+		case "authorization_code":
+			_, claims, err := ParseOAuthToken(a.config, r.FormValue("code"), oauthTokenCode)
+			if err != nil {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+				return
+			}
+
+			// Authorization codes may only be used once, used codes are
+			// kept until they expire so a restart doesn't forget them
+			jti, _ := claims["jti"].(string)
+			exp, _ := claims["exp"].(float64)
+			if jti == "" {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+				return
+			}
+
+			used, err := a.db.UseOAuthCode(jti, time.Unix(int64(exp), 0))
+			if err != nil {
+				log.WithError(err).Error("error recording used authorization code")
+				writeOAuthError(w, http.StatusInternalServerError, "server_error", "error exchanging authorization code")
+				return
+			}
+			if used {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code already used")
+				return
+			}
+
+			challenge, _ := claims["code_challenge"].(string)
+			if claims["client_id"] != app.ClientID || claims["redirect_uri"] != r.FormValue("redirect_uri") {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client or redirect uri")
+				return
+			}
+			if !VerifyCodeChallenge(challenge, r.FormValue("code_verifier")) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid code verifier")
+				return
+			}
+
+			if user, err = a.oauthUser(claims); err != nil {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "user not found")
+				return
+			}
+
+			scope, _ := claims["scope"].(string)
+			grantID = GenerateRandomToken()
+			scopes = strings.Fields(scope)
+		case "refresh_token":
+			token, claims, err := ParseOAuthToken(a.config, r.FormValue("refresh_token"), oauthTokenRefresh)
+			if err != nil {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+				return
+			}
+
+			refresh, err := a.db.GetToken(token.Signature)
+			if err != nil || refresh.ClientID != app.ClientID {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token revoked or issued to another client")
+				return
+			}
+
+			if user, err = a.oauthUser(claims); err != nil {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "user not found")
+				return
+			}
+
+			grantID = refresh.GrantID
+			scopes = refresh.Scopes
+
+			// Apps may ask for fewer scopes than they were granted
+			if scope := r.FormValue("scope"); scope != "" {
+				requested, err := ParseScopes(scope)
+				if err != nil {
+					writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "")
+					return
+				}
+				for _, s := range requested {
+					if !HasString(scopes, s) {
+						writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope was not granted")
+						return
+					}
+				}
+				scopes = requested
+			}
+
+			if err := RevokeTokens(a.db, user, func(t *Token) bool { return t.GrantID == grantID }); err != nil {
+				log.WithError(err).Errorf("error revoking tokens for %s", user.Username)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		default:
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+			return
+		}
+
+		access, refresh, err := IssueOAuthTokens(a.config, a.db, user, app, grantID, scopes, r.UserAgent())
+		if err != nil {
+			log.WithError(err).Errorf("error issuing tokens for %s to %s", user.Username, app.ClientID)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.OAuthTokenResponse{
+			AccessToken:  access.Value,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(oauthAccessTokenExpiry.Seconds()),
+			RefreshToken: refresh.Value,
+			Scope:        strings.Join(scopes, " "),
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(body)
+	}
+}
+
+// OAuthRevokeEndpoint revokes an access token or refresh token (and with
+// it the rest of its grant) as defined by RFC 7009
+func (a *API) OAuthRevokeEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		app, err := a.oauthClient(r)
+		if err != nil {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client or invalid client secret")
+			return
+		}
+
+		value := r.FormValue("token")
+
+		token, claims, err := ParseOAuthToken(a.config, value, oauthTokenRefresh)
+		if err != nil {
+			token, claims, err = ParseOAuthToken(a.config, value, oauthTokenAccess)
+		}
+
+		// Invalid tokens need no revoking
+		if err == nil {
+			if tkn, err := a.db.GetToken(token.Signature); err == nil && tkn.ClientID == app.ClientID {
+				if user, err := a.oauthUser(claims); err == nil {
+					if err := RevokeTokens(a.db, user, func(t *Token) bool { return t.GrantID == tkn.GrantID }); err != nil {
+						log.WithError(err).Errorf("error revoking tokens for %s", user.Username)
+						http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+						return
+					}
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
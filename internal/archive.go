@@ -36,6 +36,17 @@ type Archiver interface {
 	Count() (int, error)
 }
 
+// EnsureArchived archives the twt if it is not already in the archive.
+func EnsureArchived(archive Archiver, twt types.Twt) error {
+	if archive.Has(twt.Hash()) {
+		return nil
+	}
+	if err := archive.Archive(twt); err != nil && err != ErrTwtAlreadyArchived {
+		return err
+	}
+	return nil
+}
+
 // NullArchiver implements Archiver using dummy implementation stubs
 type NullArchiver struct{}
 
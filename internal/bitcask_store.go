@@ -2,7 +2,10 @@ package internal
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prologic/bitcask"
 	log "github.com/sirupsen/logrus"
@@ -11,15 +14,35 @@ import (
 )
 
 const (
-	feedsKeyPrefix    = "/feeds"
-	sessionsKeyPrefix = "/sessions"
-	usersKeyPrefix    = "/users"
-	tokensKeyPrefix   = "/tokens"
+	aliasesKeyPrefix       = "/aliases"
+	apFollowersKeyPrefix   = "/apfollowers"
+	apRetriesKeyPrefix     = "/apretries"
+	feedsKeyPrefix         = "/feeds"
+	listsKeyPrefix         = "/lists"
+	notificationsKeyPrefix = "/notifications"
+	oauthAppsKeyPrefix     = "/oauthapps"
+	oauthCodesKeyPrefix    = "/oauthcodes"
+	sessionsKeyPrefix      = "/sessions"
+	usersKeyPrefix         = "/users"
+	tokensKeyPrefix        = "/tokens"
+	webhooksKeyPrefix      = "/webhooks"
+	webmentionsKeyPrefix   = "/webmentions"
 )
 
 // BitcaskStore ...
 type BitcaskStore struct {
 	db *bitcask.Bitcask
+
+	// unreadMu guards unread which counts each user's unread notifications
+	// so they don't have to be scanned for on every page load. A user's
+	// count is loaded on first use and kept up to date as their
+	// notifications are stored and deleted.
+	unreadMu sync.Mutex
+	unread   map[string]int
+
+	// oauthCodesMu makes checking and recording a used authorization code
+	// atomic so a code can't be exchanged twice by concurrent requests
+	oauthCodesMu sync.Mutex
 }
 
 func newBitcaskStore(path string) (*BitcaskStore, error) {
@@ -31,7 +54,7 @@ func newBitcaskStore(path string) (*BitcaskStore, error) {
 		return nil, err
 	}
 
-	return &BitcaskStore{db: db}, nil
+	return &BitcaskStore{db: db, unread: make(map[string]int)}, nil
 }
 
 // Sync ...
@@ -150,6 +173,481 @@ func (bs *BitcaskStore) GetAllFeeds() ([]*Feed, error) {
 	return feeds, nil
 }
 
+func (bs *BitcaskStore) HasList(owner, name string) bool {
+	key := []byte(fmt.Sprintf("%s/%s/%s", listsKeyPrefix, owner, name))
+	return bs.db.Has(key)
+}
+
+func (bs *BitcaskStore) DelList(owner, name string) error {
+	key := []byte(fmt.Sprintf("%s/%s/%s", listsKeyPrefix, owner, name))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetList(owner, name string) (*List, error) {
+	key := []byte(fmt.Sprintf("%s/%s/%s", listsKeyPrefix, owner, name))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadList(data)
+}
+
+func (bs *BitcaskStore) SetList(owner, name string, list *List) error {
+	data, err := list.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s/%s", listsKeyPrefix, owner, name))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) LenLists() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(listsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) getLists(prefix string) ([]*List, error) {
+	var lists []*List
+
+	err := bs.db.Scan([]byte(prefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		list, err := LoadList(data)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, list)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (bs *BitcaskStore) GetUserLists(owner string) ([]*List, error) {
+	return bs.getLists(fmt.Sprintf("%s/%s/", listsKeyPrefix, owner))
+}
+
+func (bs *BitcaskStore) GetAllLists() ([]*List, error) {
+	return bs.getLists(listsKeyPrefix)
+}
+
+func (bs *BitcaskStore) DelNotification(username, id string) error {
+	bs.unreadMu.Lock()
+	defer bs.unreadMu.Unlock()
+
+	old, err := bs.GetNotification(username, id)
+	if err != nil && err != ErrNotificationNotFound {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s/%s", notificationsKeyPrefix, username, id))
+	if err := bs.db.Delete(key); err != nil {
+		return err
+	}
+
+	if old != nil && !old.Read {
+		bs.adjustUnread(username, -1)
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) GetNotification(username, id string) (*Notification, error) {
+	key := []byte(fmt.Sprintf("%s/%s/%s", notificationsKeyPrefix, username, id))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadNotification(data)
+}
+
+func (bs *BitcaskStore) SetNotification(username, id string, n *Notification) error {
+	data, err := n.Bytes()
+	if err != nil {
+		return err
+	}
+
+	bs.unreadMu.Lock()
+	defer bs.unreadMu.Unlock()
+
+	old, err := bs.GetNotification(username, id)
+	if err != nil && err != ErrNotificationNotFound {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s/%s", notificationsKeyPrefix, username, id))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+
+	wasUnread := old != nil && !old.Read
+	switch {
+	case wasUnread && n.Read:
+		bs.adjustUnread(username, -1)
+	case !wasUnread && !n.Read:
+		bs.adjustUnread(username, 1)
+	}
+	return nil
+}
+
+// adjustUnread adjusts the user's unread notifications count if it has been
+// loaded, unreadMu must be held.
+func (bs *BitcaskStore) adjustUnread(username string, delta int) {
+	if count, ok := bs.unread[username]; ok {
+		bs.unread[username] = count + delta
+	}
+}
+
+// CountUnreadNotifications returns the number of the user's unread
+// notifications
+func (bs *BitcaskStore) CountUnreadNotifications(username string) int {
+	bs.unreadMu.Lock()
+	defer bs.unreadMu.Unlock()
+
+	if count, ok := bs.unread[username]; ok {
+		return count
+	}
+
+	notifications, err := bs.GetUserNotifications(username)
+	if err != nil {
+		log.WithError(err).Warnf("error loading notifications for %s", username)
+		return 0
+	}
+
+	count := Notifications(notifications).Unread()
+	bs.unread[username] = count
+	return count
+}
+
+func (bs *BitcaskStore) LenNotifications() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(notificationsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetUserNotifications(username string) ([]*Notification, error) {
+	var notifications []*Notification
+
+	prefix := fmt.Sprintf("%s/%s/", notificationsKeyPrefix, username)
+	err := bs.db.Scan([]byte(prefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		n, err := LoadNotification(data)
+		if err != nil {
+			return err
+		}
+		notifications = append(notifications, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (bs *BitcaskStore) DelWebhook(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", webhooksKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetWebhook(id string) (*Webhook, error) {
+	key := []byte(fmt.Sprintf("%s/%s", webhooksKeyPrefix, id))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadWebhook(data)
+}
+
+func (bs *BitcaskStore) SetWebhook(id string, hook *Webhook) error {
+	data, err := hook.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", webhooksKeyPrefix, id))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) LenWebhooks() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(webhooksKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetAllWebhooks() ([]*Webhook, error) {
+	var hooks []*Webhook
+
+	err := bs.db.Scan([]byte(webhooksKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		hook, err := LoadWebhook(data)
+		if err != nil {
+			return err
+		}
+		hooks = append(hooks, hook)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (bs *BitcaskStore) DelWebMention(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", webmentionsKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetWebMention(id string) (*IncomingWebMention, error) {
+	key := []byte(fmt.Sprintf("%s/%s", webmentionsKeyPrefix, id))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrWebMentionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadIncomingWebMention(data)
+}
+
+func (bs *BitcaskStore) SetWebMention(id string, m *IncomingWebMention) error {
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", webmentionsKeyPrefix, id))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) LenWebMentions() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(webmentionsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetAllWebMentions() ([]*IncomingWebMention, error) {
+	var mentions []*IncomingWebMention
+
+	err := bs.db.Scan([]byte(webmentionsKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		m, err := LoadIncomingWebMention(data)
+		if err != nil {
+			return err
+		}
+		mentions = append(mentions, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+func (bs *BitcaskStore) DelActivityPubFollower(name, id string) error {
+	key := []byte(fmt.Sprintf("%s/%s/%s", apFollowersKeyPrefix, name, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) SetActivityPubFollower(name, id string, f *ActivityPubFollower) error {
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s/%s", apFollowersKeyPrefix, name, id))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) LenActivityPubFollowers() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(apFollowersKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetActivityPubFollowers(name string) ([]*ActivityPubFollower, error) {
+	var followers []*ActivityPubFollower
+
+	prefix := fmt.Sprintf("%s/%s/", apFollowersKeyPrefix, name)
+	err := bs.db.Scan([]byte(prefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		f, err := LoadActivityPubFollower(data)
+		if err != nil {
+			return err
+		}
+		followers = append(followers, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return followers, nil
+}
+
+func (bs *BitcaskStore) DelActivityPubRetry(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", apRetriesKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) SetActivityPubRetry(id string, r *ActivityPubRetry) error {
+	data, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", apRetriesKeyPrefix, id))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BitcaskStore) GetActivityPubRetries() ([]*ActivityPubRetry, error) {
+	var retries []*ActivityPubRetry
+
+	err := bs.db.Scan([]byte(apRetriesKeyPrefix+"/"), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		r, err := LoadActivityPubRetry(data)
+		if err != nil {
+			return err
+		}
+		retries = append(retries, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return retries, nil
+}
+
+func (bs *BitcaskStore) HasAlias(name string) bool {
+	key := []byte(fmt.Sprintf("%s/%s", aliasesKeyPrefix, name))
+	return bs.db.Has(key)
+}
+
+func (bs *BitcaskStore) DelAlias(name string) error {
+	key := []byte(fmt.Sprintf("%s/%s", aliasesKeyPrefix, name))
+	return bs.db.Delete(key)
+}
+
+// GetAlias returns the username a previous username is an alias of
+func (bs *BitcaskStore) GetAlias(name string) (string, error) {
+	key := []byte(fmt.Sprintf("%s/%s", aliasesKeyPrefix, name))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return "", ErrAliasNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (bs *BitcaskStore) SetAlias(name, username string) error {
+	key := []byte(fmt.Sprintf("%s/%s", aliasesKeyPrefix, name))
+	return bs.db.Put(key, []byte(username))
+}
+
+func (bs *BitcaskStore) LenAliases() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(aliasesKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
 func (bs *BitcaskStore) HasUser(username string) bool {
 	key := []byte(fmt.Sprintf("%s/%s", usersKeyPrefix, username))
 	return bs.db.Has(key)
@@ -316,10 +814,128 @@ func (bs *BitcaskStore) GetAllSessions() ([]*session.Session, error) {
 	return sessions, nil
 }
 
+func (bs *BitcaskStore) DelOAuthApp(clientID string) error {
+	key := []byte(fmt.Sprintf("%s/%s", oauthAppsKeyPrefix, clientID))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetOAuthApp(clientID string) (*OAuthApp, error) {
+	key := []byte(fmt.Sprintf("%s/%s", oauthAppsKeyPrefix, clientID))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrOAuthAppNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadOAuthApp(data)
+}
+
+func (bs *BitcaskStore) SetOAuthApp(clientID string, app *OAuthApp) error {
+	data, err := app.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", oauthAppsKeyPrefix, clientID))
+	if err := bs.db.Put(key, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseOAuthCode records the authorization code with the given jti as used
+// until it expires and returns true if it had already been used
+func (bs *BitcaskStore) UseOAuthCode(jti string, expiresAt time.Time) (bool, error) {
+	bs.oauthCodesMu.Lock()
+	defer bs.oauthCodesMu.Unlock()
+
+	key := []byte(fmt.Sprintf("%s/%s", oauthCodesKeyPrefix, jti))
+	if bs.db.Has(key) {
+		return true, nil
+	}
+
+	if err := bs.db.Put(key, []byte(strconv.FormatInt(expiresAt.Unix(), 10))); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// DelExpiredOAuthCodes forgets used authorization codes that have expired
+// and can no longer be exchanged anyway
+func (bs *BitcaskStore) DelExpiredOAuthCodes() error {
+	var expired [][]byte
+
+	now := time.Now().Unix()
+	err := bs.db.Scan([]byte(oauthCodesKeyPrefix+"/"), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		expiresAt, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil || expiresAt < now {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		if err := bs.db.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bs *BitcaskStore) LenOAuthApps() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(oauthAppsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetAllOAuthApps() ([]*OAuthApp, error) {
+	var apps []*OAuthApp
+
+	err := bs.db.Scan([]byte(oauthAppsKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		app, err := LoadOAuthApp(data)
+		if err != nil {
+			return err
+		}
+		apps = append(apps, app)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return apps, nil
+}
+
 func (bs *BitcaskStore) GetUserTokens(user *User) ([]*Token, error) {
 	tokens := []*Token{}
 	for _, signature := range user.Tokens {
 		tkn, err := bs.GetToken(signature)
+		if err == ErrTokenNotFound {
+			// Deleted or revoked
+			continue
+		}
 		if err != nil {
 			return tokens, err
 		}
@@ -117,8 +117,15 @@ func (s *Server) BlogHandler() httprouter.Handle {
 				Title: fmt.Sprintf("%s's Atom Feed", blogPost.Author),
 				URL:   fmt.Sprintf("%s/atom.xml", UserURL(URLForUser(s.config, blogPost.Author))),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s's JSON Feed", blogPost.Author),
+				URL:   fmt.Sprintf("%s/feed.json", UserURL(URLForUser(s.config, blogPost.Author))),
+			},
 		}...)
 
+		ctx.WebMentions = GetApprovedWebMentions(s.db, blogPost.Hash())
+
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
@@ -244,6 +251,11 @@ func (s *Server) BlogsHandler() httprouter.Handle {
 				Title: fmt.Sprintf("%s's Atom Feed", profile.Username),
 				URL:   fmt.Sprintf("%s/atom.xml", UserURL(profile.URL)),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s's JSON Feed", profile.Username),
+				URL:   fmt.Sprintf("%s/feed.json", UserURL(profile.URL)),
+			},
 		}...)
 
 		blogPosts, err := GetBlogPostsByAuthor(s.config, author)
@@ -361,10 +373,17 @@ func (s *Server) PublishBlogHandler() httprouter.Handle {
 		case "", user.Username:
 			blogPost, err = WriteBlog(s.config, user, title, text)
 		default:
-			if user.OwnsFeed(postas) {
-				blogPost, err = WriteBlogAs(s.config, postas, title, text)
-			} else {
+			var feed *Feed
+			if feed, err = s.db.GetFeed(postas); err != nil || !feed.Can(user, FeedActionBlog) {
 				err = ErrFeedImposter
+				break
+			}
+
+			if blogPost, err = WriteBlogAs(s.config, postas, title, text); err == nil {
+				feed.AddAuditEntry(user.Username, FeedActionBlog, blogPost.Hash())
+				if err := s.db.SetFeed(feed.Name, feed); err != nil {
+					log.WithError(err).Warnf("error recording blog post by %s to feed %s", user.Username, feed.Name)
+				}
 			}
 		}
 
@@ -378,10 +397,14 @@ func (s *Server) PublishBlogHandler() httprouter.Handle {
 
 		twtText := fmt.Sprintf("[%s](%s)", blogPost.Title, blogPost.URL(s.config.BaseURL))
 
+		var twt types.Twt
+
+		name := user.Username
 		if postas == "" || postas == user.Username {
-			_, err = AppendTwt(s.config, s.db, user, twtText)
+			twt, err = AppendTwt(s.config, s.db, user, twtText)
 		} else {
-			_, err = AppendSpecial(s.config, s.db, postas, twtText)
+			name = postas
+			twt, err = AppendSpecial(s.config, s.db, postas, twtText)
 		}
 		if err != nil {
 			log.WithError(err).Error("error posting blog post twt")
@@ -391,9 +414,13 @@ func (s *Server) PublishBlogHandler() httprouter.Handle {
 			return
 		}
 
+		s.hooks.Run(name, twt)
+
 		// Update blogs cache
 		s.blogs.Add(blogPost)
 
+		s.webhooks.FireBlog(blogPost, user.Username)
+
 		// Update user's own timeline with their own new post.
 		s.cache.FetchTwts(s.config, s.archive, user.Source(), nil)
 
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// GetTwtByHash looks up a twt by its hash first in the cache and then
+// falling back to the archive. Returns types.NilTwt if not found.
+func GetTwtByHash(cache *Cache, archive Archiver, hash string) (types.Twt, error) {
+	if twt, ok := cache.Lookup(hash); ok {
+		return twt, nil
+	}
+
+	if archive.Has(hash) {
+		return archive.Get(hash)
+	}
+
+	return types.NilTwt, nil
+}
+
+// BookmarkTwt adds the twt identified by hash to the user's bookmarks and
+// pins the twt into the archive so it survives cache eviction.
+func BookmarkTwt(cache *Cache, archive Archiver, db Store, user *User, hash string) error {
+	twt, err := GetTwtByHash(cache, archive, hash)
+	if err != nil {
+		return err
+	}
+	if twt.IsZero() {
+		return ErrTwtNotFound
+	}
+
+	if err := EnsureArchived(archive, twt); err != nil {
+		return err
+	}
+
+	user.Bookmark(twt.Hash(), twt.Twter().URL)
+
+	return db.SetUser(user.Username, user)
+}
+
+// GetBookmarkedTwts returns all of the user's bookmarked twts sorted by
+// their created timestamp. Bookmarks whose twts can no longer be found are
+// skipped.
+func GetBookmarkedTwts(cache *Cache, archive Archiver, user *User) (twts types.Twts) {
+	for hash := range user.Bookmarks {
+		twt, err := GetTwtByHash(cache, archive, hash)
+		if err != nil {
+			log.WithError(err).Warnf("error loading bookmarked twt %s", hash)
+			continue
+		}
+		if twt.IsZero() {
+			continue
+		}
+		twts = append(twts, twt)
+	}
+
+	sort.Sort(twts)
+
+	return
+}
+
+// BookmarkHandler ...
+func (s *Server) BookmarkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		hash := strings.TrimSpace(r.FormValue("hash"))
+		if hash == "" {
+			ctx.Error = true
+			ctx.Message = "No twt specified to bookmark"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		if user.Bookmarked(hash) {
+			user.Unbookmark(hash)
+
+			if err := s.db.SetUser(ctx.Username, user); err != nil {
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error removing bookmark for twt %s", hash)
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.Error = false
+			ctx.Message = fmt.Sprintf("Successfully removed bookmark for twt %s", hash)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := BookmarkTwt(s.cache, s.archive, s.db, user, hash); err != nil {
+			log.WithError(err).Errorf("error bookmarking twt %s", hash)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error bookmarking twt %s", hash)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully bookmarked twt %s", hash)
+		s.render("error", w, ctx)
+	}
+}
+
+// BookmarksHandler ...
+func (s *Server) BookmarksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		twts := GetBookmarkedTwts(s.cache, s.archive, ctx.User)
+
+		var pagedTwts types.Twts
+
+		page := SafeParseInt(r.FormValue("p"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error sorting and paging twts")
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading bookmarks"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = "Bookmarks"
+		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
+		ctx.Pager = &pager
+		s.render("bookmarks", w, ctx)
+	}
+}
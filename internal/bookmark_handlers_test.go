@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestBookmarkTwt(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-bookmarks")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	archive, err := NewDiskArchiver(filepath.Join(data, archiveDir))
+	require.NoError(t, err)
+
+	twter := types.Twter{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"}
+	now := time.Now()
+	older := retwt.NewReTwt(twter, "older", now.Add(-time.Hour))
+	newer := retwt.NewReTwt(twter, "newer", now)
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.Twts[twter.URL] = &Cached{
+		cache: make(map[string]types.Twt),
+		Twts:  types.Twts{newer, older},
+	}
+
+	user := NewUser()
+	user.Username = "alice"
+	require.NoError(t, db.SetUser("alice", user))
+
+	assert.Equal(t, ErrTwtNotFound, BookmarkTwt(cache, archive, db, user, "unknown"))
+
+	require.NoError(t, BookmarkTwt(cache, archive, db, user, older.Hash()))
+	require.NoError(t, BookmarkTwt(cache, archive, db, user, newer.Hash()))
+
+	// Bookmarked twts are pinned into the archive
+	assert.True(t, archive.Has(older.Hash()))
+	assert.True(t, archive.Has(newer.Hash()))
+
+	saved, err := db.GetUser("alice")
+	require.NoError(t, err)
+	assert.True(t, saved.Bookmarked(older.Hash()))
+	assert.Equal(t, twter.URL, saved.Bookmarks[older.Hash()])
+
+	// Bookmarking again is a no-op
+	require.NoError(t, BookmarkTwt(cache, archive, db, user, older.Hash()))
+	assert.Len(t, user.Bookmarks, 2)
+
+	// Bookmarks survive the twts being evicted from the cache
+	cache.Delete(types.Feeds{types.Feed{Nick: twter.Nick, URL: twter.URL}: true})
+
+	twts := GetBookmarkedTwts(cache, archive, user)
+	require.Len(t, twts, 2)
+	assert.Equal(t, newer.Hash(), twts[0].Hash())
+	assert.Equal(t, older.Hash(), twts[1].Hash())
+
+	// Bookmarks of twts that are gone are skipped
+	require.NoError(t, archive.Del(older.Hash()))
+
+	twts = GetBookmarkedTwts(cache, archive, user)
+	require.Len(t, twts, 1)
+	assert.Equal(t, newer.Hash(), twts[0].Hash())
+}
@@ -23,6 +23,10 @@ import (
 const (
 	feedCacheFile    = "cache"
 	feedCacheVersion = 1 // increase this if breaking changes occur to cache file.
+
+	// newTwtMaxAge is how old a twt from a previously uncached feed may be
+	// and still be considered new.
+	newTwtMaxAge = 5 * time.Minute
 )
 
 // Cached ...
@@ -65,6 +69,26 @@ type Cache struct {
 	mu      sync.RWMutex
 	Version int
 	Twts    map[string]*Cached
+
+	onNewTwts []func(twts types.Twts)
+
+	// tags indexes the twts of each cached feed by their normalized
+	// hashtags (tag to feed url to twts) and feedTags the tags indexed
+	// for each feed so it can be reindexed when it is fetched again
+	tags     map[string]map[string]types.Twts
+	feedTags map[string][]string
+
+	// moved records feeds that permanently redirected (old to new url)
+	// since MovedFeeds was last called
+	moved map[string]string
+}
+
+// OnNewTwts subscribes a callback that is called with the twts that are new
+// to the cache after each fetch. Each callback is called in its own goroutine.
+func (cache *Cache) OnNewTwts(fn func(twts types.Twts)) {
+	cache.mu.Lock()
+	cache.onNewTwts = append(cache.onNewTwts, fn)
+	cache.mu.Unlock()
 }
 
 // Store ...
@@ -153,9 +177,62 @@ func LoadCache(path string) (*Cache, error) {
 		cache.Twts = make(map[string]*Cached)
 	}
 
+	for url, cached := range cache.Twts {
+		if !strings.HasPrefix(url, "prefix:") {
+			cache.indexTags(url, cached.Twts)
+		}
+	}
+
 	return cache, nil
 }
 
+// indexTags (re)indexes the twts of the feed by url by their hashtags.
+// Must be called with cache.mu held.
+func (cache *Cache) indexTags(url string, twts types.Twts) {
+	cache.unindexTags(url)
+
+	if cache.tags == nil {
+		cache.tags = make(map[string]map[string]types.Twts)
+		cache.feedTags = make(map[string][]string)
+	}
+
+	for _, twt := range twts {
+		for _, tag := range twt.Tags() {
+			tag := NormalizeTag(tag.Tag())
+			if tag == "" {
+				continue
+			}
+
+			feeds, ok := cache.tags[tag]
+			if !ok {
+				feeds = make(map[string]types.Twts)
+				cache.tags[tag] = feeds
+			}
+
+			// Twts that use a tag more than once are only indexed once
+			if n := len(feeds[url]); n > 0 && feeds[url][n-1].Hash() == twt.Hash() {
+				continue
+			}
+			if len(feeds[url]) == 0 {
+				cache.feedTags[url] = append(cache.feedTags[url], tag)
+			}
+			feeds[url] = append(feeds[url], twt)
+		}
+	}
+}
+
+// unindexTags removes the twts of the feed by url from the tag index.
+// Must be called with cache.mu held.
+func (cache *Cache) unindexTags(url string) {
+	for _, tag := range cache.feedTags[url] {
+		delete(cache.tags[tag], url)
+		if len(cache.tags[tag]) == 0 {
+			delete(cache.tags, tag)
+		}
+	}
+	delete(cache.feedTags, url)
+}
+
 const maxfetchers = 50
 
 // FetchTwts ...
@@ -173,6 +250,7 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 	// buffered to let goroutines write without blocking before the main thread
 	// begins reading
 	twtsch := make(chan types.Twts, len(feeds))
+	newtwtsch := make(chan types.Twts, len(feeds))
 
 	var wg sync.WaitGroup
 	// max parallel http fetchers
@@ -247,6 +325,14 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 			actualurl := res.Request.URL.String()
 			if actualurl != feed.URL {
 				log.WithError(err).Errorf("feed for %s changed from %s to %s", feed.Nick, feed.URL, actualurl)
+				if movedurl, ok := PermanentlyMovedURL(res); ok {
+					cache.mu.Lock()
+					if cache.moved == nil {
+						cache.moved = make(map[string]string)
+					}
+					cache.moved[feed.URL] = movedurl
+					cache.mu.Unlock()
+				}
 				feed.URL = actualurl
 			}
 
@@ -256,7 +342,7 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				return
 			}
 
-			var twts types.Twts
+			var twts, newtwts types.Twts
 
 			switch res.StatusCode {
 			case http.StatusOK: // 200
@@ -273,7 +359,7 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 						twter.Avatar = URLForExternalAvatar(conf, feed.URL)
 					}
 				}
-				twts, old, err := types.ParseFile(limitedReader, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
+				twts, old, err := ParseFeed(limitedReader, res.Header.Get("Content-Type"), twter, conf.MaxCacheTTL, conf.MaxCacheItems)
 				if err != nil {
 					log.WithError(err).Errorf("error parsing feed %s", feed)
 					twtsch <- nil
@@ -305,11 +391,13 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 
 				lastmodified := res.Header.Get("Last-Modified")
 				cache.mu.Lock()
+				newtwts = cache.diff(feed.URL, twts)
 				cache.Twts[feed.URL] = &Cached{
 					cache:        make(map[string]types.Twt),
 					Twts:         twts,
 					Lastmodified: lastmodified,
 				}
+				cache.indexTags(feed.URL, twts)
 				cache.mu.Unlock()
 			case http.StatusNotModified: // 304
 				cache.mu.RLock()
@@ -317,6 +405,10 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				cache.mu.RUnlock()
 			}
 
+			if len(newtwts) > 0 {
+				newtwtsch <- newtwts
+			}
+
 			twtsch <- twts
 		}(feed)
 	}
@@ -329,6 +421,23 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 
 	for range twtsch {
 	}
+	close(newtwtsch)
+
+	var newtwts types.Twts
+	for twts := range newtwtsch {
+		newtwts = append(newtwts, twts...)
+	}
+
+	cache.mu.RLock()
+	onNewTwts := cache.onNewTwts
+	cache.mu.RUnlock()
+
+	if len(newtwts) > 0 {
+		sort.Sort(newtwts)
+		for _, fn := range onNewTwts {
+			go fn(newtwts)
+		}
+	}
 
 	cache.mu.RLock()
 	metrics.Gauge("cache", "feeds").Set(float64(len(cache.Twts)))
@@ -340,6 +449,46 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 	metrics.Gauge("cache", "twts").Set(float64(count))
 }
 
+// MovedFeeds returns and forgets the feeds (old to new url) that have
+// permanently moved as seen by fetches since it was last called
+func (cache *Cache) MovedFeeds() map[string]string {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	moved := cache.moved
+	cache.moved = nil
+	return moved
+}
+
+// diff returns the twts not previously cached for the feed. When the feed
+// was not cached at all only very recent twts are considered new so that
+// following a feed does not flood subscribers with its history.
+// Must be called with cache.mu held.
+func (cache *Cache) diff(url string, twts types.Twts) (newtwts types.Twts) {
+	cached, ok := cache.Twts[url]
+	if !ok {
+		for _, twt := range twts {
+			if time.Since(twt.Created()) < newTwtMaxAge {
+				newtwts = append(newtwts, twt)
+			}
+		}
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, twt := range cached.Twts {
+		seen[twt.Hash()] = true
+	}
+
+	for _, twt := range twts {
+		if !seen[twt.Hash()] {
+			newtwts = append(newtwts, twt)
+		}
+	}
+
+	return
+}
+
 // Lookup ...
 func (cache *Cache) Lookup(hash string) (types.Twt, bool) {
 	cache.mu.RLock()
@@ -391,6 +540,58 @@ func (cache *Cache) GetMentions(u *User) (twts types.Twts) {
 	return
 }
 
+// GetTimeline returns the user's timeline, the twts from the feeds they
+// follow merged with any twts tagged with a tag they follow.
+func (cache *Cache) GetTimeline(u *User) (twts types.Twts) {
+	seen := make(map[string]bool)
+
+	for feed := range u.Sources() {
+		for _, twt := range cache.GetByURL(feed.URL) {
+			if !seen[twt.Hash()] {
+				twts = append(twts, twt)
+				seen[twt.Hash()] = true
+			}
+		}
+	}
+
+	for _, twt := range u.Filter(cache.GetByTags(u.FollowedTags)) {
+		if !seen[twt.Hash()] {
+			twts = append(twts, twt)
+			seen[twt.Hash()] = true
+		}
+	}
+
+	sort.Sort(twts)
+
+	return
+}
+
+// GetByTags returns all twts in the cache (local, followed and even
+// external if any) tagged with any of the given tags.
+func (cache *Cache) GetByTags(tags []string) (twts types.Twts) {
+	if len(tags) == 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	for _, tag := range tags {
+		for _, tagged := range cache.tags[NormalizeTag(tag)] {
+			for _, twt := range tagged {
+				if !seen[twt.Hash()] {
+					twts = append(twts, twt)
+					seen[twt.Hash()] = true
+				}
+			}
+		}
+	}
+
+	return
+}
+
 // GetByPrefix ...
 func (cache *Cache) GetByPrefix(prefix string, refresh bool) types.Twts {
 	key := fmt.Sprintf("prefix:%s", prefix)
@@ -447,6 +648,7 @@ func (cache *Cache) Delete(feeds types.Feeds) {
 	for feed := range feeds {
 		cache.mu.Lock()
 		delete(cache.Twts, feed.URL)
+		cache.unindexTags(feed.URL)
 		cache.mu.Unlock()
 	}
 }
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestCacheTagIndex(t *testing.T) {
+	bob := types.Twter{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"}
+	eve := types.Twter{Nick: "eve", URL: "https://eve.example.com/twtxt.txt"}
+	now := time.Now()
+
+	golang := retwt.NewReTwt(bob, "Hello #<golang https://example.com/search?tag=golang> #<golang https://example.com/search?tag=golang>", now)
+	rust := retwt.NewReTwt(bob, "Hello #<Rust https://example.com/search?tag=rust>", now.Add(-time.Minute))
+	spam := retwt.NewReTwt(eve, "Buy now #<golang https://example.com/search?tag=golang>", now.Add(-time.Hour))
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.mu.Lock()
+	cache.indexTags(bob.URL, types.Twts{golang, rust})
+	cache.indexTags(eve.URL, types.Twts{spam})
+	cache.mu.Unlock()
+
+	assert.Len(t, cache.GetByTags(nil), 0)
+	assert.Len(t, cache.GetByTags([]string{"golang"}), 2)
+	assert.Len(t, cache.GetByTags([]string{"#RUST"}), 1)
+	assert.Len(t, cache.GetByTags([]string{"golang", "rust"}), 3)
+
+	// Refetching a feed replaces its indexed twts
+	cache.mu.Lock()
+	cache.indexTags(bob.URL, types.Twts{rust})
+	cache.mu.Unlock()
+	assert.Len(t, cache.GetByTags([]string{"golang"}), 1)
+
+	cache.Delete(types.Feeds{types.Feed{Nick: eve.Nick, URL: eve.URL}: true})
+	assert.Len(t, cache.GetByTags([]string{"golang"}), 0)
+	assert.NotContains(t, cache.tags, "golang")
+}
+
+func TestCacheGetTimelineFollowedTags(t *testing.T) {
+	alice := types.Twter{Nick: "alice", URL: "https://pod.example.com/user/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"}
+	eve := types.Twter{Nick: "eve", URL: "https://eve.example.com/twtxt.txt"}
+	now := time.Now()
+
+	own := retwt.NewReTwt(alice, "Hello #<golang https://example.com/search?tag=golang>", now)
+	tagged := retwt.NewReTwt(bob, "Go 1.16 is out #<golang https://example.com/search?tag=golang>", now.Add(-time.Minute))
+	untagged := retwt.NewReTwt(bob, "Lunch", now.Add(-2*time.Minute))
+	muted := retwt.NewReTwt(eve, "Buy now #<golang https://example.com/search?tag=golang>", now.Add(-time.Hour))
+	filtered := retwt.NewReTwt(bob, "Generics drama #<golang https://example.com/search?tag=golang>", now.Add(-2*time.Hour))
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.mu.Lock()
+	for url, twts := range map[string]types.Twts{
+		alice.URL: {own},
+		bob.URL:   {tagged, untagged, filtered},
+		eve.URL:   {muted},
+	} {
+		cache.Twts[url] = &Cached{cache: make(map[string]types.Twt), Twts: twts}
+		cache.indexTags(url, twts)
+	}
+	cache.mu.Unlock()
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = alice.URL
+	user.Muted = map[string]string{eve.Nick: eve.URL}
+	filter, err := NewMuteFilter(FilterKeyword, "drama", FilterActionHide, 0)
+	require.NoError(t, err)
+	user.Filters = []*MuteFilter{filter}
+
+	// Load the user to build its followed and muted feed lookups
+	data, err := user.Bytes()
+	require.NoError(t, err)
+	user, err = LoadUser(data)
+	require.NoError(t, err)
+
+	twts := cache.GetTimeline(user)
+	require.Len(t, twts, 1)
+	assert.Equal(t, own.Hash(), twts[0].Hash())
+
+	user.FollowTag("#golang")
+
+	// Twts with followed tags are merged in once, respecting mutes
+	twts = cache.GetTimeline(user)
+	require.Len(t, twts, 2)
+	assert.Equal(t, own.Hash(), twts[0].Hash())
+	assert.Equal(t, tagged.Hash(), twts[1].Hash())
+}
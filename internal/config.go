@@ -27,6 +27,7 @@ type Settings struct {
 	Description string `yaml:"pod_description"`
 
 	MaxTwtLength int `yaml:"max_twt_length"`
+	MaxUserFeeds int `yaml:"max_user_feeds"`
 
 	OpenProfiles      bool `yaml:"open_profiles"`
 	OpenRegistrations bool `yaml:"open_registrations"`
@@ -51,7 +52,9 @@ type Config struct {
 	TwtPrompts        []string
 	TwtsPerPage       int
 	MaxUploadSize     int64
+	MaxImportSize     int64
 	MaxTwtLength      int
+	MaxUserFeeds      int
 	MaxCacheTTL       time.Duration
 	MaxCacheItems     int
 	MsgsPerPage       int
@@ -66,6 +69,10 @@ type Config struct {
 	SMTPBind string
 	POP3Bind string
 
+	GeminiBind     string
+	GeminiCertFile string
+	GeminiKeyFile  string
+
 	SMTPHost string
 	SMTPPort int
 	SMTPUser string
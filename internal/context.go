@@ -37,6 +37,7 @@ type Context struct {
 	TwtsPerPage             int
 	TwtPrompt               string
 	MaxTwtLength            int
+	MaxUserFeeds            int
 	RegisterDisabled        bool
 	OpenProfiles            bool
 	RegisterDisabledMessage string
@@ -68,11 +69,37 @@ type Context struct {
 	Messages    Messages
 	NewMessages int
 
+	// Unread twts since the user's read markers
+	UnreadTimeline int
+	UnreadMentions int
+	ReadMarker     string
+
+	Notifications       Notifications
+	UnreadNotifications int
+
+	Webhooks      []*Webhook
+	WebhookEvents []string
+
+	OAuthApps      []*OAuthApp
+	AuthorizedApps []*AuthorizedApp
+	OAuthRequest   *OAuthRequest
+
+	WebMentions IncomingWebMentions
+
+	ImportResults []types.FollowImportResult
+	TaskURL       string
+
+	HistoryPreview *HistoryImportPreview
+
 	Twter       types.Twter
 	Twts        types.Twts
+	PinnedTwts  types.Twts
 	BlogPost    *BlogPost
 	BlogPosts   BlogPosts
+	Feed        *Feed
 	Feeds       []*Feed
+	List        *List
+	Lists       []*List
 	FeedSources FeedSourceMap
 	Pager       *paginator.Paginator
 
@@ -83,6 +110,10 @@ type Context struct {
 	// Reset Password Token
 	PasswordResetToken string
 
+	// Two-factor authentication enrolment
+	TOTPSecret    string
+	RecoveryCodes []string
+
 	// CSRF Token
 	CSRFToken string
 }
@@ -97,6 +128,7 @@ func NewContext(conf *Config, db Store, req *http.Request) *Context {
 		TwtsPerPage:      conf.TwtsPerPage,
 		TwtPrompt:        conf.RandomTwtPrompt(),
 		MaxTwtLength:     conf.MaxTwtLength,
+		MaxUserFeeds:     conf.MaxUserFeeds,
 		RegisterDisabled: !conf.OpenRegistrations,
 		OpenProfiles:     conf.OpenProfiles,
 		LastTwt:          types.NilTwt,
@@ -120,6 +152,11 @@ func NewContext(conf *Config, db Store, req *http.Request) *Context {
 				Title: fmt.Sprintf("%s local feed", conf.Name),
 				URL:   fmt.Sprintf("%s/atom.xml", conf.BaseURL),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s local JSON feed", conf.Name),
+				URL:   fmt.Sprintf("%s/feed.json", conf.BaseURL),
+			},
 		},
 	}
 
@@ -159,6 +159,11 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 					Title: fmt.Sprintf("%s's Atom Feed", twt.Twter().Nick),
 					URL:   fmt.Sprintf("%s/atom.xml", UserURL(twt.Twter().URL)),
 				},
+				types.Alternative{
+					Type:  JSONFeedContentType,
+					Title: fmt.Sprintf("%s's JSON Feed", twt.Twter().Nick),
+					URL:   fmt.Sprintf("%s/feed.json", UserURL(twt.Twter().URL)),
+				},
 			}...)
 		}
 
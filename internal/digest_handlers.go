@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// DigestSettingsHandler updates how often the user is emailed their
+// notifications and the address they are sent to.
+func (s *Server) DigestSettingsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		frequency := strings.ToLower(strings.TrimSpace(r.FormValue("frequency")))
+		email := strings.TrimSpace(r.FormValue("email"))
+
+		if !IsValidDigestFrequency(frequency) {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error updating email notifications: %s", ErrInvalidDigestFrequency)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if frequency != DigestOff && email == "" {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error updating email notifications: %s", ErrInvalidDigestEmail)
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		// Only notifications from now on are emailed when first opting in
+		if user.EmailDigest == DigestOff && frequency != DigestOff {
+			user.LastDigestAt = time.Now()
+		}
+
+		user.EmailDigest = frequency
+		if frequency == DigestOff {
+			user.DigestEmail = ""
+		} else {
+			user.DigestEmail = email
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error updating email notifications"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// UnsubscribeHandler turns off email digests for the user a signed
+// unsubscribe link was issued to. It does not require the user to be logged
+// in so the link in digest emails works in a single click.
+func (s *Server) UnsubscribeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		username, err := ParseUnsubscribeToken(s.config, r.FormValue("token"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "Invalid or expired unsubscribe link"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", username)
+			ctx.Error = true
+			ctx.Message = "Error loading user"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user.EmailDigest = DigestOff
+		user.DigestEmail = ""
+
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error updating email notifications"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = "You have been unsubscribed from email notifications"
+		s.render("error", w, ctx)
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DigestOff disables email notifications
+	DigestOff = "off"
+
+	// DigestImmediate emails new notifications as soon as the digest job
+	// next runs
+	DigestImmediate = "immediate"
+
+	// DigestDaily emails a digest of new notifications once a day
+	DigestDaily = "daily"
+
+	// DigestWeekly emails a digest of new notifications once a week
+	DigestWeekly = "weekly"
+
+	// unsubscribeLinkExpiry is how long the unsubscribe link in a digest
+	// email remains valid.
+	unsubscribeLinkExpiry = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidDigestFrequency = errors.New("error: invalid digest frequency")
+	ErrInvalidDigestEmail     = errors.New("error: an email address is required for digests")
+	ErrInvalidUnsubscribeLink = errors.New("error: invalid or expired unsubscribe link")
+)
+
+// IsValidDigestFrequency ...
+func IsValidDigestFrequency(frequency string) bool {
+	switch frequency {
+	case DigestOff, DigestImmediate, DigestDaily, DigestWeekly:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDigestNotification returns true if the notification is of a type that is
+// included in email digests
+func IsDigestNotification(n *Notification) bool {
+	switch n.Type {
+	case NotificationFollow, NotificationMention, NotificationReply:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDigestDue returns true if the user has opted in to email digests and
+// their next digest is due
+func IsDigestDue(user *User, now time.Time) bool {
+	if user.DigestEmail == "" {
+		return false
+	}
+
+	switch user.EmailDigest {
+	case DigestImmediate:
+		return true
+	case DigestDaily:
+		return now.Sub(user.LastDigestAt) >= 24*time.Hour
+	case DigestWeekly:
+		return now.Sub(user.LastDigestAt) >= 7*24*time.Hour
+	default:
+		return false
+	}
+}
+
+// GetDigestNotifications returns the user's unread follow, mention and reply
+// notifications (newest first) created since their last digest
+func GetDigestNotifications(db Store, user *User) (Notifications, error) {
+	notifications, err := GetNotifications(db, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns Notifications
+	for _, n := range notifications {
+		if !n.Read && IsDigestNotification(n) && n.CreatedAt.After(user.LastDigestAt) {
+			ns = append(ns, n)
+		}
+	}
+
+	return ns, nil
+}
+
+// CreateUnsubscribeToken returns a signed token for a one-click link that
+// turns off the user's email digests
+func CreateUnsubscribeToken(conf *Config, username string) (string, error) {
+	token := jwt.NewWithClaims(
+		jwt.SigningMethodHS256,
+		jwt.MapClaims{
+			"username":    username,
+			"purpose":     unsubscribeTokenPurpose,
+			"unsubscribe": "digest",
+			"expiresAt":   time.Now().Add(unsubscribeLinkExpiry).Unix(),
+		},
+	)
+	return token.SignedString([]byte(conf.MagicLinkSecret))
+}
+
+// ParseUnsubscribeToken validates a token created by CreateUnsubscribeToken
+// and returns the username it was issued for
+func ParseUnsubscribeToken(conf *Config, tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(conf.MagicLinkSecret), nil
+	})
+	if err != nil {
+		return "", ErrInvalidUnsubscribeLink
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != unsubscribeTokenPurpose || claims["unsubscribe"] != "digest" {
+		return "", ErrInvalidUnsubscribeLink
+	}
+
+	expiresAt, ok := claims["expiresAt"].(float64)
+	if !ok || time.Now().Unix() > int64(expiresAt) {
+		return "", ErrInvalidUnsubscribeLink
+	}
+
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		return "", ErrInvalidUnsubscribeLink
+	}
+
+	return username, nil
+}
+
+// SendDigest emails the user a digest of their notifications if one is due
+// and there is anything new to tell them about
+func SendDigest(conf *Config, db Store, user *User, now time.Time) error {
+	if !IsDigestDue(user, now) {
+		return nil
+	}
+
+	notifications, err := GetDigestNotifications(db, user)
+	if err != nil {
+		return err
+	}
+
+	if len(notifications) == 0 && user.EmailDigest == DigestImmediate {
+		return nil
+	}
+
+	if len(notifications) > 0 {
+		token, err := CreateUnsubscribeToken(conf, user.Username)
+		if err != nil {
+			return err
+		}
+
+		if err := SendDigestEmail(conf, user, notifications, token); err != nil {
+			return err
+		}
+
+		log.Infof("sent %s digest of %d notifications to %s", user.EmailDigest, len(notifications), user.Username)
+	}
+
+	user.LastDigestAt = now
+	return db.SetUser(user.Username, user)
+}
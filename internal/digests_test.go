@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/internal/passwords"
+)
+
+func TestIsDigestDue(t *testing.T) {
+	now := time.Now()
+
+	user := NewUser()
+	assert.False(t, IsDigestDue(user, now))
+
+	user.DigestEmail = "test@example.com"
+	user.EmailDigest = DigestImmediate
+	assert.True(t, IsDigestDue(user, now))
+
+	user.EmailDigest = DigestDaily
+	user.LastDigestAt = now.Add(-time.Hour)
+	assert.False(t, IsDigestDue(user, now))
+	user.LastDigestAt = now.Add(-25 * time.Hour)
+	assert.True(t, IsDigestDue(user, now))
+
+	user.EmailDigest = DigestWeekly
+	assert.False(t, IsDigestDue(user, now))
+	user.LastDigestAt = now.Add(-8 * 24 * time.Hour)
+	assert.True(t, IsDigestDue(user, now))
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	conf := &Config{MagicLinkSecret: "secret"}
+
+	token, err := CreateUnsubscribeToken(conf, "test")
+	assert.NoError(t, err)
+
+	username, err := ParseUnsubscribeToken(conf, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", username)
+
+	_, err = ParseUnsubscribeToken(&Config{MagicLinkSecret: "other"}, token)
+	assert.Equal(t, ErrInvalidUnsubscribeLink, err)
+
+	_, err = ParseUnsubscribeToken(conf, "invalid")
+	assert.Equal(t, ErrInvalidUnsubscribeLink, err)
+}
+
+func TestUnsubscribeTokenCannotResetPassword(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-digests")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com", MagicLinkSecret: "secret"}
+	pm := passwords.NewScryptPasswords(nil)
+
+	hash, err := pm.CreatePassword("hunter2")
+	require.NoError(t, err)
+
+	user := NewUser()
+	user.Username = "alice"
+	user.Password = hash
+	require.NoError(t, db.SetUser("alice", user))
+
+	tmplman, err := NewTemplateManager(conf, db, NewBlogsCache(), &Cache{Twts: make(map[string]*Cached)})
+	require.NoError(t, err)
+
+	s := &Server{config: conf, db: db, pm: pm, tmplman: tmplman}
+	handler := s.NewPasswordHandler()
+
+	newPassword := func(token string) error {
+		form := url.Values{"token": {token}, "password": {"pwned"}}
+		r := httptest.NewRequest(http.MethodPost, "/newPassword", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler(httptest.NewRecorder(), r, httprouter.Params{})
+
+		user, err := db.GetUser("alice")
+		require.NoError(t, err)
+		return pm.CheckPassword(user.Password, "pwned")
+	}
+
+	unsubscribe, err := CreateUnsubscribeToken(conf, "alice")
+	require.NoError(t, err)
+	assert.Error(t, newPassword(unsubscribe))
+
+	reset, err := jwt.NewWithClaims(
+		jwt.SigningMethodHS256,
+		jwt.MapClaims{
+			"username":  "alice",
+			"purpose":   passwordResetTokenPurpose,
+			"expiresAt": time.Now().Add(time.Minute).Unix(),
+		},
+	).SignedString([]byte(conf.MagicLinkSecret))
+	require.NoError(t, err)
+	assert.NoError(t, newPassword(reset))
+
+	// Password reset tokens can't unsubscribe users from digests either
+	_, err = ParseUnsubscribeToken(conf, reset)
+	assert.Equal(t, ErrInvalidUnsubscribeLink, err)
+}
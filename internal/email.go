@@ -57,6 +57,25 @@ The offending user/feed in question is:
 
 Kind regards,
 
+{{ .Pod }} Support
+`))
+
+	digestEmailTemplate = template.Must(template.New("email").Parse(`Hello {{ .Username }},
+
+Here is what you missed on {{ .Pod }}:
+{{ range .Notifications }}
+- {{ .String }} ({{ .CreatedAt.Format "Mon Jan 2 15:04 MST" }}){{ if .Target }}
+  {{ .Target }}{{ end }}
+{{ end }}
+You can see all of your notifications at {{ .BaseURL }}/notifications
+
+You are receiving this email because you opted in to {{ .Frequency }} email
+notifications. To stop receiving these emails visit the following link:
+
+{{ .BaseURL }}/unsubscribe?token={{ .Token }}
+
+Kind regards,
+
 {{ .Pod }} Support
 `))
 )
@@ -92,6 +111,16 @@ type ReportAbuseEmailContext struct {
 	Message  string
 }
 
+type DigestEmailContext struct {
+	Pod     string
+	BaseURL string
+
+	Token         string
+	Username      string
+	Frequency     string
+	Notifications Notifications
+}
+
 // indents a block of text with an indent string
 func Indent(text, indent string) string {
 	if text[len(text)-1:] == "\n" {
@@ -217,3 +246,33 @@ func SendReportAbuseEmail(conf *Config, nick, url, name, email, category, messag
 
 	return nil
 }
+
+func SendDigestEmail(conf *Config, user *User, notifications Notifications, token string) error {
+	recipients := []string{user.DigestEmail}
+	subject := fmt.Sprintf(
+		"[%s]: %d new notifications for %s",
+		conf.Name, len(notifications), user.Username,
+	)
+	ctx := DigestEmailContext{
+		Pod:     conf.Name,
+		BaseURL: conf.BaseURL,
+
+		Token:         token,
+		Username:      user.Username,
+		Frequency:     user.EmailDigest,
+		Notifications: notifications,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := digestEmailTemplate.Execute(buf, ctx); err != nil {
+		log.WithError(err).Error("error rendering email template")
+		return err
+	}
+
+	if err := SendEmail(conf, recipients, conf.SMTPFrom, subject, buf.String()); err != nil {
+		log.WithError(err).Errorf("error sending digest to %s", user.Username)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// TwtsEvent is published when new twts appear in a user's timeline
+	TwtsEvent = "twts"
+
+	// MentionsEvent is published when a user is mentioned in new twts
+	MentionsEvent = "mentions"
+
+	// MessagesEvent is published when a user's new messages count changes
+	MessagesEvent = "messages"
+
+	// eventQueueSize is the number of events buffered per subscriber before
+	// further events are dropped for slow consumers.
+	eventQueueSize = 16
+
+	// eventKeepAlive is how often a comment is sent on idle event streams to
+	// keep intermediate proxies from closing the connection.
+	eventKeepAlive = 30 * time.Second
+
+	// publishedTwtsTTL is how long published twts are remembered so twts
+	// pushed when posted aren't pushed again when their feed is fetched
+	publishedTwtsTTL = time.Hour
+)
+
+// Event is a notification pushed to a subscribed user
+type Event struct {
+	Type  string   `json:"type"`
+	Count int      `json:"count"`
+	Twts  []string `json:"twts,omitempty"`
+
+	Notification *Notification `json:"notification,omitempty"`
+}
+
+// Bytes ...
+func (e Event) Bytes() ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// EventBus delivers events to the users subscribed to them. Users may be
+// subscribed more than once (e.g. several open tabs).
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]bool
+	listeners   []func(username string, event Event)
+
+	publishedMu sync.Mutex
+	published   *TTLCache
+}
+
+// NewEventBus ...
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string]map[chan Event]bool),
+		published:   NewTTLCache(publishedTwtsTTL),
+	}
+}
+
+// Subscribe returns a new channel on which events for the user are delivered
+func (bus *EventBus) Subscribe(username string) chan Event {
+	ch := make(chan Event, eventQueueSize)
+
+	bus.mu.Lock()
+	if _, ok := bus.subscribers[username]; !ok {
+		bus.subscribers[username] = make(map[chan Event]bool)
+	}
+	bus.subscribers[username][ch] = true
+	bus.mu.Unlock()
+
+	metrics.Gauge("server", "subscribers").Inc()
+
+	return ch
+}
+
+// Unsubscribe removes and closes a channel returned by Subscribe
+func (bus *EventBus) Unsubscribe(username string, ch chan Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if _, ok := bus.subscribers[username][ch]; !ok {
+		return
+	}
+
+	delete(bus.subscribers[username], ch)
+	if len(bus.subscribers[username]) == 0 {
+		delete(bus.subscribers, username)
+	}
+	close(ch)
+
+	metrics.Gauge("server", "subscribers").Dec()
+}
+
+// Listen registers a function that is called with every published event
+// regardless of whether the user has any subscriptions
+func (bus *EventBus) Listen(fn func(username string, event Event)) {
+	bus.mu.Lock()
+	bus.listeners = append(bus.listeners, fn)
+	bus.mu.Unlock()
+}
+
+// Subscribers returns the usernames of all users with active subscriptions
+func (bus *EventBus) Subscribers() (usernames []string) {
+	bus.mu.RLock()
+	for username := range bus.subscribers {
+		usernames = append(usernames, username)
+	}
+	bus.mu.RUnlock()
+	return
+}
+
+// Publish delivers an event to all of the user's subscriptions without
+// blocking, events are dropped for subscribers that are not keeping up.
+func (bus *EventBus) Publish(username string, event Event) {
+	bus.mu.RLock()
+	listeners := bus.listeners
+	for ch := range bus.subscribers[username] {
+		select {
+		case ch <- event:
+		default:
+			log.Warnf("dropping %s event for slow subscriber %s", event.Type, username)
+		}
+	}
+	bus.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(username, event)
+	}
+}
+
+// unpublished returns the twts that haven't been published yet and marks
+// them as published
+func (bus *EventBus) unpublished(twts types.Twts) (fresh types.Twts) {
+	bus.publishedMu.Lock()
+	defer bus.publishedMu.Unlock()
+
+	for _, twt := range twts {
+		if bus.published.Get(twt.Hash()) == 0 {
+			bus.published.Set(twt.Hash(), 1)
+			fresh = append(fresh, twt)
+		}
+	}
+
+	return
+}
+
+// PublishTwts publishes TwtsEvent and MentionsEvent events to every
+// subscribed user for the new twts that appear in their timeline or
+// mention them. Twts are only ever published once.
+func (bus *EventBus) PublishTwts(db Store, twts types.Twts) {
+	twts = bus.unpublished(twts)
+	if len(twts) == 0 {
+		return
+	}
+
+	for _, username := range bus.Subscribers() {
+		user, err := db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Warnf("error loading user object for %s", username)
+			continue
+		}
+
+		var timeline, mentions []string
+
+		for _, twt := range user.Filter(twts) {
+			twter := twt.Twter()
+
+			if user.Is(twter.URL) {
+				// Don't tell users about their own twts
+				continue
+			}
+
+			if user.Follows(twter.URL) || user.FollowsAnyTag(twt) {
+				timeline = append(timeline, twt.Hash())
+			}
+
+			for _, mention := range twt.Mentions() {
+				if user.Is(mention.Twter().URL) {
+					mentions = append(mentions, twt.Hash())
+					break
+				}
+			}
+		}
+
+		if len(timeline) > 0 {
+			bus.Publish(username, Event{Type: TwtsEvent, Count: len(timeline), Twts: timeline})
+		}
+		if len(mentions) > 0 {
+			bus.Publish(username, Event{Type: MentionsEvent, Count: len(mentions), Twts: mentions})
+		}
+	}
+}
+
+// IsEventStream returns true if the request is for a Server-Sent Events
+// stream, such requests must not be buffered (e.g. by gzip compression).
+func IsEventStream(r *http.Request) bool {
+	return r.Header.Get("Accept") == "text/event-stream"
+}
+
+// ServeEvents streams the user's events to the client as Server-Sent Events
+// until the client disconnects. Any initial events are sent immediately.
+func ServeEvents(w http.ResponseWriter, r *http.Request, bus *EventBus, username string, initial ...Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming Unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ch := bus.Subscribe(username)
+	defer bus.Unsubscribe(username, ch)
+
+	keepalive := time.NewTicker(eventKeepAlive)
+	defer keepalive.Stop()
+
+	write := func(event Event) bool {
+		data, err := event.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing event")
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for _, event := range initial {
+		if !write(event) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok || !write(event) {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+var setupEventMetrics sync.Once
+
+// newTestEventBus returns a new EventBus with the metrics it updates set up
+// as they would be by the server
+func newTestEventBus() *EventBus {
+	setupEventMetrics.Do(func() {
+		metrics.NewGauge(
+			"server", "subscribers",
+			"Number of active event stream subscribers",
+		)
+	})
+	return NewEventBus()
+}
+
+func TestEventBus(t *testing.T) {
+	bus := newTestEventBus()
+
+	var heard []string
+	bus.Listen(func(username string, event Event) {
+		heard = append(heard, username)
+	})
+
+	tab1 := bus.Subscribe("alice")
+	tab2 := bus.Subscribe("alice")
+	other := bus.Subscribe("bob")
+	assert.ElementsMatch(t, []string{"alice", "bob"}, bus.Subscribers())
+
+	bus.Publish("alice", Event{Type: MessagesEvent, Count: 1})
+	assert.Equal(t, 1, (<-tab1).Count)
+	assert.Equal(t, 1, (<-tab2).Count)
+	assert.Len(t, other, 0)
+
+	// Listeners hear events for users without subscriptions too
+	bus.Publish("eve", Event{Type: MessagesEvent})
+	assert.Equal(t, []string{"alice", "eve"}, heard)
+
+	// Events for slow subscribers are dropped rather than blocking
+	for i := 0; i < eventQueueSize+5; i++ {
+		bus.Publish("bob", Event{Type: MessagesEvent, Count: i})
+	}
+	assert.Len(t, other, eventQueueSize)
+
+	bus.Unsubscribe("alice", tab1)
+	_, ok := <-tab1
+	assert.False(t, ok)
+	bus.Unsubscribe("alice", tab1)
+
+	bus.Unsubscribe("alice", tab2)
+	assert.Equal(t, []string{"bob"}, bus.Subscribers())
+}
+
+func TestEventBusPublishTwts(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	bob := types.Twter{Nick: "bob", URL: URLForUser(conf, "bob")}
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = URLForUser(conf, "alice")
+	alice.Following = map[string]string{"bob": bob.URL}
+	require.NoError(t, db.SetUser("alice", alice))
+
+	bus := newTestEventBus()
+	ch := bus.Subscribe("alice")
+
+	mention := retwt.NewReTwt(bob, "Hi @<alice "+alice.URL+">", time.Now())
+	bus.PublishTwts(db, types.Twts{mention})
+
+	event := <-ch
+	assert.Equal(t, TwtsEvent, event.Type)
+	assert.Equal(t, []string{mention.Hash()}, event.Twts)
+
+	event = <-ch
+	assert.Equal(t, MentionsEvent, event.Type)
+
+	// Twts pushed when posted aren't pushed again when their feed is fetched
+	bus.PublishTwts(db, types.Twts{mention})
+	assert.Len(t, ch, 0)
+}
+
+func TestServeEvents(t *testing.T) {
+	bus := newTestEventBus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		ServeEvents(w, r, bus, "alice", Event{Type: MessagesEvent, Count: 2})
+		close(done)
+	}()
+
+	for len(bus.Subscribers()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Publish("alice", Event{Type: TwtsEvent, Count: 1, Twts: []string{"abcdefg"}})
+
+	// Give the stream a moment to write the event before disconnecting
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.True(t, IsEventStream(r))
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "event: messages\ndata: {\"type\":\"messages\",\"count\":2}\n\n")
+	assert.Contains(t, w.Body.String(), "event: twts\ndata: {\"type\":\"twts\",\"count\":1,\"twts\":[\"abcdefg\"]}\n\n")
+
+	// Disconnecting unsubscribes the stream
+	assert.Len(t, bus.Subscribers(), 0)
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportDataHandler dispatches an ExportTask to produce an archive of all
+// of the user's personal data and renders a page that polls the task
+func (s *Server) ExportDataHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		uuid, err := s.tasks.Dispatch(NewExportTask(s.config, s.db, ctx.Username))
+		if err != nil {
+			log.WithError(err).Errorf("error dispatching export task for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = "Error exporting your data, please try again later"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = "Export your data"
+		ctx.TaskURL = URLForTask(s.config.BaseURL, uuid)
+		s.render("export", w, ctx)
+	}
+}
+
+// DownloadExportHandler downloads a previously created export archive
+// belonging to the user
+func (s *Server) DownloadExportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		id := p.ByName("id")
+		if id == "" || filepath.Base(id) != id || id[0] == '.' {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		fn := ExportPath(s.config, ctx.Username, id)
+		if !FileExists(fn) {
+			ctx.Error = true
+			ctx.Message = "Export not found, it may have been replaced by a newer one"
+			s.render("404", w, ctx)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s-export.zip"`, ctx.Username),
+		)
+		http.ServeFile(w, r, fn)
+	}
+}
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	exportsDir = "exports"
+
+	exportReadme = `Personal data export for {{ .Username }} from {{ .Pod }}
+Created {{ .Created }}
+
+This archive contains a copy of your personal data:
+
+  feeds/       The twtxt.txt files of your feed{{ if .Feeds }} and of the feeds
+               you own ({{ join .Feeds ", " }}){{ end }}
+  blogs/       Your blog posts as Markdown with a .json metadata file each
+  messages.mbox  Your private messages in mbox format
+  media/       Uploaded media referenced by your twts and blog posts
+  follows.opml   The feeds you follow as OPML (importable by most readers)
+  follows.txt    The feeds you follow as twtxt "# follow = nick url" lines
+  following.json, muted.json, bookmarks.json, filters.json, lists.json,
+  tags.json      Your follow, mute, bookmark, filter, list and tag settings
+  settings.json  Your account settings (passwords and tokens are excluded)
+
+Your twtxt feeds can be hosted anywhere as plain text files and the
+follows can be imported into another pod from Settings -> Import.
+`
+)
+
+var (
+	ErrExportNotFound = errors.New("error: export not found")
+
+	exportReadmeTemplate = template.Must(
+		template.New("readme").
+			Funcs(template.FuncMap{"join": strings.Join}).
+			Parse(exportReadme),
+	)
+)
+
+// exportSettings is the subset of a user's account settings included in an
+// export, deliberately excluding the password hash and any tokens
+type exportSettings struct {
+	Username  string
+	Tagline   string
+	URL       string
+	CreatedAt time.Time
+
+	Theme                      string
+	DisplayDatesInTimezone     string
+	IsFollowersPubliclyVisible bool
+	IsFollowingPubliclyVisible bool
+
+	Feeds  []string
+	Pinned []string
+
+	EmailDigest string
+}
+
+// ExportPath returns the path on disk of the export archive with the given
+// id belonging to username
+func ExportPath(conf *Config, username, id string) string {
+	return filepath.Join(conf.Data, exportsDir, username, fmt.Sprintf("%s.zip", id))
+}
+
+// URLForExport returns the url an export archive can be downloaded from
+func URLForExport(baseURL, id string) string {
+	return fmt.Sprintf(
+		"%s/settings/export/%s",
+		strings.TrimSuffix(baseURL, "/"),
+		id,
+	)
+}
+
+// ExportTask produces a zip archive of all of a user's personal data,
+// their feeds, blog posts, messages, media, follows and settings
+type ExportTask struct {
+	*BaseTask
+
+	conf     *Config
+	db       Store
+	username string
+}
+
+func NewExportTask(conf *Config, db Store, username string) *ExportTask {
+	return &ExportTask{
+		BaseTask: NewBaseTask(),
+
+		conf:     conf,
+		db:       db,
+		username: username,
+	}
+}
+
+func (t *ExportTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *ExportTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	log.Infof("starting export task for %s", t.username)
+
+	user, err := t.db.GetUser(t.username)
+	if err != nil {
+		log.WithError(err).Errorf("error loading user %s for export", t.username)
+		return t.Fail(err)
+	}
+
+	p := filepath.Join(t.conf.Data, exportsDir, user.Username)
+
+	// Only the most recent export is kept around for each user
+	if err := os.RemoveAll(p); err != nil {
+		log.WithError(err).Warnf("error removing previous exports for %s", user.Username)
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		log.WithError(err).Error("error creating exports directory")
+		return t.Fail(err)
+	}
+
+	fn := ExportPath(t.conf, user.Username, t.ID())
+
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		log.WithError(err).Error("error creating export archive")
+		return t.Fail(err)
+	}
+
+	if err := WriteExport(t.conf, t.db, user, f); err != nil {
+		f.Close()
+		os.Remove(fn)
+		log.WithError(err).Errorf("error writing export for %s", user.Username)
+		return t.Fail(err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(fn)
+		log.WithError(err).Error("error closing export archive")
+		return t.Fail(err)
+	}
+
+	log.Infof("export complete for %s", user.Username)
+
+	t.SetData("exportID", t.ID())
+	t.SetData("exportURI", URLForExport(t.conf.BaseURL, t.ID()))
+
+	return nil
+}
+
+// WriteExport writes a zip archive of all of the user's personal data to w
+func WriteExport(conf *Config, db Store, user *User, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	media := make(map[string]bool)
+	addMedia := func(data []byte) {
+		for _, name := range GetMediaNamesFromText(string(data)) {
+			media[name] = true
+		}
+	}
+
+	writeFile := func(name string, data []byte) error {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	}
+
+	writeJSON := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFile(name, data)
+	}
+
+	copyFile := func(name, fn string) error {
+		src, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, src)
+		return err
+	}
+
+	nicks := append([]string{user.Username}, user.Feeds...)
+
+	for _, nick := range nicks {
+		fn := filepath.Join(conf.Data, feedsDir, nick)
+		if !FileExists(fn) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("error reading feed %s: %w", nick, err)
+		}
+		addMedia(data)
+
+		if err := writeFile(path.Join("feeds", nick, "twtxt.txt"), data); err != nil {
+			return err
+		}
+	}
+
+	for _, nick := range nicks {
+		root := filepath.Join(conf.Data, blogsDir, nick)
+		if !FileExists(root) {
+			continue
+		}
+
+		err := filepath.Walk(root, func(fn string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			ext := filepath.Ext(fn)
+			if ext != ".md" && ext != ".json" {
+				return nil
+			}
+
+			rel, err := filepath.Rel(filepath.Join(conf.Data, blogsDir), fn)
+			if err != nil {
+				return err
+			}
+
+			if ext == ".md" {
+				data, err := ioutil.ReadFile(fn)
+				if err != nil {
+					return err
+				}
+				addMedia(data)
+			}
+
+			return copyFile(path.Join("blogs", filepath.ToSlash(rel)), fn)
+		})
+		if err != nil {
+			return fmt.Errorf("error exporting blog posts for %s: %w", nick, err)
+		}
+	}
+
+	if fn := filepath.Join(conf.Data, msgsDir, user.Username); FileExists(fn) {
+		if err := copyFile("messages.mbox", fn); err != nil {
+			return fmt.Errorf("error exporting messages: %w", err)
+		}
+	}
+
+	for name := range media {
+		name = filepath.Base(strings.SplitN(name, "?", 2)[0])
+		if name == "" || name == "." || name == "/" || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		candidates := []string{name}
+		if filepath.Ext(name) == "" {
+			candidates = []string{name + ".webp", name + ".png"}
+		}
+
+		for _, candidate := range candidates {
+			fn := filepath.Join(conf.Data, mediaDir, candidate)
+			if !FileExists(fn) {
+				continue
+			}
+			if err := copyFile(path.Join("media", candidate), fn); err != nil {
+				return fmt.Errorf("error exporting media %s: %w", candidate, err)
+			}
+		}
+	}
+
+	for _, format := range []string{FollowsFormatOPML, FollowsFormatTwtxt} {
+		data, err := ExportFollows(conf, user, format)
+		if err != nil {
+			return err
+		}
+
+		name := "follows.opml"
+		if format == FollowsFormatTwtxt {
+			name = "follows.txt"
+		}
+		if err := writeFile(name, data); err != nil {
+			return err
+		}
+	}
+
+	lists, err := db.GetUserLists(user.Username)
+	if err != nil {
+		log.WithError(err).Warnf("error loading lists for %s", user.Username)
+	}
+
+	settings := exportSettings{
+		Username:  user.Username,
+		Tagline:   user.Tagline,
+		URL:       user.URL,
+		CreatedAt: user.CreatedAt,
+
+		Theme:                      user.Theme,
+		DisplayDatesInTimezone:     user.DisplayDatesInTimezone,
+		IsFollowersPubliclyVisible: user.IsFollowersPubliclyVisible,
+		IsFollowingPubliclyVisible: user.IsFollowingPubliclyVisible,
+
+		Feeds:  user.Feeds,
+		Pinned: user.Pinned,
+
+		EmailDigest: user.EmailDigest,
+	}
+
+	for _, file := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"following.json", user.Following},
+		{"muted.json", user.Muted},
+		{"bookmarks.json", user.Bookmarks},
+		{"filters.json", user.Filters},
+		{"lists.json", lists},
+		{"tags.json", user.FollowedTags},
+		{"settings.json", settings},
+	} {
+		if err := writeJSON(file.name, file.v); err != nil {
+			return err
+		}
+	}
+
+	readme := &strings.Builder{}
+	if err := exportReadmeTemplate.Execute(readme, map[string]interface{}{
+		"Username": user.Username,
+		"Pod":      conf.Name,
+		"Created":  time.Now().UTC().Format(time.RFC3339),
+		"Feeds":    user.Feeds,
+	}); err != nil {
+		return err
+	}
+	if err := writeFile("README.txt", []byte(readme.String())); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportTask(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = URLForUser(conf, "alice")
+	user.Password = "secret-hash"
+	user.Following = map[string]string{"bob": "https://bob.example.com/twtxt.txt"}
+	require.NoError(t, db.SetUser("alice", user))
+
+	for dir, files := range map[string]map[string]string{
+		feedsDir: {"alice": "2020-01-01T00:00:00Z\tHello ![](https://pod.example.com/media/abc)\n"},
+		msgsDir:  {"alice": "From bob\n\nHi\n"},
+		mediaDir: {"abc.webp": "webp", "abc.png": "png", "other.webp": "other"},
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(data, dir), 0755))
+		for name, content := range files {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(data, dir, name), []byte(content), 0644))
+		}
+	}
+
+	task := NewExportTask(conf, db, "alice")
+	require.NoError(t, task.Run())
+	require.Equal(t, TaskStateComplete.String(), task.Result().State)
+
+	id := task.Result().Data["exportID"]
+	assert.Equal(t, URLForExport(conf.BaseURL, id), task.Result().Data["exportURI"])
+
+	zr, err := zip.OpenReader(ExportPath(conf, "alice", id))
+	require.NoError(t, err)
+	defer zr.Close()
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		contents[f.Name] = string(body)
+	}
+
+	assert.Contains(t, contents["feeds/alice/twtxt.txt"], "Hello")
+	assert.Equal(t, "From bob\n\nHi\n", contents["messages.mbox"])
+	assert.Equal(t, "webp", contents["media/abc.webp"])
+	assert.Equal(t, "png", contents["media/abc.png"])
+	assert.NotContains(t, contents, "media/other.webp")
+	assert.Contains(t, contents["follows.txt"], "# follow = bob https://bob.example.com/twtxt.txt")
+	assert.Contains(t, contents, "README.txt")
+	assert.NotContains(t, contents["settings.json"], "secret-hash")
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxFeedLinks is the number of links a feed's profile may have
+	maxFeedLinks = 5
+)
+
+var (
+	ErrTooManyFeedLinks = errors.New("error: too many links")
+	ErrInvalidFeedLink  = errors.New("error: links must be http or https urls")
+)
+
+// ParseFeedLinks parses the links of a feed's profile given one per line
+func ParseFeedLinks(text string) ([]string, error) {
+	links := []string{}
+
+	for _, line := range strings.Split(text, "\n") {
+		link := strings.TrimSpace(line)
+		if link == "" {
+			continue
+		}
+
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, ErrInvalidFeedLink
+		}
+
+		links = append(links, u.String())
+	}
+
+	if len(links) > maxFeedLinks {
+		return nil, ErrTooManyFeedLinks
+	}
+
+	return links, nil
+}
+
+// UpdateFeedProfile updates the feed's profile from the form values of a
+// request to manage it and stores its new avatar if one was uploaded
+func UpdateFeedProfile(conf *Config, feed *Feed, r *http.Request) error {
+	links, err := ParseFeedLinks(r.FormValue("links"))
+	if err != nil {
+		return err
+	}
+
+	avatarFile, _, err := r.FormFile("avatar_file")
+	if err != nil && err != http.ErrMissingFile {
+		return err
+	}
+
+	if avatarFile != nil {
+		opts := &ImageOptions{
+			Resize: true,
+			Width:  AvatarResolution,
+			Height: AvatarResolution,
+		}
+		if _, err := StoreUploadedImage(conf, avatarFile, avatarsDir, feed.Name, opts); err != nil {
+			return err
+		}
+	}
+
+	feed.Tagline = strings.Join(strings.Fields(r.FormValue("tagline")), " ")
+	feed.Description = strings.TrimSpace(r.FormValue("description"))
+	feed.Links = links
+	feed.IsFollowersPubliclyVisible = r.FormValue("isFollowersPubliclyVisible") == "on"
+	feed.IsMembersPubliclyVisible = r.FormValue("isMembersPubliclyVisible") == "on"
+
+	return nil
+}
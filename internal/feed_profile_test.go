@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeedLinks(t *testing.T) {
+	links, err := ParseFeedLinks("https://example.com\n\n  http://example.org/about  \r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com", "http://example.org/about"}, links)
+
+	links, err = ParseFeedLinks("")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	_, err = ParseFeedLinks("javascript:alert(1)")
+	assert.Equal(t, ErrInvalidFeedLink, err)
+
+	_, err = ParseFeedLinks("example.com")
+	assert.Equal(t, ErrInvalidFeedLink, err)
+
+	_, err = ParseFeedLinks("https://a.com\nhttps://b.com\nhttps://c.com\nhttps://d.com\nhttps://e.com\nhttps://f.com")
+	assert.Equal(t, ErrTooManyFeedLinks, err)
+}
+
+func TestUserFeedLimit(t *testing.T) {
+	conf := &Config{MaxUserFeeds: 3}
+	user := NewUser()
+
+	assert.Equal(t, 3, user.FeedLimit(conf))
+
+	user.MaxFeeds = 10
+	assert.Equal(t, 10, user.FeedLimit(conf))
+
+	user.MaxFeeds = 0
+	assert.Equal(t, DefaultMaxUserFeeds, user.FeedLimit(&Config{}))
+}
+
+func TestFeedProfilePrivacy(t *testing.T) {
+	feed := NewFeed()
+	feed.Name = "project"
+	feed.Description = "All about the project"
+	feed.Followers = map[string]string{"carol": "https://pod.example.com/user/carol/twtxt.txt"}
+	feed.Owners = map[string]string{"alice": FeedRoleOwner}
+
+	alice := NewUser()
+	alice.Username = "alice"
+
+	profile := feed.Profile("https://pod.example.com", nil)
+	assert.Equal(t, "All about the project", profile.Tagline)
+	assert.Equal(t, feed.Followers, profile.Followers)
+	assert.Equal(t, feed.Owners, profile.Members)
+
+	feed.Tagline = "The project"
+	feed.IsFollowersPubliclyVisible = false
+	feed.IsMembersPubliclyVisible = false
+
+	profile = feed.Profile("https://pod.example.com", nil)
+	assert.Equal(t, "The project", profile.Tagline)
+	assert.Empty(t, profile.Followers)
+	assert.Empty(t, profile.Members)
+
+	profile = feed.Profile("https://pod.example.com", alice)
+	assert.Equal(t, feed.Followers, profile.Followers)
+	assert.Equal(t, feed.Owners, profile.Members)
+}
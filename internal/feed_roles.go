@@ -0,0 +1,363 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// FeedRoleOwner can do anything with a feed including managing its
+	// members, transferring and archiving it
+	FeedRoleOwner = "owner"
+
+	// FeedRoleEditor can post as a feed and update its description and avatar
+	FeedRoleEditor = "editor"
+
+	// FeedRolePoster can only post as a feed
+	FeedRolePoster = "poster"
+
+	FeedActionPost     = "post"
+	FeedActionBlog     = "blog"
+	FeedActionUpdate   = "update"
+	FeedActionInvite   = "invite"
+	FeedActionJoin     = "join"
+	FeedActionRemove   = "remove"
+	FeedActionRole     = "role"
+	FeedActionTransfer = "transfer"
+
+	// maxFeedAuditEntries is the number of audit entries kept per feed, the
+	// oldest entries are dropped as new ones are added
+	maxFeedAuditEntries = 500
+)
+
+var (
+	ErrInvalidFeedRole      = errors.New("error: invalid feed role")
+	ErrFeedPermissionDenied = errors.New("error: your role on this feed does not permit this")
+	ErrFeedMemberExists     = errors.New("error: user is already a member of this feed")
+	ErrFeedMemberNotFound   = errors.New("error: user is not a member of this feed")
+	ErrFeedInviteNotFound   = errors.New("error: no invitation to this feed")
+	ErrLastFeedOwner        = errors.New("error: a feed must have at least one owner")
+
+	// FeedRoles are the roles a member of a feed can have from the most to
+	// the least privileged
+	FeedRoles = []string{FeedRoleOwner, FeedRoleEditor, FeedRolePoster}
+)
+
+// FeedAuditEntry records which member of a feed did what and when
+type FeedAuditEntry struct {
+	Created  time.Time
+	Username string
+	Action   string
+	Detail   string
+}
+
+// ValidFeedRole returns true if role is one of FeedRoles
+func ValidFeedRole(role string) bool {
+	return HasString(FeedRoles, role)
+}
+
+// Role returns the user's role on the feed or an empty string if they are
+// not a member. Owners of feeds created before feeds had roles are only
+// recorded against the user and are treated as owners.
+func (f *Feed) Role(user *User) string {
+	if user == nil {
+		return ""
+	}
+	if role, ok := f.Owners[user.Username]; ok {
+		return role
+	}
+	if user.OwnsFeed(f.Name) {
+		return FeedRoleOwner
+	}
+	return ""
+}
+
+// Can returns true if the user's role on the feed permits the action
+func (f *Feed) Can(user *User, action string) bool {
+	switch f.Role(user) {
+	case FeedRoleOwner:
+		return true
+	case FeedRoleEditor:
+		return action == FeedActionPost || action == FeedActionBlog || action == FeedActionUpdate
+	case FeedRolePoster:
+		return action == FeedActionPost || action == FeedActionBlog
+	default:
+		return false
+	}
+}
+
+// InvitedAs returns the role username has been invited to join the feed
+// with or an empty string if they have not been invited
+func (f *Feed) InvitedAs(username string) string {
+	return f.Invites[username]
+}
+
+// HasOtherOwners returns true if anyone other than username owns the feed
+func (f *Feed) HasOtherOwners(username string) bool {
+	for member, role := range f.Owners {
+		if member != username && role == FeedRoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAuditEntry records an action by username in the feed's audit trail
+func (f *Feed) AddAuditEntry(username, action, detail string) {
+	f.Audit = append(f.Audit, FeedAuditEntry{
+		Created:  time.Now(),
+		Username: username,
+		Action:   action,
+		Detail:   detail,
+	})
+	if len(f.Audit) > maxFeedAuditEntries {
+		f.Audit = f.Audit[len(f.Audit)-maxFeedAuditEntries:]
+	}
+}
+
+// AuditTrail returns the feed's audit entries newest first
+func (f *Feed) AuditTrail() []FeedAuditEntry {
+	entries := make([]FeedAuditEntry, len(f.Audit))
+	for i, entry := range f.Audit {
+		entries[len(f.Audit)-1-i] = entry
+	}
+	return entries
+}
+
+// adopt records the legacy owner of a feed created before feeds had roles
+// so that they count as an owner once other members are added
+func (f *Feed) adopt(user *User) {
+	if _, ok := f.Owners[user.Username]; !ok && user.OwnsFeed(f.Name) {
+		f.Owners[user.Username] = FeedRoleOwner
+	}
+}
+
+// PostAsFeed appends a twt to the named feed on behalf of user if their role
+// permits it and records who posted it in the feed's audit trail
+func PostAsFeed(conf *Config, db Store, user *User, name, text string, args ...interface{}) (types.Twt, error) {
+	feed, err := db.GetFeed(name)
+	if err != nil {
+		if err == ErrFeedNotFound {
+			return types.NilTwt, ErrFeedImposter
+		}
+		return types.NilTwt, err
+	}
+
+	if !feed.Can(user, FeedActionPost) {
+		return types.NilTwt, ErrFeedImposter
+	}
+
+	twt, err := AppendSpecial(conf, db, feed.Name, text, args...)
+	if err != nil {
+		return types.NilTwt, err
+	}
+
+	feed.AddAuditEntry(user.Username, FeedActionPost, twt.Hash())
+	if err := db.SetFeed(feed.Name, feed); err != nil {
+		log.WithError(err).Warnf("error recording post by %s to feed %s", user.Username, feed.Name)
+	}
+
+	return twt, nil
+}
+
+// InviteFeedMember invites username to join the feed with the given role.
+// The invitation is recorded on the feed until the user accepts or
+// declines it.
+func InviteFeedMember(db Store, by *User, feed *Feed, username, role string) error {
+	if !ValidFeedRole(role) {
+		return ErrInvalidFeedRole
+	}
+	if !feed.Can(by, FeedActionInvite) {
+		return ErrFeedPermissionDenied
+	}
+	if !db.HasUser(username) {
+		return ErrUserNotFound
+	}
+
+	feed.adopt(by)
+
+	if _, ok := feed.Owners[username]; ok {
+		return ErrFeedMemberExists
+	}
+
+	feed.Invites[username] = role
+	feed.AddAuditEntry(by.Username, FeedActionInvite, fmt.Sprintf("%s as %s", username, role))
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// AcceptFeedInvite makes the user a member of the feed with the role they
+// were invited with
+func AcceptFeedInvite(db Store, user *User, feed *Feed) error {
+	role, ok := feed.Invites[user.Username]
+	if !ok {
+		return ErrFeedInviteNotFound
+	}
+
+	delete(feed.Invites, user.Username)
+	feed.Owners[user.Username] = role
+	feed.AddAuditEntry(user.Username, FeedActionJoin, role)
+
+	// Only owners count the feed as theirs, see AddFeedOwnership
+	if role == FeedRoleOwner {
+		user.MemberFeeds = RemoveString(user.MemberFeeds, feed.Name)
+		if !user.OwnsFeed(feed.Name) {
+			user.Feeds = append(user.Feeds, feed.Name)
+		}
+	} else {
+		user.Feeds = RemoveString(user.Feeds, feed.Name)
+		if !user.IsFeedMember(feed.Name) {
+			user.MemberFeeds = append(user.MemberFeeds, feed.Name)
+		}
+	}
+	user.Follow(feed.Name, feed.URL)
+	feed.AddFollower(user.Username, user.URL)
+
+	if err := db.SetUser(user.Username, user); err != nil {
+		return err
+	}
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// DeclineFeedInvite removes the user's invitation to the feed
+func DeclineFeedInvite(db Store, user *User, feed *Feed) error {
+	if _, ok := feed.Invites[user.Username]; !ok {
+		return ErrFeedInviteNotFound
+	}
+
+	delete(feed.Invites, user.Username)
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// RemoveFeedMember removes username from the feed or revokes their pending
+// invitation. Members may always remove themselves but a feed's last owner
+// cannot leave it.
+func RemoveFeedMember(db Store, by *User, feed *Feed, username string) error {
+	if username != by.Username && !feed.Can(by, FeedActionRemove) {
+		return ErrFeedPermissionDenied
+	}
+
+	feed.adopt(by)
+
+	if _, ok := feed.Invites[username]; ok {
+		delete(feed.Invites, username)
+		feed.AddAuditEntry(by.Username, FeedActionRemove, fmt.Sprintf("invitation for %s", username))
+		return db.SetFeed(feed.Name, feed)
+	}
+
+	role, ok := feed.Owners[username]
+	if !ok {
+		return ErrFeedMemberNotFound
+	}
+	if role == FeedRoleOwner && !feed.HasOtherOwners(username) {
+		return ErrLastFeedOwner
+	}
+
+	delete(feed.Owners, username)
+	feed.AddAuditEntry(by.Username, FeedActionRemove, username)
+
+	if user, err := db.GetUser(username); err == nil {
+		if err := RemoveFeedOwnership(db, user, feed); err != nil {
+			return err
+		}
+	}
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// SetFeedMemberRole changes the role of a member of the feed
+func SetFeedMemberRole(db Store, by *User, feed *Feed, username, role string) error {
+	if !ValidFeedRole(role) {
+		return ErrInvalidFeedRole
+	}
+	if !feed.Can(by, FeedActionRole) {
+		return ErrFeedPermissionDenied
+	}
+
+	feed.adopt(by)
+
+	current, ok := feed.Owners[username]
+	if !ok {
+		return ErrFeedMemberNotFound
+	}
+	if current == role {
+		return nil
+	}
+	if current == FeedRoleOwner && !feed.HasOtherOwners(username) {
+		return ErrLastFeedOwner
+	}
+
+	feed.Owners[username] = role
+	feed.AddAuditEntry(by.Username, FeedActionRole, fmt.Sprintf("%s from %s to %s", username, current, role))
+
+	member, err := db.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if role == FeedRoleOwner {
+		err = AddFeedOwnership(db, member, feed)
+	} else {
+		err = AddFeedMembership(db, member, feed)
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// TransferFeed hands the feed over from one of its owners to another user
+// who becomes an owner in their place
+func TransferFeed(db Store, from, to *User, feed *Feed) error {
+	if !feed.Can(from, FeedActionTransfer) {
+		return ErrFeedPermissionDenied
+	}
+
+	delete(feed.Owners, from.Username)
+	delete(feed.Invites, to.Username)
+	feed.Owners[to.Username] = FeedRoleOwner
+	feed.AddAuditEntry(from.Username, FeedActionTransfer, to.Username)
+
+	if err := RemoveFeedOwnership(db, from, feed); err != nil {
+		return err
+	}
+	if err := AddFeedOwnership(db, to, feed); err != nil {
+		return err
+	}
+
+	return db.SetFeed(feed.Name, feed)
+}
+
+// ArchiveFeed detaches every member from the feed so that nobody can post
+// as it anymore. The feed and its twts are kept.
+func ArchiveFeed(db Store, user *User, feed *Feed) error {
+	if !feed.Can(user, FeedActionRemove) {
+		return ErrFeedPermissionDenied
+	}
+
+	for username := range feed.Owners {
+		if username == user.Username {
+			continue
+		}
+		member, err := db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Warnf("error loading member %s of feed %s", username, feed.Name)
+			continue
+		}
+		if err := RemoveFeedOwnership(db, member, feed); err != nil {
+			return err
+		}
+	}
+
+	feed.Owners = make(map[string]string)
+	feed.Invites = make(map[string]string)
+
+	return DetachFeedFromOwner(db, user, feed)
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedRoles(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-feed-roles")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, BaseURL: "https://pod.example.com"}
+
+	newUser := func(username string) *User {
+		user := NewUser()
+		user.Username = username
+		user.URL = URLForUser(conf, username)
+		require.NoError(t, db.SetUser(username, user))
+		return user
+	}
+
+	alice := newUser("alice")
+	bob := newUser("bob")
+	carol := newUser("carol")
+
+	require.NoError(t, CreateFeed(conf, db, alice, "project", false))
+	feed, err := db.GetFeed("project")
+	require.NoError(t, err)
+	assert.Equal(t, FeedRoleOwner, feed.Role(alice))
+	assert.Equal(t, "", feed.Role(bob))
+
+	_, err = PostAsFeed(conf, db, bob, "project", "Hello")
+	assert.Equal(t, ErrFeedImposter, err)
+
+	assert.Equal(t, ErrFeedPermissionDenied, InviteFeedMember(db, bob, feed, "carol", FeedRolePoster))
+	assert.Equal(t, ErrInvalidFeedRole, InviteFeedMember(db, alice, feed, "bob", "admin"))
+	require.NoError(t, InviteFeedMember(db, alice, feed, "bob", FeedRolePoster))
+	assert.Equal(t, FeedRolePoster, feed.InvitedAs("bob"))
+
+	require.NoError(t, AcceptFeedInvite(db, bob, feed))
+	assert.False(t, bob.OwnsFeed("project"))
+	assert.True(t, bob.IsFeedMember("project"))
+	assert.Equal(t, []string{"project"}, bob.PostAsFeeds())
+	assert.Equal(t, ErrFeedInviteNotFound, AcceptFeedInvite(db, carol, feed))
+
+	twt, err := PostAsFeed(conf, db, bob, "project", "Hello from bob")
+	require.NoError(t, err)
+
+	feed, err = db.GetFeed("project")
+	require.NoError(t, err)
+	assert.True(t, feed.Can(bob, FeedActionPost))
+	assert.False(t, feed.Can(bob, FeedActionUpdate))
+
+	trail := feed.AuditTrail()
+	require.NotEmpty(t, trail)
+	assert.Equal(t, "bob", trail[0].Username)
+	assert.Equal(t, FeedActionPost, trail[0].Action)
+	assert.Equal(t, twt.Hash(), trail[0].Detail)
+
+	assert.Equal(t, ErrFeedPermissionDenied, SetFeedMemberRole(db, bob, feed, "bob", FeedRoleOwner))
+	require.NoError(t, SetFeedMemberRole(db, alice, feed, "bob", FeedRoleEditor))
+	assert.True(t, feed.Can(bob, FeedActionUpdate))
+
+	// Only owners count the feed as their own
+	require.NoError(t, SetFeedMemberRole(db, alice, feed, "bob", FeedRoleOwner))
+	bob, err = db.GetUser("bob")
+	require.NoError(t, err)
+	assert.True(t, bob.OwnsFeed("project"))
+	assert.False(t, bob.IsFeedMember("project"))
+
+	require.NoError(t, SetFeedMemberRole(db, alice, feed, "bob", FeedRoleEditor))
+	bob, err = db.GetUser("bob")
+	require.NoError(t, err)
+	assert.False(t, bob.OwnsFeed("project"))
+	assert.True(t, bob.IsFeedMember("project"))
+
+	assert.Equal(t, ErrLastFeedOwner, SetFeedMemberRole(db, alice, feed, "alice", FeedRoleEditor))
+	assert.Equal(t, ErrLastFeedOwner, RemoveFeedMember(db, alice, feed, "alice"))
+
+	require.NoError(t, RemoveFeedMember(db, bob, feed, "bob"))
+	bob, err = db.GetUser("bob")
+	require.NoError(t, err)
+	assert.False(t, bob.OwnsFeed("project"))
+	assert.False(t, bob.IsFeedMember("project"))
+	assert.Equal(t, "", feed.Role(bob))
+}
@@ -0,0 +1,353 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// FeedFormatTwtxt is a plain twtxt.txt feed
+	FeedFormatTwtxt = "twtxt"
+
+	// FeedFormatRSS is an RSS 2.0 feed
+	FeedFormatRSS = "rss"
+
+	// FeedFormatAtom is an Atom (RFC 4287) feed
+	FeedFormatAtom = "atom"
+
+	// FeedFormatJSON is a JSON Feed (https://jsonfeed.org/)
+	FeedFormatJSON = "json"
+
+	// maxFeedEntryTitle is the maximum length of a title derived from an
+	// entry's content when the entry has no title of its own
+	maxFeedEntryTitle = 140
+)
+
+var (
+	ErrInvalidSyndicationFeed = errors.New("error: invalid rss, atom or json feed")
+
+	cdataRe     = regexp.MustCompile(`<!\[CDATA\[((?s).*?)\]\]>`)
+	stripTagsRe = regexp.MustCompile(`<[^>]*>`)
+
+	// feedTimeLayouts are the timestamp layouts seen in the wild in RSS,
+	// Atom and JSON feeds, tried in order
+	feedTimeLayouts = []string{
+		time.RFC3339,
+		time.RFC3339Nano,
+		time.RFC1123Z,
+		time.RFC1123,
+		time.RFC822Z,
+		time.RFC822,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"2 Jan 2006 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	}
+)
+
+// feedEntry is a single entry of a syndication feed normalized across the
+// RSS, Atom and JSON Feed formats
+type feedEntry struct {
+	Title   string
+	Link    string
+	Content string
+	Created time.Time
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Link  string `xml:"link"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+			Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// atomText is an Atom text construct which may contain (x)html markup
+type atomText struct {
+	Body string `xml:",innerxml"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name `xml:"feed"`
+	Entries []struct {
+		Title     atomText   `xml:"title"`
+		ID        string     `xml:"id"`
+		Links     []atomLink `xml:"link"`
+		Summary   atomText   `xml:"summary"`
+		Content   atomText   `xml:"content"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+	} `xml:"entry"`
+}
+
+type jsonFeed struct {
+	Version string `json:"version"`
+	Items   []struct {
+		ID            string `json:"id"`
+		URL           string `json:"url"`
+		ExternalURL   string `json:"external_url"`
+		Title         string `json:"title"`
+		ContentText   string `json:"content_text"`
+		ContentHTML   string `json:"content_html"`
+		Summary       string `json:"summary"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+// DetectFeedFormat returns the format of a feed from its Content-Type and,
+// for generic or missing types, by sniffing the start of its body.
+func DetectFeedFormat(contentType string, data []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/rss+xml":
+		return FeedFormatRSS
+	case "application/atom+xml":
+		return FeedFormatAtom
+	case "application/feed+json":
+		return FeedFormatJSON
+	case "text/plain":
+		return FeedFormatTwtxt
+	}
+
+	head := bytes.ToLower(bytes.TrimSpace(data))
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("{")) && bytes.Contains(head, []byte("jsonfeed.org/version")):
+		return FeedFormatJSON
+	case bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<rss")):
+		return FeedFormatRSS
+	case bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<feed")):
+		return FeedFormatAtom
+	}
+
+	return FeedFormatTwtxt
+}
+
+// ParseFeed parses a twtxt, RSS, Atom or JSON feed as detected by
+// DetectFeedFormat and returns its twts split into current and old twts in
+// the same way as types.ParseFile
+func ParseFeed(r io.Reader, contentType string, twter types.Twter, ttl time.Duration, N int) (types.Twts, types.Twts, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format := DetectFeedFormat(contentType, data)
+	if format == FeedFormatTwtxt {
+		return types.ParseFile(bytes.NewReader(data), twter, ttl, N)
+	}
+
+	entries, err := parseFeedEntries(format, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var twts, old types.Twts
+
+	oldTime := time.Now().Add(-ttl)
+
+	for _, entry := range entries {
+		twt, err := entry.Twt(twter)
+		if err != nil {
+			continue
+		}
+
+		if ttl > 0 && twt.Created().Before(oldTime) {
+			old = append(old, twt)
+		} else {
+			twts = append(twts, twt)
+		}
+	}
+
+	sort.Sort(twts)
+	sort.Sort(old)
+
+	if N > 0 && len(twts) > N {
+		old = append(old, twts[N:]...)
+		twts = twts[:N]
+	}
+
+	return twts, old, nil
+}
+
+func parseFeedEntries(format string, data []byte) ([]feedEntry, error) {
+	var entries []feedEntry
+
+	switch format {
+	case FeedFormatRSS:
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, ErrInvalidSyndicationFeed
+		}
+		for _, item := range feed.Channel.Items {
+			link := item.Link
+			if link == "" && strings.HasPrefix(item.GUID, "http") {
+				link = item.GUID
+			}
+			date := item.PubDate
+			if date == "" {
+				date = item.Date
+			}
+			entries = append(entries, feedEntry{
+				Title:   item.Title,
+				Link:    link,
+				Content: item.Description,
+				Created: ParseFeedTime(date),
+			})
+		}
+	case FeedFormatAtom:
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, ErrInvalidSyndicationFeed
+		}
+		for _, entry := range feed.Entries {
+			var link string
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			content := entry.Summary.Body
+			if content == "" {
+				content = entry.Content.Body
+			}
+			date := entry.Published
+			if date == "" {
+				date = entry.Updated
+			}
+			entries = append(entries, feedEntry{
+				Title:   entry.Title.Body,
+				Link:    link,
+				Content: content,
+				Created: ParseFeedTime(date),
+			})
+		}
+	case FeedFormatJSON:
+		var feed jsonFeed
+		if err := json.Unmarshal(data, &feed); err != nil {
+			return nil, ErrInvalidSyndicationFeed
+		}
+		for _, item := range feed.Items {
+			link := item.URL
+			if link == "" {
+				link = item.ExternalURL
+			}
+			content := item.ContentText
+			if content == "" {
+				content = item.Summary
+			}
+			if content == "" {
+				content = item.ContentHTML
+			}
+			date := item.DatePublished
+			if date == "" {
+				date = item.DateModified
+			}
+			entries = append(entries, feedEntry{
+				Title:   item.Title,
+				Link:    link,
+				Content: content,
+				Created: ParseFeedTime(date),
+			})
+		}
+	default:
+		return nil, ErrInvalidSyndicationFeed
+	}
+
+	return entries, nil
+}
+
+// ParseFeedTime parses a timestamp from an RSS, Atom or JSON feed returning
+// the zero time if it is missing or in an unknown layout
+func ParseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+
+	return time.Time{}
+}
+
+// cleanFeedText strips markup from feed text and collapses it onto a single
+// line as twts are line delimited
+func cleanFeedText(s string) string {
+	s = cdataRe.ReplaceAllString(s, "$1")
+	s = stripTagsRe.ReplaceAllString(s, " ")
+	s = stripTagsRe.ReplaceAllString(html.UnescapeString(s), " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Twt converts the entry into a twt with a text of the entry's title
+// followed by its link. Entries without a title (common for microblogs) use
+// their truncated content instead. The twt's hash is stable for as long as
+// the entry's title, link and timestamp don't change.
+func (e feedEntry) Twt(twter types.Twter) (types.Twt, error) {
+	if e.Created.IsZero() {
+		return nil, fmt.Errorf("error: feed entry %q has no timestamp", e.Link)
+	}
+
+	title := cleanFeedText(e.Title)
+	if title == "" {
+		title = cleanFeedText(e.Content)
+		if runes := []rune(title); len(runes) > maxFeedEntryTitle {
+			title = strings.TrimSpace(string(runes[:maxFeedEntryTitle-1])) + "…"
+		}
+	}
+
+	link := strings.TrimSpace(e.Link)
+
+	var text string
+	switch {
+	case title != "" && link != "":
+		text = fmt.Sprintf("**%s** %s", title, link)
+	case link != "":
+		text = link
+	case title != "":
+		text = title
+	default:
+		return nil, fmt.Errorf("error: empty feed entry")
+	}
+
+	line := fmt.Sprintf("%s\t%s", e.Created.Format(time.RFC3339), text)
+
+	return types.ParseLine(line, twter)
+}
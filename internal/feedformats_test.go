@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	_ "github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestDetectFeedFormat(t *testing.T) {
+	assert.Equal(t, FeedFormatTwtxt, DetectFeedFormat("text/plain; charset=utf-8", []byte("<rss>")))
+	assert.Equal(t, FeedFormatRSS, DetectFeedFormat("application/rss+xml", nil))
+	assert.Equal(t, FeedFormatAtom, DetectFeedFormat("application/atom+xml", nil))
+	assert.Equal(t, FeedFormatJSON, DetectFeedFormat("application/feed+json", nil))
+	assert.Equal(t, FeedFormatRSS, DetectFeedFormat("text/xml", []byte(`<?xml version="1.0"?><rss version="2.0">`)))
+	assert.Equal(t, FeedFormatAtom, DetectFeedFormat("", []byte(`<feed xmlns="http://www.w3.org/2005/Atom">`)))
+	assert.Equal(t, FeedFormatJSON, DetectFeedFormat("application/json", []byte(`{"version": "https://jsonfeed.org/version/1.1"}`)))
+	assert.Equal(t, FeedFormatTwtxt, DetectFeedFormat("", []byte("2020-11-01T12:00:00Z\tHello")))
+}
+
+func TestParseFeed(t *testing.T) {
+	twter := types.Twter{Nick: "blog", URL: "https://blog.example.com/feed"}
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"rss", "application/rss+xml", `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>Second &lt;b&gt;post&lt;/b&gt;</title><link>https://blog.example.com/2</link><pubDate>Mon, 02 Nov 2020 12:00:00 +0000</pubDate></item>
+<item><title>First post</title><link>https://blog.example.com/1</link><pubDate>Sun, 01 Nov 2020 12:00:00 GMT</pubDate></item>
+<item><title>Undated</title><link>https://blog.example.com/0</link></item>
+</channel></rss>`},
+		{"atom", "application/atom+xml", `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><title>First post</title><link rel="alternate" href="https://blog.example.com/1"/><published>2020-11-01T12:00:00Z</published></entry>
+<entry><title>Second <b>post</b></title><link href="https://blog.example.com/2"/><updated>2020-11-02T12:00:00Z</updated></entry>
+</feed>`},
+		{"json", "application/feed+json", `{"version": "https://jsonfeed.org/version/1.1", "items": [
+{"id": "1", "url": "https://blog.example.com/1", "title": "First post", "date_published": "2020-11-01T12:00:00Z"},
+{"id": "2", "url": "https://blog.example.com/2", "title": "Second <b>post</b>", "date_published": "2020-11-02T12:00:00Z"}
+]}`},
+	}
+
+	var hashes []string
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			twts, old, err := ParseFeed(strings.NewReader(testCase.body), testCase.contentType, twter, 0, 0)
+			require.NoError(t, err)
+			assert.Len(t, old, 0)
+			require.Len(t, twts, 2)
+
+			assert.Equal(t, "**Second post** https://blog.example.com/2", twts[0].Text())
+			assert.Equal(t, time.Date(2020, 11, 2, 12, 0, 0, 0, time.UTC), twts[0].Created().UTC())
+			assert.Equal(t, "**First post** https://blog.example.com/1", twts[1].Text())
+
+			hashes = append(hashes, twts[0].Hash())
+		})
+	}
+
+	// The same entry hashes the same regardless of the feed's format
+	require.Len(t, hashes, 3)
+	assert.Equal(t, hashes[0], hashes[1])
+	assert.Equal(t, hashes[1], hashes[2])
+
+	twts, old, err := ParseFeed(strings.NewReader(testCases[0].body), testCases[0].contentType, twter, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, twts, 1)
+	assert.Len(t, old, 1)
+
+	_, _, err = ParseFeed(strings.NewReader("<rss><channel>"), "application/rss+xml", twter, 0, 0)
+	assert.Equal(t, ErrInvalidSyndicationFeed, err)
+}
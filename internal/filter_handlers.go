@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ParseFilterExpiry parses the expiry of a mute filter. An empty string or
+// "never" means the filter never expires.
+func ParseFilterExpiry(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "never" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// AddFilterHandler ...
+func (s *Server) AddFilterHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		expiry, err := ParseFilterExpiry(r.FormValue("expires"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Invalid filter expiry: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		filter, err := NewMuteFilter(
+			r.FormValue("type"),
+			r.FormValue("value"),
+			r.FormValue("action"),
+			expiry,
+		)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error adding filter: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		user.AddFilter(filter)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error adding filter"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// DeleteFilterHandler ...
+func (s *Server) DeleteFilterHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		if err := user.RemoveFilter(p.ByName("id")); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error deleting filter"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error deleting filter"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
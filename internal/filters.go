@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// FilterKeyword matches twts containing a word or phrase (case insensitive)
+	FilterKeyword = "keyword"
+
+	// FilterRegex matches twts whose text matches a regular expression
+	FilterRegex = "regex"
+
+	// FilterTag matches twts tagged with a #hashtag
+	FilterTag = "tag"
+
+	// FilterURL matches twts mentioning or linking to a URL
+	FilterURL = "url"
+
+	// FilterActionHide removes matching twts from view entirely
+	FilterActionHide = "hide"
+
+	// FilterActionWarn collapses matching twts behind a warning
+	FilterActionWarn = "warn"
+)
+
+var (
+	ErrInvalidFilterType   = errors.New("error: invalid filter type")
+	ErrInvalidFilterAction = errors.New("error: invalid filter action")
+	ErrInvalidFilterValue  = errors.New("error: invalid filter value")
+	ErrFilterNotFound      = errors.New("error: filter not found")
+)
+
+// MuteFilter hides or collapses twts matching a keyword, regular expression,
+// hashtag or mentioned URL, optionally until ExpiresAt.
+type MuteFilter struct {
+	ID        string
+	Type      string
+	Value     string
+	Action    string `default:"hide"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	re *regexp.Regexp
+}
+
+// NewMuteFilter validates and returns a new filter. A zero expiry creates a
+// filter that never expires.
+func NewMuteFilter(typ, value, action string, expiry time.Duration) (*MuteFilter, error) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	action = strings.ToLower(strings.TrimSpace(action))
+	value = strings.TrimSpace(value)
+
+	if action == "" {
+		action = FilterActionHide
+	}
+	if action != FilterActionHide && action != FilterActionWarn {
+		return nil, ErrInvalidFilterAction
+	}
+
+	switch typ {
+	case FilterKeyword:
+		value = strings.ToLower(value)
+	case FilterRegex:
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, ErrInvalidFilterValue
+		}
+	case FilterTag:
+		value = strings.ToLower(strings.TrimPrefix(value, "#"))
+	case FilterURL:
+		value = NormalizeURL(value)
+	default:
+		return nil, ErrInvalidFilterType
+	}
+
+	if value == "" {
+		return nil, ErrInvalidFilterValue
+	}
+
+	now := time.Now()
+
+	filter := &MuteFilter{
+		ID:        GenerateRandomToken(),
+		Type:      typ,
+		Value:     value,
+		Action:    action,
+		CreatedAt: now,
+	}
+
+	if expiry > 0 {
+		filter.ExpiresAt = now.Add(expiry)
+	}
+
+	return filter, nil
+}
+
+// Expired returns true if the filter has an expiry that has passed
+func (f *MuteFilter) Expired() bool {
+	return !f.ExpiresAt.IsZero() && time.Now().After(f.ExpiresAt)
+}
+
+// String returns a human readable description of the filter
+func (f *MuteFilter) String() string {
+	switch f.Type {
+	case FilterTag:
+		return "#" + f.Value
+	case FilterRegex:
+		return "/" + f.Value + "/"
+	default:
+		return f.Value
+	}
+}
+
+// Match returns true if the twt matches the filter
+func (f *MuteFilter) Match(twt types.Twt) bool {
+	if f.Expired() {
+		return false
+	}
+
+	switch f.Type {
+	case FilterKeyword:
+		return strings.Contains(strings.ToLower(twt.Text()), f.Value)
+	case FilterRegex:
+		if f.re == nil {
+			re, err := regexp.Compile(f.Value)
+			if err != nil {
+				return false
+			}
+			f.re = re
+		}
+		return f.re.MatchString(twt.Text())
+	case FilterTag:
+		for _, tag := range twt.Tags() {
+			if strings.ToLower(strings.TrimPrefix(tag.Tag(), "#")) == f.Value {
+				return true
+			}
+		}
+	case FilterURL:
+		for _, mention := range twt.Mentions() {
+			if NormalizeURL(mention.Twter().URL) == f.Value {
+				return true
+			}
+		}
+		return strings.Contains(twt.Text(), f.Value)
+	}
+
+	return false
+}
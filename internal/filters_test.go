@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestMuteFilter(t *testing.T) {
+	twter := types.Twter{Nick: "test", URL: "http://0.0.0.0:8000/user/test/twtxt.txt"}
+	twt := retwt.NewReTwt(twter, "Hello World! #<golang http://0.0.0.0:8000/search?tag=golang>", time.Now())
+
+	testCases := []struct {
+		typ      string
+		value    string
+		expected bool
+	}{
+		{FilterKeyword, "world", true},
+		{FilterKeyword, "universe", false},
+		{FilterRegex, `^Hello\s`, true},
+		{FilterRegex, `^World`, false},
+		{FilterTag, "#golang", true},
+		{FilterTag, "rust", false},
+	}
+
+	for _, testCase := range testCases {
+		filter, err := NewMuteFilter(testCase.typ, testCase.value, FilterActionHide, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, filter.Match(twt), "%s %s", testCase.typ, testCase.value)
+	}
+
+	_, err := NewMuteFilter("bogus", "value", FilterActionHide, 0)
+	assert.Equal(t, ErrInvalidFilterType, err)
+
+	_, err = NewMuteFilter(FilterRegex, "(", FilterActionHide, 0)
+	assert.Equal(t, ErrInvalidFilterValue, err)
+
+	filter, err := NewMuteFilter(FilterKeyword, "world", FilterActionWarn, time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, filter.Expired())
+
+	filter.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.True(t, filter.Expired())
+	assert.False(t, filter.Match(twt))
+}
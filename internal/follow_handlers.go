@@ -1,14 +1,14 @@
 package internal
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"path/filepath"
-	"regexp"
 	"strings"
 
-	"github.com/jointwt/twtxt"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 )
@@ -18,8 +18,11 @@ func (s *Server) FollowHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
 
-		nick := strings.TrimSpace(r.FormValue("nick"))
-		url := NormalizeURL(r.FormValue("url"))
+		nick, url := ResolveFollow(
+			s.config, s.db,
+			strings.TrimSpace(r.FormValue("nick")),
+			strings.TrimSpace(r.FormValue("url")),
+		)
 
 		if r.Method == "GET" && nick == "" && url == "" {
 			ctx.Title = "Follow a new feed"
@@ -82,18 +85,7 @@ func (s *Server) FollowHandler() httprouter.Handle {
 					return
 				}
 
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(s.config, followee.Username),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				NotifyFeedFollow(s.db, s.events, followee.Username, user.Username, user.URL)
 			} else if s.db.HasFeed(nick) {
 				feed, err := s.db.GetFeed(nick)
 				if err != nil {
@@ -114,18 +106,7 @@ func (s *Server) FollowHandler() httprouter.Handle {
 					return
 				}
 
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						feed.Name, URLForUser(s.config, feed.Name),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				NotifyFeedFollow(s.db, s.events, feed.Name, user.Username, user.URL)
 			}
 		}
 
@@ -135,66 +116,163 @@ func (s *Server) FollowHandler() httprouter.Handle {
 	}
 }
 
-// ImportHandler ...
+// ImportHandler imports feeds for the user, or a feed they own, to follow
+// from an uploaded or pasted OPML document or list of follows. Each one is
+// validated by a FollowsImportTask whose results are shown once complete.
 func (s *Server) ImportHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
+		ctx.Title = "Import feeds from a list"
 
 		if r.Method == "GET" {
-			ctx.Title = "Import feeds from a list"
+			if uuid := r.FormValue("task"); uuid != "" {
+				t, ok := s.tasks.Lookup(uuid)
+				task, isImportTask := t.(*FollowsImportTask)
+				if !ok || !isImportTask || task.username != ctx.Username {
+					ctx.Error = true
+					ctx.Message = "Import not found, it may have expired"
+					s.render("error", w, ctx)
+					return
+				}
+
+				result := task.Result()
+				switch result.State {
+				case TaskStateComplete.String():
+				case TaskStateFailed.String():
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Error importing feeds: %s", result.Error)
+					s.render("error", w, ctx)
+					return
+				default:
+					ctx.TaskURL = URLForTask(s.config.BaseURL, uuid)
+					s.render("import", w, ctx)
+					return
+				}
+
+				if err := json.Unmarshal([]byte(result.Data["results"]), &ctx.ImportResults); err != nil {
+					log.WithError(err).Error("error decoding follows import results")
+					ctx.Error = true
+					ctx.Message = "Error importing feeds"
+					s.render("error", w, ctx)
+					return
+				}
+
+				ctx.Message = fmt.Sprintf(
+					"Successfully imported %s of %d feeds",
+					result.Data["imported"], len(ctx.ImportResults),
+				)
+			}
+
 			s.render("import", w, ctx)
 			return
 		}
 
-		feeds := r.FormValue("feeds")
+		data := []byte(r.FormValue("feeds"))
+
+		file, _, err := r.FormFile("file")
+		if err != nil && err != http.ErrMissingFile {
+			log.WithError(err).Error("error reading import file")
+			ctx.Error = true
+			ctx.Message = "Error reading import file"
+			s.render("error", w, ctx)
+			return
+		}
+		if file != nil {
+			defer file.Close()
+			if data, err = ioutil.ReadAll(io.LimitReader(file, s.config.MaxUploadSize)); err != nil {
+				log.WithError(err).Error("error reading import file")
+				ctx.Error = true
+				ctx.Message = "Error reading import file"
+				s.render("error", w, ctx)
+				return
+			}
+		}
+
+		feeds, err := ParseFollows(data)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error parsing feeds to import: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
 
-		if feeds == "" {
+		if len(feeds) == 0 {
 			ctx.Error = true
 			ctx.Message = "Nothing to import!"
 			s.render("error", w, ctx)
 			return
 		}
 
-		user := ctx.User
-		if user == nil {
-			log.Fatalf("user not found in context")
+		if len(feeds) > maxImportFollows {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error importing feeds: %s", ErrTooManyFollows)
+			s.render("error", w, ctx)
+			return
 		}
 
-		re := regexp.MustCompile(`(?P<nick>.*?)[: ](?P<url>.*)`)
+		feed := r.FormValue("feed")
+		if _, err := GetFollowsImporter(s.db, ctx.User, feed); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error importing feeds: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
 
-		imported := 0
+		uuid, err := s.tasks.Dispatch(NewFollowsImportTask(s.config, s.db, ctx.Username, feed, feeds))
+		if err != nil {
+			log.WithError(err).Error("error dispatching follows import task")
+			ctx.Error = true
+			ctx.Message = "Error importing feeds, please try again later"
+			s.render("error", w, ctx)
+			return
+		}
 
-		scanner := bufio.NewScanner(strings.NewReader(feeds))
-		for scanner.Scan() {
-			line := scanner.Text()
-			matches := re.FindStringSubmatch(line)
-			if len(matches) == 3 {
-				nick := strings.TrimSpace(matches[1])
-				url := NormalizeURL(strings.TrimSpace(matches[2]))
-				if nick != "" && url != "" {
-					user.Following[nick] = url
-					imported++
-				}
-			}
+		ctx.TaskURL = URLForTask(s.config.BaseURL, uuid)
+		s.render("import", w, ctx)
+	}
+}
+
+// ExportHandler downloads the feeds the user, or a feed they own, follows
+// as OPML or as twtxt `# follow = nick url` lines
+func (s *Server) ExportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		format := strings.ToLower(r.FormValue("format"))
+		if format == "" {
+			format = FollowsFormatOPML
+		}
+
+		name := ctx.Username
+		if feed := r.FormValue("feed"); feed != "" {
+			name = feed
 		}
-		if err := scanner.Err(); err != nil {
-			log.WithError(err).Error("error scanning feeds for import")
+
+		from, err := GetFollowsImporter(s.db, ctx.User, name)
+		if err != nil {
 			ctx.Error = true
-			ctx.Message = "Error importing feeds"
+			ctx.Message = fmt.Sprintf("Error exporting feeds: %s", err)
 			s.render("error", w, ctx)
+			return
 		}
 
-		if err := s.db.SetUser(ctx.Username, user); err != nil {
+		data, err := ExportFollowsOf(s.config, from, format)
+		if err != nil {
 			ctx.Error = true
-			ctx.Message = "Error importing feeds"
+			ctx.Message = fmt.Sprintf("Error exporting feeds: %s", err)
 			s.render("error", w, ctx)
 			return
 		}
 
-		ctx.Error = false
-		ctx.Message = fmt.Sprintf("Successfully imported %d feeds", imported)
-		s.render("error", w, ctx)
+		if format == FollowsFormatOPML {
+			w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-follows.opml"`, name))
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-follows.txt"`, name))
+		}
 
+		_, _ = w.Write(data)
 	}
 }
 
@@ -247,18 +325,6 @@ func (s *Server) UnfollowHandler() httprouter.Handle {
 						log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
 					}
 				}
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(s.config, followee.Username),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
 			}
 		}
 
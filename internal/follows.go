@@ -0,0 +1,334 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// FollowsFormatOPML exports follows as an OPML 2.0 outline
+	FollowsFormatOPML = "opml"
+
+	// FollowsFormatTwtxt exports follows as twtxt `# follow = nick url`
+	// metadata comments
+	FollowsFormatTwtxt = "twtxt"
+
+	// maxImportFollows is the maximum number of follows validated in a single
+	// import as each one fetches the feed
+	maxImportFollows = 200
+)
+
+var (
+	ErrInvalidOPML        = errors.New("error: invalid opml document")
+	ErrTooManyFollows     = errors.New("error: too many follows to import at once")
+	ErrUnknownFollowsType = errors.New("error: unknown follows export format")
+
+	followMetaRe = regexp.MustCompile(`^#\s*follow\s*=\s*(\S+)\s+(\S+)`)
+	followLineRe = regexp.MustCompile(`^@?<?([^\s:<>]+)(?::\s*|\s+)(https?://[^\s>]+)>?$`)
+)
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// sortedFollows returns a map of nick to url as a list of feeds sorted by nick
+func sortedFollows(follows map[string]string) []types.Feed {
+	var feeds []types.Feed
+	for nick, url := range follows {
+		feeds = append(feeds, types.Feed{Nick: nick, URL: url})
+	}
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].Nick < feeds[j].Nick })
+	return feeds
+}
+
+// URLForFollowsImport returns the URL of the results of a FollowsImportTask
+func URLForFollowsImport(baseURL, uuid string) string {
+	return fmt.Sprintf(
+		"%s/import?task=%s",
+		strings.TrimSuffix(baseURL, "/"),
+		uuid,
+	)
+}
+
+// ExportFollows serializes the feeds the user follows (nick to url) in the
+// given format which is one of FollowsFormatOPML or FollowsFormatTwtxt
+func ExportFollows(conf *Config, user *User, format string) ([]byte, error) {
+	title := fmt.Sprintf("Feeds followed by %s on %s", user.Username, conf.Name)
+	return exportFollows(title, user.Following, format)
+}
+
+// ExportFeedFollows serializes the feeds an owned feed follows in the given
+// format which is one of FollowsFormatOPML or FollowsFormatTwtxt
+func ExportFeedFollows(conf *Config, feed *Feed, format string) ([]byte, error) {
+	title := fmt.Sprintf("Feeds followed by %s on %s", feed.Name, conf.Name)
+	return exportFollows(title, feed.Following, format)
+}
+
+// ExportFollowsOf serializes the follows of the user or feed returned by
+// GetFollowsImporter in the given format
+func ExportFollowsOf(conf *Config, from FollowsImporter, format string) ([]byte, error) {
+	switch from := from.(type) {
+	case *User:
+		return ExportFollows(conf, from, format)
+	case *Feed:
+		return ExportFeedFollows(conf, from, format)
+	default:
+		return nil, fmt.Errorf("error: cannot export follows of %T", from)
+	}
+}
+
+func exportFollows(title string, following map[string]string, format string) ([]byte, error) {
+	follows := sortedFollows(following)
+
+	switch format {
+	case FollowsFormatOPML:
+		doc := opmlDocument{Version: "2.0"}
+		doc.Head.Title = title
+		doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+
+		for _, feed := range follows {
+			doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+				Text:    feed.Nick,
+				Title:   feed.Nick,
+				Type:    "twtxt",
+				XMLURL:  feed.URL,
+				HTMLURL: UserURL(feed.URL),
+			})
+		}
+
+		data, err := xml.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), data...), nil
+	case FollowsFormatTwtxt:
+		buf := &bytes.Buffer{}
+		for _, feed := range follows {
+			fmt.Fprintf(buf, "# follow = %s %s\n", feed.Nick, feed.URL)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, ErrUnknownFollowsType
+	}
+}
+
+// ParseFollows parses a list of follows to import from an OPML document or
+// from plain text with one follow per line as either a twtxt
+// `# follow = nick url` comment, `nick url`, `nick: url` or `@<nick url>`
+func ParseFollows(data []byte) ([]types.Feed, error) {
+	var feeds []types.Feed
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		var doc opmlDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, ErrInvalidOPML
+		}
+
+		var walk func(outlines []opmlOutline)
+		walk = func(outlines []opmlOutline) {
+			for _, outline := range outlines {
+				if outline.XMLURL != "" {
+					nick := outline.Title
+					if nick == "" {
+						nick = outline.Text
+					}
+					feeds = append(feeds, types.Feed{
+						Nick: NormalizeFeedName(nick),
+						URL:  NormalizeURL(outline.XMLURL),
+					})
+				}
+				walk(outline.Outlines)
+			}
+		}
+		walk(doc.Body.Outlines)
+
+		return feeds, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		matches := followMetaRe.FindStringSubmatch(line)
+		if matches == nil && !strings.HasPrefix(line, "#") {
+			matches = followLineRe.FindStringSubmatch(line)
+		}
+		if matches == nil {
+			continue
+		}
+
+		feeds = append(feeds, types.Feed{
+			Nick: strings.TrimSpace(matches[1]),
+			URL:  NormalizeURL(strings.TrimSpace(matches[2])),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+// FollowsImporter is a user or feed that follows can be imported into
+type FollowsImporter interface {
+	Follow(nick, url string)
+	FollowAndValidate(conf *Config, nick, url string) error
+}
+
+// ImportFollows follows each of the feeds via FollowAndValidate returning
+// the result of each. Feeds that are already followed are reported as such
+// and are not an error for the import as a whole.
+func ImportFollows(conf *Config, into FollowsImporter, feeds []types.Feed) ([]types.FollowImportResult, error) {
+	if len(feeds) > maxImportFollows {
+		return nil, ErrTooManyFollows
+	}
+
+	var results []types.FollowImportResult
+
+	for _, feed := range feeds {
+		result := types.FollowImportResult{Nick: feed.Nick, URL: feed.URL}
+
+		if feed.Nick == "" || feed.URL == "" {
+			result.Error = "missing nick or url"
+		} else if err := into.FollowAndValidate(conf, feed.Nick, feed.URL); err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// GetFollowsImporter returns the user, or if name is not empty the feed
+// the user may update, that follows are imported into or exported from
+func GetFollowsImporter(db Store, user *User, name string) (FollowsImporter, error) {
+	if name == "" || name == user.Username {
+		user, err := db.GetUser(user.Username)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	feed, err := db.GetFeed(name)
+	if err != nil {
+		return nil, err
+	}
+	if !feed.Can(user, FeedActionUpdate) {
+		return nil, ErrFeedImposter
+	}
+	return feed, nil
+}
+
+// FollowsImportTask validates and follows feeds imported by a user into
+// their own follows or those of a feed they own
+type FollowsImportTask struct {
+	*BaseTask
+
+	conf     *Config
+	db       Store
+	username string
+	feed     string
+	feeds    []types.Feed
+}
+
+func NewFollowsImportTask(conf *Config, db Store, username, feed string, feeds []types.Feed) *FollowsImportTask {
+	return &FollowsImportTask{
+		BaseTask: NewBaseTask(),
+
+		conf:     conf,
+		db:       db,
+		username: username,
+		feed:     feed,
+		feeds:    feeds,
+	}
+}
+
+func (t *FollowsImportTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *FollowsImportTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	user, err := t.db.GetUser(t.username)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	into, err := GetFollowsImporter(t.db, user, t.feed)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	results, err := ImportFollows(t.conf, into, t.feeds)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	// Validating may take a while so the follows are added to a freshly
+	// loaded user or feed to not lose any changes made in the meantime
+	into, err = GetFollowsImporter(t.db, user, t.feed)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	imported := 0
+	for _, result := range results {
+		if result.Error == "" {
+			into.Follow(result.Nick, result.URL)
+			imported++
+		}
+	}
+
+	switch into := into.(type) {
+	case *User:
+		err = t.db.SetUser(into.Username, into)
+	case *Feed:
+		err = t.db.SetFeed(into.Name, into)
+	}
+	if err != nil {
+		log.WithError(err).Errorf("error saving follows imported by %s", t.username)
+		return t.Fail(err)
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	t.SetData("results", string(data))
+	t.SetData("imported", strconv.Itoa(imported))
+	t.SetData("resultsURI", URLForFollowsImport(t.conf.BaseURL, t.ID()))
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func TestParseFollows(t *testing.T) {
+	feeds, err := ParseFollows([]byte(`# follow = prologic https://twtxt.net/user/prologic/twtxt.txt
+# nick = ignored
+news: https://news.example.com/twtxt.txt
+bob https://bob.example.com/twtxt.txt
+@<alice https://alice.example.com/twtxt.txt>
+https://no.nick.example.com/twtxt.txt
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []types.Feed{
+		{Nick: "prologic", URL: "https://twtxt.net/user/prologic/twtxt.txt"},
+		{Nick: "news", URL: "https://news.example.com/twtxt.txt"},
+		{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"},
+		{Nick: "alice", URL: "https://alice.example.com/twtxt.txt"},
+	}, feeds)
+}
+
+func TestExportAndParseOPML(t *testing.T) {
+	conf := &Config{Name: "test"}
+	user := &User{
+		Username: "alice",
+		Following: map[string]string{
+			"prologic": "https://twtxt.net/user/prologic/twtxt.txt",
+			"bob":      "https://bob.example.com/twtxt.txt",
+		},
+	}
+
+	data, err := ExportFollows(conf, user, FollowsFormatOPML)
+	require.NoError(t, err)
+
+	feeds, err := ParseFollows(data)
+	require.NoError(t, err)
+	assert.Equal(t, []types.Feed{
+		{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"},
+		{Nick: "prologic", URL: "https://twtxt.net/user/prologic/twtxt.txt"},
+	}, feeds)
+
+	data, err = ExportFollows(conf, user, FollowsFormatTwtxt)
+	require.NoError(t, err)
+	assert.Equal(t, "# follow = bob https://bob.example.com/twtxt.txt\n# follow = prologic https://twtxt.net/user/prologic/twtxt.txt\n", string(data))
+
+	_, err = ExportFollows(conf, user, "csv")
+	assert.Equal(t, ErrUnknownFollowsType, err)
+
+	_, err = ParseFollows([]byte("<opml><body>"))
+	assert.Equal(t, ErrInvalidOPML, err)
+}
+
+func TestFeedFollows(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-follows")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Name: "test"}
+
+	alice := NewUser()
+	alice.Username = "alice"
+	require.NoError(t, db.SetUser("alice", alice))
+
+	eve := NewUser()
+	eve.Username = "eve"
+	require.NoError(t, db.SetUser("eve", eve))
+
+	feed := NewFeed()
+	feed.Name = "news"
+	feed.Owners["alice"] = FeedRoleOwner
+	feed.Owners["eve"] = FeedRolePoster
+	feed.Follow("bob", "https://bob.example.com/twtxt.txt")
+	require.NoError(t, db.SetFeed("news", feed))
+
+	assert.True(t, feed.Follows("https://bob.example.com/twtxt.txt/"))
+
+	// Follows are exported from the user unless a feed is named
+	from, err := GetFollowsImporter(db, alice, "")
+	require.NoError(t, err)
+	assert.IsType(t, &User{}, from)
+
+	from, err = GetFollowsImporter(db, alice, "news")
+	require.NoError(t, err)
+
+	export, err := ExportFollowsOf(conf, from, FollowsFormatTwtxt)
+	require.NoError(t, err)
+	assert.Equal(t, "# follow = bob https://bob.example.com/twtxt.txt\n", string(export))
+
+	// Posters can't manage a feed's follows
+	_, err = GetFollowsImporter(db, eve, "news")
+	assert.Equal(t, ErrFeedImposter, err)
+}
@@ -0,0 +1,428 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// GeminiContentType is the media type of gemtext documents
+	GeminiContentType = "text/gemini; charset=utf-8"
+
+	// maxGeminiRequest is the maximum length of a Gemini request line
+	// (1024 bytes for the URL plus CRLF)
+	maxGeminiRequest = 1026
+
+	geminiCertFile = "gemini.crt"
+	geminiKeyFile  = "gemini.key"
+)
+
+// Gemini response status codes
+const (
+	GeminiStatusSuccess       = 20
+	GeminiStatusTemporaryFail = 40
+	GeminiStatusNotFound      = 51
+	GeminiStatusProxyRefused  = 53
+	GeminiStatusBadRequest    = 59
+)
+
+var (
+	geminiLinkRe    = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)\)`)
+	geminiMentionRe = regexp.MustCompile(`(@|#)<([^ ]+) *([^>]+)>`)
+)
+
+// GeminiResponse is the status, meta (mime type or error message) and
+// optional body of a response to a Gemini request
+type GeminiResponse struct {
+	Status int
+	Meta   string
+	Body   []byte
+}
+
+// Bytes returns the response in wire format
+func (res GeminiResponse) Bytes() []byte {
+	header := fmt.Sprintf("%d %s\r\n", res.Status, res.Meta)
+	if res.Status != GeminiStatusSuccess {
+		return []byte(header)
+	}
+	return append([]byte(header), res.Body...)
+}
+
+func geminiError(status int, meta string) GeminiResponse {
+	return GeminiResponse{Status: status, Meta: meta}
+}
+
+func geminiDocument(body string) GeminiResponse {
+	return GeminiResponse{Status: GeminiStatusSuccess, Meta: GeminiContentType, Body: []byte(body)}
+}
+
+// LoadOrCreateGeminiCert loads the configured TLS certificate and key for
+// the Gemini service or, if none are configured, a self-signed certificate
+// for the pod's hostname which is created on first use in the data dir
+func LoadOrCreateGeminiCert(conf *Config) (tls.Certificate, error) {
+	if conf.GeminiCertFile != "" && conf.GeminiKeyFile != "" {
+		return tls.LoadX509KeyPair(conf.GeminiCertFile, conf.GeminiKeyFile)
+	}
+
+	certFile := filepath.Join(conf.Data, geminiCertFile)
+	keyFile := filepath.Join(conf.Data, geminiKeyFile)
+
+	if FileExists(certFile) && FileExists(keyFile) {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	hostname := HostnameFromURL(conf.BaseURL)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if err := ioutil.WriteFile(certFile, certPem, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	log.Infof("created self-signed gemini certificate for %s", hostname)
+
+	return tls.X509KeyPair(certPem, keyPem)
+}
+
+// GeminiHandler renders the pod's public timeline, profiles, twtxt.txt
+// feeds, permalinks, conversations and blog posts for Gemini clients
+type GeminiHandler struct {
+	config  *Config
+	db      Store
+	cache   *Cache
+	archive Archiver
+}
+
+// NewGeminiHandler ...
+func NewGeminiHandler(config *Config, db Store, cache *Cache, archive Archiver) *GeminiHandler {
+	return &GeminiHandler{config, db, cache, archive}
+}
+
+// Handle routes a Gemini request for u to the matching page
+func (h *GeminiHandler) Handle(u *url.URL) GeminiResponse {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch {
+	case parts[0] == "":
+		return h.timeline(SafeParseInt(u.RawQuery, 1))
+	case parts[0] == "user" && len(parts) == 2:
+		return h.profile(NormalizeUsername(parts[1]))
+	case parts[0] == "user" && len(parts) == 3 && parts[2] == "twtxt.txt":
+		return h.twtxt(NormalizeUsername(parts[1]))
+	case parts[0] == "twt" && len(parts) == 2:
+		return h.permalink(parts[1])
+	case parts[0] == "conv" && len(parts) == 2:
+		return h.conversation(parts[1])
+	case parts[0] == "blog" && len(parts) == 6:
+		return h.blogPost(parts[1:])
+	}
+
+	return geminiError(GeminiStatusNotFound, "Not Found")
+}
+
+func (h *GeminiHandler) timeline(page int) GeminiResponse {
+	twts := h.cache.GetByPrefix(h.config.BaseURL, false)
+
+	start := (page - 1) * h.config.TwtsPerPage
+	if start < 0 || (start > 0 && start >= len(twts)) {
+		return geminiError(GeminiStatusNotFound, "Not Found")
+	}
+	end := start + h.config.TwtsPerPage
+	if end > len(twts) {
+		end = len(twts)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# %s\n\n", h.config.Name)
+	if h.config.Description != "" {
+		fmt.Fprintf(buf, "%s\n\n", h.config.Description)
+	}
+	fmt.Fprintf(buf, "=> %s Web\n\n", h.config.BaseURL)
+	fmt.Fprintf(buf, "## Local Timeline\n\n")
+
+	for _, twt := range twts[start:end] {
+		h.writeTwt(buf, twt)
+	}
+
+	if end < len(twts) {
+		fmt.Fprintf(buf, "=> /?%d Older twts\n", page+1)
+	}
+
+	return geminiDocument(buf.String())
+}
+
+func (h *GeminiHandler) profile(nick string) GeminiResponse {
+	var profile types.Profile
+
+	if user, err := h.db.GetUser(nick); err == nil {
+		profile = user.Profile(h.config.BaseURL, nil)
+	} else if feed, err := h.db.GetFeed(nick); err == nil {
+		profile = feed.Profile(h.config.BaseURL, nil)
+	} else {
+		return geminiError(GeminiStatusNotFound, "Not Found")
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# %s\n\n", profile.Username)
+	if profile.Tagline != "" {
+		fmt.Fprintf(buf, "> %s\n\n", profile.Tagline)
+	}
+	fmt.Fprintf(buf, "=> /user/%s/twtxt.txt twtxt.txt\n", profile.Username)
+	fmt.Fprintf(buf, "=> %s Web\n", UserURL(profile.URL))
+	fmt.Fprintf(buf, "\nFollowers: %d · Following: %d\n\n", len(profile.Followers), len(profile.Following))
+	fmt.Fprintf(buf, "## Twts\n\n")
+
+	twts := h.cache.GetByURL(profile.URL)
+	if len(twts) > h.config.TwtsPerPage {
+		twts = twts[:h.config.TwtsPerPage]
+	}
+	for _, twt := range twts {
+		h.writeTwt(buf, twt)
+	}
+
+	return geminiDocument(buf.String())
+}
+
+func (h *GeminiHandler) twtxt(nick string) GeminiResponse {
+	fn, err := securejoin.SecureJoin(filepath.Join(h.config.Data, feedsDir), nick)
+	if err != nil {
+		return geminiError(GeminiStatusBadRequest, "Bad Request")
+	}
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return geminiError(GeminiStatusNotFound, "Not Found")
+		}
+		log.WithError(err).Errorf("error reading feed %s", nick)
+		return geminiError(GeminiStatusTemporaryFail, "Internal Server Error")
+	}
+
+	return GeminiResponse{Status: GeminiStatusSuccess, Meta: "text/plain; charset=utf-8", Body: data}
+}
+
+func (h *GeminiHandler) lookupTwt(hash string) (types.Twt, bool) {
+	if twt, ok := h.cache.Lookup(hash); ok {
+		return twt, true
+	}
+
+	if h.archive.Has(hash) {
+		twt, err := h.archive.Get(hash)
+		if err != nil {
+			log.WithError(err).Errorf("error loading twt %s from archive", hash)
+			return nil, false
+		}
+		return twt, true
+	}
+
+	return nil, false
+}
+
+func (h *GeminiHandler) permalink(hash string) GeminiResponse {
+	twt, ok := h.lookupTwt(hash)
+	if !ok {
+		return geminiError(GeminiStatusNotFound, "Not Found")
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Twt #%s\n\n", twt.Hash())
+	h.writeTwt(buf, twt)
+	fmt.Fprintf(buf, "=> / %s\n", h.config.Name)
+
+	return geminiDocument(buf.String())
+}
+
+func (h *GeminiHandler) conversation(hash string) GeminiResponse {
+	root, ok := h.lookupTwt(hash)
+	if !ok {
+		return geminiError(GeminiStatusNotFound, "Not Found")
+	}
+
+	twts := types.Twts{root}
+	for _, twt := range h.cache.GetAll() {
+		if twt.Hash() == root.Hash() {
+			continue
+		}
+		var tags types.TagList = twt.Tags()
+		if HasString(UniqStrings(tags.Tags()), hash) {
+			twts = append(twts, twt)
+		}
+	}
+	sort.Sort(sort.Reverse(twts))
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Conversation #%s\n\n", hash)
+	for _, twt := range twts {
+		h.writeTwt(buf, twt)
+	}
+
+	return geminiDocument(buf.String())
+}
+
+func (h *GeminiHandler) blogPost(parts []string) GeminiResponse {
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			return geminiError(GeminiStatusNotFound, "Not Found")
+		}
+	}
+
+	blogPost, err := BlogPostFromParams(h.config, httprouter.Params{
+		httprouter.Param{Key: "author", Value: parts[0]},
+		httprouter.Param{Key: "year", Value: parts[1]},
+		httprouter.Param{Key: "month", Value: parts[2]},
+		httprouter.Param{Key: "date", Value: parts[3]},
+		httprouter.Param{Key: "slug", Value: parts[4]},
+	})
+	if err != nil {
+		return geminiError(GeminiStatusNotFound, "Not Found")
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# %s\n\n", blogPost.Title)
+	fmt.Fprintf(buf, "By %s on %s\n\n", blogPost.Author, blogPost.Published().Format("Mon, Jan 2 2006"))
+
+	// Blog posts are Markdown which reads well enough as gemtext once
+	// links are pulled out onto their own lines
+	body, links := geminiText(h.config, blogPost.Content())
+	fmt.Fprintf(buf, "%s\n\n", body)
+	for _, link := range links {
+		fmt.Fprintf(buf, "%s\n", link)
+	}
+
+	fmt.Fprintf(buf, "\n=> /user/%s %s\n", blogPost.Author, blogPost.Author)
+	fmt.Fprintf(buf, "=> /conv/%s Comments\n", blogPost.Hash())
+
+	return geminiDocument(buf.String())
+}
+
+func (h *GeminiHandler) writeTwt(buf *bytes.Buffer, twt types.Twt) {
+	twter := twt.Twter()
+
+	fmt.Fprintf(buf, "### %s · %s\n", twter.Nick, twt.Created().UTC().Format("Mon, Jan 2 2006 15:04 MST"))
+
+	text, links := geminiText(h.config, twt.Text())
+	fmt.Fprintf(buf, "%s\n", geminiEscape(text))
+
+	if h.config.IsLocalURL(twter.URL) && strings.HasSuffix(twter.URL, "/twtxt.txt") {
+		fmt.Fprintf(buf, "=> /user/%s %s\n", twter.Nick, twter.Nick)
+	} else {
+		fmt.Fprintf(buf, "=> %s %s\n", twter.URL, twter.Nick)
+	}
+	fmt.Fprintf(buf, "=> /twt/%s Permalink\n", twt.Hash())
+	if twt.Subject() != "" {
+		fmt.Fprintf(buf, "=> /conv/%s Conversation\n", twt.Hash())
+	}
+	for _, link := range links {
+		fmt.Fprintf(buf, "%s\n", link)
+	}
+	fmt.Fprintf(buf, "\n")
+}
+
+// geminiText converts twt or blog post text into gemtext, replacing
+// mentions and tags with their names and Markdown links and media with
+// their text, and returns the links as gemtext link lines to be written
+// after the text as gemtext doesn't support inline links
+func geminiText(conf *Config, text string) (string, []string) {
+	var links []string
+
+	text = strings.ReplaceAll(text, "\u2028", "\n")
+
+	text = geminiMentionRe.ReplaceAllStringFunc(text, func(match string) string {
+		parts := geminiMentionRe.FindStringSubmatch(match)
+		prefix, nick, uri := parts[1], parts[2], parts[3]
+
+		if prefix == "@" {
+			if conf.IsLocalURL(uri) && strings.HasSuffix(uri, "/twtxt.txt") {
+				links = append(links, fmt.Sprintf("=> /user/%s @%s", nick, nick))
+			} else {
+				links = append(links, fmt.Sprintf("=> %s @%s", uri, nick))
+			}
+		}
+
+		return prefix + nick
+	})
+
+	text = geminiLinkRe.ReplaceAllStringFunc(text, func(match string) string {
+		parts := geminiLinkRe.FindStringSubmatch(match)
+		title, uri := parts[1], parts[2]
+
+		if title == "" {
+			title = uri
+		}
+		links = append(links, fmt.Sprintf("=> %s %s", uri, title))
+
+		return title
+	})
+
+	return text, links
+}
+
+// geminiEscape indents lines of twt text that would otherwise be interpreted
+// as gemtext headings, links, lists, quotes or preformatting toggles
+func geminiEscape(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		for _, prefix := range []string{"#", "=>", "*", ">", "```"} {
+			if strings.HasPrefix(line, prefix) {
+				lines[i] = " " + line
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
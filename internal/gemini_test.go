@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiText(t *testing.T) {
+	conf := &Config{BaseURL: "https://twtxt.net"}
+
+	text, links := geminiText(conf, "@<prologic https://twtxt.net/user/prologic/twtxt.txt> @<bob https://bob.example.com/twtxt.txt> see [this](https://example.com/) ![](https://twtxt.net/media/abc)")
+	assert.Equal(t, "@prologic @bob see this https://twtxt.net/media/abc", text)
+	assert.Equal(t, []string{
+		"=> /user/prologic @prologic",
+		"=> https://bob.example.com/twtxt.txt @bob",
+		"=> https://example.com/ this",
+		"=> https://twtxt.net/media/abc https://twtxt.net/media/abc",
+	}, links)
+
+	assert.Equal(t, " #twtxt rocks\nplain\n => not a link", geminiEscape("#twtxt rocks\nplain\n=> not a link"))
+}
+
+func TestLoadOrCreateGeminiCert(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-gemini")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	conf := &Config{Data: data, BaseURL: "https://twtxt.net"}
+
+	cert, err := LoadOrCreateGeminiCert(conf)
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate, 1)
+
+	// The self-signed certificate is reused on restart
+	again, err := LoadOrCreateGeminiCert(conf)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Certificate[0], again.Certificate[0])
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -216,6 +217,10 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 				return
 			}
+			if user.MovedTo != "" {
+				http.Redirect(w, r, UserURL(user.MovedTo), http.StatusMovedPermanently)
+				return
+			}
 			profile = user.Profile(s.config.BaseURL, ctx.User)
 		} else if s.db.HasFeed(nick) {
 			feed, err := s.db.GetFeed(nick)
@@ -252,6 +257,11 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 				Title: fmt.Sprintf("%s's Atom Feed", profile.Username),
 				URL:   fmt.Sprintf("%s/atom.xml", UserURL(profile.URL)),
 			},
+			types.Alternative{
+				Type:  JSONFeedContentType,
+				Title: fmt.Sprintf("%s's JSON Feed", profile.Username),
+				URL:   fmt.Sprintf("%s/feed.json", UserURL(profile.URL)),
+			},
 		}...)
 
 		twts := s.cache.GetByURL(profile.URL)
@@ -271,6 +281,7 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 		}
 
 		ctx.Title = fmt.Sprintf("%s's Profile: %s", profile.Username, profile.Tagline)
+		ctx.PinnedTwts = FilterTwts(ctx.User, GetPinnedTwts(s.cache, s.archive, profile.Pinned))
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
 
@@ -305,7 +316,7 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 			return
 		}
 
-		if !ctx.User.OwnsFeed(feed.Name) {
+		if feed.Role(ctx.User) == "" {
 			ctx.Error = true
 			s.render("401", w, ctx)
 			return
@@ -313,40 +324,67 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 
 		switch r.Method {
 		case http.MethodGet:
+			ctx.Feed = feed
 			ctx.Profile = feed.Profile(s.config.BaseURL, ctx.User)
 			ctx.Title = fmt.Sprintf("Manage feed %s", feed.Name)
 			s.render("manageFeed", w, ctx)
 			return
 		case http.MethodPost:
-			description := r.FormValue("description")
-			feed.Description = description
-
-			avatarFile, _, err := r.FormFile("avatar_file")
-			if err != nil && err != http.ErrMissingFile {
-				log.WithError(err).Error("error parsing form file")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			if avatarFile != nil {
-				opts := &ImageOptions{
-					Resize: true,
-					Width:  AvatarResolution,
-					Height: AvatarResolution,
+			action := r.FormValue("action")
+			username := NormalizeUsername(r.FormValue("username"))
+			role := r.FormValue("role")
+
+			switch action {
+			case FeedActionInvite, FeedActionRemove, FeedActionRole:
+				var message string
+
+				switch action {
+				case FeedActionInvite:
+					err = InviteFeedMember(s.db, ctx.User, feed, username, role)
+					if err == nil {
+						n := NewNotification(NotificationFeedInvite, username, ctx.User.Username, ctx.User.URL, feed.Name)
+						n.Text = role
+						Notify(s.db, s.events, n)
+					}
+					message = fmt.Sprintf("Successfully invited %s to %s as %s", username, feed.Name, role)
+				case FeedActionRemove:
+					err = RemoveFeedMember(s.db, ctx.User, feed, username)
+					message = fmt.Sprintf("Successfully removed %s from %s", username, feed.Name)
+				case FeedActionRole:
+					err = SetFeedMemberRole(s.db, ctx.User, feed, username, role)
+					message = fmt.Sprintf("Successfully changed the role of %s on %s to %s", username, feed.Name, role)
 				}
-				_, err = StoreUploadedImage(
-					s.config, avatarFile,
-					avatarsDir, feedName,
-					opts,
-				)
+
 				if err != nil {
+					log.WithError(err).Warnf("error managing members of feed %s", feed.Name)
 					ctx.Error = true
-					ctx.Message = fmt.Sprintf("Error updating user: %s", err)
+					ctx.Message = fmt.Sprintf("Error managing feed members: %s", err)
 					s.render("error", w, ctx)
 					return
 				}
+
+				ctx.Error = false
+				ctx.Message = message
+				s.render("error", w, ctx)
+				return
+			}
+
+			if !feed.Can(ctx.User, FeedActionUpdate) {
+				ctx.Error = true
+				s.render("401", w, ctx)
+				return
+			}
+
+			if err := UpdateFeedProfile(s.config, feed, r); err != nil {
+				log.WithError(err).Warnf("error updating profile of feed %s", feed.Name)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error updating feed: %s", err)
+				s.render("error", w, ctx)
+				return
 			}
 
+			feed.AddAuditEntry(ctx.User.Username, FeedActionUpdate, "")
+
 			if err := s.db.SetFeed(feed.Name, feed); err != nil {
 				log.WithError(err).Warnf("error updating user object for followee %s", feed.Name)
 
@@ -395,13 +433,13 @@ func (s *Server) ArchiveFeedHandler() httprouter.Handle {
 			return
 		}
 
-		if !ctx.User.OwnsFeed(feed.Name) {
+		if !feed.Can(ctx.User, FeedActionRemove) {
 			ctx.Error = true
 			s.render("401", w, ctx)
 			return
 		}
 
-		if err := DetachFeedFromOwner(s.db, ctx.User, feed); err != nil {
+		if err := ArchiveFeed(s.db, ctx.User, feed); err != nil {
 			log.WithError(err).Warnf("Error detaching feed owner %s from feed %s", ctx.User.Username, feed.Name)
 			ctx.Error = true
 			ctx.Message = "Error archiving feed"
@@ -415,6 +453,54 @@ func (s *Server) ArchiveFeedHandler() httprouter.Handle {
 	}
 }
 
+// FeedInviteHandler accepts or declines the user's invitation to a feed
+func (s *Server) FeedInviteHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		feedName := NormalizeFeedName(p.ByName("name"))
+
+		feed, err := s.db.GetFeed(feedName)
+		if err != nil {
+			log.WithError(err).Errorf("error loading feed object for %s", feedName)
+			ctx.Error = true
+			ctx.Message = "Feed not found"
+			s.render("404", w, ctx)
+			return
+		}
+
+		user, err := s.db.GetUser(ctx.Username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = "Error loading user"
+			s.render("error", w, ctx)
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "accept":
+			err = AcceptFeedInvite(s.db, user, feed)
+			ctx.Message = fmt.Sprintf("You are now a member of %s", feed.Name)
+		case "decline":
+			err = DeclineFeedInvite(s.db, user, feed)
+			ctx.Message = fmt.Sprintf("Declined invitation to %s", feed.Name)
+		default:
+			err = ErrFeedInviteNotFound
+		}
+
+		if err != nil {
+			log.WithError(err).Warnf("error responding to invitation to %s", feed.Name)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error responding to invitation: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		s.render("error", w, ctx)
+	}
+}
+
 // OldTwtxtHandler ...
 // Redirect old URIs (twtxt <= v0.0.8) of the form /u/<nick> -> /user/<nick>/twtxt.txt
 // TODO: Remove this after v1
@@ -602,44 +688,71 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			return
 		}
 
+		var (
+			user *User
+			feed *Feed
+		)
+
+		if user, err = s.db.GetUser(nick); err != nil {
+			user = nil
+			if feed, err = s.db.GetFeed(nick); err != nil {
+				feed = nil
+				log.WithError(err).Warnf("unable to load user or feed object for %s", nick)
+			}
+		}
+
+		if user != nil && user.MovedTo != "" {
+			notice := MovedNotice(nick, user.MovedTo)
+			w.Header().Set("Location", user.MovedTo)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(notice)))
+			w.WriteHeader(http.StatusMovedPermanently)
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(notice)
+			}
+			return
+		}
+
+		// Pins are served in the preamble so the feed changes when they do
+		modTime := fileInfo.ModTime()
+
+		preamble := &FeedPreamble{}
+		if user != nil {
+			preamble.AddAll("pin", user.Pinned)
+			if user.PinnedAt.After(modTime) {
+				modTime = user.PinnedAt
+			}
+		} else if feed != nil {
+			preamble.AddAll("pin", feed.Pinned)
+			if feed.PinnedAt.After(modTime) {
+				modTime = feed.PinnedAt
+			}
+			if feed.Tagline != "" {
+				preamble.Add("description", feed.Tagline)
+			}
+			preamble.AddAll("link", feed.Links)
+		}
+
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()+int64(preamble.Len())))
 		w.Header().Set("Link", fmt.Sprintf(`<%s/user/%s/webmention>; rel="webmention"`, s.config.BaseURL, nick))
-		w.Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
 
 		followerClient, err := DetectFollowerFromUserAgent(r.UserAgent())
 		if err != nil {
 			log.WithError(err).Warnf("unable to detect twtxt client from %s", FormatRequest(r))
 		} else {
-			var (
-				user       *User
-				feed       *Feed
-				err        error
-				followedBy bool
-			)
+			var followedBy bool
 
-			if user, err = s.db.GetUser(nick); err == nil {
+			if user != nil {
 				followedBy = user.FollowedBy(followerClient.URL)
-			} else if feed, err = s.db.GetFeed(nick); err == nil {
+			} else if feed != nil {
 				followedBy = feed.FollowedBy(followerClient.URL)
-			} else {
-				log.WithError(err).Warnf("unable to load user or feed object for %s", nick)
 			}
 
 			if (user != nil) || (feed != nil) {
 				if (s.config.Debug || followerClient.IsPublicURL()) && !followedBy {
-					if _, err := AppendSpecial(
-						s.config, s.db,
-						twtxtBot,
-						fmt.Sprintf(
-							"FOLLOW: @<%s %s> from @<%s %s> using %s",
-							nick, URLForUser(s.config, nick),
-							followerClient.Nick, followerClient.URL,
-							followerClient.Client,
-						),
-					); err != nil {
-						log.WithError(err).Warnf("error appending special FOLLOW post")
-					}
+					NotifyFeedFollow(s.db, s.events, nick, followerClient.Nick, followerClient.URL)
 
 					if user != nil {
 						user.AddFollower(followerClient.Nick, followerClient.URL)
@@ -670,8 +783,48 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			return
 		}
 
-		http.ServeContent(w, r, filepath.Base(fn), fileInfo.ModTime(), f)
+		if preamble.Len() > 0 {
+			data, err := ioutil.ReadAll(f)
+			if err != nil {
+				log.WithError(err).Error("error reading feed")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			content := bytes.NewReader(append(preamble.Bytes(), data...))
+			http.ServeContent(w, r, filepath.Base(fn), modTime, content)
+			return
+		}
+
+		http.ServeContent(w, r, filepath.Base(fn), modTime, f)
+	}
+}
+
+// postTwt posts text as the user, or as the feed postas, and runs the
+// posted twt hooks. When editing is not NilTwt the text replaces it keeping
+// its timestamp and the hooks aren't run again as it isn't a new twt.
+func (s *Server) postTwt(user *User, postas, text string, editing types.Twt) (twt types.Twt, err error) {
+	var args []interface{}
+	if !editing.IsZero() {
+		args = append(args, editing.Created())
+	}
+
+	name := postas
+	switch postas {
+	case "", user.Username:
+		name = user.Username
+		twt, err = AppendTwt(s.config, s.db, user, text, args...)
+	default:
+		twt, err = PostAsFeed(s.config, s.db, user, postas, text, args...)
 	}
+	if err != nil {
+		return types.NilTwt, err
+	}
+
+	if editing.IsZero() {
+		s.hooks.Run(name, twt)
+	}
+
+	return twt, nil
 }
 
 // PostHandler ...
@@ -748,27 +901,13 @@ func (s *Server) PostHandler() httprouter.Handle {
 			return
 		}
 
-		var twt types.Twt = types.NilTwt
-
-		switch postas {
-		case "", user.Username:
-			if hash != "" && lastTwt.Hash() == hash {
-				twt, err = AppendTwt(s.config, s.db, user, text, lastTwt.Created)
-			} else {
-				twt, err = AppendTwt(s.config, s.db, user, text)
-			}
-		default:
-			if user.OwnsFeed(postas) {
-				if hash != "" && lastTwt.Hash() == hash {
-					twt, err = AppendSpecial(s.config, s.db, postas, text, lastTwt.Created)
-				} else {
-					twt, err = AppendSpecial(s.config, s.db, postas, text)
-				}
-			} else {
-				err = ErrFeedImposter
-			}
+		// Editing the last twt replaces it keeping its timestamp
+		var editing types.Twt = types.NilTwt
+		if hash != "" && lastTwt.Hash() == hash {
+			editing = lastTwt
 		}
 
+		twt, err := s.postTwt(user, postas, text, editing)
 		if err != nil {
 			log.WithError(err).Error("error posting twt")
 			ctx.Error = true
@@ -815,13 +954,9 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 			ctx.Title = "Local timeline"
 		} else {
 			ctx.Title = "Timeline"
-			user := ctx.User
-			if user != nil {
-				for feed := range user.Sources() {
-					twts = append(twts, s.cache.GetByURL(feed.URL)...)
-				}
+			if user := ctx.User; user != nil {
+				twts = s.cache.GetTimeline(user)
 			}
-			sort.Sort(twts)
 		}
 
 		var pagedTwts types.Twts
@@ -853,6 +988,13 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
 
+		if ctx.Authenticated {
+			ctx.ReadMarker = FindReadDivider(ctx.Twts, ctx.User.GetReadMarker(TimelineReadMarker))
+			if page == 1 {
+				UpdateReadMarker(s.db, ctx.User, TimelineReadMarker, twts)
+			}
+		}
+
 		s.render("timeline", w, ctx)
 	}
 }
@@ -974,12 +1116,18 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 					Title: fmt.Sprintf("%s's Atom Feed", twt.Twter().Nick),
 					URL:   fmt.Sprintf("%s/atom.xml", UserURL(twt.Twter().URL)),
 				},
+				types.Alternative{
+					Type:  JSONFeedContentType,
+					Title: fmt.Sprintf("%s's JSON Feed", twt.Twter().Nick),
+					URL:   fmt.Sprintf("%s/feed.json", UserURL(twt.Twter().URL)),
+				},
 			}...)
 		}
 
 		fmt.Println("TWT", twt)
 
 		ctx.Twts = FilterTwts(ctx.User, types.Twts{twt})
+		ctx.WebMentions = GetApprovedWebMentions(s.db, twt.Hash())
 		s.render("permalink", w, ctx)
 
 	}
@@ -1050,10 +1198,29 @@ func (s *Server) MentionsHandler() httprouter.Handle {
 		ctx.Title = "Mentions"
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
+
+		ctx.ReadMarker = FindReadDivider(ctx.Twts, ctx.User.GetReadMarker(MentionsReadMarker))
+		if page == 1 {
+			UpdateReadMarker(s.db, ctx.User, MentionsReadMarker, twts)
+		}
+
 		s.render("timeline", w, ctx)
 	}
 }
 
+// EventsHandler streams real-time timeline, mentions and messages updates to
+// the user's browser as Server-Sent Events.
+func (s *Server) EventsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		ServeEvents(
+			w, r, s.events, ctx.User.Username,
+			Event{Type: MessagesEvent, Count: s.msgs.Get(ctx.User.Username)},
+		)
+	}
+}
+
 // SearchHandler ...
 func (s *Server) SearchHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -1136,7 +1303,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			return
 		}
 
-		if _, err := AppendSpecial(
+		if twt, err := AppendSpecial(
 			s.config, s.db,
 			twtxtBot,
 			fmt.Sprintf(
@@ -1146,6 +1313,8 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			),
 		); err != nil {
 			log.WithError(err).Warnf("error appending special FOLLOW post")
+		} else {
+			s.hooks.Run(twtxtBot, twt)
 		}
 
 		ctx.Error = false
@@ -1241,9 +1410,6 @@ func (s *Server) LoginHandler() httprouter.Handle {
 		// #239: Throttle failed login attempts and lock user  account.
 		failures.Reset(user.Username)
 
-		// Login successful
-		log.Infof("login successful: %s", username)
-
 		// Lookup session
 		sess := r.Context().Value(session.SessionKey)
 		if sess == nil {
@@ -1252,6 +1418,31 @@ func (s *Server) LoginHandler() httprouter.Handle {
 			return
 		}
 
+		// Return to where login was required, e.g: an app's authorization
+		// request, or else the page the user was on
+		redirect := RedirectRefererURL(r, s.config, "/")
+		if v, ok := sess.(*session.Session).Get("login_redirect"); ok {
+			redirect = v
+			_ = sess.(*session.Session).Del("login_redirect")
+		}
+
+		// Two-factor authentication is a second step at /login/2fa which
+		// authorizes the session once a valid code is entered
+		if user.HasTOTP() {
+			_ = sess.(*session.Session).Set("totp_username", username)
+			_ = sess.(*session.Session).Set("totp_redirect", redirect)
+			if rememberme {
+				_ = sess.(*session.Session).Set("totp_persist", "1")
+			} else {
+				_ = sess.(*session.Session).Del("totp_persist")
+			}
+			http.Redirect(w, r, "/login/2fa", http.StatusFound)
+			return
+		}
+
+		// Login successful
+		log.Infof("login successful: %s", username)
+
 		// Authorize session
 		_ = sess.(*session.Session).Set("username", username)
 
@@ -1260,7 +1451,7 @@ func (s *Server) LoginHandler() httprouter.Handle {
 			_ = sess.(*session.Session).Set("persist", "1")
 		}
 
-		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/"), http.StatusFound)
+		http.Redirect(w, r, redirect, http.StatusFound)
 	}
 }
 
@@ -1307,7 +1498,7 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 			return
 		}
 
-		if s.db.HasUser(username) || s.db.HasFeed(username) {
+		if s.db.HasUser(username) || s.db.HasFeed(username) || s.db.HasAlias(username) {
 			ctx.Error = true
 			ctx.Message = "User or Feed with that name already exists! Please pick another!"
 			s.render("error", w, ctx)
@@ -1409,7 +1600,26 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		ctx := NewContext(s.config, s.db, r)
 
 		if r.Method == "GET" {
+			webhooks, err := GetUserWebhooks(s.db, ctx.Username)
+			if err != nil {
+				log.WithError(err).Errorf("error loading webhooks for %s", ctx.Username)
+			}
+
+			apps, err := GetUserOAuthApps(s.db, ctx.Username)
+			if err != nil {
+				log.WithError(err).Errorf("error loading apps for %s", ctx.Username)
+			}
+
+			authorized, err := GetAuthorizedApps(s.db, ctx.User)
+			if err != nil {
+				log.WithError(err).Errorf("error loading authorized apps for %s", ctx.Username)
+			}
+
 			ctx.Title = "Settings"
+			ctx.Webhooks = webhooks
+			ctx.WebhookEvents = WebhookEvents
+			ctx.OAuthApps = apps
+			ctx.AuthorizedApps = authorized
 			s.render("settings", w, ctx)
 			return
 		}
@@ -1501,7 +1711,7 @@ func (s *Server) DeleteTokenHandler() httprouter.Handle {
 
 		signature := p.ByName("signature")
 
-		if err := s.db.DelToken(signature); err != nil {
+		if err := RevokeTokens(s.db, ctx.User, func(t *Token) bool { return t.Signature == signature }); err != nil {
 			ctx.Error = true
 			ctx.Message = "Error deleting token"
 			s.render("error", w, ctx)
@@ -1547,6 +1757,11 @@ func (s *Server) FollowersHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 				return
 			}
+
+			if !feed.IsFollowersPubliclyVisible && feed.Role(ctx.User) == "" {
+				s.render("401", w, ctx)
+				return
+			}
 			ctx.Profile = feed.Profile(s.config.BaseURL, ctx.User)
 		} else {
 			ctx.Error = true
@@ -1594,6 +1809,14 @@ func (s *Server) FollowingHandler() httprouter.Handle {
 				return
 			}
 			ctx.Profile = user.Profile(s.config.BaseURL, ctx.User)
+
+			if ctx.User.Is(user.URL) {
+				lists, err := s.db.GetUserLists(user.Username)
+				if err != nil {
+					log.WithError(err).Warnf("error loading lists for %s", nick)
+				}
+				ctx.Lists = lists
+			}
 		} else {
 			ctx.Error = true
 			ctx.Message = "User Not Found"
@@ -1827,7 +2050,7 @@ func (s *Server) ResetPasswordHandler() httprouter.Handle {
 		// Create magic link
 		token := jwt.NewWithClaims(
 			jwt.SigningMethodHS256,
-			jwt.MapClaims{"username": username, "expiresAt": expiryTime},
+			jwt.MapClaims{"username": username, "purpose": passwordResetTokenPurpose, "expiresAt": expiryTime},
 		)
 		tokenString, err := token.SignedString([]byte(s.config.MagicLinkSecret))
 		if err != nil {
@@ -1900,7 +2123,14 @@ func (s *Server) NewPasswordHandler() httprouter.Handle {
 			return []byte(s.config.MagicLinkSecret), nil
 		})
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = err.Error()
+			s.render("error", w, ctx)
+			return
+		}
+
+		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["purpose"] == passwordResetTokenPurpose {
 
 			var username = fmt.Sprintf("%v", claims["username"])
 			var expiresAt int = int(claims["expiresAt"].(float64))
@@ -1953,7 +2183,7 @@ func (s *Server) NewPasswordHandler() httprouter.Handle {
 			s.render("error", w, ctx)
 		} else {
 			ctx.Error = true
-			ctx.Message = err.Error()
+			ctx.Message = "Invalid token"
 			s.render("error", w, ctx)
 			return
 		}
@@ -1990,53 +2220,52 @@ func (s *Server) TaskHandler() httprouter.Handle {
 	}
 }
 
+// syndicationFeed returns the profile and twts of the local user or feed
+// nick or, if nick is empty, the pod's local timeline for syndication
+func (s *Server) syndicationFeed(nick string) (types.Profile, types.Twts, error) {
+	if nick == "" {
+		profile := types.Profile{
+			Type:     "Local",
+			Username: s.config.Name,
+			Tagline:  "", // TODO: Maybe Twtxt Pods should have a configurable description?
+			URL:      s.config.BaseURL,
+		}
+		return profile, s.cache.GetByPrefix(s.config.BaseURL, false), nil
+	}
+
+	if s.db.HasUser(nick) {
+		user, err := s.db.GetUser(nick)
+		if err != nil {
+			return types.Profile{}, nil, err
+		}
+		profile := user.Profile(s.config.BaseURL, nil)
+		return profile, s.cache.GetByURL(profile.URL), nil
+	}
+
+	if s.db.HasFeed(nick) {
+		feed, err := s.db.GetFeed(nick)
+		if err != nil {
+			return types.Profile{}, nil, err
+		}
+		profile := feed.Profile(s.config.BaseURL, nil)
+		return profile, s.cache.GetByURL(profile.URL), nil
+	}
+
+	return types.Profile{}, nil, ErrFeedNotFound
+}
+
 // SyndicationHandler ...
 func (s *Server) SyndicationHandler() httprouter.Handle {
 	formatTwt := FormatTwtFactory(s.config)
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		var (
-			twts    types.Twts
-			profile types.Profile
-			err     error
-		)
-
 		nick := NormalizeUsername(p.ByName("nick"))
-		if nick != "" {
-			if s.db.HasUser(nick) {
-				if user, err := s.db.GetUser(nick); err == nil {
-					profile = user.Profile(s.config.BaseURL, nil)
-					twts = s.cache.GetByURL(profile.URL)
-				} else {
-					log.WithError(err).Error("error loading user object")
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				}
-			} else if s.db.HasFeed(nick) {
-				if feed, err := s.db.GetFeed(nick); err == nil {
-					profile = feed.Profile(s.config.BaseURL, nil)
-					twts = s.cache.GetByURL(profile.URL)
-				} else {
-					log.WithError(err).Error("error loading user object")
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				}
-			} else {
-				http.Error(w, "Feed Not Found", http.StatusNotFound)
-				return
-			}
-		} else {
-			twts = s.cache.GetByPrefix(s.config.BaseURL, false)
-
-			profile = types.Profile{
-				Type:     "Local",
-				Username: s.config.Name,
-				Tagline:  "", // TODO: Maybe Twtxt Pods should have a configurable description?
-				URL:      s.config.BaseURL,
-			}
-		}
 
-		if err != nil {
+		profile, twts, err := s.syndicationFeed(nick)
+		if err == ErrFeedNotFound {
+			http.Error(w, "Feed Not Found", http.StatusNotFound)
+			return
+		} else if err != nil {
 			log.WithError(err).Errorf("errorloading feeds for %s", nick)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
@@ -2044,10 +2273,12 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 
 		if r.Method == http.MethodHead {
 			defer r.Body.Close()
-			w.Header().Set(
-				"Last-Modified",
-				twts[len(twts)].Created().Format(http.TimeFormat),
-			)
+			if len(twts) > 0 {
+				w.Header().Set(
+					"Last-Modified",
+					twts[0].Created().Format(http.TimeFormat),
+				)
+			}
 			return
 		}
 
@@ -2088,6 +2319,57 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 	}
 }
 
+// JSONFeedHandler serves the same feeds as the SyndicationHandler as
+// JSON Feed 1.1 documents
+func (s *Server) JSONFeedHandler() httprouter.Handle {
+	jsonFeed := JSONFeedFactory(s.config, s.cache)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+
+		profile, twts, err := s.syndicationFeed(nick)
+		if err == ErrFeedNotFound {
+			http.Error(w, "Feed Not Found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithError(err).Errorf("error loading feeds for %s", nick)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var avatar, feedURL string
+		if nick == "" {
+			avatar = fmt.Sprintf("%s/pod/avatar", strings.TrimSuffix(s.config.BaseURL, "/"))
+			feedURL = fmt.Sprintf("%s/feed.json", strings.TrimSuffix(s.config.BaseURL, "/"))
+		} else {
+			avatar = URLForAvatar(s.config, nick)
+			feedURL = fmt.Sprintf("%s/feed.json", UserURL(profile.URL))
+		}
+
+		w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", JSONFeedContentType))
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			if len(twts) > 0 {
+				w.Header().Set(
+					"Last-Modified",
+					twts[0].Created().Format(http.TimeFormat),
+				)
+			}
+			return
+		}
+
+		data, err := jsonFeed(profile, avatar, feedURL, twts).Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing feed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write(data)
+	}
+}
+
 // PodConfigHandler ...
 func (s *Server) PodConfigHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -2229,8 +2511,13 @@ func (s *Server) TransferFeedHandler() httprouter.Handle {
 			}
 
 			// Transfer ownerships
-			_ = RemoveFeedOwnership(s.db, fromUser, feed)
-			_ = AddFeedOwnership(s.db, toUser, feed)
+			if err := TransferFeed(s.db, fromUser, toUser, feed); err != nil {
+				log.WithError(err).Errorf("Error transferring feed %s to %s", feed.Name, toUser.Username)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error transferring feed: %s", err)
+				s.render("error", w, ctx)
+				return
+			}
 
 			ctx.Error = false
 			ctx.Message = "Feed ownership changed successfully."
@@ -2254,8 +2541,28 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 		}
 
 		for _, feed := range feeds {
+			// Members who don't own a feed just leave it
+			if ctx.User.IsFeedMember(feed.Name) {
+				delete(feed.Owners, ctx.User.Username)
+				feed.AddAuditEntry(ctx.User.Username, FeedActionRemove, ctx.User.Username)
+				if err := s.db.SetFeed(feed.Name, feed); err != nil {
+					log.WithError(err).Warnf("error removing %s from feed %s", ctx.User.Username, feed.Name)
+				}
+				continue
+			}
+
 			// Get user's owned feeds
 			if ctx.User.OwnsFeed(feed.Name) {
+				// Shared feeds carry on without the user if anyone else owns them
+				if feed.HasOtherOwners(ctx.User.Username) {
+					delete(feed.Owners, ctx.User.Username)
+					feed.AddAuditEntry(ctx.User.Username, FeedActionRemove, ctx.User.Username)
+					if err := s.db.SetFeed(feed.Name, feed); err != nil {
+						log.WithError(err).Warnf("error removing %s from feed %s", ctx.User.Username, feed.Name)
+					}
+					continue
+				}
+
 				// Get twts in a feed
 				nick := feed.Name
 				if nick != "" {
@@ -2399,6 +2706,63 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 			}
 		}
 
+		// Delete user's lists
+		if lists, err := s.db.GetUserLists(ctx.Username); err == nil {
+			for _, list := range lists {
+				if err := s.db.DelList(list.Owner, list.Name); err != nil {
+					log.WithError(err).Warnf("error deleting list %s", list.Name)
+				}
+			}
+		}
+
+		// Delete user's apps and tokens
+		if apps, err := GetUserOAuthApps(s.db, ctx.Username); err == nil {
+			for _, app := range apps {
+				if err := s.db.DelOAuthApp(app.ClientID); err != nil {
+					log.WithError(err).Warnf("error deleting app %s", app.ClientID)
+				}
+			}
+		}
+		if err := RevokeTokens(s.db, ctx.User, func(_ *Token) bool { return true }); err != nil {
+			log.WithError(err).Warnf("error deleting tokens of %s", ctx.Username)
+		}
+
+		// Delete user's webhooks
+		if webhooks, err := GetUserWebhooks(s.db, ctx.Username); err == nil {
+			for _, hook := range webhooks {
+				if err := s.db.DelWebhook(hook.ID); err != nil {
+					log.WithError(err).Warnf("error deleting webhook %s", hook.ID)
+				}
+			}
+		}
+
+		// Delete webmentions of the user and their feeds
+		if mentions, err := GetUserWebMentions(s.db, ctx.User); err == nil {
+			for _, m := range mentions {
+				if err := s.db.DelWebMention(m.ID); err != nil {
+					log.WithError(err).Warnf("error deleting webmention %s", m.ID)
+				}
+			}
+		}
+
+		// Delete user's activitypub followers
+		if followers, err := s.db.GetActivityPubFollowers(ctx.Username); err == nil {
+			for _, f := range followers {
+				if err := s.db.DelActivityPubFollower(ctx.Username, f.ID); err != nil {
+					log.WithError(err).Warnf("error deleting activitypub follower %s", f.Actor)
+				}
+			}
+		}
+
+		// Delete user's notifications
+		if notifications, err := s.db.GetUserNotifications(ctx.Username); err == nil {
+			for _, n := range notifications {
+				if err := s.db.DelNotification(ctx.Username, n.ID); err != nil {
+					log.WithError(err).Warnf("error deleting notification %s", n.ID)
+				}
+			}
+		}
+
 		// Delete user
 		if err := s.db.DelUser(ctx.Username); err != nil {
 			ctx.Error = true
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/renstrom/shortuuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// ImportHistoryHandler uploads a Twitter archive or Mastodon outbox and
+// dispatches a dry-run HistoryImportTask to preview the import
+func (s *Server) ImportHistoryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Title = "Import your history"
+
+		if r.Method == "GET" {
+			s.render("import_history", w, ctx)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxImportSize)
+
+		file, _, err := r.FormFile("archive")
+		if err != nil {
+			log.WithError(err).Error("error reading history archive")
+			ctx.Error = true
+			ctx.Message = "No archive uploaded or archive is too large"
+			s.render("error", w, ctx)
+			return
+		}
+		defer file.Close()
+
+		// Only the most recently uploaded archive is kept around for each user
+		dir := filepath.Join(s.config.Data, historyDir, ctx.Username)
+		if err := os.RemoveAll(dir); err != nil {
+			log.WithError(err).Warnf("error removing previous history archives for %s", ctx.Username)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.WithError(err).Error("error creating history directory")
+			ctx.Error = true
+			ctx.Message = "Error uploading archive"
+			s.render("error", w, ctx)
+			return
+		}
+
+		id := shortuuid.New()
+
+		f, err := os.OpenFile(HistoryArchivePath(s.config, ctx.Username, id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			log.WithError(err).Error("error creating history archive")
+			ctx.Error = true
+			ctx.Message = "Error uploading archive"
+			s.render("error", w, ctx)
+			return
+		}
+		_, err = io.Copy(f, file)
+		f.Close()
+		if err != nil {
+			log.WithError(err).Error("error writing history archive")
+			ctx.Error = true
+			ctx.Message = "Error uploading archive"
+			s.render("error", w, ctx)
+			return
+		}
+
+		uuid, err := s.tasks.Dispatch(NewHistoryImportTask(s.config, ctx.Username, id, true))
+		if err != nil {
+			log.WithError(err).Error("error dispatching history import task")
+			ctx.Error = true
+			ctx.Message = "Error importing your history, please try again later"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.TaskURL = URLForTask(s.config.BaseURL, uuid)
+		s.render("import_history", w, ctx)
+	}
+}
+
+// ImportHistoryPreviewHandler shows the result of a dry-run import and on
+// POST dispatches the HistoryImportTask that imports the history for real
+func (s *Server) ImportHistoryPreviewHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Title = "Import your history"
+
+		id := p.ByName("id")
+		if id == "" || filepath.Base(id) != id || id[0] == '.' || !FileExists(HistoryArchivePath(s.config, ctx.Username, id)) {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error importing your history: %s", ErrHistoryNotFound)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if r.Method == "POST" {
+			uuid, err := s.tasks.Dispatch(NewHistoryImportTask(s.config, ctx.Username, id, false))
+			if err != nil {
+				log.WithError(err).Error("error dispatching history import task")
+				ctx.Error = true
+				ctx.Message = "Error importing your history, please try again later"
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.TaskURL = URLForTask(s.config.BaseURL, uuid)
+			s.render("import_history", w, ctx)
+			return
+		}
+
+		t, ok := s.tasks.Lookup(r.FormValue("task"))
+		task, isHistoryTask := t.(*HistoryImportTask)
+		if !ok || !isHistoryTask || task.username != ctx.Username || task.id != id || !task.dryRun {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error importing your history: %s", ErrHistoryNotFound)
+			s.render("error", w, ctx)
+			return
+		}
+
+		result := task.Result()
+		if result.State != TaskStateComplete.String() {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error reading your archive: %s", result.Error)
+			s.render("error", w, ctx)
+			return
+		}
+
+		var preview HistoryImportPreview
+		if err := json.Unmarshal([]byte(result.Data["preview"]), &preview); err != nil {
+			log.WithError(err).Error("error decoding history import preview")
+			ctx.Error = true
+			ctx.Message = "Error reading your archive"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.HistoryPreview = &preview
+		s.render("import_history", w, ctx)
+	}
+}
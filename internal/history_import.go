@@ -0,0 +1,617 @@
+package internal
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// HistoryFormatTwitter is a Twitter archive zip with its data/tweets.js
+	HistoryFormatTwitter = "twitter"
+
+	// HistoryFormatMastodon is a Mastodon outbox.json on its own or in a
+	// zip of a Mastodon archive along with its media_attachments
+	HistoryFormatMastodon = "mastodon"
+
+	historyDir = "history"
+
+	// maxHistoryPreview is the number of twts shown in an import's preview
+	maxHistoryPreview = 20
+
+	// maxHistoryFileSize is the largest uncompressed tweets.js or
+	// outbox.json read from an archive
+	maxHistoryFileSize = 256 << 20
+
+	twitterTimeLayout = "Mon Jan 02 15:04:05 -0700 2006"
+)
+
+var (
+	ErrUnknownHistoryFormat = errors.New("error: not a Twitter archive or Mastodon outbox")
+	ErrHistoryNotFound      = errors.New("error: history import not found")
+	ErrHistoryFileTooLarge  = errors.New("error: archive contains a file that is too large to import")
+
+	twitterTweetsRe  = regexp.MustCompile(`^data/tweets?(-part\d+)?\.js$`)
+	historyLinkRe    = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]+)"[^>]*>(.*?)</a>`)
+	historyParaRe    = regexp.MustCompile(`(?i)</p>\s*<p[^>]*>`)
+	historyBreakRe   = regexp.MustCompile(`(?i)<br\s*/?>`)
+	historyNewlineRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// HistoryTwt is a post from another service to be imported as a twt
+type HistoryTwt struct {
+	Created time.Time
+	Text    string
+
+	// Media are the paths of images in the archive attached to the post
+	Media []string `json:",omitempty"`
+}
+
+// HistoryImportPreview summarises what importing an archive would do and is
+// the result of a dry-run HistoryImportTask
+type HistoryImportPreview struct {
+	ID      string
+	Format  string
+	Count   int
+	Media   int
+	Skipped int
+	First   time.Time
+	Last    time.Time
+
+	// Twts are the most recent twts that would be imported
+	Twts []HistoryTwt
+}
+
+// HistoryArchivePath returns the path of an archive uploaded by username to
+// import with the given id
+func HistoryArchivePath(conf *Config, username, id string) string {
+	return filepath.Join(conf.Data, historyDir, username, id)
+}
+
+// URLForHistoryPreview returns the url of the preview of an import from the
+// dry-run task with the given uuid
+func URLForHistoryPreview(baseURL, id, uuid string) string {
+	return fmt.Sprintf(
+		"%s/import/history/%s?task=%s",
+		strings.TrimSuffix(baseURL, "/"),
+		id, uuid,
+	)
+}
+
+// HistoryArchive is a parsed Twitter or Mastodon archive
+type HistoryArchive struct {
+	Format  string
+	Twts    []HistoryTwt
+	Skipped int
+
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+}
+
+// Close closes the underlying zip file, if any
+func (a *HistoryArchive) Close() error {
+	if a.zr != nil {
+		return a.zr.Close()
+	}
+	return nil
+}
+
+// Open opens a media file in the archive
+func (a *HistoryArchive) Open(name string) (io.ReadCloser, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return f.Open()
+}
+
+// Preview returns a summary of the archive's twts for a dry-run
+func (a *HistoryArchive) Preview(id string) *HistoryImportPreview {
+	preview := &HistoryImportPreview{
+		ID:      id,
+		Format:  a.Format,
+		Count:   len(a.Twts),
+		Skipped: a.Skipped,
+	}
+
+	for _, twt := range a.Twts {
+		preview.Media += len(twt.Media)
+	}
+
+	if len(a.Twts) > 0 {
+		preview.First = a.Twts[0].Created
+		preview.Last = a.Twts[len(a.Twts)-1].Created
+	}
+
+	for i := len(a.Twts) - 1; i >= 0 && len(preview.Twts) < maxHistoryPreview; i-- {
+		preview.Twts = append(preview.Twts, a.Twts[i])
+	}
+
+	return preview
+}
+
+// OpenHistoryArchive parses the Twitter archive zip or Mastodon outbox (on
+// its own or in a zip) at fn returning its posts sorted oldest first.
+// Reposts (retweets and boosts) are skipped.
+func OpenHistoryArchive(fn string) (*HistoryArchive, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	f.Close()
+
+	archive := &HistoryArchive{files: make(map[string]*zip.File)}
+
+	if !bytes.Equal(magic[:n], []byte("PK\x03\x04")) {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if err := archive.parseMastodon(data, ""); err != nil {
+			return nil, err
+		}
+		archive.sort()
+		return archive, nil
+	}
+
+	zr, err := zip.OpenReader(fn)
+	if err != nil {
+		return nil, ErrUnknownHistoryFormat
+	}
+	archive.zr = zr
+
+	var (
+		tweets []string
+		outbox string
+	)
+
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if strings.HasPrefix(name, "../") || f.FileInfo().IsDir() {
+			continue
+		}
+		archive.files[name] = f
+
+		if twitterTweetsRe.MatchString(name) {
+			tweets = append(tweets, name)
+		} else if path.Base(name) == "outbox.json" {
+			outbox = name
+		}
+	}
+
+	readFile := func(name string) ([]byte, error) {
+		rc, err := archive.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxHistoryFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxHistoryFileSize {
+			return nil, ErrHistoryFileTooLarge
+		}
+		return data, nil
+	}
+
+	switch {
+	case len(tweets) > 0:
+		for _, name := range tweets {
+			data, err := readFile(name)
+			if err != nil {
+				archive.Close()
+				return nil, err
+			}
+			if err := archive.parseTwitter(data); err != nil {
+				archive.Close()
+				return nil, err
+			}
+		}
+	case outbox != "":
+		data, err := readFile(outbox)
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		if err := archive.parseMastodon(data, path.Dir(outbox)); err != nil {
+			archive.Close()
+			return nil, err
+		}
+	default:
+		archive.Close()
+		return nil, ErrUnknownHistoryFormat
+	}
+
+	archive.sort()
+
+	return archive, nil
+}
+
+func (a *HistoryArchive) sort() {
+	sort.SliceStable(a.Twts, func(i, j int) bool {
+		return a.Twts[i].Created.Before(a.Twts[j].Created)
+	})
+}
+
+type twitterTweet struct {
+	ID        string `json:"id_str"`
+	FullText  string `json:"full_text"`
+	CreatedAt string `json:"created_at"`
+
+	Entities struct {
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+
+	ExtendedEntities struct {
+		Media []struct {
+			URL      string `json:"url"`
+			MediaURL string `json:"media_url_https"`
+			Type     string `json:"type"`
+		} `json:"media"`
+	} `json:"extended_entities"`
+}
+
+// parseTwitter parses a data/tweets.js file from a Twitter archive which is
+// a JSON array of tweets assigned to a JavaScript variable
+func (a *HistoryArchive) parseTwitter(data []byte) error {
+	a.Format = HistoryFormatTwitter
+
+	if i := bytes.IndexByte(data, '='); i >= 0 && i < bytes.IndexByte(data, '[') {
+		data = data[i+1:]
+	}
+
+	var items []struct {
+		Tweet twitterTweet `json:"tweet"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return ErrUnknownHistoryFormat
+	}
+
+	for _, item := range items {
+		tweet := item.Tweet
+
+		text := html.UnescapeString(tweet.FullText)
+		if strings.HasPrefix(text, "RT @") {
+			a.Skipped++
+			continue
+		}
+
+		created, err := time.Parse(twitterTimeLayout, tweet.CreatedAt)
+		if err != nil {
+			log.WithError(err).Warnf("error parsing timestamp of tweet %s", tweet.ID)
+			a.Skipped++
+			continue
+		}
+
+		for _, url := range tweet.Entities.URLs {
+			if url.URL != "" && url.ExpandedURL != "" {
+				text = strings.ReplaceAll(text, url.URL, url.ExpandedURL)
+			}
+		}
+
+		var media []string
+		for _, m := range tweet.ExtendedEntities.Media {
+			if m.URL != "" {
+				text = strings.ReplaceAll(text, m.URL, "")
+			}
+			if m.Type != "photo" || m.MediaURL == "" {
+				continue
+			}
+
+			base := fmt.Sprintf("%s-%s", tweet.ID, path.Base(m.MediaURL))
+			for _, dir := range []string{"data/tweets_media", "data/tweet_media"} {
+				if _, ok := a.files[path.Join(dir, base)]; ok {
+					media = append(media, path.Join(dir, base))
+					break
+				}
+			}
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" && len(media) == 0 {
+			a.Skipped++
+			continue
+		}
+
+		a.Twts = append(a.Twts, HistoryTwt{Created: created, Text: text, Media: media})
+	}
+
+	return nil
+}
+
+type mastodonNote struct {
+	Type      string    `json:"type"`
+	Published time.Time `json:"published"`
+	Summary   string    `json:"summary"`
+	Content   string    `json:"content"`
+
+	Attachment []struct {
+		MediaType string `json:"mediaType"`
+		URL       string `json:"url"`
+	} `json:"attachment"`
+}
+
+// parseMastodon parses a Mastodon outbox.json, an ActivityStreams ordered
+// collection of activities. Media is looked up relative to dir in the zip.
+func (a *HistoryArchive) parseMastodon(data []byte, dir string) error {
+	a.Format = HistoryFormatMastodon
+
+	var outbox struct {
+		Type         string `json:"type"`
+		OrderedItems []struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		} `json:"orderedItems"`
+	}
+	if err := json.Unmarshal(data, &outbox); err != nil || outbox.Type != "OrderedCollection" {
+		return ErrUnknownHistoryFormat
+	}
+
+	for _, item := range outbox.OrderedItems {
+		if item.Type != "Create" {
+			a.Skipped++
+			continue
+		}
+
+		var note mastodonNote
+		if err := json.Unmarshal(item.Object, &note); err != nil || note.Type != "Note" || note.Published.IsZero() {
+			a.Skipped++
+			continue
+		}
+
+		text := historyHTMLText(note.Content)
+		if summary := historyHTMLText(note.Summary); summary != "" {
+			text = fmt.Sprintf("CW: %s\n\n%s", summary, text)
+		}
+
+		var media []string
+		for _, attachment := range note.Attachment {
+			if !strings.HasPrefix(attachment.MediaType, "image/") {
+				continue
+			}
+			name := path.Join(dir, strings.TrimPrefix(attachment.URL, "/"))
+			if _, ok := a.files[name]; ok {
+				media = append(media, name)
+			}
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" && len(media) == 0 {
+			a.Skipped++
+			continue
+		}
+
+		a.Twts = append(a.Twts, HistoryTwt{Created: note.Published, Text: text, Media: media})
+	}
+
+	return nil
+}
+
+// historyHTMLText converts the HTML content of a post into plain text with
+// paragraphs and line breaks as new lines. Links are replaced by their url
+// except for mentions and hashtags which keep their text.
+func historyHTMLText(s string) string {
+	s = historyParaRe.ReplaceAllString(s, "\n\n")
+	s = historyBreakRe.ReplaceAllString(s, "\n")
+	s = historyLinkRe.ReplaceAllStringFunc(s, func(match string) string {
+		matches := historyLinkRe.FindStringSubmatch(match)
+		text := strings.TrimSpace(html.UnescapeString(stripTagsRe.ReplaceAllString(matches[2], "")))
+		if strings.HasPrefix(text, "@") || strings.HasPrefix(text, "#") {
+			return text
+		}
+		return html.UnescapeString(matches[1])
+	})
+	s = html.UnescapeString(stripTagsRe.ReplaceAllString(s, ""))
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(historyNewlineRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// historyTwtTime returns the timestamp of a line of a twtxt feed
+func historyTwtTime(line string) (time.Time, bool) {
+	i := strings.IndexByte(line, '\t')
+	if i < 0 || strings.HasPrefix(line, "#") {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(time.RFC3339, strings.TrimSpace(line[:i]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
+
+// MergeHistory merges twt lines into the user's feed file in timestamp
+// order, keeping any comments at the top and skipping lines already in the
+// feed. It returns the number of twts added. The feed is locked while it is
+// rewritten so twts posted in the meantime aren't lost.
+func MergeHistory(conf *Config, username string, lines []string) (int, error) {
+	p := filepath.Join(conf.Data, feedsDir)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		log.WithError(err).Error("error creating feeds directory")
+		return 0, err
+	}
+
+	defer feedLocks.Lock(username)()
+
+	fn := filepath.Join(p, username)
+
+	var header, twts []string
+	seen := make(map[string]bool)
+
+	if f, err := os.Open(fn); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), int(conf.MaxFetchLimit)+1)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if _, ok := historyTwtTime(line); ok {
+				twts = append(twts, line)
+				seen[line] = true
+			} else if strings.TrimSpace(line) != "" {
+				header = append(header, line)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	added := 0
+	for _, line := range lines {
+		if _, ok := historyTwtTime(line); !ok || seen[line] {
+			continue
+		}
+		seen[line] = true
+		twts = append(twts, line)
+		added++
+	}
+
+	sort.SliceStable(twts, func(i, j int) bool {
+		ti, _ := historyTwtTime(twts[i])
+		tj, _ := historyTwtTime(twts[j])
+		return ti.Before(tj)
+	})
+
+	buf := &bytes.Buffer{}
+	for _, line := range append(header, twts...) {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := fn + ".import"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// HistoryImportTask imports the posts of a Twitter or Mastodon archive
+// uploaded by a user into their feed, or when dry-run only previews them
+type HistoryImportTask struct {
+	*BaseTask
+
+	conf     *Config
+	username string
+	id       string
+	dryRun   bool
+}
+
+func NewHistoryImportTask(conf *Config, username, id string, dryRun bool) *HistoryImportTask {
+	return &HistoryImportTask{
+		BaseTask: NewBaseTask(),
+
+		conf:     conf,
+		username: username,
+		id:       id,
+		dryRun:   dryRun,
+	}
+}
+
+func (t *HistoryImportTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *HistoryImportTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	log.Infof("starting history import task for %s (dry-run: %t)", t.username, t.dryRun)
+
+	fn := HistoryArchivePath(t.conf, t.username, t.id)
+	if !FileExists(fn) {
+		return t.Fail(ErrHistoryNotFound)
+	}
+
+	archive, err := OpenHistoryArchive(fn)
+	if err != nil {
+		log.WithError(err).Errorf("error opening history archive for %s", t.username)
+		return t.Fail(err)
+	}
+	defer archive.Close()
+
+	if t.dryRun {
+		data, err := json.Marshal(archive.Preview(t.id))
+		if err != nil {
+			return t.Fail(err)
+		}
+		t.SetData("preview", string(data))
+		t.SetData("previewURI", URLForHistoryPreview(t.conf.BaseURL, t.id, t.ID()))
+		return nil
+	}
+
+	opts := &ImageOptions{Resize: true, Width: MediaResolution, Height: 0}
+
+	var lines []string
+	for _, twt := range archive.Twts {
+		text := twt.Text
+
+		for _, name := range twt.Media {
+			rc, err := archive.Open(name)
+			if err != nil {
+				log.WithError(err).Warnf("error opening media %s", name)
+				continue
+			}
+			mediaURI, err := StoreUploadedImage(t.conf, rc, mediaDir, "", opts)
+			rc.Close()
+			if err != nil {
+				log.WithError(err).Warnf("error storing media %s", name)
+				continue
+			}
+			text += fmt.Sprintf(" ![](%s)", mediaURI)
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"%s\t%s",
+			twt.Created.Format(time.RFC3339),
+			ExpandTag(t.conf, CleanTwt(text)),
+		))
+	}
+
+	added, err := MergeHistory(t.conf, t.username, lines)
+	if err != nil {
+		log.WithError(err).Errorf("error merging history into feed of %s", t.username)
+		return t.Fail(err)
+	}
+
+	if err := os.Remove(fn); err != nil {
+		log.WithError(err).Warn("error removing imported history archive")
+	}
+
+	log.Infof("imported %d twts into feed of %s", added, t.username)
+
+	t.SetData("imported", strconv.Itoa(added))
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestZip(t *testing.T, fn string, files map[string]string) {
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+func TestOpenHistoryArchiveTwitter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twtxt-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "twitter.zip")
+	writeTestZip(t, fn, map[string]string{
+		"data/tweets.js": `window.YTD.tweets.part0 = [
+  {"tweet": {"id_str": "2", "created_at": "Thu Oct 11 20:19:24 +0000 2018",
+    "full_text": "Look &amp; see https://t.co/abc https://t.co/img",
+    "entities": {"urls": [{"url": "https://t.co/abc", "expanded_url": "https://example.com/"}]},
+    "extended_entities": {"media": [{"url": "https://t.co/img", "type": "photo",
+      "media_url_https": "https://pbs.twimg.com/media/pic.jpg"}]}}},
+  {"tweet": {"id_str": "1", "created_at": "Wed Oct 10 20:19:24 +0000 2018", "full_text": "First!"}},
+  {"tweet": {"id_str": "3", "created_at": "Fri Oct 12 20:19:24 +0000 2018", "full_text": "RT @bob: hi"}}
+]`,
+		"data/tweets_media/2-pic.jpg": "jpeg",
+	})
+
+	archive, err := OpenHistoryArchive(fn)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	assert.Equal(t, HistoryFormatTwitter, archive.Format)
+	assert.Equal(t, 1, archive.Skipped)
+	require.Len(t, archive.Twts, 2)
+
+	assert.Equal(t, "First!", archive.Twts[0].Text)
+	assert.Equal(t, time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC), archive.Twts[0].Created.UTC())
+	assert.Equal(t, "Look & see https://example.com/", archive.Twts[1].Text)
+	assert.Equal(t, []string{"data/tweets_media/2-pic.jpg"}, archive.Twts[1].Media)
+
+	preview := archive.Preview("abc")
+	assert.Equal(t, 2, preview.Count)
+	assert.Equal(t, 1, preview.Media)
+	assert.Equal(t, "Look & see https://example.com/", preview.Twts[0].Text)
+}
+
+func TestOpenHistoryArchiveMastodon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twtxt-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "outbox.json")
+	require.NoError(t, ioutil.WriteFile(fn, []byte(`{
+  "type": "OrderedCollection",
+  "orderedItems": [
+    {"type": "Create", "object": {"type": "Note", "published": "2019-01-01T10:00:00Z",
+      "content": "<p>Hello <span class=\"h-card\"><a href=\"https://m.example/@bob\" class=\"u-url mention\">@<span>bob</span></a></span></p><p>See <a href=\"https://example.com/\"><span>example.com</span></a></p>"}},
+    {"type": "Announce", "object": "https://m.example/users/bob/statuses/1"}
+  ]
+}`), 0644))
+
+	archive, err := OpenHistoryArchive(fn)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	assert.Equal(t, HistoryFormatMastodon, archive.Format)
+	assert.Equal(t, 1, archive.Skipped)
+	require.Len(t, archive.Twts, 1)
+	assert.Equal(t, "Hello @bob\n\nSee https://example.com/", archive.Twts[0].Text)
+
+	require.NoError(t, ioutil.WriteFile(fn, []byte(`{"hello": "world"}`), 0644))
+	_, err = OpenHistoryArchive(fn)
+	assert.Equal(t, ErrUnknownHistoryFormat, err)
+}
+
+func TestMergeHistory(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	conf := &Config{Data: data, MaxFetchLimit: 1 << 20}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(data, feedsDir, "alice"), []byte(
+		"# nick = alice\n"+
+			"2020-01-01T00:00:00Z\tNewer\n",
+	), 0644))
+
+	lines := []string{
+		"2018-01-01T00:00:00Z\tOld",
+		"2021-01-01T00:00:00Z\tNewest",
+		"2020-01-01T00:00:00Z\tNewer",
+	}
+
+	added, err := MergeHistory(conf, "alice", lines)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	feed, err := ioutil.ReadFile(filepath.Join(data, feedsDir, "alice"))
+	require.NoError(t, err)
+	assert.Equal(t,
+		"# nick = alice\n"+
+			"2018-01-01T00:00:00Z\tOld\n"+
+			"2020-01-01T00:00:00Z\tNewer\n"+
+			"2021-01-01T00:00:00Z\tNewest\n",
+		string(feed),
+	)
+
+	added, err = MergeHistory(conf, "alice", lines)
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+}
+
+func TestMergeHistoryConcurrentAppend(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, BaseURL: "https://pod.example.com", MaxFetchLimit: 1 << 20}
+
+	user := NewUser()
+	user.Username = "alice"
+
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, time.Unix(int64(i), 0).UTC().Format(time.RFC3339)+"\tImported")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			_, err := MergeHistory(conf, "alice", lines[i*100:(i+1)*100])
+			assert.NoError(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, err := AppendTwt(conf, db, user, "Posted")
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+
+	// Twts posted while history is merged aren't lost
+	feed, err := ioutil.ReadFile(filepath.Join(data, feedsDir, "alice"))
+	require.NoError(t, err)
+	assert.Equal(t, 1000, strings.Count(string(feed), "\tImported\n"))
+	assert.Equal(t, 50, strings.Count(string(feed), "\tPosted\n"))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"time"
 
 	"github.com/jointwt/twtxt/types"
 	"github.com/robfig/cron"
@@ -30,9 +31,12 @@ func init() {
 		"SyncStore":         NewJobSpec("@every 1m", NewSyncStoreJob),
 		"UpdateFeeds":       NewJobSpec("@every 5m", NewUpdateFeedsJob),
 		"UpdateFeedSources": NewJobSpec("@every 15m", NewUpdateFeedSourcesJob),
+		"SendDigests":       NewJobSpec("@every 5m", NewSendDigestsJob),
+		"RetryWebhooks":     NewJobSpec("@every 1m", NewRetryWebhooksJob),
 
-		"FixUserAccounts":   NewJobSpec("@hourly", NewFixUserAccountsJob),
-		"DeleteOldSessions": NewJobSpec("@hourly", NewDeleteOldSessionsJob),
+		"FixUserAccounts":         NewJobSpec("@hourly", NewFixUserAccountsJob),
+		"DeleteOldSessions":       NewJobSpec("@hourly", NewDeleteOldSessionsJob),
+		"DeleteExpiredOAuthCodes": NewJobSpec("@hourly", NewDeleteExpiredOAuthCodesJob),
 
 		"FixMissingTwts": NewJobSpec("@daily", NewFixMissingTwtsJob),
 		"Stats":          NewJobSpec("@daily", NewStatsJob),
@@ -200,9 +204,27 @@ func (job *UpdateFeedsJob) Run() {
 		}
 	}
 
+	// Lists may include external feeds their owners do not otherwise follow
+	lists, err := job.db.GetAllLists()
+	if err != nil {
+		log.WithError(err).Warn("unable to get all lists from database")
+	}
+	for _, list := range lists {
+		for feed := range list.Sources() {
+			sources[feed] = true
+		}
+	}
+
 	log.Infof("updating %d sources", len(sources))
 	job.cache.FetchTwts(job.conf, job.archive, sources, followers)
 
+	if moved := job.cache.MovedFeeds(); len(moved) > 0 {
+		log.Infof("updating follows of %d moved feeds", len(moved))
+		if err := UpdateMovedFeeds(job.db, moved); err != nil {
+			log.WithError(err).Warn("error updating follows of moved feeds")
+		}
+	}
+
 	log.Infof("warming cache with local twts for %s", job.conf.BaseURL)
 	job.cache.GetByPrefix(job.conf.BaseURL, true)
 
@@ -363,6 +385,26 @@ func (job *DeleteOldSessionsJob) Run() {
 	}
 }
 
+type DeleteExpiredOAuthCodesJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewDeleteExpiredOAuthCodesJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &DeleteExpiredOAuthCodesJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *DeleteExpiredOAuthCodesJob) Run() {
+	log.Info("deleting expired oauth codes")
+
+	if err := job.db.DelExpiredOAuthCodes(); err != nil {
+		log.WithError(err).Error("error deleting expired oauth codes")
+	}
+}
+
 type FixFollowersJob struct {
 	conf    *Config
 	blogs   *BlogsCache
@@ -418,3 +460,72 @@ func (job *FixFollowersJob) Run() {
 		log.WithError(err).Error("error syncing store")
 	}
 }
+
+type SendDigestsJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewSendDigestsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &SendDigestsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *SendDigestsJob) Run() {
+	users, err := job.db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Warn("unable to get all users from database")
+		return
+	}
+
+	now := time.Now()
+
+	for _, user := range users {
+		if err := SendDigest(job.conf, job.db, user, now); err != nil {
+			log.WithError(err).Warnf("error sending email digest to %s", user.Username)
+		}
+	}
+}
+
+type RetryWebhooksJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewRetryWebhooksJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &RetryWebhooksJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *RetryWebhooksJob) Run() {
+	hooks, err := job.db.GetAllWebhooks()
+	if err != nil {
+		log.WithError(err).Warn("unable to get all webhooks from database")
+		return
+	}
+
+	now := time.Now()
+
+	for _, hook := range hooks {
+		if len(hook.Retries) == 0 {
+			continue
+		}
+
+		retries, err := TakeDueWebhookRetries(job.db, hook.ID, now)
+		if err != nil {
+			log.WithError(err).Warnf("error loading retries for webhook %s", hook.ID)
+			continue
+		}
+
+		for _, retry := range retries {
+			task := NewWebhookTask(job.conf, job.db, hook, retry.Payload, retry.Attempt)
+			if err := task.Run(); err != nil {
+				log.WithError(err).Warnf("error retrying delivery %s to webhook %s", retry.Payload.ID, hook.ID)
+			}
+		}
+	}
+}
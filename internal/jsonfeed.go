@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// JSONFeedVersion is the version of the JSON Feed spec we produce
+	JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+	// JSONFeedContentType is the media type of a JSON Feed document
+	JSONFeedContentType = "application/feed+json"
+)
+
+var mediaRe = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// JSONFeedAuthor is the author of a JSON Feed or one of its items
+type JSONFeedAuthor struct {
+	Name   string `json:"name,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// JSONFeedAttachment is a media file attached to a twt
+type JSONFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Title    string `json:"title,omitempty"`
+}
+
+// JSONFeedMention is a feed mentioned by a twt
+type JSONFeedMention struct {
+	Nick string `json:"nick"`
+	URL  string `json:"url"`
+}
+
+// JSONFeedTwtxt is the `_twtxt` extension of an item carrying the twtxt
+// specific details of the twt
+type JSONFeedTwtxt struct {
+	Hash         string            `json:"hash"`
+	Subject      string            `json:"subject,omitempty"`
+	Conversation string            `json:"conversation,omitempty"`
+	Feed         string            `json:"feed"`
+	Mentions     []JSONFeedMention `json:"mentions,omitempty"`
+}
+
+// JSONFeedItem is a single twt of a JSON Feed
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	DatePublished string               `json:"date_published"`
+	Authors       []JSONFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []JSONFeedAttachment `json:"attachments,omitempty"`
+	Twtxt         JSONFeedTwtxt        `json:"_twtxt"`
+}
+
+// JSONFeed is a JSON Feed 1.1 (https://jsonfeed.org/version/1.1) document
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+// Bytes ...
+func (feed JSONFeed) Bytes() ([]byte, error) {
+	data, err := json.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// JSONFeedFactory returns a function that builds the JSON Feed for a
+// profile's twts and avatar, formatting their text and resolving conversations against
+// the pod's cache
+func JSONFeedFactory(conf *Config, cache *Cache) func(profile types.Profile, avatar, feedURL string, twts types.Twts) JSONFeed {
+	formatTwt := FormatTwtFactory(conf)
+	urlForConv := URLForConvFactory(conf, cache)
+
+	return func(profile types.Profile, avatar, feedURL string, twts types.Twts) JSONFeed {
+		feed := JSONFeed{
+			Version:     JSONFeedVersion,
+			Title:       fmt.Sprintf("%s Twtxt JSON Feed", profile.Username),
+			HomePageURL: UserURL(profile.URL),
+			FeedURL:     feedURL,
+			Description: profile.Tagline,
+			Icon:        avatar,
+			Authors: []JSONFeedAuthor{{
+				Name:   profile.Username,
+				URL:    UserURL(profile.URL),
+				Avatar: avatar,
+			}},
+			Items: []JSONFeedItem{},
+		}
+
+		for _, twt := range twts {
+			twter := twt.Twter()
+
+			item := JSONFeedItem{
+				ID:            twt.Hash(),
+				URL:           URLForTwt(conf.BaseURL, twt.Hash()),
+				ContentHTML:   string(formatTwt(twt.Text())),
+				ContentText:   twt.Text(),
+				DatePublished: twt.Created().Format(time.RFC3339),
+				Authors: []JSONFeedAuthor{{
+					Name:   twter.Nick,
+					URL:    UserURL(twter.URL),
+					Avatar: twter.Avatar,
+				}},
+				Attachments: JSONFeedAttachments(twt.Text()),
+				Twtxt: JSONFeedTwtxt{
+					Hash:         twt.Hash(),
+					Subject:      twt.Subject(),
+					Conversation: urlForConv(twt),
+					Feed:         twter.URL,
+				},
+			}
+
+			for _, tag := range twt.Tags() {
+				item.Tags = append(item.Tags, tag.Tag())
+			}
+
+			for _, mention := range twt.Mentions() {
+				item.Twtxt.Mentions = append(item.Twtxt.Mentions, JSONFeedMention{
+					Nick: mention.Twter().Nick,
+					URL:  mention.Twter().URL,
+				})
+			}
+
+			feed.Items = append(feed.Items, item)
+		}
+
+		return feed
+	}
+}
+
+// JSONFeedAttachments returns the media (images, video and audio) embedded
+// in a twt's text as JSON Feed attachments
+func JSONFeedAttachments(text string) []JSONFeedAttachment {
+	var attachments []JSONFeedAttachment
+
+	for _, match := range mediaRe.FindAllStringSubmatch(text, -1) {
+		u, err := url.Parse(match[2])
+		if err != nil || u.Scheme == "" {
+			continue
+		}
+
+		attachments = append(attachments, JSONFeedAttachment{
+			URL:      u.String(),
+			MimeType: mediaMimeType(u.Path),
+			Title:    strings.TrimSpace(match[1]),
+		})
+	}
+
+	return attachments
+}
+
+// mediaMimeType returns the mime type of a media file by its extension.
+// Media without an extension are images served as WebP (or PNG to older
+// clients) by the MediaHandler.
+func mediaMimeType(path string) string {
+	switch ext := filepath.Ext(path); ext {
+	case "", ".webp":
+		return "image/webp"
+	case ".png":
+		return "image/png"
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	case ".mp3":
+		return "audio/mpeg"
+	case ".ogg":
+		return "audio/ogg"
+	default:
+		if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+			return mimeType
+		}
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFeedAttachments(t *testing.T) {
+	text := "Look! ![](https://twtxt.net/media/abc) ![a cat](https://twtxt.net/media/cat.mp4) ![](/media/relative) ![](https://example.com/song.mp3)"
+
+	assert.Equal(t, []JSONFeedAttachment{
+		{URL: "https://twtxt.net/media/abc", MimeType: "image/webp"},
+		{URL: "https://twtxt.net/media/cat.mp4", MimeType: "video/mp4", Title: "a cat"},
+		{URL: "https://example.com/song.mp3", MimeType: "audio/mpeg"},
+	}, JSONFeedAttachments(text))
+
+	assert.Nil(t, JSONFeedAttachments("No media here"))
+}
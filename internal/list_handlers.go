@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// GetListTwts returns all cached twts from the feeds in the list sorted by
+// their created timestamp.
+func GetListTwts(cache *Cache, list *List) (twts types.Twts) {
+	for feed := range list.Sources() {
+		twts = append(twts, cache.GetByURL(feed.URL)...)
+	}
+
+	sort.Sort(twts)
+
+	return
+}
+
+// ListHandler ...
+func (s *Server) ListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		nick := NormalizeUsername(p.ByName("nick"))
+		name := NormalizeFeedName(p.ByName("name"))
+
+		list, err := s.db.GetList(nick, name)
+		if err != nil {
+			if err != ErrListNotFound {
+				log.WithError(err).Errorf("error loading list %s for %s", name, nick)
+			}
+			ctx.Error = true
+			ctx.Message = "List Not Found"
+			s.render("404", w, ctx)
+			return
+		}
+
+		// Private lists are indistinguishable from missing ones
+		if !list.VisibleTo(ctx.Username) {
+			ctx.Error = true
+			ctx.Message = "List Not Found"
+			s.render("404", w, ctx)
+			return
+		}
+
+		twts := GetListTwts(s.cache, list)
+
+		var pagedTwts types.Twts
+
+		page := SafeParseInt(r.FormValue("p"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error sorting and paging twts")
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading the list"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Alternatives = append(ctx.Alternatives, types.Alternatives{
+			types.Alternative{
+				Type:  "application/atom+xml",
+				Title: fmt.Sprintf("%s's %s list Atom Feed", list.Owner, list.Name),
+				URL:   fmt.Sprintf("%s/atom.xml", URLForList(s.config.BaseURL, list.Owner, list.Name)),
+			},
+		}...)
+
+		ctx.Title = fmt.Sprintf("%s's %s list", list.Owner, list.Name)
+		ctx.List = list
+		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
+		ctx.Pager = &pager
+
+		if ctx.Authenticated && ctx.Username == list.Owner {
+			marker := ListReadMarker(list.Name)
+			ctx.ReadMarker = FindReadDivider(ctx.Twts, ctx.User.GetReadMarker(marker))
+			if page == 1 {
+				UpdateReadMarker(s.db, ctx.User, marker, twts)
+			}
+		}
+
+		s.render("list", w, ctx)
+	}
+}
+
+// ListSyndicationHandler ...
+func (s *Server) ListSyndicationHandler() httprouter.Handle {
+	formatTwt := FormatTwtFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		nick := NormalizeUsername(p.ByName("nick"))
+		name := NormalizeFeedName(p.ByName("name"))
+
+		list, err := s.db.GetList(nick, name)
+		if err != nil {
+			if err != ErrListNotFound {
+				log.WithError(err).Errorf("error loading list %s for %s", name, nick)
+			}
+			http.Error(w, "List Not Found", http.StatusNotFound)
+			return
+		}
+
+		if !list.VisibleTo(ctx.Username) {
+			http.Error(w, "List Not Found", http.StatusNotFound)
+			return
+		}
+
+		twts := GetListTwts(s.cache, list)
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			if len(twts) > 0 {
+				w.Header().Set(
+					"Last-Modified",
+					twts[0].Created().Format(http.TimeFormat),
+				)
+			}
+			return
+		}
+
+		feed := &feeds.Feed{
+			Title:       fmt.Sprintf("%s's %s list Twtxt Atom Feed", list.Owner, list.Name),
+			Link:        &feeds.Link{Href: URLForList(s.config.BaseURL, list.Owner, list.Name)},
+			Description: fmt.Sprintf("Twts from the %s list by %s", list.Name, list.Owner),
+			Author:      &feeds.Author{Name: list.Owner},
+			Created:     time.Now(),
+		}
+
+		var items []*feeds.Item
+
+		for _, twt := range twts {
+			items = append(items, &feeds.Item{
+				Id:          twt.Hash(),
+				Title:       string(formatTwt(twt.Text())),
+				Link:        &feeds.Link{Href: URLForTwt(s.config.BaseURL, twt.Hash())},
+				Author:      &feeds.Author{Name: twt.Twter().Nick},
+				Description: string(formatTwt(twt.Text())),
+				Created:     twt.Created(),
+			},
+			)
+		}
+		feed.Items = items
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		data, err := feed.ToAtom()
+		if err != nil {
+			log.WithError(err).Error("error serializing feed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte(data))
+	}
+}
+
+// ManageListsHandler creates and deletes lists as well as adding and
+// removing feeds to/from lists owned by the user.
+func (s *Server) ManageListsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		action := strings.ToLower(strings.TrimSpace(r.FormValue("action")))
+		name := NormalizeFeedName(r.FormValue("name"))
+		nick := strings.TrimSpace(r.FormValue("nick"))
+		url := NormalizeURL(r.FormValue("url"))
+
+		if err := ValidateFeedName(s.config.Data, name); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Invalid list name: %s", err.Error())
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		if action == "create" {
+			if s.db.HasList(user.Username, name) {
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error creating list: %s", ErrListAlreadyExists)
+				s.render("error", w, ctx)
+				return
+			}
+
+			if err := s.db.SetList(user.Username, name, NewList(user.Username, name)); err != nil {
+				log.WithError(err).Errorf("error creating list %s for %s", name, user.Username)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error creating list: %s", name)
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.Error = false
+			ctx.Message = fmt.Sprintf("Successfully created list: %s", name)
+			s.render("error", w, ctx)
+			return
+		}
+
+		list, err := s.db.GetList(user.Username, name)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error loading list: %s", name)
+			s.render("error", w, ctx)
+			return
+		}
+
+		switch action {
+		case "delete":
+			if err := s.db.DelList(user.Username, name); err != nil {
+				log.WithError(err).Errorf("error deleting list %s for %s", name, user.Username)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error deleting list: %s", name)
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.Error = false
+			ctx.Message = fmt.Sprintf("Successfully deleted list: %s", name)
+			s.render("error", w, ctx)
+			return
+		case "add":
+			if nick == "" {
+				ctx.Error = true
+				ctx.Message = "No feed specified to add to the list"
+				s.render("error", w, ctx)
+				return
+			}
+
+			// Feeds the user already follows may be added by nick alone
+			if url == "" {
+				url = user.Following[nick]
+			}
+
+			if url == "" {
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("No url specified for %s", nick)
+				s.render("error", w, ctx)
+				return
+			}
+
+			if !user.Follows(url) {
+				if err := ValidateFeed(s.config, nick, url); err != nil {
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Unable to add %s to list: %s", nick, err)
+					s.render("error", w, ctx)
+					return
+				}
+			}
+
+			list.AddFeed(nick, url)
+			ctx.Message = fmt.Sprintf("Successfully added %s to list: %s", nick, name)
+		case "remove":
+			list.RemoveFeed(nick)
+			ctx.Message = fmt.Sprintf("Successfully removed %s from list: %s", nick, name)
+		case "public":
+			list.Public = true
+			ctx.Message = fmt.Sprintf("List %s is now public", name)
+		case "private":
+			list.Public = false
+			ctx.Message = fmt.Sprintf("List %s is now private", name)
+		default:
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Unknown list action: %s", action)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetList(user.Username, name, list); err != nil {
+			log.WithError(err).Errorf("error updating list %s for %s", name, user.Username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error updating list: %s", name)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		s.render("error", w, ctx)
+	}
+}
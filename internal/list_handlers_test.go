@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/internal/session"
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestListStore(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-lists")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetList("alice", "work")
+	assert.Equal(t, ErrListNotFound, err)
+
+	list := NewList("alice", "work")
+	list.AddFeed("bob", "https://bob.example.com/twtxt.txt")
+	require.NoError(t, db.SetList("alice", "work", list))
+	require.NoError(t, db.SetList("alice", "friends", NewList("alice", "friends")))
+	require.NoError(t, db.SetList("bob", "work", NewList("bob", "work")))
+
+	assert.True(t, db.HasList("alice", "work"))
+	assert.Equal(t, int64(3), db.LenLists())
+
+	saved, err := db.GetList("alice", "work")
+	require.NoError(t, err)
+	assert.False(t, saved.Public)
+	assert.True(t, saved.HasFeed("https://bob.example.com/twtxt.txt"))
+
+	lists, err := db.GetUserLists("alice")
+	require.NoError(t, err)
+	assert.Len(t, lists, 2)
+
+	require.NoError(t, db.DelList("alice", "work"))
+	assert.False(t, db.HasList("alice", "work"))
+	assert.True(t, db.HasList("bob", "work"))
+}
+
+func TestListVisibility(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-lists")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	for _, username := range []string{"alice", "eve"} {
+		user := NewUser()
+		user.Username = username
+		require.NoError(t, db.SetUser(username, user))
+	}
+
+	twter := types.Twter{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"}
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.Twts[twter.URL] = &Cached{
+		cache: make(map[string]types.Twt),
+		Twts:  types.Twts{retwt.NewReTwt(twter, "secret plans", time.Now())},
+	}
+
+	list := NewList("alice", "work")
+	list.AddFeed(twter.Nick, twter.URL)
+	require.NoError(t, db.SetList("alice", "work", list))
+
+	s := &Server{config: conf, db: db, cache: cache}
+	handler := s.ListSyndicationHandler()
+
+	get := func(username string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/user/alice/list/work/atom.xml", nil)
+		if username != "" {
+			sess := session.NewSession(session.NewMemoryStore(time.Hour))
+			sess.Data = session.Map{"username": username}
+			r = r.WithContext(context.WithValue(r.Context(), session.SessionKey, sess))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r, httprouter.Params{
+			httprouter.Param{Key: "nick", Value: "alice"},
+			httprouter.Param{Key: "name", Value: "work"},
+		})
+		return w
+	}
+
+	// Lists are private to their owner by default
+	assert.Equal(t, http.StatusNotFound, get("").Code)
+	assert.Equal(t, http.StatusNotFound, get("eve").Code)
+
+	w := get("alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "secret plans")
+
+	list.Public = true
+	require.NoError(t, db.SetList("alice", "work", list))
+
+	assert.Equal(t, http.StatusOK, get("").Code)
+	assert.Equal(t, http.StatusOK, get("eve").Code)
+}
@@ -29,6 +29,13 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		}
 
 		if r.Method == "GET" {
+			webhooks, err := GetPodWebhooks(s.db)
+			if err != nil {
+				log.WithError(err).Error("error loading pod webhooks")
+			}
+
+			ctx.Webhooks = webhooks
+			ctx.WebhookEvents = WebhookEvents
 			s.render("managePod", w, ctx)
 			return
 		}
@@ -36,6 +43,7 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		name := strings.TrimSpace(r.FormValue("podName"))
 		description := strings.TrimSpace(r.FormValue("podDescription"))
 		maxTwtLength := SafeParseInt(r.FormValue("maxTwtLength"), s.config.MaxTwtLength)
+		maxUserFeeds := SafeParseInt(r.FormValue("maxUserFeeds"), s.config.MaxUserFeeds)
 		openProfiles := r.FormValue("enableOpenProfiles") == "on"
 		openRegistrations := r.FormValue("enableOpenRegistrations") == "on"
 
@@ -89,6 +97,8 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 
 		// Update twt length
 		s.config.MaxTwtLength = maxTwtLength
+		// Update feeds per user
+		s.config.MaxUserFeeds = maxUserFeeds
 		// Update open profiles
 		s.config.OpenProfiles = openProfiles
 		// Update open registrations
@@ -153,7 +163,7 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 			return
 		}
 
-		if s.db.HasUser(username) || s.db.HasFeed(username) {
+		if s.db.HasUser(username) || s.db.HasFeed(username) || s.db.HasAlias(username) {
 			ctx.Error = true
 			ctx.Message = "User or Feed with that name already exists! Please pick another!"
 			s.render("error", w, ctx)
@@ -209,6 +219,106 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 	}
 }
 
+// FeedLimitHandler overrides the maximum number of feeds a user may create
+func (s *Server) FeedLimitHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		username := NormalizeUsername(r.FormValue("username"))
+		maxFeeds := SafeParseInt(r.FormValue("maxFeeds"), 0)
+
+		if maxFeeds < 0 {
+			ctx.Error = true
+			ctx.Message = "Feed limit cannot be negative"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", username)
+			ctx.Error = true
+			ctx.Message = "User not found"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user.MaxFeeds = maxFeeds
+
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating user object for %s", username)
+			ctx.Error = true
+			ctx.Message = "Error updating user"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("%s may now create up to %d feeds", user.Username, user.FeedLimit(s.config))
+		s.render("error", w, ctx)
+	}
+}
+
+// ResetTOTPHandler turns off two-factor authentication for a user who has
+// lost access to their authenticator app and recovery codes
+func (s *Server) ResetTOTPHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		username := NormalizeUsername(r.FormValue("username"))
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", username)
+			ctx.Error = true
+			ctx.Message = "User not found"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if !user.HasTOTP() {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("%s does not have two-factor authentication enabled", user.Username)
+			s.render("error", w, ctx)
+			return
+		}
+
+		user.DisableTOTP()
+
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating user object for %s", username)
+			ctx.Error = true
+			ctx.Message = "Error updating user"
+			s.render("error", w, ctx)
+			return
+		}
+
+		log.Infof("two-factor authentication for %s reset by %s", user.Username, ctx.Username)
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Two-factor authentication has been reset for %s, they can now login with just their password", user.Username)
+		s.render("error", w, ctx)
+	}
+}
+
 // DelUserHandler ...
 func (s *Server) DelUserHandler() httprouter.Handle {
 	isAdminUser := IsAdminUserFactory(s.config)
@@ -246,6 +356,16 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 		for _, feed := range feeds {
 			// Get user's owned feeds
 			if user.OwnsFeed(feed.Name) {
+				// Shared feeds carry on without the user if anyone else owns them
+				if feed.HasOtherOwners(user.Username) {
+					delete(feed.Owners, user.Username)
+					feed.AddAuditEntry(ctx.User.Username, FeedActionRemove, user.Username)
+					if err := s.db.SetFeed(feed.Name, feed); err != nil {
+						log.WithError(err).Warnf("error removing %s from feed %s", user.Username, feed.Name)
+					}
+					continue
+				}
+
 				// Get twts in a feed
 				nick := feed.Name
 				if nick != "" {
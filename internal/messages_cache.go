@@ -19,6 +19,27 @@ const (
 type MessagesCache struct {
 	mu            sync.RWMutex
 	MessageCounts map[string]int
+
+	onChange func(username string, count int)
+}
+
+// OnChange registers a callback that is called with a user's new messages
+// count whenever it changes.
+func (cache *MessagesCache) OnChange(fn func(username string, count int)) {
+	cache.mu.Lock()
+	cache.onChange = fn
+	cache.mu.Unlock()
+}
+
+func (cache *MessagesCache) changed(username string) {
+	cache.mu.RLock()
+	onChange := cache.onChange
+	count := cache.MessageCounts[username]
+	cache.mu.RUnlock()
+
+	if onChange != nil {
+		onChange(username, count)
+	}
 }
 
 // NewMessagesCache ...
@@ -118,6 +139,7 @@ func (cache *MessagesCache) Inc(username string) {
 	cache.mu.Lock()
 	cache.MessageCounts[username]++
 	cache.mu.Unlock()
+	cache.changed(username)
 }
 
 // Dec ...
@@ -125,6 +147,7 @@ func (cache *MessagesCache) Dec(username string) {
 	cache.mu.Lock()
 	cache.MessageCounts[username]--
 	cache.mu.Unlock()
+	cache.changed(username)
 }
 
 // Get ...
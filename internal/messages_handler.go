@@ -89,6 +89,8 @@ func (s *Server) SendMessageHandler() httprouter.Handle {
 		}
 		s.msgs.Inc(recipient)
 
+		Notify(s.db, s.events, NewNotification(NotificationMessage, recipient, ctx.User.Username, ctx.User.URL, "/messages"))
+
 		ctx.Error = false
 		ctx.Message = "Messages successfully sent"
 		s.render("error", w, ctx)
@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/h2non/filetype"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidExport  = errors.New("error: invalid or corrupt export archive")
+	ErrInvalidMovedTo = errors.New("error: invalid url to move account to")
+
+	// importMediaRe matches the names the pod gives to processed uploads,
+	// a shortuuid and the extension of one of the formats media is served as
+	importMediaRe = regexp.MustCompile(`^[a-zA-Z0-9]{22}\.(png|webp|ogg|mp3|webm|mp4)$`)
+)
+
+// MovedNotice returns the body served in place of a moved user's feed, a
+// `# url =` metadata comment pointing at the new feed for clients that
+// do not follow redirects
+func MovedNotice(nick, url string) []byte {
+	preamble := &FeedPreamble{}
+	preamble.Add("nick", nick)
+	preamble.Add("url", url)
+	fmt.Fprintf(&preamble.Buffer, "# This feed has moved to %s\n", url)
+	return preamble.Bytes()
+}
+
+// MoveTo marks the user's account as moved to the feed at url on another
+// pod, or clears it if url is empty
+func (u *User) MoveTo(conf *Config, url string) error {
+	if url == "" {
+		u.MovedTo = ""
+		return nil
+	}
+
+	url = NormalizeURL(url)
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return ErrInvalidMovedTo
+	}
+	if url == NormalizeURL(u.URL) || strings.HasPrefix(url, conf.BaseURL) {
+		return ErrInvalidMovedTo
+	}
+
+	if err := ValidateFeed(conf, u.Username, url); err != nil {
+		return err
+	}
+
+	u.MovedTo = url
+	return nil
+}
+
+// PermanentlyMovedURL returns the url a feed moved to if the response was
+// only reached by following permanent (301 or 308) redirects
+func PermanentlyMovedURL(res *http.Response) (string, bool) {
+	req := res.Request
+	if req == nil || req.Response == nil {
+		return "", false
+	}
+
+	for req != nil && req.Response != nil {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		default:
+			return "", false
+		}
+		req = req.Response.Request
+	}
+
+	return res.Request.URL.String(), true
+}
+
+// UpdateMovedFeeds replaces the urls of feeds that have moved (old url to
+// new url) in every user's follows and list
+func UpdateMovedFeeds(db Store, moved map[string]string) error {
+	if len(moved) == 0 {
+		return nil
+	}
+
+	replace := func(follows map[string]string) bool {
+		changed := false
+		for nick, url := range follows {
+			if newURL, ok := moved[url]; ok {
+				follows[nick] = newURL
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if replace(user.Following) {
+			log.Infof("updating moved feeds followed by %s", user.Username)
+			if err := db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Warnf("error updating user object for %s", user.Username)
+			}
+		}
+	}
+
+	lists, err := db.GetAllLists()
+	if err != nil {
+		return err
+	}
+
+	for _, list := range lists {
+		if replace(list.Feeds) {
+			if err := db.SetList(list.Owner, list.Name, list); err != nil {
+				log.WithError(err).Warnf("error updating list %s of %s", list.Name, list.Owner)
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportBaseURL returns the base url of the pod an export was created on
+// from the user's feed url in its settings, e.g: https://example.com
+func exportBaseURL(url string) string {
+	if i := strings.Index(url, "/user/"); i > 0 {
+		return url[:i]
+	}
+	return ""
+}
+
+// ImportExport restores the personal data in an export archive created by
+// an ExportTask (usually on another pod) into the user's account. The
+// user's own feed, blog posts, messages and media are merged with any
+// existing data and links to media on the old pod are rewritten.
+func ImportExport(conf *Config, user *User, r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ErrInvalidExport
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if strings.HasPrefix(name, "../") || strings.HasPrefix(name, "/") || f.FileInfo().IsDir() {
+			continue
+		}
+		files[name] = f
+	}
+
+	readFile := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(io.LimitReader(rc, conf.MaxUploadSize))
+	}
+
+	readJSON := func(name string, v interface{}) error {
+		data, err := readFile(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+
+	var settings exportSettings
+	data, err := readFile("settings.json")
+	if err != nil {
+		return ErrInvalidExport
+	}
+	if err := json.Unmarshal(data, &settings); err != nil || settings.Username == "" {
+		return ErrInvalidExport
+	}
+
+	rewrite := func(data []byte) []byte {
+		oldBaseURL := exportBaseURL(settings.URL)
+		if oldBaseURL == "" || oldBaseURL == strings.TrimSuffix(conf.BaseURL, "/") {
+			return data
+		}
+		return bytes.ReplaceAll(
+			data,
+			[]byte(oldBaseURL+"/media/"),
+			[]byte(strings.TrimSuffix(conf.BaseURL, "/")+"/media/"),
+		)
+	}
+
+	// Twts from the old feed come first as feeds are ordered oldest first
+	if data, err := readFile(path.Join("feeds", settings.Username, "twtxt.txt")); err == nil {
+		fn := filepath.Join(conf.Data, feedsDir, user.Username)
+		existing, err := ioutil.ReadFile(fn)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		data = rewrite(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+
+		if err := os.MkdirAll(filepath.Join(conf.Data, feedsDir), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fn, append(data, existing...), 0644); err != nil {
+			return fmt.Errorf("error writing feed: %w", err)
+		}
+	}
+
+	blogsPrefix := path.Join("blogs", settings.Username) + "/"
+	for name := range files {
+		if !strings.HasPrefix(name, blogsPrefix) || path.Ext(name) != ".json" {
+			continue
+		}
+
+		blogPost := &BlogPost{}
+		if err := readJSON(name, blogPost); err != nil {
+			log.WithError(err).Warnf("error reading blog post metadata %s", name)
+			continue
+		}
+
+		content, err := readFile(strings.TrimSuffix(name, ".json") + ".md")
+		if err != nil {
+			log.WithError(err).Warnf("error reading blog post %s", name)
+			continue
+		}
+
+		if blogPost.Slug == "" || strings.ContainsAny(blogPost.Slug, "/\\") || strings.HasPrefix(blogPost.Slug, ".") {
+			log.Warnf("invalid blog post slug in %s", name)
+			continue
+		}
+
+		blogPost.Author = user.Username
+		blogPost.data = bytes.NewBuffer(rewrite(content))
+
+		if err := blogPost.Save(conf); err != nil {
+			return fmt.Errorf("error saving blog post: %w", err)
+		}
+	}
+
+	if data, err := readFile("messages.mbox"); err == nil {
+		if err := os.MkdirAll(filepath.Join(conf.Data, msgsDir), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(conf.Data, msgsDir, user.Username), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("error writing messages: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(conf.Data, mediaDir), 0755); err != nil {
+		return err
+	}
+	for name := range files {
+		if path.Dir(name) != "media" {
+			continue
+		}
+
+		// Media is served from the pod's own origin so only files named
+		// and typed like the pod's own processed uploads are restored
+		base := path.Base(name)
+		if !importMediaRe.MatchString(base) {
+			log.Warnf("skipping unexpected media %s in export of %s", base, user.Username)
+			continue
+		}
+
+		fn := filepath.Join(conf.Data, mediaDir, base)
+		if FileExists(fn) {
+			continue
+		}
+
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		if kind, err := filetype.Match(data); err != nil || "."+kind.Extension != path.Ext(base) {
+			log.Warnf("skipping media %s in export of %s whose content is not %s", base, user.Username, path.Ext(base))
+			continue
+		}
+		if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+			return fmt.Errorf("error writing media %s: %w", base, err)
+		}
+	}
+
+	var (
+		following    map[string]string
+		muted        map[string]string
+		bookmarks    map[string]string
+		filters      []*MuteFilter
+		followedTags []string
+	)
+
+	for _, file := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"following.json", &following},
+		{"muted.json", &muted},
+		{"bookmarks.json", &bookmarks},
+		{"filters.json", &filters},
+		{"tags.json", &followedTags},
+	} {
+		if err := readJSON(file.name, file.v); err != nil {
+			return ErrInvalidExport
+		}
+	}
+
+	if user.Following == nil {
+		user.Following = make(map[string]string)
+	}
+	for nick, url := range following {
+		if _, ok := user.Following[nick]; !ok {
+			user.Following[nick] = url
+		}
+	}
+
+	if user.Muted == nil {
+		user.Muted = make(map[string]string)
+	}
+	for nick, url := range muted {
+		user.Muted[nick] = url
+	}
+
+	if user.Bookmarks == nil {
+		user.Bookmarks = make(map[string]string)
+	}
+	for hash, url := range bookmarks {
+		user.Bookmarks[hash] = url
+	}
+
+	user.Filters = append(user.Filters, filters...)
+
+	for _, tag := range followedTags {
+		if !HasString(user.FollowedTags, tag) {
+			user.FollowedTags = append(user.FollowedTags, tag)
+		}
+	}
+
+	if user.Tagline == "" {
+		user.Tagline = settings.Tagline
+	}
+	if settings.Theme != "" {
+		user.Theme = settings.Theme
+	}
+	if settings.DisplayDatesInTimezone != "" {
+		user.DisplayDatesInTimezone = settings.DisplayDatesInTimezone
+	}
+	user.IsFollowersPubliclyVisible = settings.IsFollowersPubliclyVisible
+	user.IsFollowingPubliclyVisible = settings.IsFollowingPubliclyVisible
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ImportExportHandler imports an export archive, usually created on
+// another pod, into the user's account when moving to this pod
+func (s *Server) ImportExportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		file, _, err := r.FormFile("archive")
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "No export archive uploaded"
+			s.render("error", w, ctx)
+			return
+		}
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(file, s.config.MaxUploadSize))
+		if err != nil {
+			log.WithError(err).Error("error reading export archive")
+			ctx.Error = true
+			ctx.Message = "Error reading export archive"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := ImportExport(s.config, user, bytes.NewReader(data), int64(len(data))); err != nil {
+			log.WithError(err).Errorf("error importing export archive for %s", user.Username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error importing export archive: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error importing export archive"
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.GetByPrefix(s.config.BaseURL, true)
+
+		ctx.Error = false
+		ctx.Message = "Successfully imported your export archive"
+		s.render("error", w, ctx)
+	}
+}
+
+// MoveAccountHandler marks the user's account as moved to a feed on
+// another pod, redirecting their feed and profile there, or clears it
+func (s *Server) MoveAccountHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+		}
+
+		url := strings.TrimSpace(r.FormValue("url"))
+
+		if err := user.MoveTo(s.config, url); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error moving account: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error moving account"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		if user.MovedTo == "" {
+			ctx.Message = "Your account is no longer marked as moved"
+		} else {
+			ctx.Message = fmt.Sprintf("Your account is now marked as moved to %s", user.MovedTo)
+		}
+		s.render("error", w, ctx)
+	}
+}
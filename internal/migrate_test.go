@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermanentlyMovedURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/temp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "2020-01-01T00:00:00Z\tHello")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for path, expected := range map[string]string{
+		"/old":  server.URL + "/new",
+		"/temp": "",
+		"/new":  "",
+	} {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		url, ok := PermanentlyMovedURL(res)
+		assert.Equal(t, expected != "", ok, path)
+		assert.Equal(t, expected, url, path)
+	}
+}
+
+func TestExportAndImport(t *testing.T) {
+	oldData, err := ioutil.TempDir("", "twtxt-migrate-old")
+	require.NoError(t, err)
+	defer os.RemoveAll(oldData)
+
+	newData, err := ioutil.TempDir("", "twtxt-migrate-new")
+	require.NoError(t, err)
+	defer os.RemoveAll(newData)
+
+	db, err := NewStore("bitcask://" + oldData + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	oldConf := &Config{Data: oldData, Name: "old", BaseURL: "https://old.example.com", MaxUploadSize: 1 << 20}
+	newConf := &Config{Data: newData, Name: "new", BaseURL: "https://new.example.com", MaxUploadSize: 1 << 20}
+
+	old := NewUser()
+	old.Username = "alice"
+	old.URL = URLForUser(oldConf, "alice")
+	old.Tagline = "Hello"
+	old.Following = map[string]string{"bob": "https://bob.example.com/twtxt.txt"}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(oldData, feedsDir), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(oldData, feedsDir, "alice"),
+		[]byte("2020-01-01T00:00:00Z\tOld ![](https://old.example.com/media/aBcDeFgHiJkLmNoPqRsTuV)\n"),
+		0644,
+	))
+	require.NoError(t, os.MkdirAll(filepath.Join(oldData, mediaDir), 0755))
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(oldData, mediaDir, "aBcDeFgHiJkLmNoPqRsTuV.webp"), webp, 0644))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteExport(oldConf, db, old, buf))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(newData, feedsDir), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(newData, feedsDir, "alice2"),
+		[]byte("2021-01-01T00:00:00Z\tNew\n"),
+		0644,
+	))
+
+	user := NewUser()
+	user.Username = "alice2"
+	user.URL = URLForUser(newConf, "alice2")
+
+	require.NoError(t, ImportExport(newConf, user, bytes.NewReader(buf.Bytes()), int64(buf.Len())))
+
+	feed, err := ioutil.ReadFile(filepath.Join(newData, feedsDir, "alice2"))
+	require.NoError(t, err)
+	assert.Equal(t,
+		"2020-01-01T00:00:00Z\tOld ![](https://new.example.com/media/aBcDeFgHiJkLmNoPqRsTuV)\n2021-01-01T00:00:00Z\tNew\n",
+		string(feed),
+	)
+
+	assert.True(t, FileExists(filepath.Join(newData, mediaDir, "aBcDeFgHiJkLmNoPqRsTuV.webp")))
+	assert.Equal(t, "https://bob.example.com/twtxt.txt", user.Following["bob"])
+	assert.Equal(t, "Hello", user.Tagline)
+
+	assert.Equal(t, ErrInvalidExport, ImportExport(newConf, user, bytes.NewReader([]byte("nope")), 4))
+}
+
+func TestImportExportMedia(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-migrate")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	conf := &Config{Data: data, BaseURL: "https://new.example.com", MaxUploadSize: 1 << 20}
+
+	fn := filepath.Join(data, "export.zip")
+	writeTestZip(t, fn, map[string]string{
+		"settings.json":                     `{"Username":"alice","URL":"https://old.example.com/user/alice/twtxt.txt"}`,
+		"media/aBcDeFgHiJkLmNoPqRsTuV.webp": "RIFF\x00\x00\x00\x00WEBPVP8 ",
+		"media/evil.html":                   "<script>alert(1)</script>",
+		"media/zYxWvUtSrQpOnMlKjIhGfE.png":  "<svg onload=alert(1)>",
+	})
+	archive, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = URLForUser(conf, "alice")
+
+	require.NoError(t, ImportExport(conf, user, bytes.NewReader(archive), int64(len(archive))))
+
+	// Only media named and typed like the pod's own uploads is restored
+	assert.True(t, FileExists(filepath.Join(data, mediaDir, "aBcDeFgHiJkLmNoPqRsTuV.webp")))
+	assert.False(t, FileExists(filepath.Join(data, mediaDir, "evil.html")))
+	assert.False(t, FileExists(filepath.Join(data, mediaDir, "zYxWvUtSrQpOnMlKjIhGfE.png")))
+}
@@ -17,23 +17,43 @@ import (
 )
 
 const (
-	maxUserFeeds = 5 // 5 is < 7 and humans can only really handle ~7 things
+	maxPinnedTwts = 3 // a handful of pins keeps the profile readable
 )
 
 var (
 	ErrFeedAlreadyExists = errors.New("error: feed already exists by that name")
 	ErrAlreadyFollows    = errors.New("error: you already follow this feed")
 	ErrTooManyFeeds      = errors.New("error: you have too many feeds")
+	ErrTooManyPins       = errors.New("error: you have too many pinned twts")
+	ErrTwtNotFound       = errors.New("error: twt not found")
+	ErrListAlreadyExists = errors.New("error: list already exists by that name")
 )
 
 // Feed ...
 type Feed struct {
 	Name        string
+	Tagline     string
 	Description string
 	URL         string
 	CreatedAt   time.Time
 
+	Links []string `default:"[]"`
+
+	IsFollowersPubliclyVisible bool `default:"true"`
+	IsMembersPubliclyVisible   bool `default:"true"`
+
 	Followers map[string]string `default:"{}"`
+	Following map[string]string `default:"{}"`
+	Pinned    []string          `default:"[]"`
+
+	// PinnedAt is when Pinned last changed, pins are served in the feed
+	PinnedAt time.Time
+
+	// Owners maps the usernames of the feed's members to their role and
+	// Invites those invited to become members to the role offered
+	Owners  map[string]string `default:"{}"`
+	Invites map[string]string `default:"{}"`
+	Audit   []FeedAuditEntry  `default:"[]"`
 
 	remotes map[string]string
 }
@@ -56,18 +76,77 @@ type User struct {
 	Feeds  []string `default:"[]"`
 	Tokens []string `default:"[]"`
 
+	// MemberFeeds are the feeds the user has joined as an editor or poster,
+	// the feeds they own are in Feeds
+	MemberFeeds []string `default:"[]"`
+
+	// MaxFeeds overrides the pod's MaxUserFeeds for this user when set by
+	// a pod owner, zero uses the pod's limit
+	MaxFeeds int `default:"0"`
+
+	// MovedTo is the url of the feed on another pod this account has moved
+	// to, its feed and profile permanently redirect there when set
+	MovedTo string `default:""`
+
 	SMTPToken string `default:""`
 	POP3Token string `default:""`
 
+	// TOTPSecret is the user's two-factor authentication secret, empty when
+	// 2FA is off, and TOTPRecoveryCodes the hashes of their unused
+	// recovery codes
+	TOTPSecret        string   `default:""`
+	TOTPRecoveryCodes []string `default:"[]"`
+
+	// TOTPLastStep is the time step of the last authenticator app code
+	// used so that a code can't be replayed
+	TOTPLastStep int64 `default:"0"`
+
 	Followers map[string]string `default:"{}"`
 	Following map[string]string `default:"{}"`
 	Muted     map[string]string `default:"{}"`
+	Bookmarks map[string]string `default:"{}"`
+	Pinned    []string          `default:"[]"`
+	Filters   []*MuteFilter     `default:"[]"`
+
+	// PinnedAt is when Pinned last changed, pins are served in the feed
+	PinnedAt time.Time
+
+	FollowedTags []string `default:"[]"`
+
+	ReadMarkers map[string]*ReadMarker `default:"{}"`
+
+	// EmailDigest is how often notifications are emailed to DigestEmail
+	// which unlike the recovery email is stored only once a user opts in
+	EmailDigest  string `default:"off"`
+	DigestEmail  string
+	LastDigestAt time.Time
 
 	muted   map[string]string
 	remotes map[string]string
 	sources map[string]string
 }
 
+// List is a named subset of the feeds a user follows (and possibly
+// other external feeds) with its own timeline.
+type List struct {
+	Name      string
+	Owner     string
+	CreatedAt time.Time
+
+	// Public lists can be viewed by others, lists are private to their
+	// owner by default
+	Public bool `default:"false"`
+
+	Feeds map[string]string `default:"{}"`
+}
+
+// ReadMarker records the most recent twt a user has seen in one of their
+// timelines (the timeline itself, mentions or a list).
+type ReadMarker struct {
+	Hash      string
+	Timestamp time.Time
+}
+
 // Token ...
 type Token struct {
 	Signature string
@@ -75,6 +154,15 @@ type Token struct {
 	UserAgent string
 	CreatedAt time.Time
 	ExpiresAt time.Time
+
+	// ClientID is the app an OAuth token was issued to, GrantID ties the
+	// access and refresh tokens of one authorization together and Scopes
+	// limits what the token may be used for. Tokens issued by /api/v1/auth
+	// have none of these and may be used for anything.
+	ClientID string   `default:""`
+	GrantID  string   `default:""`
+	Scopes   []string `default:"[]"`
+	Refresh  bool     `default:"false"`
 }
 
 func LoadToken(data []byte) (token *Token, err error) {
@@ -100,7 +188,7 @@ func (t *Token) Bytes() ([]byte, error) {
 
 func CreateFeed(conf *Config, db Store, user *User, name string, force bool) error {
 	if user != nil {
-		if !force && len(user.Feeds) > maxUserFeeds {
+		if !force && len(user.Feeds) >= user.FeedLimit(conf) {
 			return ErrTooManyFeeds
 		}
 	}
@@ -108,7 +196,7 @@ func CreateFeed(conf *Config, db Store, user *User, name string, force bool) err
 	fn := filepath.Join(conf.Data, feedsDir, name)
 	stat, err := os.Stat(fn)
 
-	if err == nil && !force {
+	if (err == nil || db.HasAlias(name)) && !force {
 		return ErrFeedAlreadyExists
 	}
 
@@ -135,6 +223,10 @@ func CreateFeed(conf *Config, db Store, user *User, name string, force bool) err
 	feed.Followers = followers
 	feed.CreatedAt = time.Now()
 
+	if user != nil {
+		feed.Owners[user.Username] = FeedRoleOwner
+	}
+
 	if err := db.SetFeed(name, feed); err != nil {
 		return err
 	}
@@ -151,10 +243,12 @@ func DetachFeedFromOwner(db Store, user *User, feed *Feed) (err error) {
 	delete(user.sources, feed.URL)
 
 	user.Feeds = RemoveString(user.Feeds, feed.Name)
+	user.MemberFeeds = RemoveString(user.MemberFeeds, feed.Name)
 	if err = db.SetUser(user.Username, user); err != nil {
 		return
 	}
 
+	delete(feed.Owners, user.Username)
 	delete(feed.Followers, user.Username)
 	if err = db.SetFeed(feed.Name, feed); err != nil {
 		return
@@ -165,6 +259,7 @@ func DetachFeedFromOwner(db Store, user *User, feed *Feed) (err error) {
 
 func RemoveFeedOwnership(db Store, user *User, feed *Feed) (err error) {
 	user.Feeds = RemoveString(user.Feeds, feed.Name)
+	user.MemberFeeds = RemoveString(user.MemberFeeds, feed.Name)
 	if err = db.SetUser(user.Username, user); err != nil {
 		return
 	}
@@ -173,7 +268,31 @@ func RemoveFeedOwnership(db Store, user *User, feed *Feed) (err error) {
 }
 
 func AddFeedOwnership(db Store, user *User, feed *Feed) (err error) {
-	user.Feeds = append(user.Feeds, feed.Name)
+	if user.OwnsFeed(feed.Name) && !user.IsFeedMember(feed.Name) {
+		return nil
+	}
+
+	user.MemberFeeds = RemoveString(user.MemberFeeds, feed.Name)
+	if !user.OwnsFeed(feed.Name) {
+		user.Feeds = append(user.Feeds, feed.Name)
+	}
+	if err = db.SetUser(user.Username, user); err != nil {
+		return
+	}
+
+	return nil
+}
+
+// AddFeedMembership records a feed the user has joined without owning it
+func AddFeedMembership(db Store, user *User, feed *Feed) (err error) {
+	if user.IsFeedMember(feed.Name) && !user.OwnsFeed(feed.Name) {
+		return nil
+	}
+
+	user.Feeds = RemoveString(user.Feeds, feed.Name)
+	if !user.IsFeedMember(feed.Name) {
+		user.MemberFeeds = append(user.MemberFeeds, feed.Name)
+	}
 	if err = db.SetUser(user.Username, user); err != nil {
 		return
 	}
@@ -204,6 +323,9 @@ func LoadFeed(data []byte) (feed *Feed, err error) {
 	if feed.Followers == nil {
 		feed.Followers = make(map[string]string)
 	}
+	if feed.Following == nil {
+		feed.Following = make(map[string]string)
+	}
 
 	feed.remotes = make(map[string]string)
 	for n, u := range feed.Followers {
@@ -216,6 +338,33 @@ func LoadFeed(data []byte) (feed *Feed, err error) {
 	return
 }
 
+// NewList ...
+func NewList(owner, name string) *List {
+	list := &List{Owner: owner, Name: name, CreatedAt: time.Now()}
+	if err := defaults.Set(list); err != nil {
+		log.WithError(err).Error("error creating new list object")
+	}
+	return list
+}
+
+// LoadList ...
+func LoadList(data []byte) (list *List, err error) {
+	list = &List{}
+	if err := defaults.Set(list); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	if list.Feeds == nil {
+		list.Feeds = make(map[string]string)
+	}
+
+	return
+}
+
 // NewUser ...
 func NewUser() *User {
 	user := &User{}
@@ -248,6 +397,21 @@ func LoadUser(data []byte) (user *User, err error) {
 	if user.Following == nil {
 		user.Following = make(map[string]string)
 	}
+	if user.Bookmarks == nil {
+		user.Bookmarks = make(map[string]string)
+	}
+	if user.ReadMarkers == nil {
+		user.ReadMarkers = make(map[string]*ReadMarker)
+	}
+
+	// Drop expired filters, they are pruned for good on the next save
+	var filters []*MuteFilter
+	for _, filter := range user.Filters {
+		if filter != nil && !filter.Expired() {
+			filters = append(filters, filter)
+		}
+	}
+	user.Filters = filters
 
 	user.muted = make(map[string]string)
 	for n, u := range user.Muted {
@@ -287,6 +451,60 @@ func (f *Feed) FollowedBy(url string) bool {
 	return ok
 }
 
+// Follows returns true if the feed follows the feed at url
+func (f *Feed) Follows(url string) bool {
+	url = NormalizeURL(url)
+	for _, u := range f.Following {
+		if NormalizeURL(u) == url {
+			return true
+		}
+	}
+	return false
+}
+
+// Follow ...
+func (f *Feed) Follow(nick, url string) {
+	if !f.Follows(url) {
+		f.Following[nick] = url
+	}
+}
+
+// FollowAndValidate ...
+func (f *Feed) FollowAndValidate(conf *Config, nick, url string) error {
+	if err := ValidateFeed(conf, nick, url); err != nil {
+		return err
+	}
+
+	if f.Follows(url) {
+		return ErrAlreadyFollows
+	}
+
+	f.Following[nick] = url
+
+	return nil
+}
+
+// Pin pins the twt identified by hash to the top of the feed's profile.
+func (f *Feed) Pin(hash string) error {
+	if HasString(f.Pinned, hash) {
+		return nil
+	}
+	if len(f.Pinned) >= maxPinnedTwts {
+		return ErrTooManyPins
+	}
+	f.Pinned = append(f.Pinned, hash)
+	f.PinnedAt = time.Now()
+	return nil
+}
+
+// Unpin removes the twt identified by hash from the feed's pinned twts.
+func (f *Feed) Unpin(hash string) {
+	if HasString(f.Pinned, hash) {
+		f.Pinned = RemoveString(f.Pinned, hash)
+		f.PinnedAt = time.Now()
+	}
+}
+
 func (f *Feed) Source() types.Feeds {
 	feeds := make(types.Feeds)
 	feeds[types.Feed{Nick: f.Name, URL: f.URL}] = true
@@ -306,19 +524,44 @@ func (f *Feed) Profile(baseURL string, viewer *User) types.Profile {
 		muted = viewer.HasMuted(f.URL)
 	}
 
+	// Feeds created before feeds had taglines only have a description
+	tagline := f.Tagline
+	if tagline == "" {
+		tagline = f.Description
+	}
+
+	member := f.Role(viewer) != ""
+
+	followers := f.Followers
+	if !f.IsFollowersPubliclyVisible && !member {
+		followers = map[string]string{}
+	}
+
+	members := map[string]string{}
+	if f.IsMembersPubliclyVisible || member {
+		members = f.Owners
+	}
+
 	return types.Profile{
 		Type: "Feed",
 
-		Username: f.Name,
-		Tagline:  f.Description,
-		URL:      f.URL,
-		BlogsURL: URLForBlogs(baseURL, f.Name),
+		Username:    f.Name,
+		Tagline:     tagline,
+		Description: f.Description,
+		URL:         f.URL,
+		BlogsURL:    URLForBlogs(baseURL, f.Name),
+		Links:       f.Links,
 
 		Follows:    follows,
 		FollowedBy: followedBy,
 		Muted:      muted,
 
-		Followers: f.Followers,
+		Followers: followers,
+		Members:   members,
+		Pinned:    f.Pinned,
+
+		IsFollowersPubliclyVisible: f.IsFollowersPubliclyVisible,
+		IsMembersPubliclyVisible:   f.IsMembersPubliclyVisible,
 	}
 }
 
@@ -330,6 +573,45 @@ func (f *Feed) Bytes() ([]byte, error) {
 	return data, nil
 }
 
+func (l *List) AddFeed(nick, url string) {
+	l.Feeds[nick] = NormalizeURL(url)
+}
+
+func (l *List) RemoveFeed(nick string) {
+	delete(l.Feeds, nick)
+}
+
+func (l *List) HasFeed(url string) bool {
+	url = NormalizeURL(url)
+	for _, u := range l.Feeds {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
+
+// VisibleTo returns true if the user by username may view the list
+func (l *List) VisibleTo(username string) bool {
+	return l.Public || (username != "" && username == l.Owner)
+}
+
+func (l *List) Sources() types.Feeds {
+	feeds := make(types.Feeds)
+	for nick, url := range l.Feeds {
+		feeds[types.Feed{Nick: nick, URL: url}] = true
+	}
+	return feeds
+}
+
+func (l *List) Bytes() ([]byte, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 func (u *User) String() string {
 	url, err := url.Parse(u.URL)
 	if err != nil {
@@ -356,6 +638,17 @@ func (u *User) HasToken(token string) bool {
 	return false
 }
 
+// FeedLimit returns the maximum number of feeds the user may create
+func (u *User) FeedLimit(conf *Config) int {
+	if u.MaxFeeds > 0 {
+		return u.MaxFeeds
+	}
+	if conf.MaxUserFeeds > 0 {
+		return conf.MaxUserFeeds
+	}
+	return DefaultMaxUserFeeds
+}
+
 func (u *User) OwnsFeed(name string) bool {
 	name = NormalizeFeedName(name)
 	for _, feed := range u.Feeds {
@@ -366,6 +659,26 @@ func (u *User) OwnsFeed(name string) bool {
 	return false
 }
 
+// IsFeedMember returns true if the user has joined the named feed as an
+// editor or poster
+func (u *User) IsFeedMember(name string) bool {
+	name = NormalizeFeedName(name)
+	for _, feed := range u.MemberFeeds {
+		if NormalizeFeedName(feed) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PostAsFeeds returns the feeds the user may post as, those they own
+// followed by those they are a member of
+func (u *User) PostAsFeeds() []string {
+	feeds := make([]string, 0, len(u.Feeds)+len(u.MemberFeeds))
+	feeds = append(feeds, u.Feeds...)
+	return append(feeds, u.MemberFeeds...)
+}
+
 func (u *User) Is(url string) bool {
 	if NormalizeURL(url) == "" {
 		return false
@@ -399,6 +712,44 @@ func (u *User) Unmute(nick string) {
 	}
 }
 
+// Bookmark adds the twt identified by hash (from the feed url) to the
+// user's bookmarks.
+func (u *User) Bookmark(hash, url string) {
+	u.Bookmarks[hash] = NormalizeURL(url)
+}
+
+// Unbookmark removes the twt identified by hash from the user's bookmarks.
+func (u *User) Unbookmark(hash string) {
+	delete(u.Bookmarks, hash)
+}
+
+// Bookmarked returns true if the user has bookmarked the twt identified by hash.
+func (u *User) Bookmarked(hash string) bool {
+	_, ok := u.Bookmarks[hash]
+	return ok
+}
+
+// Pin pins the twt identified by hash to the top of the user's profile.
+func (u *User) Pin(hash string) error {
+	if HasString(u.Pinned, hash) {
+		return nil
+	}
+	if len(u.Pinned) >= maxPinnedTwts {
+		return ErrTooManyPins
+	}
+	u.Pinned = append(u.Pinned, hash)
+	u.PinnedAt = time.Now()
+	return nil
+}
+
+// Unpin removes the twt identified by hash from the user's pinned twts.
+func (u *User) Unpin(hash string) {
+	if HasString(u.Pinned, hash) {
+		u.Pinned = RemoveString(u.Pinned, hash)
+		u.PinnedAt = time.Now()
+	}
+}
+
 func (u *User) Follow(nick, url string) {
 	if !u.Follows(url) {
 		u.Following[nick] = url
@@ -421,6 +772,25 @@ func (u *User) FollowAndValidate(conf *Config, nick, url string) error {
 	return nil
 }
 
+// FollowTag follows a #hashtag so that twts tagged with it appear in the
+// user's timeline.
+func (u *User) FollowTag(tag string) {
+	tag = NormalizeTag(tag)
+	if tag != "" && !HasString(u.FollowedTags, tag) {
+		u.FollowedTags = append(u.FollowedTags, tag)
+	}
+}
+
+// UnfollowTag ...
+func (u *User) UnfollowTag(tag string) {
+	u.FollowedTags = RemoveString(u.FollowedTags, NormalizeTag(tag))
+}
+
+// FollowsTag ...
+func (u *User) FollowsTag(tag string) bool {
+	return HasString(u.FollowedTags, NormalizeTag(tag))
+}
+
 func (u *User) Follows(url string) bool {
 	_, ok := u.sources[NormalizeURL(url)]
 	return ok
@@ -479,6 +849,10 @@ func (u *User) Profile(baseURL string, viewer *User) types.Profile {
 
 		Followers: u.Followers,
 		Following: u.Following,
+		Pinned:    u.Pinned,
+
+		IsFollowersPubliclyVisible: u.IsFollowersPubliclyVisible,
+		IsFollowingPubliclyVisible: u.IsFollowingPubliclyVisible,
 	}
 }
 
@@ -486,9 +860,96 @@ func (u *User) Twter() types.Twter {
 	return types.Twter{Nick: u.Username, URL: u.URL}
 }
 
+// FollowsAnyTag returns true if the twt is tagged with a tag the user follows
+func (u *User) FollowsAnyTag(twt types.Twt) bool {
+	for _, tag := range twt.Tags() {
+		if u.FollowsTag(tag.Tag()) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReadMarker returns the user's read position for the named timeline
+// or a zero marker if they have never read it.
+func (u *User) GetReadMarker(name string) ReadMarker {
+	if marker, ok := u.ReadMarkers[name]; ok && marker != nil {
+		return *marker
+	}
+	return ReadMarker{}
+}
+
+// MarkRead advances the user's read position for the named timeline to the
+// given twt. Markers never move backwards, returns true if it was advanced.
+func (u *User) MarkRead(name string, twt types.Twt) bool {
+	if twt.IsZero() {
+		return false
+	}
+
+	marker := u.GetReadMarker(name)
+	if !twt.Created().After(marker.Timestamp) {
+		return false
+	}
+
+	if u.ReadMarkers == nil {
+		u.ReadMarkers = make(map[string]*ReadMarker)
+	}
+	u.ReadMarkers[name] = &ReadMarker{Hash: twt.Hash(), Timestamp: twt.Created()}
+
+	return true
+}
+
+// AddFilter adds a mute filter
+func (u *User) AddFilter(filter *MuteFilter) {
+	u.Filters = append(u.Filters, filter)
+}
+
+// RemoveFilter removes the mute filter identified by id
+func (u *User) RemoveFilter(id string) error {
+	for i, filter := range u.Filters {
+		if filter.ID == id {
+			u.Filters = append(u.Filters[:i], u.Filters[i+1:]...)
+			return nil
+		}
+	}
+	return ErrFilterNotFound
+}
+
+// MatchFilter returns the first active mute filter matching the twt with
+// the given action or nil if there is none.
+func (u *User) MatchFilter(twt types.Twt, action string) *MuteFilter {
+	for _, filter := range u.Filters {
+		if filter.Action == action && filter.Match(twt) {
+			return filter
+		}
+	}
+	return nil
+}
+
+// MuteWarning returns a description of the filter the twt should be
+// collapsed behind or an empty string if the twt should be shown as is.
+func (u *User) MuteWarning(twt types.Twt) string {
+	if filter := u.MatchFilter(twt, FilterActionWarn); filter != nil {
+		return filter.String()
+	}
+	return ""
+}
+
+// MuteWarnings returns the warnings for all twts that match a filter keyed
+// by the twt's hash.
+func (u *User) MuteWarnings(twts types.Twts) map[string]string {
+	warnings := make(map[string]string)
+	for _, twt := range twts {
+		if warning := u.MuteWarning(twt); warning != "" {
+			warnings[twt.Hash()] = warning
+		}
+	}
+	return warnings
+}
+
 func (u *User) Filter(twts []types.Twt) (filtered []types.Twt) {
 	// fast-path
-	if len(u.muted) == 0 {
+	if len(u.muted) == 0 && len(u.Filters) == 0 {
 		return twts
 	}
 
@@ -496,6 +957,9 @@ func (u *User) Filter(twts []types.Twt) (filtered []types.Twt) {
 		if u.HasMuted(twt.Twter().URL) {
 			continue
 		}
+		if u.MatchFilter(twt, FilterActionHide) != nil {
+			continue
+		}
 		filtered = append(filtered, twt)
 	}
 	return
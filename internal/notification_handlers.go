@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+)
+
+// NotificationsHandler ...
+func (s *Server) NotificationsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		notifications, err := GetNotifications(s.db, ctx.User.Username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading notifications for %s", ctx.User.Username)
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading notifications"
+			s.render("error", w, ctx)
+			return
+		}
+
+		var pagedNotifications Notifications
+
+		page := SafeParseInt(r.FormValue("p"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(notifications), s.config.TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedNotifications); err != nil {
+			log.WithError(err).Error("error paging notifications")
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading notifications"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = "Notifications"
+		ctx.Notifications = pagedNotifications
+		ctx.Pager = &pager
+
+		s.render("notifications", w, ctx)
+	}
+}
+
+// MarkNotificationsReadHandler marks a single notification, or all of the
+// user's notifications if no id is given, as read.
+func (s *Server) MarkNotificationsReadHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		id := strings.TrimSpace(r.FormValue("id"))
+
+		if err := MarkNotificationsRead(s.db, ctx.User.Username, id); err != nil {
+			log.WithError(err).Errorf("error marking notifications read for %s", ctx.User.Username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error updating notifications: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/notifications", http.StatusFound)
+	}
+}
@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/creasty/defaults"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// NotificationFollow is sent when someone starts following a user or
+	// one of their feeds
+	NotificationFollow = "follow"
+
+	// NotificationMention is sent when a user is mentioned in a twt
+	NotificationMention = "mention"
+
+	// NotificationReply is sent when someone replies to one of a user's twts
+	NotificationReply = "reply"
+
+	// NotificationWebMention is sent when a webmention for a user is received
+	NotificationWebMention = "webmention"
+
+	// NotificationMessage is sent when a user receives a new private message
+	NotificationMessage = "message"
+
+	// NotificationFeedInvite is sent when a user is invited to become a
+	// member of a feed, the role offered is kept in the notification's Text
+	NotificationFeedInvite = "invite"
+
+	// NotificationsEvent is published when a user receives a new notification
+	NotificationsEvent = "notifications"
+
+	// maxNotifications is the number of notifications kept per user, older
+	// notifications are pruned as new ones arrive.
+	maxNotifications = 200
+)
+
+var (
+	ErrNotificationNotFound = errors.New("error: notification not found")
+
+	subjectHashRegexp = regexp.MustCompile(`\(#([a-z0-9]+)\)`)
+)
+
+// Notification is an in-app notice to a user about activity concerning them
+type Notification struct {
+	ID        string
+	Type      string
+	Username  string
+	From      string
+	FromURL   string
+	Target    string
+	Hash      string
+	Text      string
+	CreatedAt time.Time
+	Read      bool
+}
+
+// NewNotification returns a new unread notification for the user
+func NewNotification(typ, username, from, fromURL, target string) *Notification {
+	return &Notification{
+		ID:        GenerateRandomToken(),
+		Type:      typ,
+		Username:  username,
+		From:      from,
+		FromURL:   fromURL,
+		Target:    target,
+		CreatedAt: time.Now(),
+	}
+}
+
+// LoadNotification ...
+func LoadNotification(data []byte) (n *Notification, err error) {
+	n = &Notification{}
+	if err := defaults.Set(n); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// String returns a short human readable summary of the notification
+func (n *Notification) String() string {
+	switch n.Type {
+	case NotificationFollow:
+		return fmt.Sprintf("%s started following %s", n.From, n.Target)
+	case NotificationMention:
+		return fmt.Sprintf("%s mentioned you", n.From)
+	case NotificationReply:
+		return fmt.Sprintf("%s replied to your twt", n.From)
+	case NotificationWebMention:
+		if n.From != "" {
+			return fmt.Sprintf("%s mentioned you on %s", n.From, n.Target)
+		}
+		return fmt.Sprintf("You were mentioned on %s", n.Target)
+	case NotificationMessage:
+		return fmt.Sprintf("New message from %s", n.From)
+	case NotificationFeedInvite:
+		return fmt.Sprintf("%s invited you to join %s as %s", n.From, n.Target, n.Text)
+	default:
+		return n.Text
+	}
+}
+
+func (n *Notification) Bytes() ([]byte, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Notifications ...
+type Notifications []*Notification
+
+func (ns Notifications) Len() int           { return len(ns) }
+func (ns Notifications) Less(i, j int) bool { return ns[i].CreatedAt.After(ns[j].CreatedAt) }
+func (ns Notifications) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
+
+// Unread returns the number of unread notifications
+func (ns Notifications) Unread() (unread int) {
+	for _, n := range ns {
+		if !n.Read {
+			unread++
+		}
+	}
+	return
+}
+
+// GetNotifications returns the user's notifications sorted newest first
+func GetNotifications(db Store, username string) (Notifications, error) {
+	notifications, err := db.GetUserNotifications(username)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := Notifications(notifications)
+	sort.Sort(ns)
+
+	return ns, nil
+}
+
+// Notify stores the notification, prunes the user's oldest notifications
+// beyond maxNotifications and publishes a NotificationsEvent if bus is not
+// nil. Errors are logged as notifications are best effort.
+func Notify(db Store, bus *EventBus, n *Notification) {
+	if !db.HasUser(n.Username) {
+		return
+	}
+
+	if err := db.SetNotification(n.Username, n.ID, n); err != nil {
+		log.WithError(err).Warnf("error storing %s notification for %s", n.Type, n.Username)
+		return
+	}
+
+	ns, err := GetNotifications(db, n.Username)
+	if err != nil {
+		log.WithError(err).Warnf("error loading notifications for %s", n.Username)
+		return
+	}
+
+	if len(ns) > maxNotifications {
+		for _, old := range ns[maxNotifications:] {
+			if err := db.DelNotification(n.Username, old.ID); err != nil {
+				log.WithError(err).Warnf("error pruning notification %s for %s", old.ID, n.Username)
+			}
+		}
+		ns = ns[:maxNotifications]
+	}
+
+	if bus != nil {
+		bus.Publish(n.Username, Event{Type: NotificationsEvent, Count: ns.Unread(), Notification: n})
+	}
+}
+
+// NotifyFeedFollow notifies the owner(s) of the named user or feed that they
+// have a new follower.
+func NotifyFeedFollow(db Store, bus *EventBus, name, from, fromURL string) {
+	if db.HasUser(name) {
+		Notify(db, bus, NewNotification(NotificationFollow, name, from, fromURL, name))
+		return
+	}
+
+	for _, owner := range GetFeedOwners(db, name) {
+		Notify(db, bus, NewNotification(NotificationFollow, owner, from, fromURL, name))
+	}
+}
+
+// MarkNotificationsRead marks the user's notification with the given id, or
+// all their notifications if id is empty, as read.
+func MarkNotificationsRead(db Store, username, id string) error {
+	if id != "" {
+		n, err := db.GetNotification(username, id)
+		if err != nil {
+			return err
+		}
+		n.Read = true
+		return db.SetNotification(username, id, n)
+	}
+
+	ns, err := db.GetUserNotifications(username)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range ns {
+		if n.Read {
+			continue
+		}
+		n.Read = true
+		if err := db.SetNotification(username, n.ID, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotifyTwts creates mention and reply notifications for local users from
+// newly fetched twts. A twt that both replies to and mentions a user only
+// creates a reply notification.
+func NotifyTwts(conf *Config, db Store, cache *Cache, bus *EventBus, twts types.Twts) {
+	for _, twt := range twts {
+		twter := twt.Twter()
+		notified := make(map[string]bool)
+
+		if match := subjectHashRegexp.FindStringSubmatch(twt.Subject()); match != nil {
+			if parent, ok := cache.Lookup(match[1]); ok {
+				if user, err := GetUserFromURL(conf, db, parent.Twter().URL); err == nil && !user.Is(twter.URL) {
+					n := NewNotification(NotificationReply, user.Username, twter.Nick, twter.URL, URLForTwt(conf.BaseURL, twt.Hash()))
+					n.Hash = twt.Hash()
+					Notify(db, bus, n)
+					notified[user.Username] = true
+				}
+			}
+		}
+
+		for _, mention := range twt.Mentions() {
+			user, err := GetUserFromURL(conf, db, mention.Twter().URL)
+			if err != nil || notified[user.Username] || user.Is(twter.URL) {
+				continue
+			}
+
+			n := NewNotification(NotificationMention, user.Username, twter.Nick, twter.URL, URLForTwt(conf.BaseURL, twt.Hash()))
+			n.Hash = twt.Hash()
+			Notify(db, bus, n)
+			notified[user.Username] = true
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestNotify(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-notifications")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.SetUser("alice", NewUser()))
+
+	bus := newTestEventBus()
+	ch := bus.Subscribe("alice")
+
+	// Notifications for unknown users are dropped
+	Notify(db, bus, NewNotification(NotificationFollow, "eve", "bob", "", "eve"))
+	assert.Equal(t, int64(0), db.LenNotifications())
+
+	// Load the unread count before notifying to check it's kept up to date
+	assert.Equal(t, 0, db.CountUnreadNotifications("alice"))
+
+	n := NewNotification(NotificationFollow, "alice", "bob", "", "alice")
+	Notify(db, bus, n)
+	event := <-ch
+	assert.Equal(t, NotificationsEvent, event.Type)
+	assert.Equal(t, 1, event.Count)
+	assert.Equal(t, n.ID, event.Notification.ID)
+	assert.Equal(t, 1, db.CountUnreadNotifications("alice"))
+
+	// Only the newest maxNotifications are kept
+	now := time.Now()
+	for i := 0; i < maxNotifications+5; i++ {
+		n := NewNotification(NotificationMessage, "alice", fmt.Sprintf("user%d", i), "", "")
+		n.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		Notify(db, nil, n)
+	}
+
+	ns, err := GetNotifications(db, "alice")
+	require.NoError(t, err)
+	require.Len(t, ns, maxNotifications)
+	assert.Equal(t, fmt.Sprintf("user%d", maxNotifications+4), ns[0].From)
+	assert.Equal(t, "user5", ns[maxNotifications-1].From)
+	assert.Equal(t, maxNotifications, db.CountUnreadNotifications("alice"))
+
+	require.NoError(t, MarkNotificationsRead(db, "alice", ns[0].ID))
+	assert.Equal(t, maxNotifications-1, db.CountUnreadNotifications("alice"))
+
+	// Marking a notification read twice doesn't count it twice
+	require.NoError(t, MarkNotificationsRead(db, "alice", ns[0].ID))
+	assert.Equal(t, maxNotifications-1, db.CountUnreadNotifications("alice"))
+
+	require.NoError(t, db.DelNotification("alice", ns[1].ID))
+	assert.Equal(t, maxNotifications-2, db.CountUnreadNotifications("alice"))
+
+	require.NoError(t, MarkNotificationsRead(db, "alice", ""))
+	assert.Equal(t, 0, db.CountUnreadNotifications("alice"))
+}
+
+func TestNotifyTwts(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-notifications")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	alice := types.Twter{Nick: "alice", URL: URLForUser(conf, "alice")}
+	bob := types.Twter{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = alice.URL
+	require.NoError(t, db.SetUser("alice", user))
+
+	now := time.Now()
+	parent := retwt.NewReTwt(alice, "Hello world", now.Add(-time.Hour))
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.Twts[alice.URL] = &Cached{cache: make(map[string]types.Twt), Twts: types.Twts{parent}}
+
+	mention := retwt.NewReTwt(bob, "Hi @<alice "+alice.URL+">", now)
+	reply := retwt.NewReTwt(bob, fmt.Sprintf("(#%s) @<alice %s> Hi back", parent.Hash(), alice.URL), now)
+	own := retwt.NewReTwt(alice, "Note to self @<alice "+alice.URL+">", now)
+
+	NotifyTwts(conf, db, cache, nil, types.Twts{mention, reply, own})
+
+	ns, err := GetNotifications(db, "alice")
+	require.NoError(t, err)
+	require.Len(t, ns, 2)
+
+	kinds := make(map[string]string)
+	for _, n := range ns {
+		assert.Equal(t, "bob", n.From)
+		kinds[n.Hash] = n.Type
+	}
+
+	// A reply that also mentions the user only notifies them once
+	assert.Equal(t, map[string]string{
+		mention.Hash(): NotificationMention,
+		reply.Hash():   NotificationReply,
+	}, kinds)
+}
@@ -0,0 +1,428 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ScopeRead allows reading timelines, profiles, notifications and
+	// settings
+	ScopeRead = "read"
+
+	// ScopeWrite allows posting, following, muting, bookmarking and other
+	// everyday actions
+	ScopeWrite = "write"
+
+	// ScopeAccount allows changing the user's settings and exporting their
+	// data
+	ScopeAccount = "account"
+
+	oauthTokenCode    = "code"
+	oauthTokenAccess  = "access"
+	oauthTokenRefresh = "refresh"
+
+	// oauthCodeExpiry is how long an app has to exchange an authorization
+	// code for tokens
+	oauthCodeExpiry = 10 * time.Minute
+
+	// oauthAccessTokenExpiry is how long an access token is valid for before
+	// the app must use its refresh token
+	oauthAccessTokenExpiry = time.Hour
+
+	// maxOAuthRedirectURIs is the number of redirect uris an app may have
+	maxOAuthRedirectURIs = 5
+)
+
+var (
+	ErrOAuthAppNotFound     = errors.New("error: app not found")
+	ErrInvalidOAuthAppName  = errors.New("error: invalid app name")
+	ErrInvalidRedirectURI   = errors.New("error: invalid redirect uri")
+	ErrTooManyRedirectURIs  = errors.New("error: too many redirect uris")
+	ErrInvalidScope         = errors.New("error: invalid scope")
+	ErrInvalidCodeChallenge = errors.New("error: invalid or missing PKCE code challenge")
+
+	// OAuthScopes are all of the scopes an app may request, tokens issued
+	// by /api/v1/auth have all of them
+	OAuthScopes = []string{ScopeRead, ScopeWrite, ScopeAccount}
+)
+
+// OAuthApp is a third-party app registered by a user that other users may
+// authorize to access their account with the OAuth2 authorization code flow
+type OAuthApp struct {
+	ClientID     string
+	Secret       string // Hash of the client secret, empty for public clients
+	Name         string
+	Owner        string
+	RedirectURIs []string `default:"[]"`
+	CreatedAt    time.Time
+}
+
+// AuthorizedApp is an app a user has granted access to their account
+type AuthorizedApp struct {
+	App       *OAuthApp
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// OAuthRequest is an app's request for authorization shown to the user on
+// the consent screen
+type OAuthRequest struct {
+	App           *OAuthApp
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+func LoadOAuthApp(data []byte) (app *OAuthApp, err error) {
+	app = &OAuthApp{}
+	if err := defaults.Set(app); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &app); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (app *OAuthApp) Bytes() ([]byte, error) {
+	data, err := json.Marshal(app)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func hashOAuthSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// validRedirectURI returns true if uri is an absolute url an authorization
+// code may be sent to. Plain http is only allowed for apps running on the
+// user's own machine, native apps may use their own schemes.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	case "javascript", "data", "vbscript", "file":
+		return false
+	default:
+		return true
+	}
+}
+
+// NewOAuthApp registers a new app owned by owner with one redirect uri per
+// line. Confidential apps are given a client secret which is returned only
+// once, public apps (e.g: mobile and single page apps) rely on PKCE alone.
+func NewOAuthApp(owner, name, redirectURIs string, confidential bool) (*OAuthApp, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, "", ErrInvalidOAuthAppName
+	}
+
+	var uris []string
+	for _, line := range strings.Split(redirectURIs, "\n") {
+		uri := strings.TrimSpace(line)
+		if uri == "" {
+			continue
+		}
+		if !validRedirectURI(uri) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+		if !HasString(uris, uri) {
+			uris = append(uris, uri)
+		}
+	}
+	if len(uris) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	if len(uris) > maxOAuthRedirectURIs {
+		return nil, "", ErrTooManyRedirectURIs
+	}
+
+	app := &OAuthApp{
+		ClientID:     GenerateRandomToken(),
+		Name:         name,
+		Owner:        owner,
+		RedirectURIs: uris,
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if confidential {
+		secret = GenerateRandomToken() + GenerateRandomToken()
+		app.Secret = hashOAuthSecret(secret)
+	}
+
+	return app, secret, nil
+}
+
+// Confidential returns true if the app authenticates with a client secret
+func (app *OAuthApp) Confidential() bool {
+	return app.Secret != ""
+}
+
+// CheckSecret returns true if secret is the app's client secret, public
+// apps have no secret to check
+func (app *OAuthApp) CheckSecret(secret string) bool {
+	if !app.Confidential() {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(app.Secret), []byte(hashOAuthSecret(secret))) == 1
+}
+
+// HasRedirectURI returns true if uri exactly matches one of the app's
+// registered redirect uris
+func (app *OAuthApp) HasRedirectURI(uri string) bool {
+	return HasString(app.RedirectURIs, uri)
+}
+
+// GetUserOAuthApps returns the apps registered by username
+func GetUserOAuthApps(db Store, username string) ([]*OAuthApp, error) {
+	apps, err := db.GetAllOAuthApps()
+	if err != nil {
+		return nil, err
+	}
+
+	var userApps []*OAuthApp
+	for _, app := range apps {
+		if app.Owner == username {
+			userApps = append(userApps, app)
+		}
+	}
+	return userApps, nil
+}
+
+// ParseScopes parses a space separated list of scopes defaulting to read
+// only access when none are requested
+func ParseScopes(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !HasString(OAuthScopes, s) {
+			return nil, ErrInvalidScope
+		}
+		if !HasString(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{ScopeRead}
+	}
+	return scopes, nil
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against the S256 code
+// challenge the app sent when requesting authorization
+func VerifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func signOAuthClaims(conf *Config, claims jwt.MapClaims) (value, signature string, err error) {
+	value, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(conf.APISigningKey))
+	if err != nil {
+		return "", "", err
+	}
+	return value, value[strings.LastIndex(value, ".")+1:], nil
+}
+
+// ParseOAuthToken parses and validates an authorization code, access token
+// or refresh token of the given type
+func ParseOAuthToken(conf *Config, value, typ string) (*jwt.Token, jwt.MapClaims, error) {
+	token, err := jwt.Parse(value, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(conf.APISigningKey), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, nil, ErrInvalidToken
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if t, _ := claims["typ"].(string); t != typ {
+		return nil, nil, ErrInvalidToken
+	}
+	if username, _ := claims["username"].(string); username == "" {
+		return nil, nil, ErrInvalidToken
+	}
+
+	return token, claims, nil
+}
+
+// NewOAuthCode creates the short lived authorization code an app exchanges
+// for tokens once the user has approved its request
+func NewOAuthCode(conf *Config, user *User, req *OAuthRequest) (string, error) {
+	code, _, err := signOAuthClaims(conf, jwt.MapClaims{
+		"typ":            oauthTokenCode,
+		"jti":            GenerateRandomToken(),
+		"username":       user.Username,
+		"client_id":      req.App.ClientID,
+		"redirect_uri":   req.RedirectURI,
+		"scope":          strings.Join(req.Scopes, " "),
+		"code_challenge": req.CodeChallenge,
+		"exp":            time.Now().Add(oauthCodeExpiry).Unix(),
+	})
+	return code, err
+}
+
+// IssueOAuthTokens creates an access token and refresh token for the app
+// to access the user's account. Both are stored as the user's tokens so
+// they can be listed and revoked like any other token.
+func IssueOAuthTokens(conf *Config, db Store, user *User, app *OAuthApp, grantID string, scopes []string, userAgent string) (access, refresh *Token, err error) {
+	now := time.Now()
+	scope := strings.Join(scopes, " ")
+
+	newToken := func(typ string, expiresAt time.Time) (*Token, error) {
+		claims := jwt.MapClaims{
+			"typ":       typ,
+			"jti":       GenerateRandomToken(),
+			"username":  user.Username,
+			"client_id": app.ClientID,
+			"scope":     scope,
+		}
+		if !expiresAt.IsZero() {
+			claims["exp"] = expiresAt.Unix()
+		}
+
+		value, signature, err := signOAuthClaims(conf, claims)
+		if err != nil {
+			return nil, err
+		}
+
+		token := &Token{
+			Signature: signature,
+			Value:     value,
+			UserAgent: userAgent,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+			ClientID:  app.ClientID,
+			GrantID:   grantID,
+			Scopes:    scopes,
+			Refresh:   typ == oauthTokenRefresh,
+		}
+		if err := db.SetToken(token.Signature, token); err != nil {
+			return nil, err
+		}
+		user.AddToken(token)
+
+		return token, nil
+	}
+
+	if access, err = newToken(oauthTokenAccess, now.Add(oauthAccessTokenExpiry)); err != nil {
+		return nil, nil, err
+	}
+	if refresh, err = newToken(oauthTokenRefresh, time.Time{}); err != nil {
+		return nil, nil, err
+	}
+
+	if err := db.SetUser(user.Username, user); err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
+
+// RevokeTokens deletes the user's tokens that match and forgets any of
+// their tokens that no longer exist
+func RevokeTokens(db Store, user *User, match func(token *Token) bool) error {
+	var signatures []string
+	for _, signature := range user.Tokens {
+		token, err := db.GetToken(signature)
+		if err == ErrTokenNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if match(token) {
+			if err := db.DelToken(signature); err != nil {
+				return err
+			}
+			continue
+		}
+
+		signatures = append(signatures, signature)
+	}
+
+	user.Tokens = signatures
+
+	return db.SetUser(user.Username, user)
+}
+
+// GetAuthorizedApps returns the apps the user has granted access to their
+// account
+func GetAuthorizedApps(db Store, user *User) ([]*AuthorizedApp, error) {
+	tokens, err := db.GetUserTokens(user)
+	if err != nil {
+		return nil, err
+	}
+
+	authorized := make(map[string]*AuthorizedApp)
+	for _, token := range tokens {
+		if token.ClientID == "" {
+			continue
+		}
+
+		if a, ok := authorized[token.ClientID]; ok {
+			for _, scope := range token.Scopes {
+				if !HasString(a.Scopes, scope) {
+					a.Scopes = append(a.Scopes, scope)
+				}
+			}
+			if token.CreatedAt.Before(a.CreatedAt) {
+				a.CreatedAt = token.CreatedAt
+			}
+			continue
+		}
+
+		app, err := db.GetOAuthApp(token.ClientID)
+		if err != nil {
+			log.WithError(err).Warnf("error loading app %s", token.ClientID)
+			continue
+		}
+
+		authorized[token.ClientID] = &AuthorizedApp{
+			App:       app,
+			Scopes:    append([]string{}, token.Scopes...),
+			CreatedAt: token.CreatedAt,
+		}
+	}
+
+	var apps []*AuthorizedApp
+	for _, a := range authorized {
+		apps = append(apps, a)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].CreatedAt.Before(apps[j].CreatedAt) })
+
+	return apps, nil
+}
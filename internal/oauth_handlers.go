@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+// oauthRedirect sends the user back to the app with the result of its
+// authorization request
+func oauthRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// OAuthAuthorizeHandler shows the consent screen for an app's OAuth2
+// authorization code request (with PKCE) and redirects back to the app with
+// an authorization code once the user approves it
+func (s *Server) OAuthAuthorizeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		// Come back to the request once the user has logged in
+		if !ctx.Authenticated {
+			if sess := r.Context().Value(session.SessionKey); sess != nil && r.Method == "GET" {
+				_ = sess.(*session.Session).Set("login_redirect", r.URL.RequestURI())
+			}
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		app, err := s.db.GetOAuthApp(r.FormValue("client_id"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "Unknown app! Please check with the app's developer."
+			s.render("error", w, ctx)
+			return
+		}
+
+		redirectURI := r.FormValue("redirect_uri")
+		if redirectURI == "" && len(app.RedirectURIs) == 1 {
+			redirectURI = app.RedirectURIs[0]
+		}
+
+		// Never redirect to a uri the app didn't register
+		if !app.HasRedirectURI(redirectURI) {
+			ctx.Error = true
+			ctx.Message = "Invalid redirect uri! Please check with the app's developer."
+			s.render("error", w, ctx)
+			return
+		}
+
+		state := r.FormValue("state")
+		fail := func(code, description string) {
+			params := url.Values{"error": {code}, "error_description": {description}}
+			if state != "" {
+				params.Set("state", state)
+			}
+			oauthRedirect(w, r, redirectURI, params)
+		}
+
+		if r.FormValue("response_type") != "code" {
+			fail("unsupported_response_type", "only the authorization code flow is supported")
+			return
+		}
+
+		challenge := r.FormValue("code_challenge")
+		if challenge == "" || r.FormValue("code_challenge_method") != "S256" {
+			fail("invalid_request", ErrInvalidCodeChallenge.Error())
+			return
+		}
+
+		scopes, err := ParseScopes(r.FormValue("scope"))
+		if err != nil {
+			fail("invalid_scope", err.Error())
+			return
+		}
+
+		req := &OAuthRequest{
+			App:           app,
+			RedirectURI:   redirectURI,
+			Scopes:        scopes,
+			State:         state,
+			CodeChallenge: challenge,
+		}
+
+		if r.Method == "GET" {
+			ctx.Title = fmt.Sprintf("Authorize %s", app.Name)
+			ctx.OAuthRequest = req
+			s.render("authorize", w, ctx)
+			return
+		}
+
+		if r.FormValue("action") != "approve" {
+			fail("access_denied", "the user denied the request")
+			return
+		}
+
+		code, err := NewOAuthCode(s.config, ctx.User, req)
+		if err != nil {
+			log.WithError(err).Errorf("error creating authorization code for %s", ctx.Username)
+			fail("server_error", "error creating authorization code")
+			return
+		}
+
+		log.Infof("%s authorized %s (%s)", ctx.Username, app.Name, app.ClientID)
+
+		params := url.Values{"code": {code}}
+		if state != "" {
+			params.Set("state", state)
+		}
+		oauthRedirect(w, r, redirectURI, params)
+	}
+}
+
+// AddOAuthAppHandler registers a new third-party app
+func (s *Server) AddOAuthAppHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		app, secret, err := NewOAuthApp(
+			ctx.Username,
+			r.FormValue("name"),
+			r.FormValue("redirect_uris"),
+			r.FormValue("confidential") == "on",
+		)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error registering app: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetOAuthApp(app.ClientID, app); err != nil {
+			log.WithError(err).Errorf("error storing app for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = "Error registering app"
+			s.render("error", w, ctx)
+			return
+		}
+
+		// The client secret is only ever shown once
+		if secret != "" {
+			ctx.Error = false
+			ctx.Message = fmt.Sprintf(
+				"Registered %s with client id %s and client secret %s. Keep the secret safe, it won't be shown again!",
+				app.Name, app.ClientID, secret,
+			)
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// DeleteOAuthAppHandler deletes one of the user's apps, every token issued
+// to it stops working
+func (s *Server) DeleteOAuthAppHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		app, err := s.db.GetOAuthApp(p.ByName("id"))
+		if err != nil || app.Owner != ctx.Username {
+			ctx.Error = true
+			ctx.Message = "App not found"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.DelOAuthApp(app.ClientID); err != nil {
+			log.WithError(err).Errorf("error deleting app %s", app.ClientID)
+			ctx.Error = true
+			ctx.Message = "Error deleting app"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// RevokeOAuthAppHandler revokes an app's access to the user's account
+func (s *Server) RevokeOAuthAppHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		clientID := p.ByName("id")
+
+		if err := RevokeTokens(s.db, ctx.User, func(t *Token) bool { return t.ClientID == clientID }); err != nil {
+			log.WithError(err).Errorf("error revoking tokens of %s for %s", clientID, ctx.Username)
+			ctx.Error = true
+			ctx.Message = "Error revoking access"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOAuthApp(t *testing.T) {
+	app, secret, err := NewOAuthApp("alice", "My App", "https://app.example.com/cb\n\nhttp://localhost:8080/cb\n", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://app.example.com/cb", "http://localhost:8080/cb"}, app.RedirectURIs)
+	assert.True(t, app.Confidential())
+	assert.True(t, app.CheckSecret(secret))
+	assert.False(t, app.CheckSecret("nope"))
+	assert.True(t, app.HasRedirectURI("https://app.example.com/cb"))
+	assert.False(t, app.HasRedirectURI("https://app.example.com/cb/"))
+
+	app, secret, err = NewOAuthApp("alice", "Mobile", "com.example.app:/cb", false)
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+	assert.False(t, app.Confidential())
+
+	for _, uri := range []string{"http://example.com/cb", "javascript:alert(1)", "/cb", "https://example.com/cb#x"} {
+		_, _, err = NewOAuthApp("alice", "Bad", uri, false)
+		assert.Equal(t, ErrInvalidRedirectURI, err, uri)
+	}
+
+	_, _, err = NewOAuthApp("alice", " ", "https://app.example.com/cb", false)
+	assert.Equal(t, ErrInvalidOAuthAppName, err)
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead}, scopes)
+
+	scopes, err = ParseScopes("read write write")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead, ScopeWrite}, scopes)
+
+	_, err = ParseScopes("read admin")
+	assert.Equal(t, ErrInvalidScope, err)
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier := strings.Repeat("a1B2-", 10)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	assert.True(t, VerifyCodeChallenge(challenge, verifier))
+	assert.False(t, VerifyCodeChallenge(challenge, verifier+"x"))
+	assert.False(t, VerifyCodeChallenge(challenge, ""))
+}
+
+func TestOAuthCode(t *testing.T) {
+	conf := &Config{APISigningKey: "secret"}
+	app, _, err := NewOAuthApp("alice", "My App", "https://app.example.com/cb", false)
+	require.NoError(t, err)
+
+	code, err := NewOAuthCode(conf, &User{Username: "bob"}, &OAuthRequest{
+		App:           app,
+		RedirectURI:   "https://app.example.com/cb",
+		Scopes:        []string{ScopeRead, ScopeWrite},
+		CodeChallenge: "challenge",
+	})
+	require.NoError(t, err)
+
+	_, claims, err := ParseOAuthToken(conf, code, oauthTokenCode)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", claims["username"])
+	assert.Equal(t, app.ClientID, claims["client_id"])
+	assert.Equal(t, "read write", claims["scope"])
+
+	// Codes can't be used as access or refresh tokens
+	_, _, err = ParseOAuthToken(conf, code, oauthTokenAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, _, err = ParseOAuthToken(&Config{APISigningKey: "other"}, code, oauthTokenCode)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestUseOAuthCode(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-oauth")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+
+	used, err := db.UseOAuthCode("abc", time.Now().Add(oauthCodeExpiry))
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = db.UseOAuthCode("abc", time.Now().Add(oauthCodeExpiry))
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	_, err = db.UseOAuthCode("old", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	// Used codes are remembered until they expire, even across restarts
+	require.NoError(t, db.Close())
+	db, err = NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.DelExpiredOAuthCodes())
+
+	used, err = db.UseOAuthCode("abc", time.Now().Add(oauthCodeExpiry))
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = db.UseOAuthCode("old", time.Now().Add(oauthCodeExpiry))
+	require.NoError(t, err)
+	assert.False(t, used)
+}
@@ -56,6 +56,10 @@ const (
 	// DefaultMaxTwtLength is the default maximum length of posts permitted
 	DefaultMaxTwtLength = 288
 
+	// DefaultMaxUserFeeds is the default maximum number of feeds a user may
+	// create, pod owners can override this per user
+	DefaultMaxUserFeeds = 5 // 5 is < 7 and humans can only really handle ~7 things
+
 	// DefaultMaxCacheTTL is the default maximum cache ttl of twts in memory
 	DefaultMaxCacheTTL = time.Hour * 24 * 10 // 10 days 28 days 28 days 28 days
 
@@ -72,6 +76,10 @@ const (
 	// DefaultMaxUploadSize is the default maximum upload size permitted
 	DefaultMaxUploadSize = 1 << 24 // ~16MB (enough for high-res photos)
 
+	// DefaultMaxImportSize is the default maximum size of a Twitter or
+	// Mastodon archive that may be uploaded to import a user's history
+	DefaultMaxImportSize = 1 << 28 // ~256MB
+
 	// DefaultSessionCacheTTL is the server's default session cache ttl
 	DefaultSessionCacheTTL = 1 * time.Hour
 
@@ -88,6 +96,10 @@ const (
 	DefaultSMTPBind = "0.0.0.0:8025"
 	DefaultPOP3Bind = "0.0.0.0:8110"
 
+	// DefaultGeminiBind is the default Gemini interface and port to bind to
+	// (empty disables the Gemini service)
+	DefaultGeminiBind = ""
+
 	// Default SMTP configuration
 	DefaultSMTPHost = "smtp.gmail.com"
 	DefaultSMTPPort = 587
@@ -149,6 +161,8 @@ func NewConfig() *Config {
 		TwtPrompts:        DefaultTwtPrompts,
 		TwtsPerPage:       DefaultTwtsPerPage,
 		MaxTwtLength:      DefaultMaxTwtLength,
+		MaxUserFeeds:      DefaultMaxUserFeeds,
+		MaxImportSize:     DefaultMaxImportSize,
 		MsgsPerPage:       DefaultMsgsPerPage,
 		OpenProfiles:      DefaultOpenProfiles,
 		OpenRegistrations: DefaultOpenRegistrations,
@@ -281,6 +295,14 @@ func WithTwtsPerPage(twtsPerPage int) Option {
 	}
 }
 
+// WithMaxUserFeeds sets the maximum number of feeds a user may create
+func WithMaxUserFeeds(maxUserFeeds int) Option {
+	return func(cfg *Config) error {
+		cfg.MaxUserFeeds = maxUserFeeds
+		return nil
+	}
+}
+
 // WithMaxTwtLength sets the maximum length of posts permitted on the server
 func WithMaxTwtLength(maxTwtLength int) Option {
 	return func(cfg *Config) error {
@@ -369,6 +391,23 @@ func WithPOP3Bind(pop3Bind string) Option {
 	}
 }
 
+// WithGeminiBind sets the interface and port to use for Gemini
+func WithGeminiBind(geminiBind string) Option {
+	return func(cfg *Config) error {
+		cfg.GeminiBind = geminiBind
+		return nil
+	}
+}
+
+// WithGeminiCert sets the TLS certificate and key files to use for Gemini
+func WithGeminiCert(certFile, keyFile string) Option {
+	return func(cfg *Config) error {
+		cfg.GeminiCertFile = certFile
+		cfg.GeminiKeyFile = keyFile
+		return nil
+	}
+}
+
 // WithSMTPHost sets the SMTPHost to use for sending email
 func WithSMTPHost(host string) Option {
 	return func(cfg *Config) error {
@@ -409,6 +448,14 @@ func WithSMTPFrom(from string) Option {
 	}
 }
 
+// WithMaxImportSize sets the maximum size of archives imported by users
+func WithMaxImportSize(maxImportSize int64) Option {
+	return func(cfg *Config) error {
+		cfg.MaxImportSize = maxImportSize
+		return nil
+	}
+}
+
 // WithMaxFetchLimit sets the maximum feed fetch limit in bytes
 func WithMaxFetchLimit(limit int64) Option {
 	return func(cfg *Config) error {
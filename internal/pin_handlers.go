@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// GetPinnedTwts returns the twts identified by the pinned hashes in the
+// order they were pinned. Pins whose twts can no longer be found are
+// skipped.
+func GetPinnedTwts(cache *Cache, archive Archiver, pinned []string) (twts types.Twts) {
+	for _, hash := range pinned {
+		twt, err := GetTwtByHash(cache, archive, hash)
+		if err != nil {
+			log.WithError(err).Warnf("error loading pinned twt %s", hash)
+			continue
+		}
+		if twt.IsZero() {
+			continue
+		}
+		twts = append(twts, twt)
+	}
+	return
+}
+
+// IsPinnedFactory returns a template func that reports whether a local twt
+// is pinned to the profile of the user or feed that posted it
+func IsPinnedFactory(conf *Config, db Store) func(twt types.Twt) bool {
+	isLocalURL := IsLocalURLFactory(conf)
+	return func(twt types.Twt) bool {
+		if !isLocalURL(twt.Twter().URL) {
+			return false
+		}
+
+		name := filepath.Base(UserURL(twt.Twter().URL))
+		if user, err := db.GetUser(name); err == nil {
+			return HasString(user.Pinned, twt.Hash())
+		}
+		if feed, err := db.GetFeed(name); err == nil {
+			return HasString(feed.Pinned, twt.Hash())
+		}
+
+		return false
+	}
+}
+
+// PinTwt pins the twt identified by hash to the profile of the user or the
+// user's feed that posted it. Pinned twts are archived so they survive cache
+// eviction.
+func PinTwt(cache *Cache, archive Archiver, db Store, user *User, hash string) error {
+	twt, err := GetTwtByHash(cache, archive, hash)
+	if err != nil {
+		return err
+	}
+	if twt.IsZero() {
+		return ErrTwtNotFound
+	}
+
+	if user.Is(twt.Twter().URL) {
+		if err := user.Pin(twt.Hash()); err != nil {
+			return err
+		}
+		if err := EnsureArchived(archive, twt); err != nil {
+			return err
+		}
+		return db.SetUser(user.Username, user)
+	}
+
+	for _, name := range user.Feeds {
+		feed, err := db.GetFeed(name)
+		if err != nil {
+			log.WithError(err).Warnf("error loading feed object for %s", name)
+			continue
+		}
+		if NormalizeURL(feed.URL) != NormalizeURL(twt.Twter().URL) {
+			continue
+		}
+
+		if err := feed.Pin(twt.Hash()); err != nil {
+			return err
+		}
+		if err := EnsureArchived(archive, twt); err != nil {
+			return err
+		}
+		return db.SetFeed(feed.Name, feed)
+	}
+
+	return ErrFeedImposter
+}
+
+// UnpinTwt removes the twt identified by hash from the pinned twts of the
+// user and any of the user's feeds. This works even if the twt itself can no
+// longer be found.
+func UnpinTwt(db Store, user *User, hash string) error {
+	user.Unpin(hash)
+	if err := db.SetUser(user.Username, user); err != nil {
+		return err
+	}
+
+	for _, name := range user.Feeds {
+		feed, err := db.GetFeed(name)
+		if err != nil {
+			log.WithError(err).Warnf("error loading feed object for %s", name)
+			continue
+		}
+		if !HasString(feed.Pinned, hash) {
+			continue
+		}
+		feed.Unpin(hash)
+		if err := db.SetFeed(feed.Name, feed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PinHandler ...
+func (s *Server) PinHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		hash := strings.TrimSpace(r.FormValue("hash"))
+		if hash == "" {
+			ctx.Error = true
+			ctx.Message = "No twt specified to pin"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := PinTwt(s.cache, s.archive, s.db, ctx.User, hash); err != nil {
+			log.WithError(err).Errorf("error pinning twt %s", hash)
+			ctx.Error = true
+			switch err {
+			case ErrTooManyPins:
+				ctx.Message = fmt.Sprintf("You can only pin up to %d twts", maxPinnedTwts)
+			case ErrFeedImposter:
+				ctx.Message = "You can only pin your own twts or those of feeds you own"
+			default:
+				ctx.Message = fmt.Sprintf("Error pinning twt %s", hash)
+			}
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully pinned twt %s", hash)
+		s.render("error", w, ctx)
+	}
+}
+
+// UnpinHandler ...
+func (s *Server) UnpinHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		hash := strings.TrimSpace(r.FormValue("hash"))
+		if hash == "" {
+			ctx.Error = true
+			ctx.Message = "No twt specified to unpin"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := UnpinTwt(s.db, ctx.User, hash); err != nil {
+			log.WithError(err).Errorf("error unpinning twt %s", hash)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error unpinning twt %s", hash)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully unpinned twt %s", hash)
+		s.render("error", w, ctx)
+	}
+}
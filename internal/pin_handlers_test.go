@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestIsPinned(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-pins")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	now := time.Now()
+	alice := types.Twter{Nick: "alice", URL: URLForUser(conf, "alice")}
+	news := types.Twter{Nick: "news", URL: URLForUser(conf, "news")}
+	remote := types.Twter{Nick: "alice", URL: "https://other.example.com/user/alice/twtxt.txt"}
+
+	pinned := retwt.NewReTwt(alice, "pinned", now)
+	unpinned := retwt.NewReTwt(alice, "unpinned", now.Add(-time.Hour))
+	feedPinned := retwt.NewReTwt(news, "news", now)
+
+	user := NewUser()
+	user.Username = "alice"
+	require.NoError(t, user.Pin(pinned.Hash()))
+	assert.False(t, user.PinnedAt.IsZero())
+	require.NoError(t, db.SetUser("alice", user))
+
+	feed := NewFeed()
+	feed.Name = "news"
+	require.NoError(t, feed.Pin(feedPinned.Hash()))
+	require.NoError(t, db.SetFeed("news", feed))
+
+	isPinned := IsPinnedFactory(conf, db)
+
+	// Pin state comes from the twt's owner, not the viewer
+	assert.True(t, isPinned(pinned))
+	assert.False(t, isPinned(unpinned))
+	assert.True(t, isPinned(feedPinned))
+	assert.False(t, isPinned(retwt.NewReTwt(remote, "pinned", now)))
+
+	// Unpinning a twt that isn't pinned doesn't touch the feed
+	pinnedAt := user.PinnedAt
+	user.Unpin(unpinned.Hash())
+	assert.Equal(t, pinnedAt, user.PinnedAt)
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// TimelineReadMarker is the name of the read marker for the timeline
+	TimelineReadMarker = "timeline"
+
+	// MentionsReadMarker is the name of the read marker for mentions
+	MentionsReadMarker = "mentions"
+
+	// unreadCountsTTL is how long a user's unread counts are reused for
+	// when nothing else invalidates them (e.g. following a new feed)
+	unreadCountsTTL = time.Minute
+)
+
+var (
+	ErrInvalidReadMarker = errors.New("error: invalid read marker")
+)
+
+// ListReadMarker returns the name of the read marker for a list
+func ListReadMarker(name string) string {
+	return "list:" + name
+}
+
+// CountUnread returns the number of twts newer than the read marker. A user
+// that has never read a timeline has nothing unread.
+func CountUnread(twts types.Twts, marker ReadMarker) (unread int) {
+	if marker.Timestamp.IsZero() {
+		return 0
+	}
+
+	for _, twt := range twts {
+		if twt.Created().After(marker.Timestamp) {
+			unread++
+		}
+	}
+
+	return
+}
+
+// FindReadDivider returns the hash of the first twt the user had already
+// read when it's preceded by unread twts, otherwise an empty string. twts
+// must be sorted newest first.
+func FindReadDivider(twts types.Twts, marker ReadMarker) string {
+	if marker.Timestamp.IsZero() {
+		return ""
+	}
+
+	for i, twt := range twts {
+		if !twt.Created().After(marker.Timestamp) {
+			if i == 0 {
+				return ""
+			}
+			return twt.Hash()
+		}
+	}
+
+	return ""
+}
+
+// UpdateReadMarker advances the user's named read marker to the newest of
+// the twts (sorted newest first) and persists it if it moved.
+func UpdateReadMarker(db Store, user *User, name string, twts types.Twts) {
+	if len(twts) == 0 {
+		return
+	}
+
+	if !user.MarkRead(name, twts[0]) {
+		return
+	}
+
+	if err := db.SetUser(user.Username, user); err != nil {
+		log.WithError(err).Warnf("error updating %s read marker for %s", name, user.Username)
+	}
+}
+
+// IsValidReadMarker returns true if name is the read marker of one of the
+// user's timelines.
+func IsValidReadMarker(db Store, user *User, name string) bool {
+	switch {
+	case name == TimelineReadMarker, name == MentionsReadMarker:
+		return true
+	case strings.HasPrefix(name, ListReadMarker("")):
+		return db.HasList(user.Username, strings.TrimPrefix(name, ListReadMarker("")))
+	default:
+		return false
+	}
+}
+
+// GetReadMarkerTwts returns the twts (sorted newest first) of the timeline
+// a read marker tracks.
+func GetReadMarkerTwts(cache *Cache, db Store, user *User, name string) (types.Twts, error) {
+	switch {
+	case name == TimelineReadMarker:
+		return cache.GetTimeline(user), nil
+	case name == MentionsReadMarker:
+		twts := cache.GetMentions(user)
+		sort.Sort(twts)
+		return twts, nil
+	case strings.HasPrefix(name, ListReadMarker("")):
+		list, err := db.GetList(user.Username, strings.TrimPrefix(name, ListReadMarker("")))
+		if err != nil {
+			return nil, err
+		}
+		return GetListTwts(cache, list), nil
+	default:
+		return nil, ErrInvalidReadMarker
+	}
+}
+
+// unreadCount is a user's cached unread counts and the read markers they
+// were counted from
+type unreadCount struct {
+	timeline int
+	mentions int
+
+	timelineRead time.Time
+	mentionsRead time.Time
+	countedAt    time.Time
+}
+
+// UnreadCounts caches the number of unread twts in each user's timeline and
+// mentions so that rendering a page doesn't scan the cache. A user's counts
+// are recounted when the cache has new twts, their read markers move or
+// after unreadCountsTTL.
+type UnreadCounts struct {
+	mu     sync.Mutex
+	cache  *Cache
+	counts map[string]*unreadCount
+}
+
+// NewUnreadCounts ...
+func NewUnreadCounts(cache *Cache) *UnreadCounts {
+	uc := &UnreadCounts{
+		cache:  cache,
+		counts: make(map[string]*unreadCount),
+	}
+
+	cache.OnNewTwts(func(twts types.Twts) {
+		uc.Reset()
+	})
+
+	return uc
+}
+
+// Get returns the number of unread twts in the user's timeline and mentions
+func (uc *UnreadCounts) Get(user *User) (timeline, mentions int) {
+	timelineRead := user.GetReadMarker(TimelineReadMarker).Timestamp
+	mentionsRead := user.GetReadMarker(MentionsReadMarker).Timestamp
+
+	uc.mu.Lock()
+	count, ok := uc.counts[user.Username]
+	uc.mu.Unlock()
+
+	if ok && count.timelineRead.Equal(timelineRead) && count.mentionsRead.Equal(mentionsRead) &&
+		time.Since(count.countedAt) < unreadCountsTTL {
+		return count.timeline, count.mentions
+	}
+
+	count = &unreadCount{
+		timelineRead: timelineRead,
+		mentionsRead: mentionsRead,
+		countedAt:    time.Now(),
+	}
+
+	// Nothing can be unread in timelines the user has never read
+	if !timelineRead.IsZero() {
+		count.timeline = CountUnread(
+			FilterTwts(user, uc.cache.GetTimeline(user)),
+			user.GetReadMarker(TimelineReadMarker),
+		)
+	}
+	if !mentionsRead.IsZero() {
+		count.mentions = CountUnread(
+			FilterTwts(user, uc.cache.GetMentions(user)),
+			user.GetReadMarker(MentionsReadMarker),
+		)
+	}
+
+	uc.mu.Lock()
+	uc.counts[user.Username] = count
+	uc.mu.Unlock()
+
+	return count.timeline, count.mentions
+}
+
+// Reset forgets all cached counts
+func (uc *UnreadCounts) Reset() {
+	uc.mu.Lock()
+	uc.counts = make(map[string]*unreadCount)
+	uc.mu.Unlock()
+}
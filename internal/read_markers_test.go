@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestReadMarkers(t *testing.T) {
+	twter := types.Twter{Nick: "test", URL: "http://0.0.0.0:8000/user/test/twtxt.txt"}
+	now := time.Now()
+
+	twts := types.Twts{
+		retwt.NewReTwt(twter, "third", now),
+		retwt.NewReTwt(twter, "second", now.Add(-time.Hour)),
+		retwt.NewReTwt(twter, "first", now.Add(-2*time.Hour)),
+	}
+
+	user := NewUser()
+
+	// Never read means nothing unread
+	marker := user.GetReadMarker(TimelineReadMarker)
+	assert.Equal(t, 0, CountUnread(twts, marker))
+	assert.Equal(t, "", FindReadDivider(twts, marker))
+
+	assert.True(t, user.MarkRead(TimelineReadMarker, twts[1]))
+	marker = user.GetReadMarker(TimelineReadMarker)
+	assert.Equal(t, twts[1].Hash(), marker.Hash)
+	assert.Equal(t, 1, CountUnread(twts, marker))
+	assert.Equal(t, twts[1].Hash(), FindReadDivider(twts, marker))
+
+	// Markers never move backwards
+	assert.False(t, user.MarkRead(TimelineReadMarker, twts[2]))
+
+	assert.True(t, user.MarkRead(TimelineReadMarker, twts[0]))
+	marker = user.GetReadMarker(TimelineReadMarker)
+	assert.Equal(t, 0, CountUnread(twts, marker))
+	assert.Equal(t, "", FindReadDivider(twts, marker))
+}
+
+func TestUnreadCounts(t *testing.T) {
+	alice := types.Twter{Nick: "alice", URL: "http://0.0.0.0:8000/user/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "http://0.0.0.0:8000/user/bob/twtxt.txt"}
+	now := time.Now()
+
+	read := retwt.NewReTwt(bob, "read", now.Add(-2*time.Hour))
+	unread := retwt.NewReTwt(bob, "unread", now.Add(-time.Hour))
+	mention := retwt.NewReTwt(bob, "Hi @<alice "+alice.URL+">", now)
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.Twts[bob.URL] = &Cached{
+		cache: make(map[string]types.Twt),
+		Twts:  types.Twts{unread, read},
+	}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = alice.URL
+	user.Following = map[string]string{"bob": bob.URL}
+	data, err := user.Bytes()
+	require.NoError(t, err)
+	user, err = LoadUser(data)
+	require.NoError(t, err)
+
+	unreadCounts := NewUnreadCounts(cache)
+
+	// Never read means nothing unread
+	timeline, mentions := unreadCounts.Get(user)
+	assert.Equal(t, 0, timeline)
+	assert.Equal(t, 0, mentions)
+
+	user.MarkRead(TimelineReadMarker, read)
+	user.MarkRead(MentionsReadMarker, read)
+	timeline, mentions = unreadCounts.Get(user)
+	assert.Equal(t, 1, timeline)
+	assert.Equal(t, 0, mentions)
+
+	// Counts are reused until the cache has new twts
+	cache.Twts[bob.URL].Twts = types.Twts{mention, unread, read}
+	timeline, mentions = unreadCounts.Get(user)
+	assert.Equal(t, 1, timeline)
+	assert.Equal(t, 0, mentions)
+
+	unreadCounts.Reset()
+	timeline, mentions = unreadCounts.Get(user)
+	assert.Equal(t, 2, timeline)
+	assert.Equal(t, 1, mentions)
+
+	// Moving a read marker recounts
+	user.MarkRead(TimelineReadMarker, mention)
+	timeline, _ = unreadCounts.Get(user)
+	assert.Equal(t, 0, timeline)
+}
@@ -0,0 +1,456 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+const (
+	// maxAliasDepth is how many renames are followed when resolving an alias
+	maxAliasDepth = 10
+)
+
+var (
+	ErrUsernameTaken     = errors.New("error: username is already taken")
+	ErrUsernameUnchanged = errors.New("error: new username is the same as the old one")
+
+	aliasPathRe = regexp.MustCompile(`^/(user|blogs|blog)/([^/]+)(/.*)?$`)
+)
+
+// ResolveAlias returns the current username of a user who was previously
+// known as name, following any subsequent renames
+func ResolveAlias(db Store, name string) (string, bool) {
+	for i := 0; i < maxAliasDepth; i++ {
+		username, err := db.GetAlias(name)
+		if err != nil {
+			return "", false
+		}
+		if db.HasUser(username) {
+			return username, true
+		}
+		name = username
+	}
+	return "", false
+}
+
+// AliasRedirectHandler permanently redirects requests for the feeds,
+// profiles and blogs of renamed users to their new username. Requests for
+// an old twtxt.txt also get a `# url =` moved notice for clients that do
+// not follow redirects.
+func AliasRedirectHandler(conf *Config, db Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matches := aliasPathRe.FindStringSubmatch(r.URL.Path)
+		if matches == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		nick := NormalizeUsername(matches[2])
+		if db.HasUser(nick) || db.HasFeed(nick) || !db.HasAlias(nick) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, ok := ResolveAlias(db, nick)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u := *r.URL
+		u.Path = fmt.Sprintf("/%s/%s%s", matches[1], username, matches[3])
+
+		if matches[1] == "user" && matches[3] == "/twtxt.txt" {
+			notice := MovedNotice(nick, URLForUser(conf, username))
+			w.Header().Set("Location", u.String())
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(notice)))
+			w.WriteHeader(http.StatusMovedPermanently)
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(notice)
+			}
+			return
+		}
+
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
+
+// renameJournal records how to undo each step of a rename so that a
+// failed rename leaves everything as it was
+type renameJournal []func() error
+
+func (j *renameJournal) add(undo func() error) {
+	*j = append(*j, undo)
+}
+
+func (j renameJournal) rollback() {
+	for i := len(j) - 1; i >= 0; i-- {
+		if err := j[i](); err != nil {
+			log.WithError(err).Error("error rolling back rename")
+		}
+	}
+}
+
+// renamePath renames a file or directory if it exists
+func (j *renameJournal) renamePath(from, to string) error {
+	if !FileExists(from) {
+		return nil
+	}
+	if FileExists(to) {
+		return ErrUsernameTaken
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	j.add(func() error { return os.Rename(to, from) })
+	return nil
+}
+
+// writeFile replaces the contents of a file keeping the old contents to
+// restore on rollback
+func (j *renameJournal) writeFile(fn string, data []byte) error {
+	orig, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		return err
+	}
+	j.add(func() error { return ioutil.WriteFile(fn, orig, 0644) })
+	return nil
+}
+
+// feedURLHint prepends a `# url = ` comment with the feed's new url to the
+// feed replacing any previous one so followers pick up the new location
+func feedURLHint(data []byte, url string) []byte {
+	var lines []string
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "# url =") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return []byte(fmt.Sprintf("# url = %s\n%s", url, strings.Join(lines, "")))
+}
+
+// RenameUser renames the user oldname to newname. The user's store key,
+// feed, avatar, blog posts, messages and exports are moved together and
+// restored should any of these fail. An alias from the old username is
+// kept so that its urls permanently redirect to the new ones. References
+// by other users, lists, notifications, sessions and webhooks are then
+// updated on a best effort basis.
+func RenameUser(conf *Config, db Store, oldname, newname string) (*User, error) {
+	newname = NormalizeUsername(newname)
+
+	if err := ValidateUsername(newname); err != nil {
+		return nil, err
+	}
+	if newname == oldname {
+		return nil, ErrUsernameUnchanged
+	}
+	if db.HasUser(newname) || db.HasFeed(newname) {
+		return nil, ErrUsernameTaken
+	}
+
+	// Users may take back one of their own previous usernames
+	if db.HasAlias(newname) {
+		if username, ok := ResolveAlias(db, newname); !ok || username != oldname {
+			return nil, ErrUsernameTaken
+		}
+	}
+
+	user, err := db.GetUser(oldname)
+	if err != nil {
+		return nil, err
+	}
+
+	oldURL := user.URL
+	newURL := URLForUser(conf, newname)
+
+	var journal renameJournal
+
+	paths := [][2]string{
+		{filepath.Join(conf.Data, feedsDir, oldname), filepath.Join(conf.Data, feedsDir, newname)},
+		{filepath.Join(conf.Data, avatarsDir, oldname+".png"), filepath.Join(conf.Data, avatarsDir, newname+".png")},
+		{filepath.Join(conf.Data, avatarsDir, oldname+".webp"), filepath.Join(conf.Data, avatarsDir, newname+".webp")},
+		{filepath.Join(conf.Data, blogsDir, oldname), filepath.Join(conf.Data, blogsDir, newname)},
+		{filepath.Join(conf.Data, msgsDir, oldname), filepath.Join(conf.Data, msgsDir, newname)},
+		{filepath.Join(conf.Data, exportsDir, oldname), filepath.Join(conf.Data, exportsDir, newname)},
+		{filepath.Join(conf.Data, historyDir, oldname), filepath.Join(conf.Data, historyDir, newname)},
+	}
+
+	for _, path := range paths {
+		if err := journal.renamePath(path[0], path[1]); err != nil {
+			journal.rollback()
+			return nil, fmt.Errorf("error renaming %s: %w", filepath.Base(path[0]), err)
+		}
+	}
+
+	if fn := filepath.Join(conf.Data, feedsDir, newname); FileExists(fn) {
+		data, err := ioutil.ReadFile(fn)
+		if err == nil {
+			err = journal.writeFile(fn, feedURLHint(data, newURL))
+		}
+		if err != nil {
+			journal.rollback()
+			return nil, fmt.Errorf("error updating feed: %w", err)
+		}
+	}
+
+	if root := filepath.Join(conf.Data, blogsDir, newname); FileExists(root) {
+		err := filepath.Walk(root, func(fn string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(fn) != ".json" {
+				return nil
+			}
+
+			data, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return err
+			}
+
+			blogPost := &BlogPost{}
+			if err := json.Unmarshal(data, blogPost); err != nil {
+				return err
+			}
+			blogPost.Author = newname
+
+			data, err = json.Marshal(blogPost)
+			if err != nil {
+				return err
+			}
+
+			return journal.writeFile(fn, data)
+		})
+		if err != nil {
+			journal.rollback()
+			return nil, fmt.Errorf("error updating blog posts: %w", err)
+		}
+	}
+
+	orig, err := db.GetUser(oldname)
+	if err != nil {
+		journal.rollback()
+		return nil, err
+	}
+
+	user.Username = newname
+	user.URL = newURL
+	if _, ok := user.Following[oldname]; ok {
+		delete(user.Following, oldname)
+		user.Following[newname] = newURL
+	}
+
+	if err := db.SetUser(newname, user); err != nil {
+		journal.rollback()
+		return nil, fmt.Errorf("error saving user: %w", err)
+	}
+	journal.add(func() error { return db.DelUser(newname) })
+
+	if err := db.DelUser(oldname); err != nil {
+		journal.rollback()
+		return nil, fmt.Errorf("error removing old user: %w", err)
+	}
+	journal.add(func() error { return db.SetUser(oldname, orig) })
+
+	if db.HasAlias(newname) {
+		if err := db.DelAlias(newname); err != nil {
+			journal.rollback()
+			return nil, fmt.Errorf("error removing alias: %w", err)
+		}
+		journal.add(func() error { return db.SetAlias(newname, oldname) })
+	}
+
+	if err := db.SetAlias(oldname, newname); err != nil {
+		journal.rollback()
+		return nil, fmt.Errorf("error saving alias: %w", err)
+	}
+
+	log.Infof("renamed user %s to %s", oldname, newname)
+
+	updateRenamedReferences(db, oldname, newname, oldURL, newURL)
+
+	return user, nil
+}
+
+// RenameSessions updates the username of the logged in sessions of a
+// renamed user
+func RenameSessions(sessions []*session.Session, oldname, newname string) {
+	for _, sess := range sessions {
+		if username, ok := sess.Get("username"); ok && username == oldname {
+			if err := sess.Set("username", newname); err != nil {
+				log.WithError(err).Warnf("error updating session %s", sess.ID)
+			}
+		}
+	}
+}
+
+// updateRenamedReferences updates everything else in the store that refers
+// to a renamed user logging rather than failing on errors
+func updateRenamedReferences(db Store, oldname, newname, oldURL, newURL string) {
+	users, err := db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Warn("error loading users to rename references")
+	}
+	for _, u := range users {
+		if u.Username == newname {
+			continue
+		}
+
+		changed := false
+		for nick, url := range u.Following {
+			if url == oldURL {
+				delete(u.Following, nick)
+				if nick == oldname {
+					nick = newname
+				}
+				u.Following[nick] = newURL
+				changed = true
+			}
+		}
+		if _, ok := u.Followers[oldname]; ok {
+			delete(u.Followers, oldname)
+			u.Followers[newname] = newURL
+			changed = true
+		}
+
+		if changed {
+			if err := db.SetUser(u.Username, u); err != nil {
+				log.WithError(err).Warnf("error updating user %s", u.Username)
+			}
+		}
+	}
+
+	feeds, err := db.GetAllFeeds()
+	if err != nil {
+		log.WithError(err).Warn("error loading feeds to rename references")
+	}
+	for _, feed := range feeds {
+		changed := false
+		for nick, url := range feed.Following {
+			if url == oldURL {
+				delete(feed.Following, nick)
+				if nick == oldname {
+					nick = newname
+				}
+				feed.Following[nick] = newURL
+				changed = true
+			}
+		}
+		if _, ok := feed.Followers[oldname]; ok {
+			delete(feed.Followers, oldname)
+			feed.Followers[newname] = newURL
+			changed = true
+		}
+		if role, ok := feed.Owners[oldname]; ok {
+			delete(feed.Owners, oldname)
+			feed.Owners[newname] = role
+			changed = true
+		}
+		if role, ok := feed.Invites[oldname]; ok {
+			delete(feed.Invites, oldname)
+			feed.Invites[newname] = role
+			changed = true
+		}
+
+		if changed {
+			if err := db.SetFeed(feed.Name, feed); err != nil {
+				log.WithError(err).Warnf("error updating feed %s", feed.Name)
+			}
+		}
+	}
+
+	lists, err := db.GetUserLists(oldname)
+	if err != nil {
+		log.WithError(err).Warn("error loading lists to rename")
+	}
+	for _, list := range lists {
+		list.Owner = newname
+		if err := db.SetList(newname, list.Name, list); err != nil {
+			log.WithError(err).Warnf("error renaming list %s", list.Name)
+			continue
+		}
+		if err := db.DelList(oldname, list.Name); err != nil {
+			log.WithError(err).Warnf("error removing old list %s", list.Name)
+		}
+	}
+
+	notifications, err := db.GetUserNotifications(oldname)
+	if err != nil {
+		log.WithError(err).Warn("error loading notifications to rename")
+	}
+	for _, n := range notifications {
+		n.Username = newname
+		if err := db.SetNotification(newname, n.ID, n); err != nil {
+			log.WithError(err).Warnf("error renaming notification %s", n.ID)
+			continue
+		}
+		if err := db.DelNotification(oldname, n.ID); err != nil {
+			log.WithError(err).Warnf("error removing old notification %s", n.ID)
+		}
+	}
+
+	followers, err := db.GetActivityPubFollowers(oldname)
+	if err != nil {
+		log.WithError(err).Warn("error loading activitypub followers to rename")
+	}
+	for _, f := range followers {
+		f.Name = newname
+		if err := db.SetActivityPubFollower(newname, f.ID, f); err != nil {
+			log.WithError(err).Warnf("error renaming activitypub follower %s", f.ID)
+			continue
+		}
+		if err := db.DelActivityPubFollower(oldname, f.ID); err != nil {
+			log.WithError(err).Warnf("error removing old activitypub follower %s", f.ID)
+		}
+	}
+
+	sessions, err := db.GetAllSessions()
+	if err != nil {
+		log.WithError(err).Warn("error loading sessions to rename")
+	}
+	RenameSessions(sessions, oldname, newname)
+
+	webhooks, err := db.GetAllWebhooks()
+	if err != nil {
+		log.WithError(err).Warn("error loading webhooks to rename")
+	}
+	for _, hook := range webhooks {
+		if hook.Owner == oldname {
+			hook.Owner = newname
+			if err := db.SetWebhook(hook.ID, hook); err != nil {
+				log.WithError(err).Warnf("error updating webhook %s", hook.ID)
+			}
+		}
+	}
+
+	apps, err := db.GetAllOAuthApps()
+	if err != nil {
+		log.WithError(err).Warn("error loading apps to rename")
+	}
+	for _, app := range apps {
+		if app.Owner == oldname {
+			app.Owner = newname
+			if err := db.SetOAuthApp(app.ClientID, app); err != nil {
+				log.WithError(err).Warnf("error updating app %s", app.ClientID)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// RenameUserHandler renames the user keeping their old username as an alias
+// that permanently redirects to the new one
+func (s *Server) RenameUserHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		username := strings.TrimSpace(r.FormValue("username"))
+
+		user, err := RenameUser(s.config, s.db, ctx.Username, username)
+		if err != nil {
+			log.WithError(err).Errorf("error renaming user %s to %s", ctx.Username, username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error changing your username: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		// Logged in sessions are kept in memory as well as in the store
+		sessions, err := s.sc.GetAllSessions()
+		if err != nil {
+			log.WithError(err).Warn("error loading sessions to rename")
+		}
+		RenameSessions(sessions, ctx.Username, user.Username)
+
+		s.cache.GetByPrefix(s.config.BaseURL, true)
+		s.blogs.UpdateBlogs(s.config)
+
+		ctx.Username = user.Username
+		ctx.User = user
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Your username is now %s, your old feed and profile urls redirect here", user.Username)
+		s.render("error", w, ctx)
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameUser(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-rename")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, Name: "test", BaseURL: "https://pod.example.com"}
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = URLForUser(conf, "alice")
+	require.NoError(t, db.SetUser("alice", alice))
+
+	bob := NewUser()
+	bob.Username = "bob"
+	bob.URL = URLForUser(conf, "bob")
+	bob.Following = map[string]string{"alice": alice.URL}
+	require.NoError(t, db.SetUser("bob", bob))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(data, feedsDir, "alice"),
+		[]byte("2020-01-01T00:00:00Z\tHello\n"),
+		0644,
+	))
+
+	_, err = RenameUser(conf, db, "alice", "bob")
+	assert.Equal(t, ErrUsernameTaken, err)
+
+	user, err := RenameUser(conf, db, "alice", "alicia")
+	require.NoError(t, err)
+	assert.Equal(t, "alicia", user.Username)
+	assert.Equal(t, URLForUser(conf, "alicia"), user.URL)
+
+	assert.False(t, db.HasUser("alice"))
+	assert.True(t, db.HasUser("alicia"))
+	assert.False(t, FeedExists(conf, "alice"))
+
+	feed, err := ioutil.ReadFile(filepath.Join(data, feedsDir, "alicia"))
+	require.NoError(t, err)
+	assert.Equal(t, "# url = https://pod.example.com/user/alicia/twtxt.txt\n2020-01-01T00:00:00Z\tHello\n", string(feed))
+
+	username, ok := ResolveAlias(db, "alice")
+	assert.True(t, ok)
+	assert.Equal(t, "alicia", username)
+
+	bob, err = db.GetUser("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"alicia": user.URL}, bob.Following)
+
+	handler := AliasRedirectHandler(conf, db, http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/alice/twtxt.txt", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/user/alicia/twtxt.txt", w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "# url = https://pod.example.com/user/alicia/twtxt.txt")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/bob/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Users can take back their old username
+	_, err = RenameUser(conf, db, "alicia", "alice")
+	require.NoError(t, err)
+	assert.True(t, db.HasUser("alice"))
+	assert.False(t, db.HasAlias("alice"))
+	assert.True(t, db.HasAlias("alicia"))
+}
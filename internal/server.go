@@ -2,14 +2,12 @@ package internal
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
@@ -29,6 +27,7 @@ import (
 	"github.com/jointwt/twtxt/internal/passwords"
 	"github.com/jointwt/twtxt/internal/session"
 	"github.com/jointwt/twtxt/internal/webmention"
+	"github.com/jointwt/twtxt/types"
 )
 
 var (
@@ -57,6 +56,21 @@ type Server struct {
 	// Feed Cache
 	cache *Cache
 
+	// Unread Counts
+	unread *UnreadCounts
+
+	// Event Bus
+	events *EventBus
+
+	// Outgoing Webhooks
+	webhooks *Webhooks
+
+	// ActivityPub Bridge
+	activitypub *ActivityPub
+
+	// Hooks run for twts posted to local feeds
+	hooks *AppendTwtHooks
+
 	// Feed Archiver
 	archive Archiver
 
@@ -85,6 +99,9 @@ type Server struct {
 	// SMTP Service
 	smtpService *SMTPService
 
+	// Gemini Service
+	geminiService *GeminiService
+
 	// Passwords
 	pm passwords.Passwords
 }
@@ -92,6 +109,8 @@ type Server struct {
 func (s *Server) render(name string, w http.ResponseWriter, ctx *Context) {
 	if ctx.Authenticated && ctx.Username != "" {
 		ctx.NewMessages = s.msgs.Get(ctx.User.Username)
+		ctx.UnreadTimeline, ctx.UnreadMentions = s.unread.Get(ctx.User)
+		ctx.UnreadNotifications = s.db.CountUnreadNotifications(ctx.User.Username)
 	}
 
 	buf, err := s.tmplman.Exec(name, ctx)
@@ -121,6 +140,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.cron.Stop()
 	s.tasks.Stop()
 	s.smtpService.Stop()
+	s.geminiService.Stop()
 
 	if err := s.server.Shutdown(ctx); err != nil {
 		log.WithError(err).Error("error shutting down server")
@@ -196,6 +216,12 @@ func (s *Server) setupMetrics() {
 		},
 	)
 
+	// event subscribers
+	metrics.NewGauge(
+		"server", "subscribers",
+		"Number of active event stream subscribers",
+	)
+
 	// database keys
 	metrics.NewGaugeFunc(
 		"db", "feeds",
@@ -204,6 +230,48 @@ func (s *Server) setupMetrics() {
 			return float64(s.db.LenFeeds())
 		},
 	)
+	metrics.NewGaugeFunc(
+		"db", "lists",
+		"Number of database /lists keys",
+		func() float64 {
+			return float64(s.db.LenLists())
+		},
+	)
+	metrics.NewGaugeFunc(
+		"db", "notifications",
+		"Number of database /notifications keys",
+		func() float64 {
+			return float64(s.db.LenNotifications())
+		},
+	)
+	metrics.NewGaugeFunc(
+		"db", "webhooks",
+		"Number of database /webhooks keys",
+		func() float64 {
+			return float64(s.db.LenWebhooks())
+		},
+	)
+	metrics.NewGaugeFunc(
+		"db", "aliases",
+		"Number of database /aliases keys",
+		func() float64 {
+			return float64(s.db.LenAliases())
+		},
+	)
+	metrics.NewGaugeFunc(
+		"db", "webmentions",
+		"Number of database /webmentions keys",
+		func() float64 {
+			return float64(s.db.LenWebMentions())
+		},
+	)
+	metrics.NewGaugeFunc(
+		"db", "apfollowers",
+		"Number of database /apfollowers keys",
+		func() float64 {
+			return float64(s.db.LenActivityPubFollowers())
+		},
+	)
 	metrics.NewGaugeFunc(
 		"db", "sessions",
 		"Number of database /sessions keys",
@@ -225,6 +293,13 @@ func (s *Server) setupMetrics() {
 			return float64(s.db.LenTokens())
 		},
 	)
+	metrics.NewGaugeFunc(
+		"db", "oauthapps",
+		"Number of database /oauthapps keys",
+		func() float64 {
+			return float64(s.db.LenOAuthApps())
+		},
+	)
 
 	// feed cache sources
 	metrics.NewGauge(
@@ -310,109 +385,65 @@ func (s *Server) processWebMention(source, target *url.URL, sourceData *microfor
 		WithField("target", target).
 		Infof("received webmention from %s to %s", source.String(), target.String())
 
-	getEntry := func(data *microformats.Data) (*microformats.MicroFormat, error) {
-		if data != nil {
-			for _, item := range sourceData.Items {
-				if HasString(item.Type, "h-entry") {
-					return item, nil
-				}
-			}
-		}
-		return nil, errors.New("error: no entry found")
+	owner, hash, err := ResolveWebMentionTarget(s.config, s.cache, s.blogs, target)
+	if err != nil {
+		log.WithError(err).WithField("target", target.String()).Warn("unable to resolve webmention target")
+		return err
 	}
 
-	getAuthor := func(entry *microformats.MicroFormat) (*microformats.MicroFormat, error) {
-		if entry != nil {
-			authors := entry.Properties["author"]
-			if len(authors) > 0 {
-				if v, ok := authors[0].(*microformats.MicroFormat); ok {
-					return v, nil
-				}
-			}
-		}
-		return nil, errors.New("error: no author found")
+	var owners []string
+	if s.db.HasUser(owner) {
+		owners = []string{owner}
+	} else {
+		owners = GetFeedOwners(s.db, owner)
+	}
+	if len(owners) == 0 {
+		log.WithField("target", target.String()).Warnf("no owner found for webmention target %s", owner)
+		return ErrInvalidWebMentionTarget
 	}
 
-	parseSourceData := func(data *microformats.Data) (string, string, error) {
-		if data == nil {
-			log.Warn("no source data to parse")
-			return "", "", nil
-		}
-
-		entry, err := getEntry(data)
-		if err != nil {
-			log.WithError(err).Error("error getting entry")
-			return "", "", err
-		}
-
-		author, err := getAuthor(entry)
-		if err != nil {
-			log.WithError(err).Error("error getting author")
-			return "", "", err
-		}
-
-		var authorName string
-
-		if author != nil {
-			authorName = strings.TrimSpace(author.Value)
-		}
-
-		var sourceFeed string
-
-		for _, alternate := range sourceData.Alternates {
-			if alternate.Type == "text/plain" {
-				sourceFeed = alternate.URL
-			}
-		}
+	authorName, sourceFeed, content := ParseWebMentionSource(sourceData)
 
-		return authorName, sourceFeed, nil
+	m := NewIncomingWebMention(owner, hash, source.String(), target.String())
+	if existing, err := s.db.GetWebMention(m.ID); err == nil {
+		// Keep the moderation status and original time of re-sent mentions
+		m.Status = existing.Status
+		m.CreatedAt = existing.CreatedAt
 	}
+	m.Author = authorName
+	m.AuthorURL = sourceFeed
+	m.Content = content
 
-	user, err := GetUserFromURL(s.config, s.db, target.String())
-	if err != nil {
-		log.WithError(err).WithField("target", target.String()).Warn("unable to get used from webmention target")
+	if err := s.db.SetWebMention(m.ID, m); err != nil {
+		log.WithError(err).Errorf("error storing webmention from %s", source)
 		return err
 	}
 
-	authorName, sourceFeed, err := parseSourceData(sourceData)
-	if err != nil {
-		log.WithError(err).Warnf("error parsing mf2 source data from %s", source)
+	if m.Status != WebMentionPending {
+		return nil
 	}
 
-	if authorName != "" && sourceFeed != "" {
-		if _, err := AppendSpecial(
-			s.config, s.db,
-			twtxtBot,
-			fmt.Sprintf(
-				"MENTION: @<%s %s> from @<%s %s> on %s",
-				user.Username, user.URL, authorName, sourceFeed,
-				source.String(),
-			),
-		); err != nil {
-			log.WithError(err).Warnf("error appending special MENTION post")
-			return err
-		}
-	} else {
-		if _, err := AppendSpecial(
-			s.config, s.db,
-			twtxtBot,
-			fmt.Sprintf(
-				"WEBMENTION: @<%s %s> on %s",
-				user.Username, user.URL,
-				source.String(),
-			),
-		); err != nil {
-			log.WithError(err).Warnf("error appending special MENTION post")
-			return err
-		}
+	for _, username := range owners {
+		Notify(s.db, s.events, NewNotification(NotificationWebMention, username, authorName, sourceFeed, source.String()))
 	}
 
 	return nil
 }
 
+func (s *Server) processWebUnmention(source, target *url.URL) error {
+	id := FastHash(source.String() + " " + target.String())
+	if err := s.db.DelWebMention(id); err != nil {
+		log.WithError(err).Warnf("error deleting webmention from %s to %s", source, target)
+		return err
+	}
+	log.Infof("deleted webmention from %s to %s", source, target)
+	return nil
+}
+
 func (s *Server) setupWebMentions() {
 	webmentions = webmention.New()
 	webmentions.Mention = s.processWebMention
+	webmentions.Unmention = s.processWebUnmention
 }
 
 func (s *Server) setupCronJobs() error {
@@ -428,6 +459,11 @@ func (s *Server) setupCronJobs() error {
 		log.Infof("Started background job %s (%s)", name, jobSpec.Schedule)
 	}
 
+	if err := s.cron.AddFunc("@every 1m", s.activitypub.RetryDeliveries); err != nil {
+		return err
+	}
+	log.Info("Started background job RetryActivityPub (@every 1m)")
+
 	return nil
 }
 
@@ -474,8 +510,22 @@ func (s *Server) initRoutes() {
 	s.router.GET("/robots.txt", s.RobotsHandler())
 	s.router.HEAD("/robots.txt", s.RobotsHandler())
 
+	s.router.GET("/.well-known/webfinger", s.WebFingerHandler())
+
+	s.router.GET("/ap/:nick", s.ActivityPubActorHandler())
+	s.router.GET("/ap/:nick/outbox", s.ActivityPubOutboxHandler())
+	s.router.GET("/ap/:nick/followers", s.ActivityPubFollowersHandler())
+	s.router.POST("/ap/:nick/inbox", s.ActivityPubInboxHandler())
+
 	s.router.GET("/discover", s.am.MustAuth(s.DiscoverHandler()))
 	s.router.GET("/mentions", s.am.MustAuth(s.MentionsHandler()))
+	s.router.GET("/events", s.am.MustAuth(s.EventsHandler()))
+
+	s.router.GET("/notifications", s.am.MustAuth(s.NotificationsHandler()))
+	s.router.POST("/notifications/read", s.am.MustAuth(s.MarkNotificationsReadHandler()))
+
+	s.router.GET("/webmentions", s.am.MustAuth(s.WebMentionsHandler()))
+	s.router.POST("/webmentions/:id", s.am.MustAuth(s.ModerateWebMentionHandler()))
 	s.router.GET("/search", s.SearchHandler())
 
 	s.router.HEAD("/twt/:hash", s.PermalinkHandler())
@@ -528,6 +578,15 @@ func (s *Server) initRoutes() {
 	s.router.GET("/user/:nick/followers", s.FollowersHandler())
 	s.router.GET("/user/:nick/following", s.FollowingHandler())
 
+	if s.config.OpenProfiles {
+		s.router.GET("/user/:nick/list/:name", s.ListHandler())
+	} else {
+		s.router.GET("/user/:nick/list/:name", s.am.MustAuth(s.ListHandler()))
+	}
+	s.router.HEAD("/user/:nick/list/:name/atom.xml", s.ListSyndicationHandler())
+	s.router.GET("/user/:nick/list/:name/atom.xml", s.ListSyndicationHandler())
+	s.router.POST("/lists", s.am.MustAuth(s.ManageListsHandler()))
+
 	s.router.GET("/pod/avatar", s.PodAvatarHandler())
 
 	// WebMentions
@@ -546,13 +605,20 @@ func (s *Server) initRoutes() {
 	s.router.HEAD("/user/:nick/atom.xml", s.SyndicationHandler())
 	s.router.GET("/atom.xml", s.SyndicationHandler())
 	s.router.GET("/user/:nick/atom.xml", s.SyndicationHandler())
+	s.router.HEAD("/feed.json", s.JSONFeedHandler())
+	s.router.HEAD("/user/:nick/feed.json", s.JSONFeedHandler())
+	s.router.GET("/feed.json", s.JSONFeedHandler())
+	s.router.GET("/user/:nick/feed.json", s.JSONFeedHandler())
 
 	s.router.GET("/feed/:name/manage", s.am.MustAuth(s.ManageFeedHandler()))
 	s.router.POST("/feed/:name/manage", s.am.MustAuth(s.ManageFeedHandler()))
 	s.router.POST("/feed/:name/archive", s.am.MustAuth(s.ArchiveFeedHandler()))
+	s.router.POST("/feed/:name/invite", s.am.MustAuth(s.FeedInviteHandler()))
 
 	s.router.GET("/login", s.am.HasAuth(s.LoginHandler()))
 	s.router.POST("/login", s.LoginHandler())
+	s.router.GET("/login/2fa", s.LoginTOTPHandler())
+	s.router.POST("/login/2fa", s.LoginTOTPHandler())
 
 	s.router.GET("/logout", s.LogoutHandler())
 	s.router.POST("/logout", s.LogoutHandler())
@@ -582,21 +648,64 @@ func (s *Server) initRoutes() {
 
 	s.router.GET("/import", s.am.MustAuth(s.ImportHandler()))
 	s.router.POST("/import", s.am.MustAuth(s.ImportHandler()))
+	s.router.GET("/import/history", s.am.MustAuth(s.ImportHistoryHandler()))
+	s.router.POST("/import/history", s.am.MustAuth(s.ImportHistoryHandler()))
+	s.router.GET("/import/history/:id", s.am.MustAuth(s.ImportHistoryPreviewHandler()))
+	s.router.POST("/import/history/:id", s.am.MustAuth(s.ImportHistoryPreviewHandler()))
+	s.router.GET("/export", s.am.MustAuth(s.ExportHandler()))
 
 	s.router.GET("/unfollow", s.am.MustAuth(s.UnfollowHandler()))
 	s.router.POST("/unfollow", s.am.MustAuth(s.UnfollowHandler()))
 
+	s.router.GET("/followtag", s.am.MustAuth(s.FollowTagHandler()))
+	s.router.POST("/followtag", s.am.MustAuth(s.FollowTagHandler()))
+	s.router.GET("/unfollowtag", s.am.MustAuth(s.UnfollowTagHandler()))
+	s.router.POST("/unfollowtag", s.am.MustAuth(s.UnfollowTagHandler()))
+
+	s.router.GET("/bookmarks", s.am.MustAuth(s.BookmarksHandler()))
+	s.router.GET("/bookmark", s.am.MustAuth(s.BookmarkHandler()))
+	s.router.POST("/bookmark", s.am.MustAuth(s.BookmarkHandler()))
+
+	s.router.GET("/pin", s.am.MustAuth(s.PinHandler()))
+	s.router.POST("/pin", s.am.MustAuth(s.PinHandler()))
+	s.router.GET("/unpin", s.am.MustAuth(s.UnpinHandler()))
+	s.router.POST("/unpin", s.am.MustAuth(s.UnpinHandler()))
+
 	s.router.GET("/mute", s.am.MustAuth(s.MuteHandler()))
 	s.router.POST("/mute", s.am.MustAuth(s.MuteHandler()))
 	s.router.GET("/unmute", s.am.MustAuth(s.UnmuteHandler()))
 	s.router.POST("/unmute", s.am.MustAuth(s.UnmuteHandler()))
 
-	s.router.GET("/transferFeed/:name", s.TransferFeedHandler())
-	s.router.GET("/transferFeed/:name/:transferTo", s.TransferFeedHandler())
+	s.router.GET("/transferFeed/:name", s.am.MustAuth(s.TransferFeedHandler()))
+	s.router.GET("/transferFeed/:name/:transferTo", s.am.MustAuth(s.TransferFeedHandler()))
 
 	s.router.GET("/settings", s.am.MustAuth(s.SettingsHandler()))
 	s.router.POST("/settings", s.am.MustAuth(s.SettingsHandler()))
 	s.router.POST("/token/delete/:signature", s.am.MustAuth(s.DeleteTokenHandler()))
+	s.router.POST("/filter", s.am.MustAuth(s.AddFilterHandler()))
+	s.router.POST("/filter/delete/:id", s.am.MustAuth(s.DeleteFilterHandler()))
+
+	s.router.POST("/digest", s.am.MustAuth(s.DigestSettingsHandler()))
+
+	s.router.POST("/settings/export", s.am.MustAuth(s.ExportDataHandler()))
+	s.router.GET("/settings/export/:id", s.am.MustAuth(s.DownloadExportHandler()))
+	s.router.POST("/settings/import", s.am.MustAuth(s.ImportExportHandler()))
+	s.router.POST("/settings/move", s.am.MustAuth(s.MoveAccountHandler()))
+	s.router.POST("/settings/rename", s.am.MustAuth(s.RenameUserHandler()))
+	s.router.GET("/settings/2fa", s.am.MustAuth(s.TOTPSettingsHandler()))
+	s.router.POST("/settings/2fa", s.am.MustAuth(s.TOTPSettingsHandler()))
+	s.router.GET("/settings/2fa/qr.png", s.am.MustAuth(s.TOTPQRCodeHandler()))
+
+	s.router.POST("/apps", s.am.MustAuth(s.AddOAuthAppHandler()))
+	s.router.POST("/apps/delete/:id", s.am.MustAuth(s.DeleteOAuthAppHandler()))
+	s.router.POST("/apps/revoke/:id", s.am.MustAuth(s.RevokeOAuthAppHandler()))
+	s.router.GET("/oauth/authorize", s.OAuthAuthorizeHandler())
+	s.router.POST("/oauth/authorize", s.OAuthAuthorizeHandler())
+
+	s.router.POST("/webhooks", s.am.MustAuth(s.AddWebhookHandler()))
+	s.router.POST("/webhooks/delete/:id", s.am.MustAuth(s.DeleteWebhookHandler()))
+	s.router.GET("/unsubscribe", s.UnsubscribeHandler())
+	s.router.POST("/unsubscribe", s.UnsubscribeHandler())
 
 	s.router.GET("/config", s.am.MustAuth(s.PodConfigHandler()))
 	s.router.GET("/manage/pod", s.ManagePodHandler())
@@ -605,6 +714,8 @@ func (s *Server) initRoutes() {
 	s.router.GET("/manage/users", s.ManageUsersHandler())
 	s.router.POST("/manage/adduser", s.AddUserHandler())
 	s.router.POST("/manage/deluser", s.DelUserHandler())
+	s.router.POST("/manage/feedlimit", s.FeedLimitHandler())
+	s.router.POST("/manage/reset2fa", s.ResetTOTPHandler())
 
 	s.router.GET("/deleteFeeds", s.DeleteAccountHandler())
 	s.router.POST("/delete", s.am.MustAuth(s.DeleteAllHandler()))
@@ -687,7 +798,7 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		return nil, err
 	}
 
-	tmplman, err := NewTemplateManager(config, blogs, cache)
+	tmplman, err := NewTemplateManager(config, db, blogs, cache)
 	if err != nil {
 		log.WithError(err).Error("error creating template manager")
 		return nil, err
@@ -713,14 +824,61 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		sc,
 	)
 
-	api := NewAPI(router, config, cache, archive, db, pm, tasks)
+	events := NewEventBus()
+
+	webhooks := NewWebhooks(config, db, tasks)
+
+	activitypub, err := NewActivityPub(config, db, tasks, events)
+	if err != nil {
+		log.WithError(err).Error("error creating activitypub bridge")
+		return nil, err
+	}
+
+	hooks := NewAppendTwtHooks(tasks)
+
+	hooks.Register(activitypub.Publish)
+
+	// Push local twts as soon as they're posted rather than when the feed is
+	// next fetched
+	hooks.Register(func(name string, twt types.Twt) {
+		events.PublishTwts(db, types.Twts{twt})
+	})
+
+	events.Listen(func(username string, event Event) {
+		if event.Notification != nil {
+			webhooks.FireNotification(event.Notification)
+		}
+	})
+
+	cache.OnNewTwts(func(twts types.Twts) {
+		events.PublishTwts(db, twts)
+	})
+	cache.OnNewTwts(func(twts types.Twts) {
+		NotifyTwts(config, db, cache, events, twts)
+	})
+	cache.OnNewTwts(webhooks.FireTwts)
+
+	msgs.OnChange(func(username string, count int) {
+		events.Publish(username, Event{Type: MessagesEvent, Count: count})
+	})
+
+	api := NewAPI(router, config, cache, archive, db, pm, tasks, msgs, events, hooks)
 
 	pop3Service := NewPOP3Service(config, db, pm, msgs, tasks)
 
-	smtpService := NewSMTPService(config, db, pm, msgs, tasks)
+	smtpService := NewSMTPService(config, db, pm, msgs, events, tasks)
+
+	geminiService := NewGeminiService(config, db, cache, archive)
 
 	csrfHandler := nosurf.New(router)
 	csrfHandler.ExemptGlob("/api/v1/*")
+	// Globs don't match across path segments, apps authenticate to the OAuth2
+	// endpoints with their client credentials
+	csrfHandler.ExemptGlob("/api/v1/oauth/*")
+	// ActivityPub inboxes authenticate requests with HTTP signatures
+	csrfHandler.ExemptGlob("/ap/*")
+	// Unsubscribe links are signed and mail clients may POST to them
+	csrfHandler.ExemptPath("/unsubscribe")
 
 	server := &Server{
 		bind:    bind,
@@ -734,9 +892,15 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 				Prefix:               "twtxt",
 				RemoteAddressHeaders: []string{"X-Forwarded-For"},
 			}).Handler(
-				gziphandler.GzipHandler(
-					sm.Handler(csrfHandler),
-				),
+				AliasRedirectHandler(config, db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					// Event streams are never compressed as the gzip handler
+					// buffers writes and would delay events
+					if IsEventStream(r) {
+						sm.Handler(csrfHandler).ServeHTTP(w, r)
+						return
+					}
+					gziphandler.GzipHandler(sm.Handler(csrfHandler)).ServeHTTP(w, r)
+				})),
 			),
 		},
 
@@ -749,6 +913,9 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		// SMTP Servicee
 		smtpService: smtpService,
 
+		// Gemini Service
+		geminiService: geminiService,
+
 		// Blogs Cache
 		blogs: blogs,
 
@@ -758,6 +925,21 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		// Feed Cache
 		cache: cache,
 
+		// Unread Counts
+		unread: NewUnreadCounts(cache),
+
+		// Event Bus
+		events: events,
+
+		// Outgoing Webhooks
+		webhooks: webhooks,
+
+		// ActivityPub Bridge
+		activitypub: activitypub,
+
+		// Posted Twt Hooks
+		hooks: hooks,
+
 		// Feed Archiver
 		archive: archive,
 
@@ -797,6 +979,11 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	server.smtpService.Start()
 	log.Info("started SMTP service")
 
+	if server.config.GeminiBind != "" {
+		server.geminiService.Start()
+		log.Infof("started Gemini service on %s", server.config.GeminiBind)
+	}
+
 	server.setupWebMentions()
 	log.Infof("started webmentions processor")
 
@@ -1,9 +1,11 @@
 package internal
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -11,6 +13,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/mail"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
@@ -194,12 +197,13 @@ type SMTPService struct {
 	db     Store
 	pm     passwords.Passwords
 	msgs   *MessagesCache
+	events *EventBus
 	tasks  *Dispatcher
 }
 
 // NewSMTPService ...
-func NewSMTPService(config *Config, db Store, pm passwords.Passwords, msgs *MessagesCache, tasks *Dispatcher) *SMTPService {
-	svc := &SMTPService{config, db, pm, msgs, tasks}
+func NewSMTPService(config *Config, db Store, pm passwords.Passwords, msgs *MessagesCache, events *EventBus, tasks *Dispatcher) *SMTPService {
+	svc := &SMTPService{config, db, pm, msgs, events, tasks}
 
 	return svc
 }
@@ -280,6 +284,12 @@ func (s *SMTPService) storeMessage(conf *Config, msg *message.Entity, to []strin
 			return fmt.Errorf("error writing message for %s: %w", username, err)
 		}
 		s.msgs.Inc(username)
+
+		var sender string
+		if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+			sender, _ = splitEmailAddress(from.Address)
+		}
+		Notify(s.db, s.events, NewNotification(NotificationMessage, username, sender, "", "/messages"))
 	}
 
 	return nil
@@ -332,3 +342,91 @@ func (s *SMTPService) ListenAndServe() error {
 
 	return srv.ListenAndServe()
 }
+
+type GeminiService struct {
+	config  *Config
+	handler *GeminiHandler
+
+	listener net.Listener
+}
+
+// NewGeminiService ...
+func NewGeminiService(config *Config, db Store, cache *Cache, archive Archiver) *GeminiService {
+	svc := &GeminiService{config: config, handler: NewGeminiHandler(config, db, cache, archive)}
+
+	return svc
+}
+
+func (s *GeminiService) serve(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	line, err := bufio.NewReader(io.LimitReader(conn, maxGeminiRequest)).ReadString('\n')
+	if err != nil || !strings.HasSuffix(line, "\r\n") {
+		_, _ = conn.Write(geminiError(GeminiStatusBadRequest, "Bad Request").Bytes())
+		return
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(line, "\r\n"))
+	if err != nil || u.Scheme != "gemini" {
+		_, _ = conn.Write(geminiError(GeminiStatusBadRequest, "Bad Request").Bytes())
+		return
+	}
+
+	if !strings.EqualFold(u.Hostname(), HostnameFromURL(s.config.BaseURL)) {
+		_, _ = conn.Write(geminiError(GeminiStatusProxyRefused, "Proxy Request Refused").Bytes())
+		return
+	}
+
+	log.Debugf("gemini request from %s for %s", conn.RemoteAddr(), u)
+
+	_, _ = conn.Write(s.handler.Handle(u).Bytes())
+}
+
+func (s *GeminiService) Start() {
+	if s.config.GeminiBind == "" {
+		return
+	}
+
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			log.WithError(err).Error("error running Gemini service")
+		}
+	}()
+}
+
+func (s *GeminiService) Stop() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+func (s *GeminiService) ListenAndServe() error {
+	cert, err := LoadOrCreateGeminiCert(s.config)
+	if err != nil {
+		log.WithError(err).Error("error loading gemini certificate")
+		return fmt.Errorf("error loading gemini certificate: %w", err)
+	}
+
+	listener, err := tls.Listen("tcp", s.config.GeminiBind, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		log.WithError(err).Error("error creating listener")
+		return fmt.Errorf("error creating listener: %w", err)
+	}
+	s.listener = listener
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
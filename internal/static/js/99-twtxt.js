@@ -201,6 +201,63 @@ u("#theme input").on("change", function (e) {
   }
 });
 
+function setBadge(el, count) {
+  var badge = el.find(".badge");
+  if (count > 0) {
+    if (badge.length) {
+      badge.text(String(count));
+    } else {
+      el.append('<span class="badge">' + count + "</span>");
+    }
+  } else {
+    badge.remove();
+  }
+}
+
+function getBadge(el) {
+  return parseInt(el.find(".badge").text(), 10) || 0;
+}
+
+function listenForEvents() {
+  if (typeof window.EventSource == "undefined") {
+    return;
+  }
+
+  // Only authenticated users have a Timeline in the nav
+  if (!u("#timelineNav").length) {
+    return;
+  }
+
+  var newTwts = 0;
+  var source = new EventSource("/events");
+
+  source.addEventListener("twts", function (e) {
+    var data = JSON.parse(e.data);
+    newTwts += data.count;
+    setBadge(u("#timelineNav"), getBadge(u("#timelineNav")) + data.count);
+    u("#newTwts")
+      .text(newTwts + (newTwts == 1 ? " new twt" : " new twts"))
+      .first().hidden = false;
+  });
+
+  source.addEventListener("mentions", function (e) {
+    var data = JSON.parse(e.data);
+    setBadge(u("#mentionsNav"), getBadge(u("#mentionsNav")) + data.count);
+  });
+
+  source.addEventListener("notifications", function (e) {
+    var data = JSON.parse(e.data);
+    setBadge(u("#notificationsNav"), data.count);
+  });
+
+  source.addEventListener("messages", function (e) {
+    var data = JSON.parse(e.data);
+    setBadge(u("#messagesMenu"), data.count);
+  });
+}
+
+listenForEvents();
+
 function persist(e) {
   localStorage.setItem(e.target.id, e.target.value);
 }
@@ -563,6 +620,60 @@ function pollForTask(taskURL, delay, maxDelay, timeout, errorCallback, successCa
     });
 }
 
+if (u("#exportStatus").length) {
+  pollForTask(
+    u("#exportStatus").data("task"),
+    1000,
+    30000,
+    Date.now() + maxTaskWait,
+    function (errorData) {
+      u("#exportStatus").attr("aria-busy", "false");
+      u("#exportStatus").text("An error occurred exporting your data: " + errorData.error);
+    },
+    function (successData) {
+      u("#exportStatus").attr("aria-busy", "false");
+      u("#exportStatus").html('Your export is ready: <a href="' + successData.data.exportURI + '">Download</a>');
+    }
+  );
+}
+
+if (u("#historyStatus").length) {
+  pollForTask(
+    u("#historyStatus").data("task"),
+    1000,
+    30000,
+    Date.now() + maxTaskWait,
+    function (errorData) {
+      u("#historyStatus").attr("aria-busy", "false");
+      u("#historyStatus").text("An error occurred importing your history: " + errorData.error);
+    },
+    function (successData) {
+      if (successData.data.previewURI) {
+        window.location.href = successData.data.previewURI;
+        return;
+      }
+      u("#historyStatus").attr("aria-busy", "false");
+      u("#historyStatus").text("Successfully imported " + successData.data.imported + " twts into your feed");
+    }
+  );
+}
+
+if (u("#importStatus").length) {
+  pollForTask(
+    u("#importStatus").data("task"),
+    1000,
+    30000,
+    Date.now() + maxTaskWait,
+    function (errorData) {
+      u("#importStatus").attr("aria-busy", "false");
+      u("#importStatus").text("An error occurred importing your feeds: " + errorData.error);
+    },
+    function (successData) {
+      window.location.href = successData.data.resultsURI;
+    }
+  );
+}
+
 u("#uploadImage").on("change", function (e) {
   u("#uploadImageButton").removeClass("icss-camera");
   u("#uploadImageButton").addClass("icss-spinner icss-pulse");
@@ -3,6 +3,7 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jointwt/twtxt/internal/session"
 )
@@ -12,6 +13,8 @@ var (
 	ErrUserNotFound   = errors.New("error: user not found")
 	ErrTokenNotFound  = errors.New("error: token not found")
 	ErrFeedNotFound   = errors.New("error: feed not found")
+	ErrListNotFound   = errors.New("error: list not found")
+	ErrAliasNotFound  = errors.New("error: alias not found")
 	ErrInvalidSession = errors.New("error: invalid session")
 )
 
@@ -28,6 +31,48 @@ type Store interface {
 	SearchFeeds(prefix string) []string
 	GetAllFeeds() ([]*Feed, error)
 
+	DelList(owner, name string) error
+	HasList(owner, name string) bool
+	GetList(owner, name string) (*List, error)
+	SetList(owner, name string, list *List) error
+	LenLists() int64
+	GetUserLists(owner string) ([]*List, error)
+	GetAllLists() ([]*List, error)
+
+	DelNotification(username, id string) error
+	GetNotification(username, id string) (*Notification, error)
+	SetNotification(username, id string, n *Notification) error
+	LenNotifications() int64
+	GetUserNotifications(username string) ([]*Notification, error)
+	CountUnreadNotifications(username string) int
+
+	DelWebhook(id string) error
+	GetWebhook(id string) (*Webhook, error)
+	SetWebhook(id string, hook *Webhook) error
+	LenWebhooks() int64
+	GetAllWebhooks() ([]*Webhook, error)
+
+	DelWebMention(id string) error
+	GetWebMention(id string) (*IncomingWebMention, error)
+	SetWebMention(id string, m *IncomingWebMention) error
+	LenWebMentions() int64
+	GetAllWebMentions() ([]*IncomingWebMention, error)
+
+	DelActivityPubFollower(name, id string) error
+	SetActivityPubFollower(name, id string, f *ActivityPubFollower) error
+	LenActivityPubFollowers() int64
+	GetActivityPubFollowers(name string) ([]*ActivityPubFollower, error)
+
+	DelActivityPubRetry(id string) error
+	SetActivityPubRetry(id string, r *ActivityPubRetry) error
+	GetActivityPubRetries() ([]*ActivityPubRetry, error)
+
+	DelAlias(name string) error
+	HasAlias(name string) bool
+	GetAlias(name string) (string, error)
+	SetAlias(name, username string) error
+	LenAliases() int64
+
 	DelUser(username string) error
 	HasUser(username string) bool
 	GetUser(username string) (*User, error)
@@ -44,7 +89,16 @@ type Store interface {
 	LenSessions() int64
 	GetAllSessions() ([]*session.Session, error)
 
+	DelOAuthApp(clientID string) error
+	GetOAuthApp(clientID string) (*OAuthApp, error)
+	SetOAuthApp(clientID string, app *OAuthApp) error
+	LenOAuthApps() int64
+	GetAllOAuthApps() ([]*OAuthApp, error)
+	UseOAuthCode(jti string, expiresAt time.Time) (bool, error)
+	DelExpiredOAuthCodes() error
+
 	GetUserTokens(user *User) ([]*Token, error)
+	GetToken(signature string) (*Token, error)
 	SetToken(signature string, token *Token) error
 	DelToken(signature string) error
 	LenTokens() int64
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// FollowTagHandler ...
+func (s *Server) FollowTagHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		tag := NormalizeTag(r.FormValue("tag"))
+
+		if tag == "" {
+			ctx.Error = true
+			ctx.Message = "No tag specified to follow"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+			return
+		}
+
+		user.FollowTag(tag)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error following tag #%s", tag)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully followed tag #%s", tag)
+		s.render("error", w, ctx)
+
+	}
+}
+
+// UnfollowTagHandler ...
+func (s *Server) UnfollowTagHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		tag := NormalizeTag(r.FormValue("tag"))
+
+		if tag == "" {
+			ctx.Error = true
+			ctx.Message = "No tag specified to unfollow"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			log.Fatalf("user not found in context")
+			return
+		}
+
+		user.UnfollowTag(tag)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error unfollowing tag #%s", tag)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully unfollowed tag #%s", tag)
+		s.render("error", w, ctx)
+
+	}
+}
@@ -31,7 +31,7 @@ type TemplateManager struct {
 	funcMap   template.FuncMap
 }
 
-func NewTemplateManager(conf *Config, blogs *BlogsCache, cache *Cache) (*TemplateManager, error) {
+func NewTemplateManager(conf *Config, db Store, blogs *BlogsCache, cache *Cache) (*TemplateManager, error) {
 	templates := make(map[string]*template.Template)
 
 	funcMap := sprig.FuncMap()
@@ -46,6 +46,7 @@ func NewTemplateManager(conf *Config, blogs *BlogsCache, cache *Cache) (*Templat
 	funcMap["urlForBlog"] = URLForBlogFactory(conf, blogs)
 	funcMap["urlForConv"] = URLForConvFactory(conf, cache)
 	funcMap["isAdminUser"] = IsAdminUserFactory(conf)
+	funcMap["isPinned"] = IsPinnedFactory(conf, db)
 
 	m := &TemplateManager{debug: conf.Debug, templates: templates, funcMap: funcMap}
 
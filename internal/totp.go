@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpRecoveryCodes is the number of single use recovery codes a user
+	// gets when enabling two-factor authentication
+	totpRecoveryCodes = 10
+
+	// totpQRCodeSize is the width and height of the enrolment QR code
+	totpQRCodeSize = 200
+
+	// totpPeriod is the number of seconds each code is valid for and
+	// totpSkew the number of periods either side of now a code is accepted
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+var (
+	ErrInvalidTOTPCode    = errors.New("error: invalid two-factor authentication code")
+	ErrTOTPNotEnabled     = errors.New("error: two-factor authentication is not enabled")
+	ErrTOTPAlreadyEnabled = errors.New("error: two-factor authentication is already enabled")
+
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateTOTPKey generates a new TOTP secret for the user to enrol in their
+// authenticator app
+func GenerateTOTPKey(conf *Config, username string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      conf.Name,
+		AccountName: username,
+	})
+}
+
+// TOTPQRCode returns a PNG of the QR code for enrolling the key at url (an
+// otpauth:// url) in an authenticator app
+func TOTPQRCode(url string) ([]byte, error) {
+	key, err := otp.NewKeyFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(totpQRCodeSize, totpQRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// normalizeRecoveryCode strips the formatting of a recovery code as typed
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.Join(strings.Fields(code), "")
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes returns new recovery codes to show to the user once
+// and the hashes of them to store
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < totpRecoveryCodes; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return
+}
+
+// validateTOTP returns the time step of code if it is valid for secret at
+// now allowing for totpSkew steps of clock drift
+func validateTOTP(code, secret string, now time.Time) (int64, bool) {
+	counter := now.Unix() / totpPeriod
+	for step := counter - totpSkew; step <= counter+totpSkew; step++ {
+		expected, err := totp.GenerateCode(secret, time.Unix(step*totpPeriod, 0))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// HasTOTP returns true if the user has enabled two-factor authentication
+func (u *User) HasTOTP() bool {
+	return u.TOTPSecret != ""
+}
+
+// EnableTOTP enables two-factor authentication for the user if code is
+// valid for the secret they enrolled in their authenticator app
+func (u *User) EnableTOTP(secret, code string, recoveryHashes []string) error {
+	if u.HasTOTP() {
+		return ErrTOTPAlreadyEnabled
+	}
+	step, ok := validateTOTP(strings.TrimSpace(code), secret, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	u.TOTPSecret = secret
+	u.TOTPRecoveryCodes = recoveryHashes
+	u.TOTPLastStep = step
+
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication for the user
+func (u *User) DisableTOTP() {
+	u.TOTPSecret = ""
+	u.TOTPRecoveryCodes = []string{}
+}
+
+// CheckTOTP validates a code from the user's authenticator app or one of
+// their unused recovery codes. Each code can only be used once, the time
+// step of the last code used is recorded and a recovery code is removed, so
+// the user must be saved after every successful check.
+func (u *User) CheckTOTP(code string) (recovery bool, err error) {
+	if !u.HasTOTP() {
+		return false, ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, ErrInvalidTOTPCode
+	}
+
+	if step, ok := validateTOTP(code, u.TOTPSecret, time.Now()); ok {
+		if step <= u.TOTPLastStep {
+			return false, ErrInvalidTOTPCode
+		}
+		u.TOTPLastStep = step
+		return false, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range u.TOTPRecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			u.TOTPRecoveryCodes = append(u.TOTPRecoveryCodes[:i], u.TOTPRecoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, ErrInvalidTOTPCode
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/otp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+// pendingTOTPKey returns the key the user is enrolling in their
+// authenticator app, generating a new one if they haven't started yet
+func (s *Server) pendingTOTPKey(sess *session.Session, username string) (*otp.Key, error) {
+	if url, ok := sess.Get("totp_key"); ok {
+		if key, err := otp.NewKeyFromURL(url); err == nil {
+			return key, nil
+		}
+	}
+
+	key, err := GenerateTOTPKey(s.config, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.Set("totp_key", key.URL()); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// TOTPSettingsHandler enables and disables two-factor authentication and
+// regenerates recovery codes
+func (s *Server) TOTPSettingsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		sess := r.Context().Value(session.SessionKey)
+		if sess == nil {
+			log.Warn("no session found")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		user := ctx.User
+		code := r.FormValue("code")
+
+		if r.Method == "GET" {
+			if !user.HasTOTP() {
+				key, err := s.pendingTOTPKey(sess.(*session.Session), user.Username)
+				if err != nil {
+					log.WithError(err).Error("error generating totp key")
+					ctx.Error = true
+					ctx.Message = "Error setting up two-factor authentication"
+					s.render("error", w, ctx)
+					return
+				}
+				ctx.TOTPSecret = key.Secret()
+			}
+			s.render("totp", w, ctx)
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "enable":
+			key, err := s.pendingTOTPKey(sess.(*session.Session), user.Username)
+			if err != nil {
+				log.WithError(err).Error("error loading totp key")
+				ctx.Error = true
+				ctx.Message = "Error setting up two-factor authentication"
+				s.render("error", w, ctx)
+				return
+			}
+
+			codes, hashes, err := GenerateRecoveryCodes()
+			if err != nil {
+				log.WithError(err).Error("error generating recovery codes")
+				ctx.Error = true
+				ctx.Message = "Error setting up two-factor authentication"
+				s.render("error", w, ctx)
+				return
+			}
+
+			if err := user.EnableTOTP(key.Secret(), code, hashes); err != nil {
+				ctx.Error = true
+				ctx.Message = "Invalid authentication code! Check the time on your device and try again."
+				s.render("error", w, ctx)
+				return
+			}
+
+			if err := s.db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Errorf("error updating user object for %s", user.Username)
+				ctx.Error = true
+				ctx.Message = "Error enabling two-factor authentication"
+				s.render("error", w, ctx)
+				return
+			}
+
+			_ = sess.(*session.Session).Del("totp_key")
+
+			ctx.RecoveryCodes = codes
+			s.render("totp", w, ctx)
+		case "recovery":
+			if _, err := user.CheckTOTP(code); err != nil {
+				ctx.Error = true
+				ctx.Message = "Invalid authentication code!"
+				s.render("error", w, ctx)
+				return
+			}
+
+			codes, hashes, err := GenerateRecoveryCodes()
+			if err != nil {
+				log.WithError(err).Error("error generating recovery codes")
+				ctx.Error = true
+				ctx.Message = "Error generating recovery codes"
+				s.render("error", w, ctx)
+				return
+			}
+			user.TOTPRecoveryCodes = hashes
+
+			if err := s.db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Errorf("error updating user object for %s", user.Username)
+				ctx.Error = true
+				ctx.Message = "Error generating recovery codes"
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.RecoveryCodes = codes
+			s.render("totp", w, ctx)
+		case "disable":
+			if _, err := user.CheckTOTP(code); err != nil {
+				ctx.Error = true
+				ctx.Message = "Invalid authentication code!"
+				s.render("error", w, ctx)
+				return
+			}
+
+			user.DisableTOTP()
+
+			if err := s.db.SetUser(user.Username, user); err != nil {
+				log.WithError(err).Errorf("error updating user object for %s", user.Username)
+				ctx.Error = true
+				ctx.Message = "Error disabling two-factor authentication"
+				s.render("error", w, ctx)
+				return
+			}
+
+			ctx.Error = false
+			ctx.Message = "Two-factor authentication disabled"
+			s.render("error", w, ctx)
+		default:
+			ctx.Error = true
+			ctx.Message = "Invalid action"
+			s.render("error", w, ctx)
+		}
+	}
+}
+
+// TOTPQRCodeHandler serves the QR code of the key the user is enrolling in
+// their authenticator app
+func (s *Server) TOTPQRCodeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		sess := r.Context().Value(session.SessionKey)
+		if sess == nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		url, ok := sess.(*session.Session).Get("totp_key")
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		data, err := TOTPQRCode(url)
+		if err != nil {
+			log.WithError(err).Error("error generating totp qr code")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(data)
+	}
+}
+
+// LoginTOTPHandler is the second step of logging in for users with
+// two-factor authentication enabled
+func (s *Server) LoginTOTPHandler() httprouter.Handle {
+	// #239: Throttle failed login attempts and lock user  account.
+	failures := NewTTLCache(5 * time.Minute)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		sess := r.Context().Value(session.SessionKey)
+		if sess == nil {
+			log.Warn("no session found")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		username, ok := sess.(*session.Session).Get("totp_username")
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.Method == "GET" {
+			s.render("loginTOTP", w, ctx)
+			return
+		}
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "Invalid username! Hint: Register an account?"
+			s.render("error", w, ctx)
+			return
+		}
+
+		// #239: Throttle failed login attempts and lock user  account.
+		if failures.Get(user.Username) > MaxFailedLogins {
+			ctx.Error = true
+			ctx.Message = "Too many failed login attempts. Account temporarily locked! Please try again later."
+			s.render("error", w, ctx)
+			return
+		}
+
+		recovery, err := user.CheckTOTP(r.FormValue("code"))
+		if err != nil {
+			// #239: Throttle failed login attempts and lock user  account.
+			failed := failures.Inc(user.Username)
+			time.Sleep(time.Duration(IntPow(2, failed)) * time.Second)
+
+			ctx.Error = true
+			ctx.Message = "Invalid authentication code! Hint: Use one of your recovery codes?"
+			s.render("error", w, ctx)
+			return
+		}
+
+		// #239: Throttle failed login attempts and lock user  account.
+		failures.Reset(user.Username)
+
+		// Record the code used so it can't be replayed
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating user object for %s", user.Username)
+			ctx.Error = true
+			ctx.Message = "Error logging in"
+			s.render("error", w, ctx)
+			return
+		}
+		if recovery {
+			log.Infof("recovery code used by %s, %d remaining", user.Username, len(user.TOTPRecoveryCodes))
+		}
+
+		// Login successful
+		log.Infof("login successful: %s", username)
+
+		redirect, ok := sess.(*session.Session).Get("totp_redirect")
+		if !ok {
+			redirect = "/"
+		}
+		persist := sess.(*session.Session).Has("totp_persist")
+
+		_ = sess.(*session.Session).Del("totp_username")
+		_ = sess.(*session.Session).Del("totp_redirect")
+		_ = sess.(*session.Session).Del("totp_persist")
+
+		// Authorize session
+		_ = sess.(*session.Session).Set("username", username)
+
+		// Persist session?
+		if persist {
+			_ = sess.(*session.Session).Set("persist", "1")
+		}
+
+		// Show how many recovery codes are left after using one
+		if recovery {
+			redirect = "/settings/2fa"
+		}
+
+		http.Redirect(w, r, redirect, http.StatusFound)
+	}
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTOTP(t *testing.T) {
+	conf := &Config{Name: "example.com"}
+	user := &User{Username: "alice"}
+
+	key, err := GenerateTOTPKey(conf, user.Username)
+	require.NoError(t, err)
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, totpRecoveryCodes)
+
+	assert.Equal(t, ErrInvalidTOTPCode, user.EnableTOTP(key.Secret(), "000000x", hashes))
+	assert.False(t, user.HasTOTP())
+
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	require.NoError(t, err)
+	require.NoError(t, user.EnableTOTP(key.Secret(), code, hashes))
+	assert.True(t, user.HasTOTP())
+
+	// The code used to enable 2FA can't be used again
+	_, err = user.CheckTOTP(code)
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+
+	next, err := totp.GenerateCode(key.Secret(), time.Now().Add(totpPeriod*time.Second))
+	require.NoError(t, err)
+	recovery, err := user.CheckTOTP(next)
+	require.NoError(t, err)
+	assert.False(t, recovery)
+
+	// Nor can any code once it has been used
+	_, err = user.CheckTOTP(next)
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+
+	_, err = user.CheckTOTP("")
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+
+	// Recovery codes are accepted however they are typed but only once
+	recovery, err = user.CheckTOTP(" " + strings.ToUpper(codes[0]) + " ")
+	require.NoError(t, err)
+	assert.True(t, recovery)
+	assert.Len(t, user.TOTPRecoveryCodes, totpRecoveryCodes-1)
+
+	_, err = user.CheckTOTP(codes[0])
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+
+	user.DisableTOTP()
+	assert.False(t, user.HasTOTP())
+
+	_, err = user.CheckTOTP(code)
+	assert.Equal(t, ErrTOTPNotEnabled, err)
+}
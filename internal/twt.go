@@ -3,12 +3,14 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	read_file_last_line "github.com/prologic/read-file-last-line"
@@ -21,9 +23,93 @@ const (
 	feedsDir = "feeds"
 )
 
+// feedLocks serializes writes to each local feed's file
+var feedLocks = &FeedLocks{locks: make(map[string]*sync.Mutex)}
+
+// FeedLocks are a lock per local feed held while its file is written
+type FeedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// Lock locks the named feed and returns a func to unlock it
+func (l *FeedLocks) Lock(name string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[name] = lock
+	}
+	l.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// AppendTwtHook is called with the name of the user (or feed) and the new
+// twt after a twt is posted to a local feed
+type AppendTwtHook func(name string, twt types.Twt)
+
+// AppendTwtHooks are the hooks run when twts are posted to local feeds.
+// Each hook runs as its own task on the dispatcher so a slow hook doesn't
+// hold up posting or the other hooks.
+type AppendTwtHooks struct {
+	mu    sync.RWMutex
+	tasks *Dispatcher
+	hooks []AppendTwtHook
+}
+
+// NewAppendTwtHooks ...
+func NewAppendTwtHooks(tasks *Dispatcher) *AppendTwtHooks {
+	return &AppendTwtHooks{tasks: tasks}
+}
+
+// Register adds a hook that is run for every twt posted
+func (h *AppendTwtHooks) Register(hook AppendTwtHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.hooks = append(h.hooks, hook)
+}
+
+// Run dispatches the hooks for a twt posted to the named user or feed
+func (h *AppendTwtHooks) Run(name string, twt types.Twt) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, hook := range h.hooks {
+		hook := hook
+		if _, err := h.tasks.DispatchFunc(func() error {
+			hook(name, twt)
+			return nil
+		}); err != nil {
+			log.WithError(err).Errorf("error dispatching hooks for twt %s", twt.Hash())
+		}
+	}
+}
+
+// FeedPreamble holds the `# key = value` metadata comments that are
+// prepended to a feed when it is served.
+type FeedPreamble struct {
+	bytes.Buffer
+}
+
+// Add appends a single `# key = value` metadata comment.
+func (p *FeedPreamble) Add(key, value string) {
+	fmt.Fprintf(&p.Buffer, "# %s = %s\n", key, value)
+}
+
+// AddAll appends a `# key = value` metadata comment for each value.
+func (p *FeedPreamble) AddAll(key string, values []string) {
+	for _, value := range values {
+		p.Add(key, value)
+	}
+}
+
 // ExpandMentions turns "@nick" into "@<nick URL>" if we're following the user or feed
 // or if they exist on the local pod. Also turns @user@domain into
-// @<user URL> as a convenient way to mention users across pods.
+// @<user URL> as a convenient way to mention users across pods, resolving
+// the user's feed via WebFinger if it has already been looked up.
 func ExpandMentions(conf *Config, db Store, user *User, text string) string {
 	re := regexp.MustCompile(`@([a-zA-Z0-9][a-zA-Z0-9_-]+)(?:@)?((?:[_a-z0-9](?:[_a-z0-9-]{0,61}[a-z0-9]\.)|(?:[0-9]+/[0-9]{2})\.)+(?:[a-z](?:[a-z0-9-]{0,61}[a-z0-9])?)?)?`)
 	return re.ReplaceAllStringFunc(text, func(match string) string {
@@ -32,11 +118,9 @@ func ExpandMentions(conf *Config, db Store, user *User, text string) string {
 		mentionedDomain := parts[2]
 
 		if mentionedNick != "" && mentionedDomain != "" {
-			// TODO: Validate the remote end for a valid Twtxt pod?
-			// XXX: Should we always assume https:// ?
 			return fmt.Sprintf(
-				"@<%s https://%s/user/%s/twtxt.txt>",
-				mentionedNick, mentionedDomain, mentionedNick,
+				"@<%s %s>",
+				mentionedNick, ResolveMentionURL(conf, db, mentionedNick, mentionedDomain),
 			)
 		}
 
@@ -79,6 +163,8 @@ func DeleteLastTwt(conf *Config, user *User) error {
 
 	fn := filepath.Join(p, user.Username)
 
+	defer feedLocks.Lock(user.Username)()
+
 	_, n, err := GetLastTwt(conf, user)
 	if err != nil {
 		return err
@@ -94,9 +180,9 @@ func DeleteLastTwt(conf *Config, user *User) error {
 }
 
 func AppendSpecial(conf *Config, db Store, specialUsername, text string, args ...interface{}) (types.Twt, error) {
-	user := &User{Username: specialUsername}
+	user := &User{Username: specialUsername, URL: URLForUser(conf, specialUsername)}
 	user.Following = make(map[string]string)
-	return AppendTwt(conf, db, user, text, args)
+	return AppendTwt(conf, db, user, text, args...)
 }
 
 func AppendTwt(conf *Config, db Store, user *User, text string, args ...interface{}) (types.Twt, error) {
@@ -113,6 +199,8 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 
 	fn := filepath.Join(p, user.Username)
 
+	defer feedLocks.Lock(user.Username)()
+
 	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		return types.NilTwt, err
@@ -1,9 +1,15 @@
 package internal
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
 )
 
 func TestExpandTag(t *testing.T) {
@@ -87,3 +93,72 @@ func TestExpandTag(t *testing.T) {
 		})
 	}
 }
+
+func TestFeedPreamble(t *testing.T) {
+	assert := assert.New(t)
+
+	preamble := &FeedPreamble{}
+	assert.Equal(0, preamble.Len())
+
+	preamble.Add("nick", "prologic")
+	preamble.AddAll("pin", []string{"abcdefg", "hijklmn"})
+
+	assert.Equal(
+		"# nick = prologic\n# pin = abcdefg\n# pin = hijklmn\n",
+		preamble.String(),
+	)
+}
+
+func TestPostTwtEditSkipsHooks(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-post")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{Data: data, BaseURL: "https://pod.example.com"}
+
+	tasks := NewDispatcher(2, 10)
+	tasks.Start()
+	defer tasks.Stop()
+
+	posted := make(chan string, 10)
+	hooks := NewAppendTwtHooks(tasks)
+	hooks.Register(func(name string, twt types.Twt) {
+		posted <- twt.Text()
+	})
+
+	s := &Server{config: conf, db: db, hooks: hooks}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = URLForUser(conf, "alice")
+	require.NoError(t, db.SetUser("alice", user))
+
+	next := func() string {
+		select {
+		case text := <-posted:
+			return text
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for hook")
+			return ""
+		}
+	}
+
+	twt, err := s.postTwt(user, "", "Hello", types.NilTwt)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", next())
+
+	// Edits keep the twt's timestamp and aren't announced as new twts
+	require.NoError(t, DeleteLastTwt(conf, user))
+	edited, err := s.postTwt(user, "", "Hello World", twt)
+	require.NoError(t, err)
+	assert.Equal(t, twt.Created().Unix(), edited.Created().Unix())
+
+	_, err = s.postTwt(user, "", "Bye", types.NilTwt)
+	require.NoError(t, err)
+	assert.Equal(t, "Bye", next())
+	assert.Len(t, posted, 0)
+}
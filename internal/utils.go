@@ -70,6 +70,11 @@ const (
 
 	requestTimeout = time.Second * 30
 
+	// Purposes of the tokens signed with the MagicLinkSecret, so that a
+	// token issued for one purpose can't be used for another
+	passwordResetTokenPurpose = "reset"
+	unsubscribeTokenPurpose   = "unsubscribe"
+
 	DayAgo   = time.Hour * 24
 	WeekAgo  = DayAgo * 7
 	MonthAgo = DayAgo * 30
@@ -118,6 +123,7 @@ var (
 	ErrInvalidImage     = errors.New("error: invalid image")
 	ErrInvalidAudio     = errors.New("error: invalid audio")
 	ErrInvalidVideo     = errors.New("error: invalid video")
+	ErrNotPublicAddress = errors.New("error: not a public address")
 	ErrInvalidVideoSize = errors.New("error: invalid video size")
 
 	thumbnailerOpts = thumbnailer.Options{
@@ -1089,6 +1095,14 @@ func NormalizeFeedName(name string) string {
 	return name
 }
 
+// NormalizeTag strips the leading # and lowercases a hashtag
+func NormalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimPrefix(tag, "#")
+	tag = strings.ToLower(tag)
+	return tag
+}
+
 func ValidateFeed(conf *Config, nick, url string) error {
 	res, err := Request(conf, http.MethodGet, url, nil)
 	if err != nil {
@@ -1103,7 +1117,7 @@ func ValidateFeed(conf *Config, nick, url string) error {
 
 	limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 	twter := types.Twter{Nick: nick, URL: url}
-	_, _, err = types.ParseFile(limitedReader, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
+	_, _, err = ParseFeed(limitedReader, res.Header.Get("Content-Type"), twter, conf.MaxCacheTTL, conf.MaxCacheItems)
 	if err != nil {
 		return err
 	}
@@ -1161,8 +1175,12 @@ func (ua TwtxtUserAgent) IsPublicURL() bool {
 		return false
 	}
 
-	ip := ips[0]
+	return IsPublicIP(ips[0])
+}
 
+// IsPublicIP returns true if the ip is not an unspecified, loopback,
+// link-local, multicast or private address
+func IsPublicIP(ip net.IP) bool {
 	// 0.0.0.0 or ::
 	if ip.IsUnspecified() {
 		return false
@@ -1173,9 +1191,39 @@ func (ua TwtxtUserAgent) IsPublicURL() bool {
 		return false
 	}
 
+	if ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
 	return !ipip.IsPrivate(ip)
 }
 
+// dialPublic dials the address only if all of the addresses its host
+// resolves to are public
+func dialPublic(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("error: no addresses found for %s", host)
+	}
+
+	for _, ip := range ips {
+		if !IsPublicIP(ip.IP) {
+			return nil, ErrNotPublicAddress
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+}
+
 func DetectFollowerFromUserAgent(ua string) (*TwtxtUserAgent, error) {
 	match := userAgentRegex.FindStringSubmatch(ua)
 	if match == nil {
@@ -1306,6 +1354,14 @@ func URLForUser(conf *Config, username string) string {
 	)
 }
 
+func URLForList(baseURL, owner, name string) string {
+	return fmt.Sprintf(
+		"%s/user/%s/list/%s",
+		strings.TrimSuffix(baseURL, "/"),
+		owner, name,
+	)
+}
+
 func URLForAvatar(conf *Config, username string) string {
 	return fmt.Sprintf(
 		"%s/user/%s/avatar",
@@ -1495,6 +1551,15 @@ func FilterTwts(user *User, twts types.Twts) (filtered types.Twts) {
 	return user.Filter(twts)
 }
 
+// FilterWarnings returns the twts that a User has chosen to collapse behind
+// a warning keyed by hash along with the matching filter
+func FilterWarnings(user *User, twts types.Twts) map[string]string {
+	if user == nil {
+		return nil
+	}
+	return user.MuteWarnings(twts)
+}
+
 // CleanTwt cleans a twt's text, replacing new lines with spaces and
 // stripping surrounding spaces.
 func CleanTwt(text string) string {
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// webfingerCacheTTL is how long successful WebFinger lookups are cached
+	webfingerCacheTTL = 24 * time.Hour
+
+	// webfingerFailureTTL is how long failed WebFinger lookups are cached
+	// before being retried
+	webfingerFailureTTL = 15 * time.Minute
+
+	// maxWebFingerSize is the maximum size of a WebFinger response
+	maxWebFingerSize = 64 * 1024
+
+	// WebFingerProfileRel is the link relation of a user's profile page
+	WebFingerProfileRel = "http://webfinger.net/rel/profile-page"
+
+	// WebFingerAvatarRel is the link relation of a user's avatar
+	WebFingerAvatarRel = "http://webfinger.net/rel/avatar"
+)
+
+var (
+	ErrWebFingerNotFound = errors.New("error: webfinger resource not found")
+	ErrWebFingerNoFeed   = errors.New("error: webfinger resource has no twtxt feed")
+	ErrWebFingerPending  = errors.New("error: webfinger lookup in progress")
+
+	webfingerHandleRegexp = regexp.MustCompile(`^@?([a-zA-Z0-9][a-zA-Z0-9_.-]*)@((?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?::[0-9]+)?)$`)
+
+	webfingers = newWebFingerCache()
+)
+
+// WebFingerLink is a link relation of a WebFinger resource
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// WebFingerResource is a JSON Resource Descriptor (RFC 7033)
+type WebFingerResource struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+// FeedURL returns the twtxt feed of the resource, the first text/plain
+// self link
+func (r WebFingerResource) FeedURL() string {
+	for _, link := range r.Links {
+		if link.Rel == "self" && link.Type == "text/plain" && link.Href != "" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+func (r WebFingerResource) Bytes() ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// NewWebFingerResource returns the WebFinger resource of a local user or feed
+func NewWebFingerResource(conf *Config, name string) WebFingerResource {
+	return WebFingerResource{
+		Subject: fmt.Sprintf("acct:%s@%s", name, conf.LocalURL().Host),
+		Aliases: []string{
+			URLForUser(conf, name),
+			UserURL(URLForUser(conf, name)),
+		},
+		Links: []WebFingerLink{
+			{Rel: "self", Type: "text/plain", Href: URLForUser(conf, name)},
+			{Rel: "self", Type: ActivityPubContentType, Href: URLForActor(conf, name)},
+			{Rel: WebFingerProfileRel, Type: "text/html", Href: UserURL(URLForUser(conf, name))},
+			{Rel: WebFingerAvatarRel, Href: URLForAvatar(conf, name)},
+		},
+	}
+}
+
+// ParseWebFingerHandle splits a `@user@domain` or `acct:user@domain` handle
+// into its user and domain
+func ParseWebFingerHandle(handle string) (user, domain string, ok bool) {
+	handle = strings.TrimPrefix(strings.TrimSpace(handle), "acct:")
+	match := webfingerHandleRegexp.FindStringSubmatch(handle)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], strings.ToLower(match[2]), true
+}
+
+// IsLocalDomain returns true if the domain is this pod's
+func IsLocalDomain(conf *Config, domain string) bool {
+	return strings.EqualFold(domain, conf.LocalURL().Host)
+}
+
+type webfingerResult struct {
+	url    string
+	err    error
+	expiry time.Time
+}
+
+type webfingerCache struct {
+	sync.RWMutex
+	results map[string]webfingerResult
+	pending map[string]bool
+}
+
+func newWebFingerCache() *webfingerCache {
+	return &webfingerCache{
+		results: make(map[string]webfingerResult),
+		pending: make(map[string]bool),
+	}
+}
+
+// Start marks a lookup of the handle as in progress, returning false if one
+// already is
+func (cache *webfingerCache) Start(handle string) bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.pending[handle] {
+		return false
+	}
+	cache.pending[handle] = true
+	return true
+}
+
+func (cache *webfingerCache) Get(handle string) (webfingerResult, bool) {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	result, ok := cache.results[handle]
+	if !ok || time.Now().After(result.expiry) {
+		return webfingerResult{}, false
+	}
+	return result, true
+}
+
+func (cache *webfingerCache) Set(handle, url string, err error) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	ttl := webfingerCacheTTL
+	if err != nil {
+		ttl = webfingerFailureTTL
+	}
+
+	// Drop expired results so the cache doesn't grow without bound
+	now := time.Now()
+	for k, v := range cache.results {
+		if now.After(v.expiry) {
+			delete(cache.results, k)
+		}
+	}
+
+	cache.results[handle] = webfingerResult{url: url, err: err, expiry: now.Add(ttl)}
+	delete(cache.pending, handle)
+}
+
+// LookupWebFinger resolves the twtxt feed URL of a remote `user@domain` via
+// WebFinger. Results, including failures, are cached.
+func LookupWebFinger(conf *Config, user, domain string) (string, error) {
+	handle := fmt.Sprintf("%s@%s", user, strings.ToLower(domain))
+
+	if result, ok := webfingers.Get(handle); ok {
+		return result.url, result.err
+	}
+
+	feedURL, err := fetchWebFinger(conf, handle, domain)
+	if err != nil {
+		log.WithError(err).Warnf("error looking up webfinger for %s", handle)
+	}
+	webfingers.Set(handle, feedURL, err)
+
+	return feedURL, err
+}
+
+// LookupWebFingerAsync returns the cached result of resolving a remote
+// `user@domain` via WebFinger if there is one, otherwise it starts looking
+// it up in the background and returns ErrWebFingerPending.
+func LookupWebFingerAsync(conf *Config, user, domain string) (string, error) {
+	handle := fmt.Sprintf("%s@%s", user, strings.ToLower(domain))
+
+	if result, ok := webfingers.Get(handle); ok {
+		return result.url, result.err
+	}
+
+	if webfingers.Start(handle) {
+		go LookupWebFinger(conf, user, domain)
+	}
+
+	return "", ErrWebFingerPending
+}
+
+func fetchWebFinger(conf *Config, handle, domain string) (string, error) {
+	uri := fmt.Sprintf(
+		"https://%s/.well-known/webfinger?resource=%s",
+		domain, url.QueryEscape("acct:"+handle),
+	)
+
+	headers := make(http.Header)
+	headers.Set("Accept", "application/jrd+json, application/json")
+
+	res, err := Request(conf, http.MethodGet, uri, headers)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", ErrWebFingerNotFound
+	}
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var resource WebFingerResource
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxWebFingerSize)).Decode(&resource); err != nil {
+		return "", err
+	}
+
+	feedURL := resource.FeedURL()
+	if feedURL == "" {
+		return "", ErrWebFingerNoFeed
+	}
+
+	return feedURL, nil
+}
+
+// ResolveFeedURL returns the twtxt feed URL of a `user@domain` handle.
+// Local users and feeds are resolved directly, remote ones via WebFinger
+// falling back to the twtxt pod URL pattern if the lookup fails.
+func ResolveFeedURL(conf *Config, db Store, user, domain string) string {
+	return resolveFeedURL(conf, db, user, domain, LookupWebFinger)
+}
+
+// ResolveMentionURL is like ResolveFeedURL but never waits on a WebFinger
+// lookup, remote handles that haven't been resolved yet fall back to the
+// twtxt pod URL pattern while they are looked up in the background. It is
+// used when expanding mentions so posting isn't held up by slow pods.
+func ResolveMentionURL(conf *Config, db Store, user, domain string) string {
+	return resolveFeedURL(conf, db, user, domain, LookupWebFingerAsync)
+}
+
+func resolveFeedURL(conf *Config, db Store, user, domain string, lookup func(conf *Config, user, domain string) (string, error)) string {
+	if IsLocalDomain(conf, domain) {
+		name := NormalizeUsername(user)
+		if db.HasUser(name) || db.HasFeed(name) {
+			return URLForUser(conf, name)
+		}
+	}
+
+	if feedURL, err := lookup(conf, user, domain); err == nil {
+		return feedURL
+	}
+
+	// XXX: Should we always assume https:// ?
+	return fmt.Sprintf("https://%s/user/%s/twtxt.txt", domain, user)
+}
+
+// ResolveFollow resolves a follow request given as a `@user@domain` handle
+// (in either the nick or url) to the nick and feed URL to follow. Requests
+// that are not handles are returned as is with the url normalized.
+func ResolveFollow(conf *Config, db Store, nick, uri string) (string, string) {
+	handle := uri
+	if handle == "" {
+		handle = nick
+	}
+
+	user, domain, ok := ParseWebFingerHandle(handle)
+	if !ok {
+		return nick, NormalizeURL(uri)
+	}
+
+	if nick == "" || nick == handle {
+		nick = user
+	}
+
+	return nick, ResolveFeedURL(conf, db, user, domain)
+}
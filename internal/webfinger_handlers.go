@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebFingerHandler serves WebFinger (RFC 7033) lookups of the pod's users
+// and feeds so that `@user@domain` mentions and follows can be resolved to
+// their twtxt.txt feeds.
+func (s *Server) WebFingerHandler() httprouter.Handle {
+	isLocal := IsLocalURLFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		resource := strings.TrimSpace(r.FormValue("resource"))
+		if resource == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var name string
+
+		if user, domain, ok := ParseWebFingerHandle(resource); ok {
+			if !IsLocalDomain(s.config, domain) {
+				http.Error(w, "Resource Not Found", http.StatusNotFound)
+				return
+			}
+			name = user
+		} else if isLocal(resource) {
+			name = filepath.Base(UserURL(resource))
+		} else {
+			http.Error(w, "Resource Not Found", http.StatusNotFound)
+			return
+		}
+
+		name = NormalizeUsername(name)
+		if !s.db.HasUser(name) && !s.db.HasFeed(name) {
+			http.Error(w, "Resource Not Found", http.StatusNotFound)
+			return
+		}
+
+		data, err := NewWebFingerResource(s.config, name).Bytes()
+		if err != nil {
+			log.WithError(err).Errorf("error serializing webfinger resource for %s", name)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/jrd+json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebFingerHandle(t *testing.T) {
+	testCases := []struct {
+		handle string
+		user   string
+		domain string
+		ok     bool
+	}{
+		{"@prologic@twtxt.net", "prologic", "twtxt.net", true},
+		{"prologic@Twtxt.NET", "prologic", "twtxt.net", true},
+		{"acct:prologic@twtxt.net", "prologic", "twtxt.net", true},
+		{"@alice@localhost:8000", "alice", "localhost:8000", true},
+		{"@prologic", "", "", false},
+		{"https://twtxt.net/user/prologic/twtxt.txt", "", "", false},
+		{"https://prologic@twtxt.net/", "", "", false},
+	}
+
+	for _, testCase := range testCases {
+		user, domain, ok := ParseWebFingerHandle(testCase.handle)
+		assert.Equal(t, testCase.ok, ok, testCase.handle)
+		assert.Equal(t, testCase.user, user, testCase.handle)
+		assert.Equal(t, testCase.domain, domain, testCase.handle)
+	}
+}
+
+func TestWebFingerResourceFeedURL(t *testing.T) {
+	resource := WebFingerResource{
+		Subject: "acct:alice@example.com",
+		Links: []WebFingerLink{
+			{Rel: WebFingerProfileRel, Type: "text/html", Href: "https://example.com/@alice"},
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/alice"},
+			{Rel: "self", Type: "text/plain", Href: "https://example.com/alice.txt"},
+		},
+	}
+	assert.Equal(t, "https://example.com/alice.txt", resource.FeedURL())
+
+	assert.Empty(t, WebFingerResource{}.FeedURL())
+}
+
+func TestResolveMentionURL(t *testing.T) {
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	webfingers.Set("alice@example.com", "https://example.com/alice.txt", nil)
+	assert.Equal(t, "https://example.com/alice.txt", ResolveMentionURL(conf, nil, "alice", "example.com"))
+
+	// Handles that haven't been looked up yet fall back to the pod URL
+	// pattern without waiting on the lookup
+	assert.Equal(t, "https://example.invalid/user/bob/twtxt.txt", ResolveMentionURL(conf, nil, "bob", "example.invalid"))
+}
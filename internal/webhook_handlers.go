@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// AddWebhookHandler registers a new webhook for the user or, for the pod
+// owner, a pod webhook that receives events for all users.
+func (s *Server) AddWebhookHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if err := r.ParseForm(); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error parsing form"
+			s.render("error", w, ctx)
+			return
+		}
+
+		pod := r.FormValue("pod") == "on"
+		if pod && !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		hook, err := NewWebhook(ctx.Username, pod, r.FormValue("url"), r.Form["events"])
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error adding webhook: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetWebhook(hook.ID, hook); err != nil {
+			log.WithError(err).Errorf("error storing webhook for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = "Error adding webhook"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if pod {
+			http.Redirect(w, r, "/manage/pod", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// DeleteWebhookHandler ...
+func (s *Server) DeleteWebhookHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		hook, err := s.db.GetWebhook(p.ByName("id"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "Webhook not found"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if (hook.Pod && !isAdminUser(ctx.User)) || (!hook.Pod && hook.Owner != ctx.Username) {
+			ctx.Error = true
+			ctx.Message = "You do not own this webhook"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if err := s.db.DelWebhook(hook.ID); err != nil {
+			log.WithError(err).Errorf("error deleting webhook %s", hook.ID)
+			ctx.Error = true
+			ctx.Message = "Error deleting webhook"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if hook.Pod {
+			http.Redirect(w, r, "/manage/pod", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
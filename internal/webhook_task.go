@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt"
+)
+
+const (
+	// maxWebhookAttempts is the number of times a delivery is attempted
+	// before giving up
+	maxWebhookAttempts = 5
+
+	// webhookBackoff is the delay before the first retry, doubling with
+	// each subsequent attempt. Retries are picked up by the RetryWebhooks
+	// job so may be delayed by up to its schedule.
+	webhookBackoff = 30 * time.Second
+)
+
+type WebhookTask struct {
+	*BaseTask
+
+	conf    *Config
+	db      Store
+	hook    *Webhook
+	payload WebhookPayload
+	attempt int
+}
+
+func NewWebhookTask(conf *Config, db Store, hook *Webhook, payload WebhookPayload, attempt int) *WebhookTask {
+	return &WebhookTask{
+		BaseTask: NewBaseTask(),
+
+		conf:    conf,
+		db:      db,
+		hook:    hook,
+		payload: payload,
+		attempt: attempt,
+	}
+}
+
+func (t *WebhookTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *WebhookTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	statusCode, err := t.deliver()
+
+	delivery := &WebhookDelivery{
+		ID:         t.payload.ID,
+		Event:      t.payload.Event,
+		Attempt:    t.attempt,
+		StatusCode: statusCode,
+		CreatedAt:  time.Now(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	if err := RecordWebhookDelivery(t.db, t.hook.ID, delivery); err != nil {
+		if err == ErrWebhookNotFound {
+			// The webhook was deleted, don't retry
+			return t.Fail(err)
+		}
+		log.WithError(err).Warnf("error recording delivery for webhook %s", t.hook.ID)
+	}
+
+	t.SetData("statusCode", fmt.Sprintf("%d", statusCode))
+	t.SetData("attempt", fmt.Sprintf("%d", t.attempt))
+
+	if err != nil {
+		if t.attempt < maxWebhookAttempts {
+			backoff := webhookBackoff * time.Duration(1<<uint(t.attempt-1))
+			log.WithError(err).Warnf(
+				"error delivering %s to webhook %s (attempt %d), retrying in %s",
+				t.payload.Event, t.hook.ID, t.attempt, backoff,
+			)
+			retry := &WebhookRetry{
+				Payload: t.payload,
+				Attempt: t.attempt + 1,
+				RetryAt: time.Now().Add(backoff),
+			}
+			if err := ScheduleWebhookRetry(t.db, t.hook.ID, retry); err != nil {
+				log.WithError(err).Errorf("error scheduling retry for webhook %s", t.hook.ID)
+			}
+		} else {
+			log.WithError(err).Errorf(
+				"giving up delivering %s to webhook %s after %d attempts",
+				t.payload.Event, t.hook.ID, t.attempt,
+			)
+		}
+		return t.Fail(err)
+	}
+
+	return nil
+}
+
+// deliver POSTs the signed payload to the webhook and returns the response
+// status code. Any non-2xx response is an error.
+func (t *WebhookTask) deliver() (int, error) {
+	body, err := json.Marshal(t.payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(
+		"User-Agent",
+		fmt.Sprintf(
+			"twtxt/%s (Pod: %s Support: %s)",
+			twtxt.FullVersion(), t.conf.Name, URLForPage(t.conf.BaseURL, "support"),
+		),
+	)
+	req.Header.Set("X-Twtxt-Event", t.payload.Event)
+	req.Header.Set("X-Twtxt-Delivery", t.payload.ID)
+	req.Header.Set("X-Twtxt-Signature", fmt.Sprintf("sha256=%s", t.hook.Sign(body)))
+
+	client := http.Client{
+		Timeout: requestTimeout,
+	}
+
+	// Only pod webhooks may deliver to internal addresses, the address is
+	// checked as it's dialed so hostnames can't be rebound to one later
+	if !t.hook.Pod {
+		client.Transport = &http.Transport{DialContext: dialPublic}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,394 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// WebhookTwt is delivered when a new twt is posted
+	WebhookTwt = "twt"
+
+	// WebhookMention is delivered when a user is mentioned or replied to
+	WebhookMention = "mention"
+
+	// WebhookFollow is delivered when a user or feed gains a new follower
+	WebhookFollow = "follow"
+
+	// WebhookMessage is delivered when a user receives a new private message
+	WebhookMessage = "message"
+
+	// WebhookBlog is delivered when a new blog post is published
+	WebhookBlog = "blog"
+
+	// maxWebhookDeliveries is the number of deliveries kept in each
+	// webhook's delivery log
+	maxWebhookDeliveries = 20
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("error: invalid webhook url")
+	ErrInvalidWebhookEvents = errors.New("error: no valid webhook events")
+	ErrWebhookNotFound      = errors.New("error: webhook not found")
+	ErrWebhookNotPublic     = errors.New("error: webhook url is not a public address")
+
+	// WebhookEvents are all of the events webhooks may subscribe to
+	WebhookEvents = []string{WebhookTwt, WebhookMention, WebhookFollow, WebhookMessage, WebhookBlog}
+
+	// webhooksMu serializes updates to webhook delivery logs
+	webhooksMu sync.Mutex
+)
+
+// Webhook delivers signed event payloads to a URL. Pod webhooks are managed
+// by the pod owner and receive events for every user on the pod. Only pod
+// webhooks may deliver to loopback, link-local or private addresses.
+type Webhook struct {
+	ID        string
+	Owner     string
+	Pod       bool
+	URL       string
+	Secret    string
+	Events    []string `default:"[]"`
+	CreatedAt time.Time
+
+	Deliveries []*WebhookDelivery `default:"[]"`
+	Retries    []*WebhookRetry    `default:"[]"`
+}
+
+// WebhookRetry is a failed delivery waiting to be attempted again, retries
+// are stored with the webhook so they survive restarts.
+type WebhookRetry struct {
+	Payload WebhookPayload
+	Attempt int
+	RetryAt time.Time
+}
+
+// WebhookDelivery records an attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID         string
+	Event      string
+	Attempt    int
+	StatusCode int
+	Error      string
+	CreatedAt  time.Time
+}
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	ID      string      `json:"id"`
+	Event   string      `json:"event"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// NewWebhook validates and returns a new webhook with a random secret
+func NewWebhook(owner string, pod bool, uri string, events []string) (*Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+
+	// Hostnames are checked again when delivering as they may resolve to
+	// a different address by then
+	if !pod && !isPublicHost(u.Hostname()) {
+		return nil, ErrWebhookNotPublic
+	}
+
+	var valid []string
+	for _, event := range events {
+		if HasString(WebhookEvents, event) && !HasString(valid, event) {
+			valid = append(valid, event)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, ErrInvalidWebhookEvents
+	}
+
+	return &Webhook{
+		ID:         GenerateRandomToken(),
+		Owner:      owner,
+		Pod:        pod,
+		URL:        u.String(),
+		Secret:     GenerateRandomToken(),
+		Events:     valid,
+		CreatedAt:  time.Now(),
+		Deliveries: []*WebhookDelivery{},
+		Retries:    []*WebhookRetry{},
+	}, nil
+}
+
+// isPublicHost returns false if the host is localhost or an address that
+// isn't public
+func isPublicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIP(ip)
+	}
+	return true
+}
+
+// LoadWebhook ...
+func LoadWebhook(data []byte) (hook *Webhook, err error) {
+	hook = &Webhook{}
+	if err := defaults.Set(hook); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &hook); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Subscribes returns true if the webhook is subscribed to the event
+func (hook *Webhook) Subscribes(event string) bool {
+	return HasString(hook.Events, event)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the body using the
+// webhook's secret
+func (hook *Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AddDelivery records a delivery keeping only the most recent
+// maxWebhookDeliveries
+func (hook *Webhook) AddDelivery(delivery *WebhookDelivery) {
+	hook.Deliveries = append([]*WebhookDelivery{delivery}, hook.Deliveries...)
+	if len(hook.Deliveries) > maxWebhookDeliveries {
+		hook.Deliveries = hook.Deliveries[:maxWebhookDeliveries]
+	}
+}
+
+func (hook *Webhook) Bytes() ([]byte, error) {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RecordWebhookDelivery adds the delivery to the stored webhook's log
+func RecordWebhookDelivery(db Store, id string, delivery *WebhookDelivery) error {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	hook, err := db.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	hook.AddDelivery(delivery)
+
+	return db.SetWebhook(hook.ID, hook)
+}
+
+// ScheduleWebhookRetry stores a retry of a failed delivery with the webhook
+func ScheduleWebhookRetry(db Store, id string, retry *WebhookRetry) error {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	hook, err := db.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	hook.Retries = append(hook.Retries, retry)
+
+	return db.SetWebhook(hook.ID, hook)
+}
+
+// TakeDueWebhookRetries removes and returns the webhook's retries that are
+// due to be attempted again by now
+func TakeDueWebhookRetries(db Store, id string, now time.Time) ([]*WebhookRetry, error) {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	hook, err := db.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var due, pending []*WebhookRetry
+	for _, retry := range hook.Retries {
+		if retry.RetryAt.After(now) {
+			pending = append(pending, retry)
+		} else {
+			due = append(due, retry)
+		}
+	}
+
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	hook.Retries = pending
+	if hook.Retries == nil {
+		hook.Retries = []*WebhookRetry{}
+	}
+
+	if err := db.SetWebhook(hook.ID, hook); err != nil {
+		return nil, err
+	}
+
+	return due, nil
+}
+
+// GetUserWebhooks returns the webhooks owned by the user (excluding pod
+// webhooks)
+func GetUserWebhooks(db Store, username string) ([]*Webhook, error) {
+	hooks, err := db.GetAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var userHooks []*Webhook
+	for _, hook := range hooks {
+		if !hook.Pod && hook.Owner == username {
+			userHooks = append(userHooks, hook)
+		}
+	}
+	return userHooks, nil
+}
+
+// GetPodWebhooks returns the pod's webhooks
+func GetPodWebhooks(db Store) ([]*Webhook, error) {
+	hooks, err := db.GetAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var podHooks []*Webhook
+	for _, hook := range hooks {
+		if hook.Pod {
+			podHooks = append(podHooks, hook)
+		}
+	}
+	return podHooks, nil
+}
+
+// Webhooks queues deliveries of events to the webhooks subscribed to them
+type Webhooks struct {
+	conf  *Config
+	db    Store
+	tasks *Dispatcher
+}
+
+// NewWebhooks ...
+func NewWebhooks(conf *Config, db Store, tasks *Dispatcher) *Webhooks {
+	return &Webhooks{conf: conf, db: db, tasks: tasks}
+}
+
+// Fire queues delivery of the event to the webhooks of each of the owners
+// that subscribe to it as well as to subscribed pod webhooks
+func (w *Webhooks) Fire(event string, data interface{}, owners ...string) {
+	hooks, err := w.db.GetAllWebhooks()
+	if err != nil {
+		log.WithError(err).Error("error loading webhooks")
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Subscribes(event) {
+			continue
+		}
+		if !hook.Pod && !HasString(owners, hook.Owner) {
+			continue
+		}
+
+		payload := WebhookPayload{
+			ID:      GenerateRandomToken(),
+			Event:   event,
+			Created: time.Now(),
+			Data:    data,
+		}
+
+		if _, err := w.tasks.Dispatch(NewWebhookTask(w.conf, w.db, hook, payload, 1)); err != nil {
+			log.WithError(err).Errorf("error dispatching webhook %s", hook.ID)
+		}
+	}
+}
+
+// FireNotification maps notifications to webhook events
+func (w *Webhooks) FireNotification(n *Notification) {
+	switch n.Type {
+	case NotificationMention, NotificationReply, NotificationWebMention:
+		w.Fire(WebhookMention, n, n.Username)
+	case NotificationFollow:
+		w.Fire(WebhookFollow, n, n.Username)
+	case NotificationMessage:
+		w.Fire(WebhookMessage, n, n.Username)
+	}
+}
+
+// FireTwts fires twt events for newly posted twts by local users and feeds
+func (w *Webhooks) FireTwts(twts types.Twts) {
+	for _, twt := range twts {
+		twter := twt.Twter()
+		if !strings.HasPrefix(twter.URL, w.conf.BaseURL) {
+			continue
+		}
+
+		name := NormalizeUsername(filepath.Base(UserURL(twter.URL)))
+
+		owners := []string{name}
+		if !w.db.HasUser(name) {
+			owners = GetFeedOwners(w.db, name)
+		}
+
+		w.Fire(WebhookTwt, map[string]interface{}{
+			"hash":    twt.Hash(),
+			"nick":    twter.Nick,
+			"url":     twter.URL,
+			"text":    twt.Text(),
+			"created": twt.Created(),
+			"link":    URLForTwt(w.conf.BaseURL, twt.Hash()),
+		}, owners...)
+	}
+}
+
+// FireBlog fires a blog event for a newly published blog post
+func (w *Webhooks) FireBlog(blogPost *BlogPost, owners ...string) {
+	w.Fire(WebhookBlog, map[string]interface{}{
+		"title":     blogPost.Title,
+		"author":    blogPost.Author,
+		"url":       blogPost.URL(w.conf.BaseURL),
+		"published": blogPost.Published(),
+	}, owners...)
+}
+
+// GetFeedOwners returns the usernames of the users that own the named feed
+func GetFeedOwners(db Store, name string) (owners []string) {
+	users, err := db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Warnf("error loading users to find owners of %s", name)
+		return nil
+	}
+
+	for _, user := range users {
+		if user.OwnsFeed(name) {
+			owners = append(owners, user.Username)
+		}
+	}
+
+	return
+}
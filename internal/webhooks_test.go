@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebhook(t *testing.T) {
+	_, err := NewWebhook("test", false, "ftp://example.com/hook", []string{WebhookTwt})
+	assert.Equal(t, ErrInvalidWebhookURL, err)
+
+	_, err = NewWebhook("test", false, "https://example.com/hook", []string{"unknown"})
+	assert.Equal(t, ErrInvalidWebhookEvents, err)
+
+	hook, err := NewWebhook("test", false, "https://example.com/hook", []string{WebhookTwt, "unknown", WebhookTwt, WebhookFollow})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{WebhookTwt, WebhookFollow}, hook.Events)
+	assert.True(t, hook.Subscribes(WebhookFollow))
+	assert.False(t, hook.Subscribes(WebhookBlog))
+	assert.NotEmpty(t, hook.Secret)
+
+	for _, uri := range []string{
+		"http://localhost:8000/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+	} {
+		_, err = NewWebhook("test", false, uri, []string{WebhookTwt})
+		assert.Equal(t, ErrWebhookNotPublic, err, uri)
+	}
+
+	// Pod webhooks are managed by the pod owner and may be internal
+	_, err = NewWebhook("admin", true, "http://127.0.0.1/hook", []string{WebhookTwt})
+	assert.NoError(t, err)
+}
+
+func TestWebhookSign(t *testing.T) {
+	hook := &Webhook{Secret: "secret"}
+	body := []byte(`{"event":"twt"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), hook.Sign(body))
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	hook := &Webhook{}
+
+	for i := 0; i < maxWebhookDeliveries+5; i++ {
+		hook.AddDelivery(&WebhookDelivery{Attempt: i})
+	}
+
+	assert.Len(t, hook.Deliveries, maxWebhookDeliveries)
+	assert.Equal(t, maxWebhookDeliveries+4, hook.Deliveries[0].Attempt)
+}
+
+func TestWebhookTaskRetries(t *testing.T) {
+	data, err := ioutil.TempDir("", "twtxt-webhooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(data)
+
+	db, err := NewStore("bitcask://" + data + "/twtxt.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	var delivered int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer ts.Close()
+
+	// Users' webhooks are stored with a public hostname that later resolves
+	// to an internal address
+	hook, err := NewWebhook("test", false, "https://example.com/hook", []string{WebhookTwt})
+	require.NoError(t, err)
+	hook.URL = ts.URL
+	require.NoError(t, db.SetWebhook(hook.ID, hook))
+
+	payload := WebhookPayload{ID: "delivery", Event: WebhookTwt, Created: time.Now()}
+	assert.Error(t, NewWebhookTask(conf, db, hook, payload, 1).Run())
+	assert.Equal(t, 0, delivered)
+
+	saved, err := db.GetWebhook(hook.ID)
+	require.NoError(t, err)
+	require.Len(t, saved.Deliveries, 1)
+	assert.Contains(t, saved.Deliveries[0].Error, ErrNotPublicAddress.Error())
+	require.Len(t, saved.Retries, 1)
+	assert.Equal(t, 2, saved.Retries[0].Attempt)
+	assert.Equal(t, "delivery", saved.Retries[0].Payload.ID)
+
+	// Retries are stored until they're due
+	retries, err := TakeDueWebhookRetries(db, hook.ID, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, retries, 0)
+
+	retries, err = TakeDueWebhookRetries(db, hook.ID, time.Now().Add(webhookBackoff))
+	require.NoError(t, err)
+	assert.Len(t, retries, 1)
+
+	saved, err = db.GetWebhook(hook.ID)
+	require.NoError(t, err)
+	assert.Len(t, saved.Retries, 0)
+
+	// Pod webhooks may deliver to internal addresses
+	hook.Pod = true
+	require.NoError(t, db.SetWebhook(hook.ID, hook))
+	assert.NoError(t, NewWebhookTask(conf, db, hook, payload, 1).Run())
+	assert.Equal(t, 1, delivered)
+}
@@ -2,6 +2,9 @@
 package webmention
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -19,8 +22,24 @@ type WebMention struct {
 	inboxTimer  *time.Timer
 	outboxTimer *time.Timer
 	Mention     func(source, target *url.URL, sourceData *microformats.Data) error
+
+	// Unmention (optional) is called when a source no longer links to the
+	// target, e.g. when a previously received mention was deleted.
+	Unmention func(source, target *url.URL) error
 }
 
+const (
+	// maxSourceSize is the maximum size of a source document that is
+	// fetched to verify a webmention
+	maxSourceSize = 1 << 20
+
+	// requestTimeout bounds fetching targets and sources and sending
+	// webmentions so a slow remote can't stall the inbox or outbox
+	requestTimeout = 30 * time.Second
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
 func New() *WebMention {
 	wm := &WebMention{
 		inbox:  make(chan *mention, 100),
@@ -29,12 +48,14 @@ func New() *WebMention {
 	wm.inboxTimer = time.NewTimer(5 * time.Second)
 	wm.outboxTimer = time.NewTimer(5 * time.Second)
 	go func() {
-		for range wm.inboxTimer.C {
+		<-wm.inboxTimer.C
+		for {
 			wm.processInbox()
 		}
 	}()
 	go func() {
-		for range wm.outboxTimer.C {
+		<-wm.outboxTimer.C
+		for {
 			wm.processOutbox()
 		}
 	}()
@@ -47,7 +68,7 @@ type mention struct {
 }
 
 func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
-	res, err := http.Get(target.String())
+	res, err := client.Get(target.String())
 	if err != nil {
 		log.WithError(err).Error("error getting target endpoint")
 		return nil, err
@@ -85,9 +106,19 @@ func (wm *WebMention) SendNotification(target *url.URL, source *url.URL) {
 func (wm *WebMention) WebMentionEndpoint(w http.ResponseWriter, r *http.Request) {
 	source := r.FormValue("source")
 	target := r.FormValue("target")
-	if source != "" && target != "" {
-		sourceurl, _ := url.Parse(source)
-		targeturl, _ := url.Parse(target)
+	if source != "" && target != "" && source != target {
+		sourceurl, err := url.Parse(source)
+		if err != nil || (sourceurl.Scheme != "http" && sourceurl.Scheme != "https") {
+			log.Warnf("invalid webmention source %s", source)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		targeturl, err := url.Parse(target)
+		if err != nil {
+			log.Warnf("invalid webmention target %s", target)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
 		wm.inbox <- &mention{
 			sourceurl,
 			targeturl,
@@ -100,36 +131,41 @@ func (wm *WebMention) WebMentionEndpoint(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// processInbox verifies the next received mention by fetching its source
+// and checking that it really links to the target before accepting it.
 func (wm *WebMention) processInbox() {
 	mention := <-wm.inbox
 
-	res, err := http.Get(mention.source.String())
-	if err != nil || res.StatusCode/100 != 2 {
-		log.Errorf("Error getting source %s (%s): %s", mention.source, res.Status, err)
+	res, err := client.Get(mention.source.String())
+	if err != nil {
+		log.WithError(err).Errorf("Error getting source %s", mention.source)
 		return
 	}
 	defer res.Body.Close()
 
-	body, err := html.Parse(res.Body)
-	if err != nil {
-		log.Errorf("Error parsing source %s: %s", mention.source, err)
+	if res.StatusCode == http.StatusGone {
+		wm.unmention(mention)
 		return
 	}
 
-	found := searchLinks(body, mention.target)
-	if found {
-		p := microformats.New()
-		data := p.ParseNode(body, mention.source)
-		if err := wm.Mention(mention.source, mention.target, data); err != nil {
-			log.WithError(err).Error("error processing webmention")
-		} else {
-			log.Infof("processed webmention with mf2 source=%s target=%s", mention.source, mention.target)
-		}
+	if res.StatusCode/100 != 2 {
+		log.Errorf("Error getting source %s: %s", mention.source, res.Status)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSourceSize))
+	if err != nil {
+		log.WithError(err).Errorf("Error reading source %s", mention.source)
 		return
 	}
 
-	links := GetHeaderLinks(res.Header.Values("Link"))
-	if len(links) > 0 {
+	if !strings.Contains(res.Header.Get("Content-Type"), "html") {
+		// Plain text sources (e.g. twtxt feeds) must contain the target
+		if !bytes.Contains(data, []byte(mention.target.String())) {
+			log.Warnf("source %s does not link to %s", mention.source, mention.target)
+			wm.unmention(mention)
+			return
+		}
 		if err := wm.Mention(mention.source, mention.target, nil); err != nil {
 			log.WithError(err).Error("error processing webmention")
 		} else {
@@ -138,7 +174,34 @@ func (wm *WebMention) processInbox() {
 		return
 	}
 
-	log.Warnf("no links found on %s", mention.source.String())
+	body, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		log.Errorf("Error parsing source %s: %s", mention.source, err)
+		return
+	}
+
+	if !searchLinks(body, mention.target) {
+		log.Warnf("source %s does not link to %s", mention.source, mention.target)
+		wm.unmention(mention)
+		return
+	}
+
+	p := microformats.New()
+	mf2data := p.ParseNode(body, mention.source)
+	if err := wm.Mention(mention.source, mention.target, mf2data); err != nil {
+		log.WithError(err).Error("error processing webmention")
+	} else {
+		log.Infof("processed webmention with mf2 source=%s target=%s", mention.source, mention.target)
+	}
+}
+
+func (wm *WebMention) unmention(mention *mention) {
+	if wm.Unmention == nil {
+		return
+	}
+	if err := wm.Unmention(mention.source, mention.target); err != nil {
+		log.WithError(err).Error("error removing webmention")
+	}
 }
 
 func (wm *WebMention) processOutbox() {
@@ -156,8 +219,18 @@ func (wm *WebMention) processOutbox() {
 	values := make(url.Values)
 	values.Set("source", mention.source.String())
 	values.Set("target", mention.target.String())
-	if res, err := http.PostForm(endpoint.String(), values); err != nil || (res.StatusCode%100 != 2) {
+	res, err := client.PostForm(endpoint.String(), values)
+	if err != nil {
 		log.WithError(err).Errorf(
+			"error sending webmention source=%s target=%s",
+			mention.source.String(), mention.target.String(),
+		)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		log.Errorf(
 			"error sending webmention source=%s target=%s status=%s",
 			mention.source.String(), mention.target.String(), res.Status,
 		)
@@ -177,7 +250,7 @@ func searchLinks(node *html.Node, link *url.URL) bool {
 				if err == nil {
 					// jointwt/twtxt pods have the form
 					// http://pod.domain.tld/external?uri=uri&nick=nick
-					if strings.HasPrefix(target.Path, "/external") && target.Query().Get("url") == link.String() {
+					if strings.HasPrefix(target.Path, "/external") && target.Query().Get("uri") == link.String() {
 						return true
 					}
 					if target.String() == link.String() {
@@ -0,0 +1,28 @@
+package webmention
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProcessOutboxSendError(t *testing.T) {
+	// The endpoint is closed so sending the webmention fails
+	endpoint := httptest.NewServer(http.NotFoundHandler())
+	endpoint.Close()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "<"+endpoint.URL+"/webmention>; rel=\"webmention\"")
+	}))
+	defer target.Close()
+
+	source, _ := url.Parse("https://pod.example.com/twt/abcdefg")
+	targetURL, _ := url.Parse(target.URL)
+
+	wm := &WebMention{outbox: make(chan *mention, 1)}
+	wm.outbox <- &mention{source: source, target: targetURL}
+
+	// Must not panic without a response
+	wm.processOutbox()
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+)
+
+// WebMentionsHandler lists the webmentions received for the user and their
+// feeds so they can be approved or rejected.
+func (s *Server) WebMentionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		mentions, err := GetUserWebMentions(s.db, ctx.User)
+		if err != nil {
+			log.WithError(err).Errorf("error loading webmentions for %s", ctx.User.Username)
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading webmentions"
+			s.render("error", w, ctx)
+			return
+		}
+
+		var pagedMentions IncomingWebMentions
+
+		page := SafeParseInt(r.FormValue("p"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(mentions), s.config.TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedMentions); err != nil {
+			log.WithError(err).Error("error paging webmentions")
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading webmentions"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = "WebMentions"
+		ctx.WebMentions = pagedMentions
+		ctx.Pager = &pager
+
+		s.render("webmentions", w, ctx)
+	}
+}
+
+// ModerateWebMentionHandler approves, rejects or deletes a webmention
+// received for the user or one of their feeds.
+func (s *Server) ModerateWebMentionHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		m, err := s.db.GetWebMention(p.ByName("id"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "WebMention not found"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if m.Owner != ctx.User.Username && !ctx.User.OwnsFeed(m.Owner) {
+			ctx.Error = true
+			ctx.Message = "You do not own the target of this webmention"
+			s.render("403", w, ctx)
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "approve":
+			m.Status = WebMentionApproved
+		case "reject":
+			m.Status = WebMentionRejected
+		case "delete":
+			if err := s.db.DelWebMention(m.ID); err != nil {
+				log.WithError(err).Errorf("error deleting webmention %s", m.ID)
+				ctx.Error = true
+				ctx.Message = "Error deleting webmention"
+				s.render("error", w, ctx)
+				return
+			}
+			http.Redirect(w, r, "/webmentions", http.StatusFound)
+			return
+		default:
+			ctx.Error = true
+			ctx.Message = "Invalid action"
+			s.render("error", w, ctx)
+			return
+		}
+
+		m.UpdatedAt = time.Now()
+
+		if err := s.db.SetWebMention(m.ID, m); err != nil {
+			log.WithError(err).Errorf("error updating webmention %s", m.ID)
+			ctx.Error = true
+			ctx.Message = "Error updating webmention"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/webmentions", http.StatusFound)
+	}
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andyleap/microformats"
+	"github.com/creasty/defaults"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// WebMentionPending is a received webmention awaiting moderation
+	WebMentionPending = "pending"
+
+	// WebMentionApproved is a webmention shown alongside its target
+	WebMentionApproved = "approved"
+
+	// WebMentionRejected is a webmention hidden by its target's owner
+	WebMentionRejected = "rejected"
+
+	// maxWebMentionContent is the maximum length of a webmention's content
+	// that is stored and displayed
+	maxWebMentionContent = 512
+)
+
+var (
+	ErrWebMentionNotFound      = errors.New("error: webmention not found")
+	ErrInvalidWebMentionTarget = errors.New("error: invalid webmention target")
+)
+
+// IncomingWebMention is a verified webmention received for a twt, blog post
+// or profile on this pod. Owner is the user or feed the target belongs to
+// and Hash the twt or blog post hash (empty for profiles).
+type IncomingWebMention struct {
+	ID        string
+	Owner     string
+	Hash      string
+	Source    string
+	Target    string
+	Author    string
+	AuthorURL string
+	Content   string
+	Status    string `default:"pending"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewIncomingWebMention returns a new pending webmention. Mentions from the
+// same source to the same target share an ID so re-sent mentions update
+// rather than duplicate the original.
+func NewIncomingWebMention(owner, hash, source, target string) *IncomingWebMention {
+	now := time.Now()
+	return &IncomingWebMention{
+		ID:        FastHash(source + " " + target),
+		Owner:     owner,
+		Hash:      hash,
+		Source:    source,
+		Target:    target,
+		Status:    WebMentionPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// LoadIncomingWebMention ...
+func LoadIncomingWebMention(data []byte) (m *IncomingWebMention, err error) {
+	m = &IncomingWebMention{}
+	if err := defaults.Set(m); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m *IncomingWebMention) Bytes() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// IncomingWebMentions ...
+type IncomingWebMentions []*IncomingWebMention
+
+func (ms IncomingWebMentions) Len() int           { return len(ms) }
+func (ms IncomingWebMentions) Less(i, j int) bool { return ms[i].CreatedAt.After(ms[j].CreatedAt) }
+func (ms IncomingWebMentions) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+
+// ResolveWebMentionTarget returns the local user or feed that owns the
+// target of a webmention and the hash of the targeted twt or blog post, if
+// any. Targets may be twt permalinks, blog posts or user/feed profiles.
+func ResolveWebMentionTarget(conf *Config, cache *Cache, blogs *BlogsCache, target *url.URL) (owner, hash string, err error) {
+	if !strings.HasPrefix(target.String(), conf.BaseURL) {
+		return "", "", ErrInvalidWebMentionTarget
+	}
+
+	parts := strings.Split(strings.Trim(target.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 2 && parts[0] == "twt":
+		twt, ok := cache.Lookup(parts[1])
+		if !ok || !strings.HasPrefix(twt.Twter().URL, conf.BaseURL) {
+			return "", "", ErrInvalidWebMentionTarget
+		}
+		return NormalizeUsername(filepath.Base(UserURL(twt.Twter().URL))), twt.Hash(), nil
+	case len(parts) == 6 && parts[0] == "blog":
+		blogPost := &BlogPost{
+			Author: parts[1],
+			Year:   SafeParseInt(parts[2], 1970),
+			Month:  SafeParseInt(parts[3], 1),
+			Date:   SafeParseInt(parts[4], 1),
+			Slug:   parts[5],
+		}
+		if _, ok := blogs.Get(blogPost.Hash()); !ok {
+			return "", "", ErrInvalidWebMentionTarget
+		}
+		return NormalizeUsername(blogPost.Author), blogPost.Hash(), nil
+	case len(parts) >= 2 && parts[0] == "user":
+		return NormalizeUsername(parts[1]), "", nil
+	default:
+		return "", "", ErrInvalidWebMentionTarget
+	}
+}
+
+// ParseWebMentionSource extracts the author's name, feed and a summary of
+// the content from a webmention source's microformats
+func ParseWebMentionSource(data *microformats.Data) (author, feed, content string) {
+	if data == nil {
+		return
+	}
+
+	for _, alternate := range data.Alternates {
+		if alternate.Type == "text/plain" {
+			feed = alternate.URL
+		}
+	}
+
+	var entry *microformats.MicroFormat
+	for _, item := range data.Items {
+		if HasString(item.Type, "h-entry") {
+			entry = item
+			break
+		}
+	}
+	if entry == nil {
+		return
+	}
+
+	if authors := entry.Properties["author"]; len(authors) > 0 {
+		switch v := authors[0].(type) {
+		case *microformats.MicroFormat:
+			author = strings.TrimSpace(v.Value)
+		case string:
+			author = strings.TrimSpace(v)
+		}
+	}
+
+	for _, name := range []string{"summary", "content", "name"} {
+		values := entry.Properties[name]
+		if len(values) == 0 {
+			continue
+		}
+
+		switch v := values[0].(type) {
+		case string:
+			content = v
+		case map[string]string:
+			content = v["value"]
+		case map[string]interface{}:
+			content, _ = v["value"].(string)
+		}
+
+		if content = strings.TrimSpace(content); content != "" {
+			break
+		}
+	}
+
+	if runes := []rune(content); len(runes) > maxWebMentionContent {
+		content = string(runes[:maxWebMentionContent]) + "…"
+	}
+
+	return
+}
+
+// GetApprovedWebMentions returns the approved webmentions of the twt or blog
+// post with the given hash, newest first
+func GetApprovedWebMentions(db Store, hash string) IncomingWebMentions {
+	mentions, err := db.GetAllWebMentions()
+	if err != nil {
+		log.WithError(err).Warnf("error loading webmentions for %s", hash)
+		return nil
+	}
+
+	var approved IncomingWebMentions
+	for _, m := range mentions {
+		if m.Hash == hash && m.Status == WebMentionApproved {
+			approved = append(approved, m)
+		}
+	}
+
+	sort.Sort(approved)
+
+	return approved
+}
+
+// GetUserWebMentions returns the webmentions of the user and the feeds
+// they own, newest first
+func GetUserWebMentions(db Store, user *User) (IncomingWebMentions, error) {
+	mentions, err := db.GetAllWebMentions()
+	if err != nil {
+		return nil, err
+	}
+
+	var ms IncomingWebMentions
+	for _, m := range mentions {
+		if m.Owner == user.Username || user.OwnsFeed(m.Owner) {
+			ms = append(ms, m)
+		}
+	}
+
+	sort.Sort(ms)
+
+	return ms, nil
+}
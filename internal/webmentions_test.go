@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/andyleap/microformats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIncomingWebMention(t *testing.T) {
+	a := NewIncomingWebMention("test", "", "https://example.com/post", "https://pod.example.com/user/test")
+	b := NewIncomingWebMention("test", "", "https://example.com/post", "https://pod.example.com/user/test")
+	c := NewIncomingWebMention("test", "", "https://example.com/other", "https://pod.example.com/user/test")
+
+	assert.Equal(t, a.ID, b.ID)
+	assert.NotEqual(t, a.ID, c.ID)
+	assert.Equal(t, WebMentionPending, a.Status)
+}
+
+func TestResolveWebMentionTarget(t *testing.T) {
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	target, _ := url.Parse("https://pod.example.com/user/Test/")
+	owner, hash, err := ResolveWebMentionTarget(conf, nil, nil, target)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", owner)
+	assert.Empty(t, hash)
+
+	target, _ = url.Parse("https://example.com/user/test/")
+	_, _, err = ResolveWebMentionTarget(conf, nil, nil, target)
+	assert.Equal(t, ErrInvalidWebMentionTarget, err)
+
+	target, _ = url.Parse("https://pod.example.com/about")
+	_, _, err = ResolveWebMentionTarget(conf, nil, nil, target)
+	assert.Equal(t, ErrInvalidWebMentionTarget, err)
+}
+
+func TestParseWebMentionSource(t *testing.T) {
+	data := &microformats.Data{
+		Items: []*microformats.MicroFormat{
+			{
+				Type: []string{"h-entry"},
+				Properties: map[string][]interface{}{
+					"author":  {&microformats.MicroFormat{Value: " Alice "}},
+					"content": {map[string]interface{}{"value": " Nice twt! "}},
+				},
+			},
+		},
+		Alternates: []*microformats.AlternateRel{
+			{URL: "https://example.com/twtxt.txt", Type: "text/plain"},
+		},
+	}
+
+	author, feed, content := ParseWebMentionSource(data)
+	assert.Equal(t, "Alice", author)
+	assert.Equal(t, "https://example.com/twtxt.txt", feed)
+	assert.Equal(t, "Nice twt!", content)
+}
+
+func TestParseWebMentionSourceTruncatesContent(t *testing.T) {
+	data := &microformats.Data{
+		Items: []*microformats.MicroFormat{
+			{
+				Type: []string{"h-entry"},
+				Properties: map[string][]interface{}{
+					"content": {strings.Repeat("ü", maxWebMentionContent+1)},
+				},
+			},
+		},
+	}
+
+	_, _, content := ParseWebMentionSource(data)
+	assert.True(t, utf8.ValidString(content))
+	assert.Equal(t, strings.Repeat("ü", maxWebMentionContent)+"…", content)
+}
@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"time"
 )
 
 // AuthRequest ...
 type AuthRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	// OTP is a two-factor authentication or recovery code, required for
+	// users with two-factor authentication enabled
+	OTP string `json:"otp,omitempty"`
 }
 
 // NewAuthRequest ...
@@ -25,6 +30,10 @@ func NewAuthRequest(r io.Reader) (req AuthRequest, err error) {
 // AuthResponse ...
 type AuthResponse struct {
 	Token string `json:"token"`
+
+	// OTPRequired is set when the credentials were valid but the user has
+	// two-factor authentication enabled and no valid OTP was given
+	OTPRequired bool `json:"otp_required,omitempty"`
 }
 
 // Bytes ...
@@ -95,6 +104,10 @@ type PagerResponse struct {
 type PagedResponse struct {
 	Twts  Twts `json:"twts"`
 	Pager PagerResponse
+
+	// Warnings maps the hashes of twts that match a user's mute filters to
+	// the filter they should be collapsed behind.
+	Warnings map[string]string `json:"warnings,omitempty"`
 }
 
 // Bytes ...
@@ -122,6 +135,46 @@ func NewFollowRequest(r io.Reader) (req FollowRequest, err error) {
 	return
 }
 
+// ImportFollowsRequest ...
+type ImportFollowsRequest struct {
+	// Data is an OPML document or a list of follows, one per line
+	Data string `json:"data"`
+
+	// Feed is the name of an owned feed to import into instead of the user
+	Feed string `json:"feed,omitempty"`
+}
+
+// NewImportFollowsRequest ...
+func NewImportFollowsRequest(r io.Reader) (req ImportFollowsRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// FollowImportResult is the outcome of importing a single follow
+type FollowImportResult struct {
+	Nick  string `json:"nick"`
+	URL   string `json:"url"`
+	Error string `json:"error,omitempty"`
+}
+
+// ImportFollowsResponse ...
+type ImportFollowsResponse struct {
+	Results []FollowImportResult `json:"results"`
+}
+
+// Bytes ...
+func (res ImportFollowsResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
 // UnfollowRequest ...
 type UnfollowRequest struct {
 	Nick string `json:"nick"`
@@ -143,6 +196,7 @@ type ProfileResponse struct {
 	Links        Links        `json:"links"`
 	Alternatives Alternatives `json:"alternatives"`
 	Twter        Twter        `json:"twter"`
+	PinnedTwts   Twts         `json:"pinned"`
 }
 
 // ConversationRequest ...
@@ -263,3 +317,214 @@ func NewReportRequest(r io.Reader) (req ReportRequest, err error) {
 	err = json.Unmarshal(body, &req)
 	return
 }
+
+// BookmarkRequest ...
+type BookmarkRequest struct {
+	Hash string `json:"hash"`
+}
+
+// NewBookmarkRequest ...
+func NewBookmarkRequest(r io.Reader) (req BookmarkRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// List ...
+type List struct {
+	Name  string            `json:"name"`
+	Owner string            `json:"owner"`
+	URL   string            `json:"url"`
+	Feeds map[string]string `json:"feeds"`
+}
+
+// ListsResponse ...
+type ListsResponse struct {
+	Lists []List `json:"lists"`
+}
+
+// Bytes ...
+func (res ListsResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Filter ...
+type Filter struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Action    string    `json:"action"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FilterRequest ...
+type FilterRequest struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Action  string `json:"action"`
+	Expires string `json:"expires"`
+}
+
+// NewFilterRequest ...
+func NewFilterRequest(r io.Reader) (req FilterRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// FiltersResponse ...
+type FiltersResponse struct {
+	Filters []Filter `json:"filters"`
+}
+
+// Bytes ...
+func (res FiltersResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// TagRequest ...
+type TagRequest struct {
+	Tag string `json:"tag"`
+}
+
+// NewTagRequest ...
+func NewTagRequest(r io.Reader) (req TagRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// ReadMarker ...
+type ReadMarker struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Unread    int       `json:"unread"`
+}
+
+// ReadMarkersResponse ...
+type ReadMarkersResponse struct {
+	Markers []ReadMarker `json:"markers"`
+}
+
+// Bytes ...
+func (res ReadMarkersResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// ReadMarkerRequest ...
+type ReadMarkerRequest struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// NewReadMarkerRequest ...
+func NewReadMarkerRequest(r io.Reader) (req ReadMarkerRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// Notification ...
+type Notification struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from"`
+	FromURL   string    `json:"from_url"`
+	Target    string    `json:"target"`
+	Hash      string    `json:"hash,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+// NotificationsResponse ...
+type NotificationsResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+	Pager         PagerResponse
+}
+
+// Bytes ...
+func (res NotificationsResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// NotificationRequest marks the notification with ID, or all notifications
+// if ID is empty, as read.
+type NotificationRequest struct {
+	ID string `json:"id"`
+}
+
+// NewNotificationRequest ...
+func NewNotificationRequest(r io.Reader) (req NotificationRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// OAuthTokenResponse is returned by the OAuth2 token endpoint
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// Bytes ...
+func (res OAuthTokenResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// OAuthErrorResponse is returned by the OAuth2 endpoints on error, Error is
+// one of the error codes defined by RFC 6749 e.g: invalid_grant
+type OAuthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Bytes ...
+func (res OAuthErrorResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -4,11 +4,15 @@ package types
 type Profile struct {
 	Type string
 
-	Username string
-	Tagline  string
-	URL      string
-	TwtURL   string
-	BlogsURL string
+	Username    string
+	Tagline     string
+	Description string
+	URL         string
+	TwtURL      string
+	BlogsURL    string
+
+	// Links to websites related to the user/feed
+	Links []string
 
 	// `true` if the User viewing the Profile has muted this user/feed
 	Muted bool
@@ -21,6 +25,16 @@ type Profile struct {
 
 	Followers map[string]string
 	Following map[string]string
+
+	// Members of a feed and their roles if visible to the viewer
+	Members map[string]string
+
+	IsFollowersPubliclyVisible bool
+	IsFollowingPubliclyVisible bool
+	IsMembersPubliclyVisible   bool
+
+	// Hashes of the twts pinned to the top of the user/feed's profile
+	Pinned []string
 }
 
 type Link struct {